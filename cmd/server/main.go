@@ -8,16 +8,25 @@ import (
 	"syscall"
 
 	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/engine"
 )
 
 func main() {
 	// Parse command line flags
 	port := flag.String("port", "8080", "Port to run the server on")
+	maxFirings := flag.Int("max-firings", engine.DefaultBudget.MaxFirings, "Maximum firings per automatic execution (0 = unlimited)")
+	maxTimeAdvance := flag.Int("max-time-advance", engine.DefaultBudget.MaxTimeAdvance, "Maximum model time advance per automatic execution (0 = unlimited)")
+	maxWallTime := flag.Duration("max-wall-time", engine.DefaultBudget.MaxWallTime, "Maximum wall time per automatic execution (0 = unlimited)")
 	flag.Parse()
 
 	// Create API server
 	server := api.NewServer()
 	defer server.Close()
+	server.SetExecutionBudget(engine.Budget{
+		MaxFirings:     *maxFirings,
+		MaxTimeAdvance: *maxTimeAdvance,
+		MaxWallTime:    *maxWallTime,
+	})
 
 	// Set up graceful shutdown
 	c := make(chan os.Signal, 1)
@@ -2,22 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
-	case_manager "go-petri-flow/internal/case"
+	"go-petri-flow/internal/engine"
 	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
 )
 
 // CaseHandlers contains handlers for case management endpoints
 type CaseHandlers struct {
-	caseManager *case_manager.Manager
+	runtime *petri.Runtime
 }
 
 // NewCaseHandlers creates new case handlers
-func NewCaseHandlers(caseManager *case_manager.Manager) *CaseHandlers {
+func NewCaseHandlers(runtime *petri.Runtime) *CaseHandlers {
 	return &CaseHandlers{
-		caseManager: caseManager,
+		runtime: runtime,
 	}
 }
 
@@ -26,6 +30,7 @@ func NewCaseHandlers(caseManager *case_manager.Manager) *CaseHandlers {
 type CreateCaseRequest struct {
 	ID          string                 `json:"id"`
 	CPNID       string                 `json:"cpnId"`
+	CPNVersion  int                    `json:"cpnVersion,omitempty"` // deployed version to pin (default latest)
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Variables   map[string]interface{} `json:"variables,omitempty"`
@@ -44,6 +49,7 @@ type FireTransitionRequest struct {
 type CaseResponse struct {
 	ID          string                 `json:"id"`
 	CPNID       string                 `json:"cpnId"`
+	CPNVersion  int                    `json:"cpnVersion,omitempty"`
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Status      string                 `json:"status"`
@@ -63,9 +69,12 @@ type CaseListResponse struct {
 }
 
 type CaseExecutionResponse struct {
-	TransitionsFired int             `json:"transitionsFired"`
-	Completed        bool            `json:"completed"`
-	NewMarking       MarkingResponse `json:"newMarking"`
+	TransitionsFired int                   `json:"transitionsFired"`
+	Completed        bool                  `json:"completed"`
+	NewMarking       MarkingResponse       `json:"newMarking"`
+	Breakpoint       *models.BreakpointHit `json:"breakpoint,omitempty"` // Breakpoint monitor that stopped execution
+	// BudgetExceeded is set when execution stopped at a budget; the marking holds the partial result
+	BudgetExceeded *engine.BudgetExceededError `json:"budgetExceeded,omitempty"`
 }
 
 // ExecuteAll executes automatic transitions until quiescent for a case
@@ -79,12 +88,18 @@ func (h *CaseHandlers) ExecuteAll(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Case ID is required")
 		return
 	}
-	firedCount, err := h.caseManager.ExecuteAll(caseID)
+	budget, err := parseBudget(r, h.runtime.Budget())
 	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	firedCount, err := h.runtime.ExecuteAll(r.Context(), caseID, petri.WithExecutionBudget(budget))
+	var budgetErr *engine.BudgetExceededError
+	if err != nil && !errors.As(err, &budgetErr) {
 		h.writeError(w, http.StatusBadRequest, "execution_failed", err.Error())
 		return
 	}
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -103,15 +118,57 @@ func (h *CaseHandlers) ExecuteAll(w http.ResponseWriter, r *http.Request) {
 		markingResponse = MarkingResponse{GlobalClock: case_.Marking.GlobalClock, Places: places}
 	}
 	response := CaseExecutionResponse{TransitionsFired: firedCount, Completed: case_.IsCompleted(), NewMarking: markingResponse}
+	if case_.Marking != nil {
+		response.Breakpoint = case_.Marking.Monitors.PendingBreakpoint()
+	}
+	if budgetErr != nil {
+		response.BudgetExceeded = budgetErr
+		h.writeSuccess(w, response, budgetErr.Error())
+		return
+	}
 	h.writeSuccess(w, response, "")
 }
 
+// parseBudget applies optional maxFirings, maxTimeAdvance and maxWallTimeMs query parameters to the
+// server's budget. Parameters can only tighten its limits: values above a limit are clamped to it.
+func parseBudget(r *http.Request, budget engine.Budget) (engine.Budget, error) {
+	query := r.URL.Query()
+	for _, param := range []string{"maxFirings", "maxTimeAdvance", "maxWallTimeMs"} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			return budget, fmt.Errorf("%s must be a positive integer", param)
+		}
+		switch param {
+		case "maxFirings":
+			budget.MaxFirings = tighten(budget.MaxFirings, value)
+		case "maxTimeAdvance":
+			budget.MaxTimeAdvance = tighten(budget.MaxTimeAdvance, value)
+		case "maxWallTimeMs":
+			budget.MaxWallTime = time.Duration(tighten(int(budget.MaxWallTime.Milliseconds()), value)) * time.Millisecond
+		}
+	}
+	return budget, nil
+}
+
+// tighten returns the smaller of a budget limit (0 = unlimited) and a requested value
+func tighten(limit, value int) int {
+	if limit > 0 && limit < value {
+		return limit
+	}
+	return value
+}
+
 // Helper functions
 
 func (h *CaseHandlers) caseToResponse(case_ *models.Case) CaseResponse {
 	response := CaseResponse{
 		ID:          case_.ID,
 		CPNID:       case_.CPNID,
+		CPNVersion:  case_.CPNVersion,
 		Name:        case_.Name,
 		Description: case_.Description,
 		Status:      string(case_.Status),
@@ -183,7 +240,9 @@ func (h *CaseHandlers) CreateCase(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create the case
-	case_, err := h.caseManager.CreateCase(request.ID, request.CPNID, request.Name, request.Description, request.Variables)
+	case_, err := h.runtime.CreateCase(r.Context(), request.ID, request.CPNID, request.Name,
+		petri.WithCaseDescription(request.Description), petri.WithCaseVariables(request.Variables),
+		petri.WithCPNVersion(request.CPNVersion))
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "creation_failed", "Failed to create case: "+err.Error())
 		return
@@ -205,7 +264,7 @@ func (h *CaseHandlers) GetCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "case_not_found", err.Error())
 		return
@@ -233,14 +292,14 @@ func (h *CaseHandlers) UpdateCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.UpdateCase(caseID, request.Variables, request.Metadata)
+	err := h.runtime.UpdateCase(r.Context(), caseID, request.Variables, request.Metadata)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "update_failed", err.Error())
 		return
 	}
 
 	// Get updated case
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -262,14 +321,14 @@ func (h *CaseHandlers) StartCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.StartCase(caseID)
+	err := h.runtime.StartCase(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "start_failed", err.Error())
 		return
 	}
 
 	// Get updated case
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -291,14 +350,14 @@ func (h *CaseHandlers) SuspendCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.SuspendCase(caseID)
+	err := h.runtime.SuspendCase(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "suspend_failed", err.Error())
 		return
 	}
 
 	// Get updated case
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -320,14 +379,14 @@ func (h *CaseHandlers) ResumeCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.ResumeCase(caseID)
+	err := h.runtime.ResumeCase(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "resume_failed", err.Error())
 		return
 	}
 
 	// Get updated case
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -349,14 +408,14 @@ func (h *CaseHandlers) AbortCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.AbortCase(caseID)
+	err := h.runtime.AbortCase(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "abort_failed", err.Error())
 		return
 	}
 
 	// Get updated case
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -378,7 +437,7 @@ func (h *CaseHandlers) DeleteCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.DeleteCase(caseID)
+	err := h.runtime.DeleteCase(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "delete_failed", err.Error())
 		return
@@ -400,14 +459,14 @@ func (h *CaseHandlers) ExecuteStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	firedCount, err := h.caseManager.ExecuteStep(caseID)
+	firedCount, err := h.runtime.ExecuteStep(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "execution_failed", err.Error())
 		return
 	}
 
 	// Get updated case to check completion status and get marking
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -439,6 +498,9 @@ func (h *CaseHandlers) ExecuteStep(w http.ResponseWriter, r *http.Request) {
 		Completed:        case_.IsCompleted(),
 		NewMarking:       markingResponse,
 	}
+	if case_.Marking != nil {
+		response.Breakpoint = case_.Marking.Monitors.PendingBreakpoint()
+	}
 
 	h.writeSuccess(w, response, "")
 }
@@ -467,14 +529,14 @@ func (h *CaseHandlers) FireTransition(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.caseManager.FireTransition(caseID, request.TransitionID, request.BindingIndex)
+	err := h.runtime.FireCaseTransition(r.Context(), caseID, request.TransitionID, request.BindingIndex)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "fire_failed", err.Error())
 		return
 	}
 
 	// Get updated case
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -483,6 +545,28 @@ func (h *CaseHandlers) FireTransition(w http.ResponseWriter, r *http.Request) {
 	h.writeSuccess(w, h.caseToResponse(case_), "Transition fired successfully")
 }
 
+// GetCaseMonitors returns the monitor results of a case
+func (h *CaseHandlers) GetCaseMonitors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	caseID := r.URL.Query().Get("id")
+	if caseID == "" {
+		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Case ID is required")
+		return
+	}
+
+	results, err := h.runtime.CaseMonitorResults(caseID)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "case_not_found", err.Error())
+		return
+	}
+
+	h.writeSuccess(w, results, "")
+}
+
 // GetCaseMarking returns the current marking of a case
 func (h *CaseHandlers) GetCaseMarking(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -496,7 +580,7 @@ func (h *CaseHandlers) GetCaseMarking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "case_not_found", err.Error())
 		return
@@ -529,6 +613,107 @@ func (h *CaseHandlers) GetCaseMarking(w http.ResponseWriter, r *http.Request) {
 	h.writeSuccess(w, markingResponse, "")
 }
 
+// MigrateCasesRequest applies a migration plan to the cases matching a filter
+type MigrateCasesRequest struct {
+	Filter *models.CaseFilter    `json:"filter"`
+	Plan   *models.MigrationPlan `json:"plan"`
+}
+
+// MigrateCase moves a case to another version of its CPN; with dryRun=true it only reports the diff
+func (h *CaseHandlers) MigrateCase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	caseID := r.URL.Query().Get("id")
+	if caseID == "" {
+		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Case ID is required")
+		return
+	}
+
+	var plan models.MigrationPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse JSON: "+err.Error())
+		return
+	}
+
+	result, err := h.runtime.MigrateCase(r.Context(), caseID, &plan, r.URL.Query().Get("dryRun") == "true")
+	if err != nil {
+		h.writeMigrationError(w, err)
+		return
+	}
+	h.writeSuccess(w, result, "")
+}
+
+// MigrateCases applies a migration plan to all cases matching a filter, all or none
+func (h *CaseHandlers) MigrateCases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	var request MigrateCasesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse JSON: "+err.Error())
+		return
+	}
+	if request.Plan == nil {
+		h.writeError(w, http.StatusBadRequest, "missing_field", "Migration plan is required")
+		return
+	}
+
+	results, err := h.runtime.MigrateCases(r.Context(), request.Filter, request.Plan, r.URL.Query().Get("dryRun") == "true")
+	if err != nil {
+		h.writeMigrationError(w, err)
+		return
+	}
+	h.writeSuccess(w, results, fmt.Sprintf("%d cases", len(results)))
+}
+
+// writeMigrationError maps migration errors to responses; invalid migrations are reported with
+// their issues, which a dry run lists per place
+func (h *CaseHandlers) writeMigrationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, petri.ErrMigrationInvalid):
+		h.writeError(w, http.StatusUnprocessableEntity, "migration_invalid", err.Error())
+	case errors.Is(err, petri.ErrVersionNotFound) || errors.Is(err, petri.ErrVersionRetired):
+		h.writeError(w, http.StatusNotFound, "version_not_found", err.Error())
+	default:
+		h.writeError(w, http.StatusBadRequest, "migration_failed", err.Error())
+	}
+}
+
+// RenderCase draws the CPN of a case with the case's marking as SVG (default) or Graphviz DOT
+func (h *CaseHandlers) RenderCase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	caseID := r.URL.Query().Get("id")
+	if caseID == "" {
+		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Case ID is required")
+		return
+	}
+	format, ok := renderFormat(r)
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, "invalid_format", "Format must be svg or dot")
+		return
+	}
+
+	if _, err := h.runtime.GetCase(caseID); err != nil {
+		h.writeError(w, http.StatusNotFound, "case_not_found", err.Error())
+		return
+	}
+	data, err := h.runtime.RenderCase(r.Context(), caseID, format)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "render_failed", err.Error())
+		return
+	}
+	writeRendering(w, data, format)
+}
+
 // GetCaseTransitions returns enabled transitions for a case
 func (h *CaseHandlers) GetCaseTransitions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -542,27 +727,15 @@ func (h *CaseHandlers) GetCaseTransitions(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	enabledTransitions, bindingsMap, err := h.caseManager.GetEnabledTransitions(caseID)
+	statuses, err := h.runtime.CaseEnabledTransitions(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "get_transitions_failed", err.Error())
 		return
 	}
 
 	var transitions []TransitionInfo
-	for _, transition := range enabledTransitions {
-		bindingCount := len(bindingsMap[transition.ID])
-		transitions = append(transitions, TransitionInfo{
-			ID:               transition.ID,
-			Name:             transition.Name,
-			Enabled:          true,
-			Kind:             string(transition.Kind),
-			GuardExpression:  transition.GuardExpression,
-			Variables:        transition.Variables,
-			BindingCount:     bindingCount,
-			ActionExpression: transition.ActionExpression,
-			FormSchema:       transition.FormSchema,
-			LayoutSchema:     transition.LayoutSchema,
-		})
+	for _, status := range statuses {
+		transitions = append(transitions, transitionToInfo(status))
 	}
 
 	h.writeSuccess(w, transitions, "")
@@ -579,7 +752,7 @@ func (h *CaseHandlers) GetCaseEnabledTransitions(w http.ResponseWriter, r *http.
 		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Case ID is required")
 		return
 	}
-	case_, err := h.caseManager.GetCase(caseID)
+	case_, err := h.runtime.GetCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "case_not_found", err.Error())
 		return
@@ -588,8 +761,7 @@ func (h *CaseHandlers) GetCaseEnabledTransitions(w http.ResponseWriter, r *http.
 		h.writeError(w, http.StatusBadRequest, "no_marking", "Case has no marking (not started)")
 		return
 	}
-	// Use engine through case manager
-	transitions, bindingsMap, err := h.caseManager.GetEnabledTransitions(caseID)
+	statuses, err := h.runtime.CaseEnabledTransitions(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "get_enabled_failed", err.Error())
 		return
@@ -605,8 +777,8 @@ func (h *CaseHandlers) GetCaseEnabledTransitions(w http.ResponseWriter, r *http.
 		Bindings         []map[string]interface{} `json:"bindings"`
 	}
 	var result []EnabledCaseTransition
-	for _, t := range transitions {
-		bList := bindingsMap[t.ID]
+	for _, status := range statuses {
+		t := status.Transition
 		ect := EnabledCaseTransition{
 			ID:               t.ID,
 			Name:             t.Name,
@@ -616,14 +788,8 @@ func (h *CaseHandlers) GetCaseEnabledTransitions(w http.ResponseWriter, r *http.
 			FormSchema:       t.FormSchema,
 			LayoutSchema:     t.LayoutSchema,
 		}
-		for _, bind := range bList {
-			row := make(map[string]interface{})
-			for varName, token := range bind {
-				if token != nil {
-					row[varName] = token.Value
-				}
-			}
-			ect.Bindings = append(ect.Bindings, row)
+		if len(status.Bindings) > 0 {
+			ect.Bindings = bindingsToValues(status.Bindings)
 		}
 		result = append(result, ect)
 	}
@@ -643,7 +809,7 @@ func (h *CaseHandlers) QueryCases(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cases, err := h.caseManager.QueryCases(&query)
+	cases, err := h.runtime.QueryCases(r.Context(), &query)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
 		return
@@ -671,6 +837,6 @@ func (h *CaseHandlers) GetCaseStatistics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	stats := h.caseManager.GetCaseStatistics()
+	stats := h.runtime.CaseStatistics()
 	h.writeSuccess(w, stats, "")
 }
@@ -2,53 +2,50 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
 
-	case_manager "go-petri-flow/internal/case"
 	"go-petri-flow/internal/engine"
-	"go-petri-flow/internal/expression"
 	"go-petri-flow/internal/models"
-	"go-petri-flow/internal/workitem"
+	"go-petri-flow/pkg/petri"
 )
 
-// Server represents the API server
+// Server represents the API server, an HTTP adapter over a petri.Runtime
 type Server struct {
-	engine           *engine.Engine
-	parser           *models.CPNParser
-	cpns             map[string]*models.CPN     // CPN registry by ID
-	states           map[string]*models.Marking // Current markings by CPN ID
-	caseManager      *case_manager.Manager      // Case manager
-	caseHandlers     *CaseHandlers              // Case API handlers
-	workItemManager  *workitem.Manager          // Work item manager
-	workItemHandlers *WorkItemHandlers          // Work item API handlers
+	runtime          *petri.Runtime    // Engine, CPNs, cases and work items
+	caseHandlers     *CaseHandlers     // Case API handlers
+	workItemHandlers *WorkItemHandlers // Work item API handlers
 }
 
-// NewServer creates a new API server
+// NewServer creates a new API server with its own runtime
 func NewServer() *Server {
-	engine := engine.NewEngine()
-	caseManager := case_manager.NewManager(engine)
-	workItemManager := workitem.NewManager(caseManager)
+	return NewServerWithRuntime(petri.New())
+}
 
-	server := &Server{
-		engine:           engine,
-		parser:           models.NewCPNParser(),
-		cpns:             make(map[string]*models.CPN),
-		states:           make(map[string]*models.Marking),
-		caseManager:      caseManager,
-		caseHandlers:     NewCaseHandlers(caseManager),
-		workItemManager:  workItemManager,
-		workItemHandlers: NewWorkItemHandlers(workItemManager),
+// NewServerWithRuntime creates an API server exposing an existing runtime
+func NewServerWithRuntime(runtime *petri.Runtime) *Server {
+	return &Server{
+		runtime:          runtime,
+		caseHandlers:     NewCaseHandlers(runtime),
+		workItemHandlers: NewWorkItemHandlers(runtime),
 	}
+}
+
+// Runtime returns the runtime served by the server
+func (s *Server) Runtime() *petri.Runtime {
+	return s.runtime
+}
 
-	return server
+// SetExecutionBudget sets the default budget of automatic execution (ExecuteAll, sub workflow auto start)
+func (s *Server) SetExecutionBudget(budget engine.Budget) {
+	s.runtime.SetBudget(budget)
 }
 
 // Close closes the server and releases resources
 func (s *Server) Close() {
-	if s.engine != nil {
-		s.engine.Close()
+	if s.runtime != nil {
+		s.runtime.Close()
 	}
 }
 
@@ -73,7 +70,9 @@ type CPNInfo struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Status      string `json:"status"` // "loaded", "running", "completed"
+	Status      string `json:"status"`            // "loaded", "running", "completed"
+	Version     int    `json:"version,omitempty"` // latest deployed version
+	Hash        string `json:"hash,omitempty"`
 }
 
 type MarkingResponse struct {
@@ -97,6 +96,7 @@ type TransitionInfo struct {
 	ActionExpression string   `json:"actionExpression,omitempty"`
 	FormSchema       string   `json:"formSchema,omitempty"`
 	LayoutSchema     string   `json:"layoutSchema,omitempty"`
+	Priority         int      `json:"priority"`
 }
 
 // EnabledTransitionDetail extends TransitionInfo with concrete bindings
@@ -106,10 +106,24 @@ type EnabledTransitionDetail struct {
 }
 
 type SimulationStepResponse struct {
-	TransitionsFired int             `json:"transitionsFired"`
-	Completed        bool            `json:"completed"`
-	NewMarking       MarkingResponse `json:"newMarking"`
-	CurrentStep      int             `json:"currentStep"`
+	TransitionsFired int                   `json:"transitionsFired"`
+	Completed        bool                  `json:"completed"`
+	NewMarking       MarkingResponse       `json:"newMarking"`
+	CurrentStep      int                   `json:"currentStep"`
+	Breakpoint       *models.BreakpointHit `json:"breakpoint,omitempty"` // Breakpoint monitor that stopped the simulation
+}
+
+// LayoutResponse holds the definitions of a laid out CPN and of the child CPNs of its sub workflows
+type LayoutResponse struct {
+	CPN          json.RawMessage   `json:"cpn"`
+	SubWorkflows []json.RawMessage `json:"subWorkflows,omitempty"`
+}
+
+// FunctionInfo describes a Go function callable from Lua expressions
+type FunctionInfo struct {
+	Name        string `json:"name"`      // qualified name, e.g. fx.convert
+	Signature   string `json:"signature"` // e.g. (real, string) -> real
+	Description string `json:"description,omitempty"`
 }
 
 // Helper functions
@@ -135,18 +149,26 @@ func (s *Server) writeSuccess(w http.ResponseWriter, data interface{}, message s
 	})
 }
 
-func (s *Server) getCPN(cpnID string) (*models.CPN, *models.Marking, error) {
-	cpn, exists := s.cpns[cpnID]
-	if !exists {
-		return nil, nil, fmt.Errorf("CPN with ID %s not found", cpnID)
-	}
-
-	marking, exists := s.states[cpnID]
-	if !exists {
-		return nil, nil, fmt.Errorf("marking for CPN %s not found", cpnID)
+// writeRuntimeError maps an error of a runtime CPN operation to an HTTP error
+func (s *Server) writeRuntimeError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, petri.ErrCPNNotFound):
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+	case errors.Is(err, petri.ErrTransitionNotFound):
+		s.writeError(w, http.StatusNotFound, "transition_not_found", err.Error())
+	case errors.Is(err, petri.ErrTransitionNotEnabled):
+		s.writeError(w, http.StatusBadRequest, "transition_not_enabled", err.Error())
+	case errors.Is(err, petri.ErrInvalidBinding):
+		s.writeError(w, http.StatusBadRequest, "invalid_binding", err.Error())
+	case errors.Is(err, petri.ErrChildCPNNotLoaded):
+		s.writeError(w, http.StatusBadRequest, "child_cpn_missing", err.Error())
+	case errors.Is(err, petri.ErrStepNotInHistory):
+		s.writeError(w, http.StatusNotFound, "step_not_in_history", err.Error())
+	case errors.Is(err, petri.ErrSubWorkflowFailed):
+		s.writeError(w, http.StatusInternalServerError, "child_autostart_failed", err.Error())
+	default:
+		s.writeError(w, http.StatusInternalServerError, "engine_error", message+": "+err.Error())
 	}
-
-	return cpn, marking, nil
 }
 
 func (s *Server) markingToResponse(marking *models.Marking) MarkingResponse {
@@ -177,24 +199,20 @@ func (s *Server) LoadCPN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cpn, err := s.parser.ParseCPNFromDefinition(&cpnDef) // Ensure marking exists when CPN loaded
+	// Stores the CPN with its initial marking and registers it for cases
+	cpn, err := s.runtime.LoadCPN(r.Context(), &cpnDef)
 	if err != nil {
 		s.writeError(w, http.StatusBadRequest, "invalid_cpn", "Failed to parse CPN: "+err.Error())
 		return
 	}
 
-	// Store the CPN and its initial marking (reset step counter)
-	s.cpns[cpn.ID] = cpn
-	s.states[cpn.ID] = cpn.CreateInitialMarking() // Fix GetCPN to use stored marking directly
-
-	// Register CPN with case manager
-	s.caseManager.RegisterCPN(cpn)
-
 	s.writeSuccess(w, CPNInfo{
 		ID:          cpn.ID,
 		Name:        cpn.Name,
 		Description: cpn.Description,
 		Status:      "loaded",
+		Version:     cpn.Version,
+		Hash:        cpn.Hash,
 	}, "CPN loaded successfully")
 }
 
@@ -206,18 +224,19 @@ func (s *Server) ListCPNs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var cpns []CPNInfo
-	for _, cpn := range s.cpns {
-		marking := s.states[cpn.ID]
+	for _, summary := range s.runtime.ListCPNs() {
 		status := "loaded"
-		if s.engine.IsCompleted(cpn, marking) {
+		if summary.Completed {
 			status = "completed"
 		}
 
 		cpns = append(cpns, CPNInfo{
-			ID:          cpn.ID,
-			Name:        cpn.Name,
-			Description: cpn.Description,
+			ID:          summary.ID,
+			Name:        summary.Name,
+			Description: summary.Description,
 			Status:      status,
+			Version:     summary.Version,
+			Hash:        summary.Hash,
 		})
 	}
 
@@ -237,14 +256,21 @@ func (s *Server) GetCPN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cpn, exists := s.cpns[cpnID]
-	if !exists {
-		s.writeError(w, http.StatusNotFound, "cpn_not_found", "CPN with ID "+cpnID+" not found")
-		return
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_parameter", "Version must be an integer")
+			return
+		}
 	}
 
 	// Convert CPN to JSON
-	jsonData, err := s.parser.CPNToJSON(cpn)
+	jsonData, err := s.runtime.ExportCPNVersion(cpnID, version)
+	if errors.Is(err, petri.ErrCPNNotFound) || errors.Is(err, petri.ErrVersionNotFound) || errors.Is(err, petri.ErrVersionRetired) {
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		return
+	}
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, "serialization_error", "Failed to serialize CPN: "+err.Error())
 		return
@@ -257,7 +283,7 @@ func (s *Server) GetCPN(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Attach runtime status (global clock & current step) from stored state
-	if marking, ok := s.states[cpnID]; ok {
+	if marking, err := s.runtime.Marking(cpnID); err == nil {
 		cpnData["globalClock"] = marking.GlobalClock
 		cpnData["currentStep"] = marking.StepCounter
 	}
@@ -265,6 +291,58 @@ func (s *Server) GetCPN(w http.ResponseWriter, r *http.Request) {
 	s.writeSuccess(w, cpnData, "")
 }
 
+// ListCPNVersions returns the deployed versions of a CPN
+func (s *Server) ListCPNVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return
+	}
+
+	versions, err := s.runtime.CPNVersions(cpnID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		return
+	}
+	s.writeSuccess(w, versions, "")
+}
+
+// RetireCPNVersion retires a version of a CPN without active cases
+func (s *Server) RetireCPNVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return
+	}
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_parameter", "Version must be an integer")
+		return
+	}
+
+	err = s.runtime.RetireCPNVersion(r.Context(), cpnID, version)
+	switch {
+	case errors.Is(err, petri.ErrCPNNotFound) || errors.Is(err, petri.ErrVersionNotFound):
+		s.writeError(w, http.StatusNotFound, "version_not_found", err.Error())
+	case errors.Is(err, petri.ErrVersionInUse):
+		s.writeError(w, http.StatusConflict, "version_in_use", err.Error())
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, "retire_failed", err.Error())
+	default:
+		s.writeSuccess(w, nil, "CPN version retired")
+	}
+}
+
 // GetMarking returns the current marking of a CPN
 func (s *Server) GetMarking(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -278,7 +356,7 @@ func (s *Server) GetMarking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, marking, err := s.getCPN(cpnID)
+	marking, err := s.runtime.Marking(cpnID)
 	if err != nil {
 		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
 		return
@@ -287,8 +365,8 @@ func (s *Server) GetMarking(w http.ResponseWriter, r *http.Request) {
 	s.writeSuccess(w, s.markingToResponse(marking), "")
 }
 
-// GetTransitions returns information about transitions in a CPN
-func (s *Server) GetTransitions(w http.ResponseWriter, r *http.Request) {
+// RenderCPN draws a CPN with its simulation marking as SVG (default) or Graphviz DOT (format=dot)
+func (s *Server) RenderCPN(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
 		return
@@ -299,52 +377,125 @@ func (s *Server) GetTransitions(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
 		return
 	}
+	format, ok := renderFormat(r)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "invalid_format", "Format must be svg or dot")
+		return
+	}
 
-	cpn, marking, err := s.getCPN(cpnID)
-	if err != nil {
+	data, err := s.runtime.Render(r.Context(), cpnID, format)
+	if errors.Is(err, petri.ErrCPNNotFound) {
 		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
 		return
 	}
-
-	// Get enabled transitions
-	enabledTransitions, bindingsMap, err := s.engine.GetEnabledTransitions(cpn, marking)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to get enabled transitions: "+err.Error())
+		s.writeError(w, http.StatusInternalServerError, "render_failed", err.Error())
 		return
 	}
+	writeRendering(w, data, format)
+}
 
-	enabledIDs := make(map[string]bool)
-	for _, t := range enabledTransitions {
-		enabledIDs[t.ID] = true
+// LayoutCPN computes positions for a CPN and its sub workflow CPNs and returns their updated
+// definitions without changing the loaded CPNs. Nets that already have positions keep them unless
+// force=true.
+func (s *Server) LayoutCPN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
 	}
 
-	var transitions []TransitionInfo
-	for _, transition := range cpn.Transitions {
-		enabled := enabledIDs[transition.ID]
-		bindingCount := 0
-		if enabled {
-			bindingCount = len(bindingsMap[transition.ID])
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+
+	cpns, err := s.runtime.LayoutCPN(r.Context(), cpnID, force)
+	if errors.Is(err, petri.ErrCPNNotFound) {
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "layout_failed", err.Error())
+		return
+	}
+
+	var response LayoutResponse
+	parser := models.NewCPNParser()
+	for i, cpn := range cpns {
+		data, err := parser.CPNToJSON(cpn)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "serialization_error", "Failed to serialize CPN: "+err.Error())
+			return
+		}
+		if i == 0 {
+			response.CPN = data
+		} else {
+			response.SubWorkflows = append(response.SubWorkflows, data)
 		}
+	}
+	s.writeSuccess(w, response, "Layout applied")
+}
 
-		transitions = append(transitions, TransitionInfo{
-			ID:               transition.ID,
-			Name:             transition.Name,
-			Enabled:          enabled,
-			Kind:             string(transition.Kind),
-			GuardExpression:  transition.GuardExpression,
-			Variables:        transition.Variables,
-			BindingCount:     bindingCount,
-			ActionExpression: transition.ActionExpression,
-			FormSchema:       transition.FormSchema,
-			LayoutSchema:     transition.LayoutSchema,
-		})
+// renderFormat returns the render format of the format query parameter, SVG by default
+func renderFormat(r *http.Request) (petri.RenderFormat, bool) {
+	switch format := petri.RenderFormat(r.URL.Query().Get("format")); format {
+	case "", petri.RenderFormatSVG:
+		return petri.RenderFormatSVG, true
+	case petri.RenderFormatDOT:
+		return format, true
+	default:
+		return "", false
 	}
+}
 
-	s.writeSuccess(w, transitions, "")
+// writeRendering writes a rendered net with the content type of its format
+func writeRendering(w http.ResponseWriter, data []byte, format petri.RenderFormat) {
+	if format == petri.RenderFormatDOT {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 }
 
-// GetEnabledTransitions returns only enabled transitions with full binding candidates
-func (s *Server) GetEnabledTransitions(w http.ResponseWriter, r *http.Request) {
+// transitionToInfo converts a transition status to its API representation
+func transitionToInfo(status petri.TransitionStatus) TransitionInfo {
+	t := status.Transition
+	return TransitionInfo{
+		ID:               t.ID,
+		Name:             t.Name,
+		Enabled:          status.Enabled,
+		Kind:             string(t.Kind),
+		GuardExpression:  t.GuardExpression,
+		Variables:        t.Variables,
+		BindingCount:     len(status.Bindings),
+		ActionExpression: t.ActionExpression,
+		FormSchema:       t.FormSchema,
+		LayoutSchema:     t.LayoutSchema,
+		Priority:         t.Priority,
+	}
+}
+
+// bindingsToValues converts binding candidates to variable -> token value maps
+func bindingsToValues(bindings []petri.Binding) []map[string]interface{} {
+	values := make([]map[string]interface{}, 0, len(bindings))
+	for _, b := range bindings {
+		obj := make(map[string]interface{})
+		for varName, token := range b {
+			if token != nil {
+				obj[varName] = token.Value
+			}
+		}
+		values = append(values, obj)
+	}
+	return values
+}
+
+// GetTransitions returns information about transitions in a CPN
+func (s *Server) GetTransitions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
 		return
@@ -356,43 +507,44 @@ func (s *Server) GetEnabledTransitions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cpn, marking, err := s.getCPN(cpnID)
+	statuses, err := s.runtime.Transitions(r.Context(), cpnID)
 	if err != nil {
-		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		s.writeRuntimeError(w, err, "Failed to get enabled transitions")
+		return
+	}
+
+	var transitions []TransitionInfo
+	for _, status := range statuses {
+		transitions = append(transitions, transitionToInfo(status))
+	}
+
+	s.writeSuccess(w, transitions, "")
+}
+
+// GetEnabledTransitions returns only enabled transitions with full binding candidates
+func (s *Server) GetEnabledTransitions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
 		return
 	}
 
-	enabledTransitions, bindingsMap, err := s.engine.GetEnabledTransitions(cpn, marking)
+	statuses, err := s.runtime.EnabledTransitions(r.Context(), cpnID)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to get enabled transitions: "+err.Error())
+		s.writeRuntimeError(w, err, "Failed to get enabled transitions")
 		return
 	}
 
 	var details []EnabledTransitionDetail
-	for _, t := range enabledTransitions {
-		bindings := bindingsMap[t.ID]
-		bindingObjs := make([]map[string]interface{}, 0, len(bindings))
-		for _, b := range bindings {
-			obj := make(map[string]interface{})
-			for varName, token := range b {
-				obj[varName] = token.Value
-			}
-			bindingObjs = append(bindingObjs, obj)
-		}
+	for _, status := range statuses {
 		details = append(details, EnabledTransitionDetail{
-			TransitionInfo: TransitionInfo{
-				ID:               t.ID,
-				Name:             t.Name,
-				Enabled:          true,
-				Kind:             string(t.Kind),
-				GuardExpression:  t.GuardExpression,
-				Variables:        t.Variables,
-				BindingCount:     len(bindings),
-				ActionExpression: t.ActionExpression,
-				FormSchema:       t.FormSchema,
-				LayoutSchema:     t.LayoutSchema,
-			},
-			Bindings: bindingObjs,
+			TransitionInfo: transitionToInfo(status),
+			Bindings:       bindingsToValues(status.Bindings),
 		})
 	}
 
@@ -418,116 +570,90 @@ func (s *Server) FireTransition(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cpn, marking, err := s.getCPN(request.CPNID)
+	// Hierarchical transitions (subWorkflow link) run their child net inside the runtime
+	marking, err := s.runtime.FireTransition(r.Context(), request.CPNID, request.TransitionID,
+		petri.WithBindingIndex(request.BindingIndex), petri.WithFormData(request.FormData))
 	if err != nil {
-		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		s.writeRuntimeError(w, err, "Failed to fire transition")
 		return
 	}
 
-	transition := cpn.GetTransition(request.TransitionID)
-	if transition == nil {
-		s.writeError(w, http.StatusNotFound, "transition_not_found", "Transition with ID "+request.TransitionID+" not found")
+	name := request.TransitionID
+	if cpn, err := s.runtime.GetCPN(request.CPNID); err == nil {
+		if transition := cpn.GetTransition(request.TransitionID); transition != nil {
+			name = transition.Name
+		}
+	}
+	s.writeSuccess(w, s.markingToResponse(marking), "Transition "+name+" fired successfully")
+}
+
+// SimulateStep performs one simulation step
+func (s *Server) SimulateStep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
 		return
 	}
 
-	// Check if transition is enabled
-	enabled, bindings, err := s.engine.IsEnabled(cpn, transition, marking)
+	result, err := s.runtime.SimulateStep(r.Context(), cpnID)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to check if transition is enabled: "+err.Error())
+		s.writeRuntimeError(w, err, "Failed to simulate step")
 		return
 	}
 
-	if !enabled {
-		s.writeError(w, http.StatusBadRequest, "transition_not_enabled", "Transition "+transition.Name+" is not enabled")
+	s.writeSuccess(w, s.stepToResponse(result), "")
+}
+
+// SimulateSteps performs multiple simulation steps
+func (s *Server) SimulateSteps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
 		return
 	}
 
-	if request.BindingIndex >= len(bindings) {
-		s.writeError(w, http.StatusBadRequest, "invalid_binding", "Binding index out of range")
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
 		return
 	}
 
-	// Fire the transition; handle hierarchical call if subWorkflow link present.
-	binding := bindings[request.BindingIndex]
-	if sw := cpn.GetSubWorkflowByTransition(transition.ID); sw != nil {
-		// Step 1: Fire inputs + action only (engine suppresses outputs automatically for hierarchical transitions)
-		if err := s.engine.FireTransitionWithData(cpn, transition, binding, marking, request.FormData); err != nil {
-			s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to fire hierarchical transition: "+err.Error())
-			return
-		}
-		// Step 2: Execute child net (fresh instance) with autoStart semantics
-		childCPN, ok := s.cpns[sw.CPNID]
-		if !ok {
-			s.writeError(w, http.StatusBadRequest, "child_cpn_missing", fmt.Sprintf("Child CPN %s not loaded", sw.CPNID))
-			return
-		}
-		childMarking := childCPN.CreateInitialMarking()
-		// Apply simple inputMapping: parent binding var -> child variable as temporary variable tokens (not yet token injection into places)
-		// (Improvement pending: inject tokens directly in mapped child input places.)
-		if sw.AutoStart {
-			if _, err := s.engine.FireEnabledTransitions(childCPN, childMarking); err != nil {
-				s.writeError(w, http.StatusInternalServerError, "child_autostart_failed", err.Error())
-				return
-			}
-		}
-		// Step 3: If propagateOnComplete and child completed, map outputs and produce deferred parent outputs now.
-		if sw.PropagateOnComplete && s.engine.IsCompleted(childCPN, childMarking) {
-			parentBinding := engine.TokenBinding{}
-			// Build parentBinding from outputMapping; naive: pick first token from child output places for each mapping
-			for childVar, parentVar := range sw.OutputMapping {
-				var val interface{}
-				// Search for a token value corresponding to childVar heuristic: first token anywhere (since variable scoping not tracked in CPN-level path)
-				for placeID := range childMarking.Places {
-					toks := childMarking.GetTokens(placeID)
-					if len(toks) > 0 {
-						val = toks[0].Value
-						break
-					}
-				}
-				if val != nil {
-					parentBinding[parentVar] = models.NewToken(val, marking.GlobalClock)
-				}
-				_ = childVar
-			}
-			// Produce each output arc expression with built binding
-			for _, arc := range cpn.GetOutputArcs(transition.ID) {
-				if len(parentBinding) == 0 {
-					break
-				}
-				ctx := expression.NewEvaluationContext()
-				ctx.SetGlobalClock(marking.GlobalClock)
-				for varName, tk := range parentBinding {
-					ctx.BindVariable(varName, tk)
-				}
-				result, err := s.engine.EvaluatorAccessor().EvaluateArcExpression(arc.Expression, ctx)
-				if err != nil {
-					continue
-				}
-				place := cpn.GetPlace(arc.GetPlaceID())
-				if place == nil {
-					continue
-				}
-				newToken := models.NewToken(result, marking.GlobalClock)
-				if err := place.ValidateToken(newToken); err != nil {
-					continue
-				}
-				marking.AddToken(place.ID, newToken)
-			}
-		}
-	} else {
-		if err := s.engine.FireTransitionWithData(cpn, transition, binding, marking, request.FormData); err != nil {
-			s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to fire transition: "+err.Error())
-			return
+	stepsStr := r.URL.Query().Get("steps")
+	steps := 1
+	if stepsStr != "" {
+		if parsed, err := strconv.Atoi(stepsStr); err == nil && parsed > 0 {
+			steps = parsed
 		}
 	}
 
-	s.writeSuccess(w, s.markingToResponse(marking), "Transition "+transition.Name+" fired successfully")
+	// Stops early on completion, when nothing fires or at a breakpoint monitor
+	result, err := s.runtime.SimulateSteps(r.Context(), cpnID, steps)
+	if err != nil {
+		s.writeRuntimeError(w, err, "Failed to simulate step")
+		return
+	}
+
+	s.writeSuccess(w, s.stepToResponse(result), "")
 }
 
-// SimulateStep performs one simulation step
-func (s *Server) SimulateStep(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+func (s *Server) stepToResponse(result *petri.StepResult) SimulationStepResponse {
+	return SimulationStepResponse{
+		TransitionsFired: result.TransitionsFired,
+		Completed:        result.Completed,
+		NewMarking:       s.markingToResponse(result.Marking),
+		CurrentStep:      result.Step,
+		Breakpoint:       result.Breakpoint,
+	}
+}
+
+// GetMonitorResults returns the monitor results of the current simulation run of a CPN
+func (s *Server) GetMonitorResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
 		return
 	}
 
@@ -537,33 +663,47 @@ func (s *Server) SimulateStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cpn, marking, err := s.getCPN(cpnID)
+	results, err := s.runtime.MonitorResults(cpnID)
 	if err != nil {
 		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
 		return
 	}
 
-	// Perform simulation step
-	firedCount, err := s.engine.SimulateStep(cpn, marking)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to simulate step: "+err.Error())
+	// Optionally narrow down to a single monitor
+	if monitorID := r.URL.Query().Get("monitor"); monitorID != "" {
+		result := results.Get(monitorID)
+		if result == nil {
+			s.writeError(w, http.StatusNotFound, "monitor_not_found", "Monitor with ID "+monitorID+" not found")
+			return
+		}
+		s.writeSuccess(w, result, "")
 		return
 	}
 
-	completed := s.engine.IsCompleted(cpn, marking)
+	s.writeSuccess(w, results, "")
+}
+
+// ListFunctions returns the Go functions registered for use in guards, arc expressions and actions
+func (s *Server) ListFunctions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
 
-	response := SimulationStepResponse{
-		TransitionsFired: firedCount,
-		Completed:        completed,
-		NewMarking:       s.markingToResponse(marking),
-		CurrentStep:      marking.StepCounter,
+	functions := []FunctionInfo{}
+	for _, fn := range s.runtime.Functions() {
+		functions = append(functions, FunctionInfo{
+			Name:        fn.QualifiedName(),
+			Signature:   fn.Signature.String(),
+			Description: fn.Description,
+		})
 	}
 
-	s.writeSuccess(w, response, "")
+	s.writeSuccess(w, functions, "")
 }
 
-// SimulateSteps performs multiple simulation steps
-func (s *Server) SimulateSteps(w http.ResponseWriter, r *http.Request) {
+// RunExperiment runs a batch simulation experiment (independent replications from the initial marking)
+func (s *Server) RunExperiment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
 		return
@@ -575,50 +715,25 @@ func (s *Server) SimulateSteps(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stepsStr := r.URL.Query().Get("steps")
-	steps := 1
-	if stepsStr != "" {
-		if parsed, err := strconv.Atoi(stepsStr); err == nil && parsed > 0 {
-			steps = parsed
-		}
-	}
-
-	cpn, marking, err := s.getCPN(cpnID)
-	if err != nil {
+	if _, err := s.runtime.GetCPN(cpnID); err != nil {
 		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
 		return
 	}
 
-	totalFired := 0
-	for i := 0; i < steps; i++ {
-		if s.engine.IsCompleted(cpn, marking) {
-			break
-		}
-
-		firedCount, err := s.engine.SimulateStep(cpn, marking)
-		if err != nil {
-			s.writeError(w, http.StatusInternalServerError, "engine_error", "Failed to simulate step: "+err.Error())
-			return
-		}
-
-		totalFired += firedCount
-
-		// If no transitions fired, stop simulation
-		if firedCount == 0 {
-			break
-		}
+	var config engine.ExperimentConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse JSON: "+err.Error())
+		return
 	}
 
-	completed := s.engine.IsCompleted(cpn, marking)
-
-	response := SimulationStepResponse{
-		TransitionsFired: totalFired,
-		Completed:        completed,
-		NewMarking:       s.markingToResponse(marking),
-		CurrentStep:      marking.StepCounter,
+	// Experiments run on a dedicated engine so they never interfere with the shared simulation state
+	result, err := s.runtime.RunExperiment(r.Context(), cpnID, config)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "experiment_error", "Failed to run experiment: "+err.Error())
+		return
 	}
 
-	s.writeSuccess(w, response, "")
+	s.writeSuccess(w, result, "")
 }
 
 // ResetCPN resets a CPN to its initial marking
@@ -634,16 +749,24 @@ func (s *Server) ResetCPN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cpn, exists := s.cpns[cpnID]
-	if !exists {
-		s.writeError(w, http.StatusNotFound, "cpn_not_found", "CPN with ID "+cpnID+" not found")
-		return
+	// Optional seed for the random source of the new run
+	var opts []petri.ResetOption
+	if seedStr := r.URL.Query().Get("seed"); seedStr != "" {
+		seed, err := strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_parameter", "seed must be an integer")
+			return
+		}
+		opts = append(opts, petri.WithSeed(seed))
 	}
 
-	// Reset to initial marking
-	s.states[cpnID] = cpn.CreateInitialMarking()
+	marking, err := s.runtime.ResetCPN(r.Context(), cpnID, opts...)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		return
+	}
 
-	s.writeSuccess(w, s.markingToResponse(s.states[cpnID]), "CPN reset to initial marking")
+	s.writeSuccess(w, s.markingToResponse(marking), "CPN reset to initial marking")
 }
 
 // DeleteCPN removes a CPN from the server
@@ -659,16 +782,11 @@ func (s *Server) DeleteCPN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, exists := s.cpns[cpnID]; !exists {
-		s.writeError(w, http.StatusNotFound, "cpn_not_found", "CPN with ID "+cpnID+" not found")
+	// Also removes the CPN's cases
+	if err := s.runtime.DeleteCPN(r.Context(), cpnID); err != nil {
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
 		return
 	}
 
-	delete(s.cpns, cpnID)
-	delete(s.states, cpnID)
-
-	// Unregister from case manager
-	s.caseManager.UnregisterCPN(cpnID)
-
 	s.writeSuccess(w, nil, "CPN deleted successfully")
 }
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// GetHistory lists the steps of a CPN's simulation marking that can be restored
+func (s *Server) GetHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return
+	}
+
+	history, err := s.runtime.History(cpnID)
+	if err != nil {
+		s.writeRuntimeError(w, err, "Failed to get history")
+		return
+	}
+	s.writeSuccess(w, history, "")
+}
+
+// StepBack undoes firings and simulation steps of a CPN (steps={n}, default 1)
+func (s *Server) StepBack(w http.ResponseWriter, r *http.Request) {
+	cpnID, steps, ok := s.historyStepParams(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.runtime.StepBack(r.Context(), cpnID, steps)
+	if err != nil {
+		s.writeRuntimeError(w, err, "Failed to step back")
+		return
+	}
+	s.writeSuccess(w, s.stepToResponse(result), "")
+}
+
+// StepForward redoes undone firings and simulation steps of a CPN (steps={n}, default 1)
+func (s *Server) StepForward(w http.ResponseWriter, r *http.Request) {
+	cpnID, steps, ok := s.historyStepParams(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.runtime.StepForward(r.Context(), cpnID, steps)
+	if err != nil {
+		s.writeRuntimeError(w, err, "Failed to step forward")
+		return
+	}
+	s.writeSuccess(w, s.stepToResponse(result), "")
+}
+
+// GoToStep restores the simulation marking of a CPN at a step counter in its history
+func (s *Server) GoToStep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return
+	}
+	step, err := strconv.Atoi(r.URL.Query().Get("step"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_parameter", "step must be an integer")
+		return
+	}
+
+	result, err := s.runtime.GoToStep(r.Context(), cpnID, step)
+	if err != nil {
+		s.writeRuntimeError(w, err, "Failed to go to step")
+		return
+	}
+	s.writeSuccess(w, s.stepToResponse(result), "")
+}
+
+// historyStepParams checks the method and reads the CPN ID and the optional step count
+func (s *Server) historyStepParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return "", 0, false
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return "", 0, false
+	}
+	steps := 1
+	if stepsStr := r.URL.Query().Get("steps"); stepsStr != "" {
+		if parsed, err := strconv.Atoi(stepsStr); err == nil && parsed > 0 {
+			steps = parsed
+		}
+	}
+	return cpnID, steps, true
+}
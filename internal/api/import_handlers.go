@@ -0,0 +1,153 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+// maxImportSize limits the size of uploaded model files
+const maxImportSize = 32 << 20
+
+// ImportResponse describes a CPN loaded from an external model format
+type ImportResponse struct {
+	CPN    CPNInfo                  `json:"cpn"`
+	Report *models.ConversionReport `json:"report"`
+}
+
+// NetsImportResponse describes the nets loaded from a model with several nets, main net first
+type NetsImportResponse struct {
+	CPNs   []CPNInfo                `json:"cpns"`
+	Report *models.ConversionReport `json:"report"`
+}
+
+// ImportPNML loads a CPN from a PNML document in the request body
+func (s *Server) ImportPNML(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_body", "Failed to read request body: "+err.Error())
+		return
+	}
+
+	cpn, report, err := s.runtime.ImportPNML(r.Context(), data)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_pnml", "Failed to import PNML: "+err.Error())
+		return
+	}
+
+	s.writeSuccess(w, ImportResponse{
+		CPN: CPNInfo{
+			ID:          cpn.ID,
+			Name:        cpn.Name,
+			Description: cpn.Description,
+			Status:      "loaded",
+		},
+		Report: report,
+	}, "PNML imported successfully")
+}
+
+// ImportCPNTools loads the nets of a CPN Tools model in the request body. The optional id query
+// parameter sets the ID of the main net.
+func (s *Server) ImportCPNTools(w http.ResponseWriter, r *http.Request) {
+	s.importNets(w, r, "invalid_cpntools", "CPN Tools model", func(data []byte) ([]*petri.CPN, *models.ConversionReport, error) {
+		return s.runtime.ImportCPNTools(r.Context(), data, r.URL.Query().Get("id"))
+	})
+}
+
+// ImportBPMN compiles the processes of a BPMN 2.0 document in the request body and loads them
+func (s *Server) ImportBPMN(w http.ResponseWriter, r *http.Request) {
+	s.importNets(w, r, "invalid_bpmn", "BPMN", func(data []byte) ([]*petri.CPN, *models.ConversionReport, error) {
+		return s.runtime.ImportBPMN(r.Context(), data)
+	})
+}
+
+// importNets reads a model from the request body and responds with the nets the import loaded
+func (s *Server) importNets(w http.ResponseWriter, r *http.Request, code, format string, load func([]byte) ([]*petri.CPN, *models.ConversionReport, error)) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_body", "Failed to read request body: "+err.Error())
+		return
+	}
+
+	cpns, report, err := load(data)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, code, "Failed to import "+format+": "+err.Error())
+		return
+	}
+
+	response := NetsImportResponse{Report: report}
+	for _, cpn := range cpns {
+		response.CPNs = append(response.CPNs, CPNInfo{
+			ID:          cpn.ID,
+			Name:        cpn.Name,
+			Description: cpn.Description,
+			Status:      "loaded",
+		})
+	}
+	s.writeSuccess(w, response, format+" imported successfully")
+}
+
+// ExportPNML returns a loaded CPN as a PNML document. The X-Conversion-Issues header counts the
+// issues of the conversion and the Link header points to the report (see ExportPNMLReport).
+func (s *Server) ExportPNML(w http.ResponseWriter, r *http.Request) {
+	cpnID, data, report, ok := s.exportPNML(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("X-Conversion-Issues", strconv.Itoa(len(report.Issues)))
+	w.Header().Set("Link", `</api/cpn/export/pnml/report?id=`+url.QueryEscape(cpnID)+`>; rel="conversion-report"`)
+	w.Header().Set("Access-Control-Expose-Headers", "X-Conversion-Issues, Link")
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+cpnID+`.pnml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// ExportPNMLReport returns the conversion report of exporting a loaded CPN as PNML
+func (s *Server) ExportPNMLReport(w http.ResponseWriter, r *http.Request) {
+	if _, _, report, ok := s.exportPNML(w, r); ok {
+		s.writeSuccess(w, report, "")
+	}
+}
+
+// exportPNML converts the CPN named by the id query parameter to PNML. Reports false after
+// writing an error response.
+func (s *Server) exportPNML(w http.ResponseWriter, r *http.Request) (string, []byte, *models.ConversionReport, bool) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return "", nil, nil, false
+	}
+
+	cpnID := r.URL.Query().Get("id")
+	if cpnID == "" {
+		s.writeError(w, http.StatusBadRequest, "missing_parameter", "CPN ID is required")
+		return "", nil, nil, false
+	}
+
+	data, report, err := s.runtime.ExportPNML(cpnID)
+	if errors.Is(err, petri.ErrCPNNotFound) {
+		s.writeError(w, http.StatusNotFound, "cpn_not_found", err.Error())
+		return "", nil, nil, false
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "serialization_error", "Failed to export PNML: "+err.Error())
+		return "", nil, nil, false
+	}
+	return cpnID, data, report, true
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-petri-flow/pkg/petri"
+)
+
+// ForkCase copies a running case into a sandbox for what-if simulation
+func (h *CaseHandlers) ForkCase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	caseID := r.URL.Query().Get("id")
+	if caseID == "" {
+		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Case ID is required")
+		return
+	}
+
+	state, err := h.runtime.ForkCase(r.Context(), caseID)
+	if errors.Is(err, petri.ErrTooManySandboxes) {
+		h.writeError(w, http.StatusTooManyRequests, "too_many_sandboxes", err.Error())
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "fork_failed", err.Error())
+		return
+	}
+	h.writeSuccess(w, state, "Sandbox created")
+}
+
+// GetSandbox returns the state of a sandbox
+func (h *CaseHandlers) GetSandbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	sandboxID, ok := h.sandboxID(w, r)
+	if !ok {
+		return
+	}
+	state, err := h.runtime.Sandbox(sandboxID)
+	if err != nil {
+		h.writeSandboxError(w, "retrieval_failed", err)
+		return
+	}
+	h.writeSuccess(w, state, "")
+}
+
+// FireSandboxTransition fires a transition of a sandbox, manual ones included
+func (h *CaseHandlers) FireSandboxTransition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	sandboxID, ok := h.sandboxID(w, r)
+	if !ok {
+		return
+	}
+	var request FireTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse JSON: "+err.Error())
+		return
+	}
+	if request.TransitionID == "" {
+		h.writeError(w, http.StatusBadRequest, "missing_field", "Transition ID is required")
+		return
+	}
+
+	state, err := h.runtime.SandboxFire(r.Context(), sandboxID, request.TransitionID, petri.WithBindingIndex(request.BindingIndex))
+	if err != nil {
+		h.writeSandboxError(w, "fire_failed", err)
+		return
+	}
+	h.writeSuccess(w, state, "")
+}
+
+// SimulateSandbox performs simulation steps in a sandbox (steps={n}, default 1)
+func (h *CaseHandlers) SimulateSandbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	sandboxID, ok := h.sandboxID(w, r)
+	if !ok {
+		return
+	}
+	steps := 1
+	if stepsStr := r.URL.Query().Get("steps"); stepsStr != "" {
+		if parsed, err := strconv.Atoi(stepsStr); err == nil && parsed > 0 {
+			steps = parsed
+		}
+	}
+
+	state, err := h.runtime.SandboxSimulate(r.Context(), sandboxID, steps)
+	if err != nil {
+		h.writeSandboxError(w, "simulation_failed", err)
+		return
+	}
+	h.writeSuccess(w, state, "")
+}
+
+// PredictSandbox predicts completion times and paths from the marking of a sandbox
+func (h *CaseHandlers) PredictSandbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	sandboxID, ok := h.sandboxID(w, r)
+	if !ok {
+		return
+	}
+	var config petri.PredictionConfig
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse JSON: "+err.Error())
+			return
+		}
+	}
+
+	prediction, err := h.runtime.SandboxPredict(r.Context(), sandboxID, config)
+	if err != nil {
+		h.writeSandboxError(w, "prediction_failed", err)
+		return
+	}
+	h.writeSuccess(w, prediction, "")
+}
+
+// DeleteSandbox discards a sandbox
+func (h *CaseHandlers) DeleteSandbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE method is allowed")
+		return
+	}
+
+	sandboxID, ok := h.sandboxID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.runtime.DiscardSandbox(sandboxID); err != nil {
+		h.writeSandboxError(w, "delete_failed", err)
+		return
+	}
+	h.writeSuccess(w, nil, "Sandbox deleted successfully")
+}
+
+// sandboxID reads the required sandbox ID parameter
+func (h *CaseHandlers) sandboxID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sandboxID := r.URL.Query().Get("id")
+	if sandboxID == "" {
+		h.writeError(w, http.StatusBadRequest, "missing_parameter", "Sandbox ID is required")
+		return "", false
+	}
+	return sandboxID, true
+}
+
+// writeSandboxError reports unknown sandboxes as not found and other errors as bad requests
+func (h *CaseHandlers) writeSandboxError(w http.ResponseWriter, code string, err error) {
+	if errors.Is(err, petri.ErrSandboxNotFound) {
+		h.writeError(w, http.StatusNotFound, "sandbox_not_found", err.Error())
+		return
+	}
+	h.writeError(w, http.StatusBadRequest, code, err.Error())
+}
@@ -18,6 +18,15 @@ func (s *Server) SetupRoutes() *http.ServeMux {
 	mux.HandleFunc("/api/cpn/delete", s.corsMiddleware(s.DeleteCPN))
 	mux.HandleFunc("/api/cpn/reset", s.corsMiddleware(s.ResetCPN))
 	mux.HandleFunc("/api/cpn/validate", s.corsMiddleware(s.ValidateCPN))
+	mux.HandleFunc("/api/cpn/import/pnml", s.corsMiddleware(s.ImportPNML))
+	mux.HandleFunc("/api/cpn/export/pnml", s.corsMiddleware(s.ExportPNML))
+	mux.HandleFunc("/api/cpn/export/pnml/report", s.corsMiddleware(s.ExportPNMLReport))
+	mux.HandleFunc("/api/cpn/import/cpntools", s.corsMiddleware(s.ImportCPNTools))
+	mux.HandleFunc("/api/cpn/import/bpmn", s.corsMiddleware(s.ImportBPMN))
+	mux.HandleFunc("/api/cpn/render", s.corsMiddleware(s.RenderCPN))
+	mux.HandleFunc("/api/cpn/layout", s.corsMiddleware(s.LayoutCPN))
+	mux.HandleFunc("/api/cpn/versions", s.corsMiddleware(s.ListCPNVersions))
+	mux.HandleFunc("/api/cpn/versions/retire", s.corsMiddleware(s.RetireCPNVersion))
 
 	// Marking
 	mux.HandleFunc("/api/marking/get", s.corsMiddleware(s.GetMarking))
@@ -30,6 +39,14 @@ func (s *Server) SetupRoutes() *http.ServeMux {
 	// Simulation
 	mux.HandleFunc("/api/simulation/step", s.corsMiddleware(s.SimulateStep))
 	mux.HandleFunc("/api/simulation/steps", s.corsMiddleware(s.SimulateSteps))
+	mux.HandleFunc("/api/simulation/experiment", s.corsMiddleware(s.RunExperiment))
+	mux.HandleFunc("/api/simulation/history", s.corsMiddleware(s.GetHistory))
+	mux.HandleFunc("/api/simulation/back", s.corsMiddleware(s.StepBack))
+	mux.HandleFunc("/api/simulation/forward", s.corsMiddleware(s.StepForward))
+	mux.HandleFunc("/api/simulation/goto", s.corsMiddleware(s.GoToStep))
+
+	// Monitors
+	mux.HandleFunc("/api/monitors/results", s.corsMiddleware(s.GetMonitorResults))
 
 	// Case Management
 	mux.HandleFunc("/api/cases/create", s.corsMiddleware(s.caseHandlers.CreateCase))
@@ -44,6 +61,16 @@ func (s *Server) SetupRoutes() *http.ServeMux {
 	mux.HandleFunc("/api/cases/executeall", s.corsMiddleware(s.caseHandlers.ExecuteAll))
 	mux.HandleFunc("/api/cases/fire", s.corsMiddleware(s.caseHandlers.FireTransition))
 	mux.HandleFunc("/api/cases/marking", s.corsMiddleware(s.caseHandlers.GetCaseMarking))
+	mux.HandleFunc("/api/cases/render", s.corsMiddleware(s.caseHandlers.RenderCase))
+	mux.HandleFunc("/api/cases/migrate", s.corsMiddleware(s.caseHandlers.MigrateCase))
+	mux.HandleFunc("/api/cases/migrate/bulk", s.corsMiddleware(s.caseHandlers.MigrateCases))
+	mux.HandleFunc("/api/cases/fork", s.corsMiddleware(s.caseHandlers.ForkCase))
+	mux.HandleFunc("/api/sandboxes/get", s.corsMiddleware(s.caseHandlers.GetSandbox))
+	mux.HandleFunc("/api/sandboxes/fire", s.corsMiddleware(s.caseHandlers.FireSandboxTransition))
+	mux.HandleFunc("/api/sandboxes/simulate", s.corsMiddleware(s.caseHandlers.SimulateSandbox))
+	mux.HandleFunc("/api/sandboxes/predict", s.corsMiddleware(s.caseHandlers.PredictSandbox))
+	mux.HandleFunc("/api/sandboxes/delete", s.corsMiddleware(s.caseHandlers.DeleteSandbox))
+	mux.HandleFunc("/api/cases/monitors", s.corsMiddleware(s.caseHandlers.GetCaseMonitors))
 	mux.HandleFunc("/api/cases/transitions", s.corsMiddleware(s.caseHandlers.GetCaseTransitions))
 	mux.HandleFunc("/api/cases/transitions/enabled", s.corsMiddleware(s.caseHandlers.GetCaseEnabledTransitions))
 	mux.HandleFunc("/api/cases/query", s.corsMiddleware(s.caseHandlers.QueryCases))
@@ -69,6 +96,9 @@ func (s *Server) SetupRoutes() *http.ServeMux {
 	mux.HandleFunc("/api/workitems/statistics", s.corsMiddleware(s.workItemHandlers.GetWorkItemStatistics))
 	mux.HandleFunc("/api/workitems/createforcase", s.corsMiddleware(s.workItemHandlers.CreateWorkItemsForCase))
 
+	// Go functions available to Lua expressions
+	mux.HandleFunc("/api/functions", s.corsMiddleware(s.ListFunctions))
+
 	// Health check endpoint
 	mux.HandleFunc("/api/health", s.corsMiddleware(s.HealthCheck))
 
@@ -109,7 +139,7 @@ func (s *Server) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		"status":  "healthy",
 		"service": "go-petri-flow",
 		"version": "1.0.0",
-		"cpns":    len(s.cpns),
+		"cpns":    len(s.runtime.ListCPNs()),
 		"engine":  "gopher-lua",
 	}
 
@@ -129,12 +159,32 @@ func (s *Server) APIDocs(w http.ResponseWriter, r *http.Request) {
 		"description": "REST API for Colored Petri Net simulation using gopher-lua",
 		"endpoints": map[string]interface{}{
 			"CPN Management": map[string]interface{}{
-				"POST /api/cpn/load":     "Load a CPN from JSON definition",
-				"GET /api/cpn/list":      "List all loaded CPNs",
-				"GET /api/cpn/get":       "Get CPN details by ID",
-				"DELETE /api/cpn/delete": "Delete a CPN by ID",
-				"POST /api/cpn/reset":    "Reset CPN to initial marking",
-				"GET /api/cpn/validate":  "Validate a CPN and return rule violations and transition diagnostics",
+				"POST /api/cpn/load":              "Load a CPN from JSON definition",
+				"GET /api/cpn/list":               "List all loaded CPNs",
+				"GET /api/cpn/get":                "Get CPN details by ID (optional version={n}, default latest)",
+				"DELETE /api/cpn/delete":          "Delete a CPN by ID",
+				"POST /api/cpn/reset":             "Reset CPN to initial marking (optional seed={n} for the random source)",
+				"GET /api/cpn/validate":           "Validate a CPN and return rule violations and transition diagnostics",
+				"POST /api/cpn/import/pnml":       "Load a CPN from a PNML document (request body) and return a conversion report",
+				"GET /api/cpn/export/pnml":        "Download a CPN as a PNML document (issue count in the X-Conversion-Issues header)",
+				"GET /api/cpn/export/pnml/report": "Get the conversion report of exporting a CPN as PNML",
+				"POST /api/cpn/import/cpntools":   "Load the nets of a CPN Tools model (request body, optional ?id=) and return a conversion report",
+				"POST /api/cpn/import/bpmn":       "Compile the processes of a BPMN 2.0 document (request body) to CPNs, load them and return a conversion report",
+				"GET /api/cpn/render":             "Draw a CPN with its marking and enabled transitions as SVG (default) or Graphviz DOT (format=dot)",
+				"POST /api/cpn/layout":            "Compute positions for a CPN and its sub workflow CPNs (force=true replaces existing ones) and return their definitions",
+				"GET /api/cpn/versions":           "List the deployed versions of a CPN with their hashes and active cases",
+				"POST /api/cpn/versions/retire":   "Retire a version of a CPN (id, version); fails while it is the latest version or has active cases",
+				"GET /api/cases/render":           "Draw the CPN of a case with the case's marking as SVG (default) or Graphviz DOT (format=dot)",
+				"POST /api/cases/migrate":         "Move a case to another CPN version with a migration plan (body); dryRun=true only reports the diff and issues",
+				"POST /api/cases/migrate/bulk":    "Apply a migration plan to all cases matching a filter ({filter, plan}), all or none; supports dryRun=true",
+			},
+			"Sandboxes": map[string]interface{}{
+				"POST /api/cases/fork":         "Fork a running case into a sandbox without side effects (no events, no work items)",
+				"GET /api/sandboxes/get":       "Get the marking, variables, path and enabled transitions of a sandbox",
+				"POST /api/sandboxes/fire":     "Fire a transition of a sandbox, manual ones included",
+				"POST /api/sandboxes/simulate": "Perform simulation steps in a sandbox (steps={n})",
+				"POST /api/sandboxes/predict":  "Predict completion times and paths from a sandbox (body: runs, seed, maxSteps, fireManual)",
+				"DELETE /api/sandboxes/delete": "Discard a sandbox",
 			},
 			"Marking": map[string]interface{}{
 				"GET /api/marking/get": "Get current marking of a CPN",
@@ -144,8 +194,20 @@ func (s *Server) APIDocs(w http.ResponseWriter, r *http.Request) {
 				"POST /api/transitions/fire": "Manually fire a transition",
 			},
 			"Simulation": map[string]interface{}{
-				"POST /api/simulation/step":  "Perform one simulation step",
-				"POST /api/simulation/steps": "Perform multiple simulation steps",
+				"POST /api/simulation/step":       "Perform one simulation step",
+				"POST /api/simulation/steps":      "Perform multiple simulation steps",
+				"POST /api/simulation/experiment": "Run independent replications until a stop criterion and report statistics with confidence intervals",
+				"GET /api/simulation/history":     "List the steps of the simulation marking that can be restored",
+				"POST /api/simulation/back":       "Undo firings and simulation steps (steps={n}, default 1)",
+				"POST /api/simulation/forward":    "Redo undone firings and simulation steps (steps={n}, default 1)",
+				"POST /api/simulation/goto":       "Restore the marking of a step in the history (step={stepCounter})",
+			},
+			"Monitors": map[string]interface{}{
+				"GET /api/monitors/results": "Get monitor results of the current run (optional monitor={monitorId})",
+				"GET /api/cases/monitors":   "Get monitor results of a case",
+			},
+			"Functions": map[string]interface{}{
+				"GET /api/functions": "List Go functions registered by the host application for use in Lua expressions",
 			},
 			"Utility": map[string]interface{}{
 				"GET /api/health": "Health check",
@@ -6,18 +6,18 @@ import (
 	"time"
 
 	"go-petri-flow/internal/models"
-	"go-petri-flow/internal/workitem"
+	"go-petri-flow/pkg/petri"
 )
 
 // WorkItemHandlers contains handlers for work item management endpoints
 type WorkItemHandlers struct {
-	workItemManager *workitem.Manager
+	runtime *petri.Runtime
 }
 
 // NewWorkItemHandlers creates new work item handlers
-func NewWorkItemHandlers(workItemManager *workitem.Manager) *WorkItemHandlers {
+func NewWorkItemHandlers(runtime *petri.Runtime) *WorkItemHandlers {
 	return &WorkItemHandlers{
-		workItemManager: workItemManager,
+		runtime: runtime,
 	}
 }
 
@@ -167,7 +167,8 @@ func (h *WorkItemHandlers) CreateWorkItem(w http.ResponseWriter, r *http.Request
 	}
 
 	// Create the work item
-	workItem, err := h.workItemManager.CreateWorkItem(request.ID, request.CaseID, request.TransitionID, request.Name, request.Description, request.BindingIndex)
+	workItem, err := h.runtime.CreateWorkItem(r.Context(), request.ID, request.CaseID, request.TransitionID, request.Name,
+		petri.WithWorkItemDescription(request.Description), petri.WithWorkItemBinding(request.BindingIndex))
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "creation_failed", "Failed to create work item: "+err.Error())
 		return
@@ -189,7 +190,7 @@ func (h *WorkItemHandlers) GetWorkItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "workitem_not_found", err.Error())
 		return
@@ -217,14 +218,14 @@ func (h *WorkItemHandlers) UpdateWorkItem(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := h.workItemManager.UpdateWorkItem(workItemID, request.Data, request.Metadata)
+	err := h.runtime.UpdateWorkItem(r.Context(), workItemID, request.Data, request.Metadata)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "update_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -259,14 +260,14 @@ func (h *WorkItemHandlers) SetPriority(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.workItemManager.SetPriority(workItemID, priority)
+	err := h.runtime.SetWorkItemPriority(r.Context(), workItemID, priority)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "set_priority_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -294,14 +295,14 @@ func (h *WorkItemHandlers) SetDueDate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.workItemManager.SetDueDate(workItemID, request.DueDate)
+	err := h.runtime.SetWorkItemDueDate(r.Context(), workItemID, request.DueDate)
 	if err != nil {
 		h.writeError(w, http.StatusNotFound, "set_due_date_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -334,14 +335,14 @@ func (h *WorkItemHandlers) OfferWorkItem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := h.workItemManager.OfferWorkItem(workItemID, request.UserIDs)
+	err := h.runtime.OfferWorkItem(r.Context(), workItemID, request.UserIDs)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "offer_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -374,14 +375,14 @@ func (h *WorkItemHandlers) AllocateWorkItem(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err := h.workItemManager.AllocateWorkItem(workItemID, request.UserID)
+	err := h.runtime.AllocateWorkItem(r.Context(), workItemID, request.UserID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "allocate_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -403,14 +404,14 @@ func (h *WorkItemHandlers) StartWorkItem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := h.workItemManager.StartWorkItem(workItemID)
+	err := h.runtime.StartWorkItem(r.Context(), workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "start_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -432,14 +433,14 @@ func (h *WorkItemHandlers) CompleteWorkItem(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err := h.workItemManager.CompleteWorkItem(workItemID)
+	err := h.runtime.CompleteWorkItem(r.Context(), workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "complete_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -461,14 +462,14 @@ func (h *WorkItemHandlers) FailWorkItem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := h.workItemManager.FailWorkItem(workItemID)
+	err := h.runtime.FailWorkItem(r.Context(), workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "fail_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -490,14 +491,14 @@ func (h *WorkItemHandlers) CancelWorkItem(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := h.workItemManager.CancelWorkItem(workItemID)
+	err := h.runtime.CancelWorkItem(r.Context(), workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "cancel_failed", err.Error())
 		return
 	}
 
 	// Get updated work item
-	workItem, err := h.workItemManager.GetWorkItem(workItemID)
+	workItem, err := h.runtime.GetWorkItem(workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "retrieval_failed", err.Error())
 		return
@@ -519,7 +520,7 @@ func (h *WorkItemHandlers) DeleteWorkItem(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := h.workItemManager.DeleteWorkItem(workItemID)
+	err := h.runtime.DeleteWorkItem(r.Context(), workItemID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "delete_failed", err.Error())
 		return
@@ -541,7 +542,7 @@ func (h *WorkItemHandlers) QueryWorkItems(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	workItems, err := h.workItemManager.QueryWorkItems(&query)
+	workItems, err := h.runtime.QueryWorkItems(r.Context(), &query)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
 		return
@@ -575,7 +576,7 @@ func (h *WorkItemHandlers) GetWorkItemsByCase(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	workItems, err := h.workItemManager.GetWorkItemsByCase(caseID)
+	workItems, err := h.runtime.WorkItemsByCase(caseID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
 		return
@@ -602,7 +603,7 @@ func (h *WorkItemHandlers) GetWorkItemsByUser(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	workItems, err := h.workItemManager.GetWorkItemsByUser(userID)
+	workItems, err := h.runtime.WorkItemsByUser(userID)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
 		return
@@ -623,7 +624,7 @@ func (h *WorkItemHandlers) GetOverdueWorkItems(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	workItems, err := h.workItemManager.GetOverdueWorkItems()
+	workItems, err := h.runtime.OverdueWorkItems()
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
 		return
@@ -644,7 +645,7 @@ func (h *WorkItemHandlers) GetWorkItemStatistics(w http.ResponseWriter, r *http.
 		return
 	}
 
-	stats := h.workItemManager.GetWorkItemStatistics()
+	stats := h.runtime.WorkItemStatistics()
 	h.writeSuccess(w, stats, "")
 }
 
@@ -661,7 +662,7 @@ func (h *WorkItemHandlers) CreateWorkItemsForCase(w http.ResponseWriter, r *http
 		return
 	}
 
-	workItems, err := h.workItemManager.CreateWorkItemsForCase(caseID)
+	workItems, err := h.runtime.CreateWorkItemsForCase(r.Context(), caseID)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "creation_failed", err.Error())
 		return
@@ -1,8 +1,11 @@
 package case_manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,35 +14,68 @@ import (
 	"go-petri-flow/internal/models"
 )
 
+// Errors of version management; match them with errors.Is
+var (
+	ErrVersionNotFound = errors.New("CPN version not found")
+	ErrVersionRetired  = errors.New("CPN version retired")
+	ErrVersionInUse    = errors.New("CPN version in use")
+	// ErrMigrationInvalid is returned when a case cannot be migrated as planned; see the
+	// issues of the migration results
+	ErrMigrationInvalid = errors.New("case migration invalid")
+)
+
 // Manager handles case lifecycle management
 type Manager struct {
-	cases  map[string]*models.Case // Case ID -> Case
-	cpns   map[string]*models.CPN  // CPN ID -> CPN
-	engine *engine.Engine
-	mutex  sync.RWMutex
+	cases    map[string]*models.Case  // Case ID -> Case
+	cpns     map[string]*models.CPN   // CPN ID -> latest version
+	versions map[string][]*cpnVersion // CPN ID -> deployed versions, oldest first
+	engine   *engine.Engine
+	mutex    sync.RWMutex
+}
+
+// cpnVersion is a deployed version of a CPN; the CPN is dropped when the version is retired
+type cpnVersion struct {
+	info models.CPNVersion
+	cpn  *models.CPN
 }
 
 // NewManager creates a new case manager
 func NewManager(engine *engine.Engine) *Manager {
 	return &Manager{
-		cases:  make(map[string]*models.Case),
-		cpns:   make(map[string]*models.CPN),
-		engine: engine,
+		cases:    make(map[string]*models.Case),
+		cpns:     make(map[string]*models.CPN),
+		versions: make(map[string][]*cpnVersion),
+		engine:   engine,
 	}
 }
 
-// RegisterCPN registers a CPN for case management
+// RegisterCPN registers a CPN for case management as a new version of its ID (see
+// models.CPNVersion), numbered from 1. New cases use it; existing cases keep their version.
 func (m *Manager) RegisterCPN(cpn *models.CPN) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	versions := m.versions[cpn.ID]
+	cpn.Version = len(versions) + 1
+	m.versions[cpn.ID] = append(versions, &cpnVersion{
+		info: models.CPNVersion{CPNID: cpn.ID, Version: cpn.Version, Hash: cpn.Hash, DeployedAt: time.Now()},
+		cpn:  cpn,
+	})
 	m.cpns[cpn.ID] = cpn
 }
 
-// UnregisterCPN unregisters a CPN
+// NextVersion returns the version RegisterCPN assigns to the next CPN registered for an ID
+func (m *Manager) NextVersion(cpnID string) int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.versions[cpnID]) + 1
+}
+
+// UnregisterCPN unregisters a CPN with all its versions
 func (m *Manager) UnregisterCPN(cpnID string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	delete(m.cpns, cpnID)
+	delete(m.versions, cpnID)
 
 	// Remove all cases for this CPN
 	for caseID, case_ := range m.cases {
@@ -49,15 +85,231 @@ func (m *Manager) UnregisterCPN(cpnID string) {
 	}
 }
 
-// CreateCase creates a new case instance
+// cpnVersion returns a version of a CPN (0 = latest) that can run cases; the lock must be held
+func (m *Manager) cpnVersion(cpnID string, version int) (*models.CPN, error) {
+	latest, exists := m.cpns[cpnID]
+	if !exists {
+		return nil, fmt.Errorf("CPN with ID %s not found", cpnID)
+	}
+	if version == 0 {
+		return latest, nil
+	}
+	versions := m.versions[cpnID]
+	if version < 0 || version > len(versions) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrVersionNotFound, cpnID, version)
+	}
+	if v := versions[version-1]; v.cpn != nil {
+		return v.cpn, nil
+	}
+	return nil, fmt.Errorf("%w: %s version %d", ErrVersionRetired, cpnID, version)
+}
+
+// caseCPN returns the CPN version a case is pinned to; the lock must be held
+func (m *Manager) caseCPN(case_ *models.Case) (*models.CPN, bool) {
+	cpn, err := m.cpnVersion(case_.CPNID, case_.CPNVersion)
+	return cpn, err == nil
+}
+
+// GetCPNVersion returns a version of a CPN (0 = latest)
+func (m *Manager) GetCPNVersion(cpnID string, version int) (*models.CPN, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.cpnVersion(cpnID, version)
+}
+
+// GetCaseCPN returns the CPN version a case is pinned to
+func (m *Manager) GetCaseCPN(caseID string) (*models.CPN, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	case_, exists := m.cases[caseID]
+	if !exists {
+		return nil, fmt.Errorf("case with ID %s not found", caseID)
+	}
+	return m.cpnVersion(case_.CPNID, case_.CPNVersion)
+}
+
+// Versions returns the deployed versions of a CPN, oldest first, with their active cases
+func (m *Manager) Versions(cpnID string) ([]models.CPNVersion, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	versions, exists := m.versions[cpnID]
+	if !exists {
+		return nil, fmt.Errorf("CPN with ID %s not found", cpnID)
+	}
+	active := m.activeCasesByVersion(cpnID)
+	infos := make([]models.CPNVersion, len(versions))
+	for i, v := range versions {
+		infos[i] = v.info
+		infos[i].Latest = i == len(versions)-1
+		infos[i].ActiveCases = active[v.info.Version]
+	}
+	return infos, nil
+}
+
+// RetireVersion retires a version of a CPN: it can no longer run or create cases. Only versions
+// other than the latest one and without cases that have not terminated can be retired.
+func (m *Manager) RetireVersion(cpnID string, version int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	versions, exists := m.versions[cpnID]
+	if !exists {
+		return fmt.Errorf("CPN with ID %s not found", cpnID)
+	}
+	if version < 1 || version > len(versions) {
+		return fmt.Errorf("%w: %s version %d", ErrVersionNotFound, cpnID, version)
+	}
+	v := versions[version-1]
+	if v.info.IsRetired() {
+		return nil
+	}
+	if version == len(versions) {
+		return fmt.Errorf("%w: %s version %d is the latest version", ErrVersionInUse, cpnID, version)
+	}
+	if n := m.activeCasesByVersion(cpnID)[version]; n > 0 {
+		return fmt.Errorf("%w: %s version %d has %d active cases", ErrVersionInUse, cpnID, version, n)
+	}
+	now := time.Now()
+	v.info.RetiredAt = &now
+	v.cpn = nil
+	return nil
+}
+
+// activeCasesByVersion counts the cases of a CPN that have not terminated by version; the lock
+// must be held
+func (m *Manager) activeCasesByVersion(cpnID string) map[int]int {
+	counts := make(map[int]int)
+	for _, case_ := range m.cases {
+		if case_.CPNID == cpnID && !case_.IsTerminated() {
+			counts[case_.CPNVersion]++
+		}
+	}
+	return counts
+}
+
+// MigrateCase moves a case that has not terminated to another version of its CPN, carrying its
+// marking over as planned. Dry runs only report the diff and issues; otherwise an invalid
+// migration leaves the case unchanged and returns ErrMigrationInvalid with the result.
+func (m *Manager) MigrateCase(caseID string, plan *models.MigrationPlan, dryRun bool) (*models.MigrationResult, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	case_, exists := m.cases[caseID]
+	if !exists {
+		return nil, fmt.Errorf("case with ID %s not found", caseID)
+	}
+	result, err := m.planMigration(case_, plan, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return result, nil
+	}
+	if !result.Valid() {
+		messages := make([]string, len(result.Issues))
+		for i, issue := range result.Issues {
+			messages[i] = issue.Message
+		}
+		return result, fmt.Errorf("%w: %s", ErrMigrationInvalid, strings.Join(messages, "; "))
+	}
+	m.applyMigration(case_, result)
+	return result, nil
+}
+
+// MigrateCases migrates all cases matching a filter that have not terminated, ordered by ID. The
+// filter must select a CPN. Cases are migrated all or none: if any is invalid, none is changed
+// and ErrMigrationInvalid is returned with the results.
+func (m *Manager) MigrateCases(filter *models.CaseFilter, plan *models.MigrationPlan, dryRun bool) ([]*models.MigrationResult, error) {
+	if filter == nil || filter.CPNID == "" {
+		return nil, fmt.Errorf("migration filter must select a CPN")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var cases []*models.Case
+	for _, case_ := range m.cases {
+		if filter.Matches(case_) && !case_.IsTerminated() {
+			cases = append(cases, case_)
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].ID < cases[j].ID })
+
+	results := make([]*models.MigrationResult, 0, len(cases))
+	invalid := 0
+	for _, case_ := range cases {
+		result, err := m.planMigration(case_, plan, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Valid() {
+			invalid++
+		}
+		results = append(results, result)
+	}
+	if dryRun {
+		return results, nil
+	}
+	if invalid > 0 {
+		return results, fmt.Errorf("%w: %d of %d cases", ErrMigrationInvalid, invalid, len(results))
+	}
+	for i, case_ := range cases {
+		m.applyMigration(case_, results[i])
+	}
+	return results, nil
+}
+
+// planMigration computes the migration of a case without changing it; the lock must be held
+func (m *Manager) planMigration(case_ *models.Case, plan *models.MigrationPlan, dryRun bool) (*models.MigrationResult, error) {
+	if case_.IsTerminated() {
+		return nil, fmt.Errorf("case %s is %s and cannot be migrated", case_.ID, case_.Status)
+	}
+	source, exists := m.caseCPN(case_)
+	if !exists {
+		return nil, fmt.Errorf("CPN with ID %s not found", case_.CPNID)
+	}
+	target, err := m.cpnVersion(case_.CPNID, plan.TargetVersion)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.MigrationResult{
+		CaseID:      case_.ID,
+		FromVersion: case_.CPNVersion,
+		ToVersion:   target.Version,
+		DryRun:      dryRun,
+		Diff:        []models.PlaceChange{},
+		Issues:      []models.MigrationIssue{},
+	}
+	if case_.Marking != nil {
+		result.Marking = m.engine.MigrateMarking(source, target, case_.Marking, plan, result)
+	}
+	return result, nil
+}
+
+// applyMigration pins a case to the target version of a valid migration; the lock must be held
+func (m *Manager) applyMigration(case_ *models.Case, result *models.MigrationResult) {
+	case_.CPNVersion = result.ToVersion
+	if result.Marking != nil {
+		case_.Marking = result.Marking
+	}
+	result.Applied = true
+}
+
+// CreateCase creates a new case instance of the latest version of a CPN
 func (m *Manager) CreateCase(caseID, cpnID, name, description string, variables map[string]interface{}) (*models.Case, error) {
+	return m.CreateCaseAtVersion(caseID, cpnID, 0, name, description, variables)
+}
+
+// CreateCaseAtVersion creates a new case instance pinned to a version of a CPN (0 = latest)
+func (m *Manager) CreateCaseAtVersion(caseID, cpnID string, version int, name, description string, variables map[string]interface{}) (*models.Case, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	// Check if CPN exists
-	_, exists := m.cpns[cpnID]
-	if !exists {
-		return nil, fmt.Errorf("CPN with ID %s not found", cpnID)
+	cpn, err := m.cpnVersion(cpnID, version)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if case ID already exists
@@ -67,6 +319,7 @@ func (m *Manager) CreateCase(caseID, cpnID, name, description string, variables
 
 	// Create new case
 	case_ := models.NewCase(caseID, cpnID, name, description)
+	case_.CPNVersion = cpn.Version
 
 	// Set variables if provided
 	for k, v := range variables {
@@ -93,7 +346,7 @@ func (m *Manager) StartCase(caseID string) error {
 		return fmt.Errorf("case %s is not in CREATED status, current status: %s", caseID, case_.Status)
 	}
 
-	cpn, exists := m.cpns[case_.CPNID]
+	cpn, exists := m.caseCPN(case_)
 	if !exists {
 		return fmt.Errorf("CPN with ID %s not found", case_.CPNID)
 	}
@@ -218,7 +471,7 @@ func (m *Manager) ExecuteStep(caseID string) (int, error) {
 		return 0, fmt.Errorf("case %s is not running, current status: %s", caseID, case_.Status)
 	}
 
-	cpn, exists := m.cpns[case_.CPNID]
+	cpn, exists := m.caseCPN(case_)
 	if !exists {
 		return 0, fmt.Errorf("CPN with ID %s not found", case_.CPNID)
 	}
@@ -241,8 +494,26 @@ func (m *Manager) ExecuteStep(caseID string) (int, error) {
 	return firedCount, nil
 }
 
-// ExecuteAll executes automatic transitions repeatedly until quiescent for a case
+// ExecutionBudget returns the default budget of ExecuteAll
+func (m *Manager) ExecutionBudget() engine.Budget {
+	return m.engine.GetBudget()
+}
+
+// ExecuteAll executes automatic transitions repeatedly until quiescent for a case, within the engine's budget
 func (m *Manager) ExecuteAll(caseID string) (int, error) {
+	return m.ExecuteAllWithBudget(caseID, m.engine.GetBudget())
+}
+
+// ExecuteAllWithBudget executes automatic transitions until quiescent or until the budget is exhausted.
+// When the budget is exhausted the firings done so far are kept and the *engine.BudgetExceededError
+// (with its livelock diagnosis) is returned together with the number of firings.
+func (m *Manager) ExecuteAllWithBudget(caseID string, budget engine.Budget) (int, error) {
+	return m.ExecuteAllContext(context.Background(), caseID, budget)
+}
+
+// ExecuteAllContext is ExecuteAllWithBudget that also stops once ctx is done; the firings done so far
+// are kept and the context's error is returned together with the number of firings.
+func (m *Manager) ExecuteAllContext(ctx context.Context, caseID string, budget engine.Budget) (int, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -253,18 +524,23 @@ func (m *Manager) ExecuteAll(caseID string) (int, error) {
 	if case_.Status != models.CaseStatusRunning {
 		return 0, fmt.Errorf("case %s is not running, current status: %s", caseID, case_.Status)
 	}
-	cpn, exists := m.cpns[case_.CPNID]
+	cpn, exists := m.caseCPN(case_)
 	if !exists {
 		return 0, fmt.Errorf("CPN with ID %s not found", case_.CPNID)
 	}
 
-	firedCount, err := m.engine.FireEnabledTransitions(cpn, case_.Marking)
-	if err != nil {
+	firedCount, err := m.engine.FireEnabledTransitionsContext(ctx, cpn, case_.Marking, budget)
+	var budgetErr *engine.BudgetExceededError
+	stopped := errors.As(err, &budgetErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	if err != nil && !stopped {
 		return 0, fmt.Errorf("failed to execute all automatic transitions: %v", err)
 	}
 	if m.engine.IsCompleted(cpn, case_.Marking) {
 		case_.Complete()
 	}
+	if stopped {
+		return firedCount, err
+	}
 	return firedCount, nil
 }
 
@@ -282,7 +558,7 @@ func (m *Manager) FireTransition(caseID, transitionID string, bindingIndex int)
 		return fmt.Errorf("case %s is not running, current status: %s", caseID, case_.Status)
 	}
 
-	cpn, exists := m.cpns[case_.CPNID]
+	cpn, exists := m.caseCPN(case_)
 	if !exists {
 		return fmt.Errorf("CPN with ID %s not found", case_.CPNID)
 	}
@@ -380,6 +656,7 @@ func (m *Manager) fireSubWorkflowTransition(parentCase *models.Case, parentCPN *
 	if !exists {
 		return fmt.Errorf("child CPN %s not loaded", sw.CPNID)
 	}
+	childCase.CPNVersion = childCPN.Version
 	// Create child initial marking (clone of defined initial marking)
 	childMarking := childCPN.CreateInitialMarking()
 	// Apply input mapping: parent variable -> child variable by creating bound variable tokens
@@ -435,7 +712,7 @@ func (m *Manager) propagateChildCompletion(child *models.Case) {
 	if !ok {
 		return
 	}
-	parentCPN := m.cpns[parentCase.CPNID]
+	parentCPN, _ := m.caseCPN(parentCase)
 	defListKey := "_deferredOutputs"
 	raw, ok := parentCase.Metadata[defListKey]
 	if !ok {
@@ -511,33 +788,34 @@ func (m *Manager) propagateChildCompletion(child *models.Case) {
 	}
 }
 
-// produceSingleArc replicates engine output arc logic (simplified) for deferred emission
+// produceSingleArc emits the tokens of one output arc for deferred sub-workflow outputs
 func (m *Manager) produceSingleArc(cpn *models.CPN, arc *models.Arc, binding engine.TokenBinding, marking *models.Marking) {
-	// Reuse engine's evaluator indirectly: create a fresh evaluation context
-	ctx := expression.NewEvaluationContext()
-	ctx.SetGlobalClock(marking.GlobalClock)
-	for varName, token := range binding {
-		ctx.BindVariable(varName, token)
-	}
-	// Evaluate expression
-	result, err := m.engineEvaluator().EvaluateArcExpression(arc.Expression, ctx)
-	if err != nil {
-		return
-	}
-	place := cpn.GetPlace(arc.GetPlaceID())
-	if place == nil {
-		return
-	}
-	newToken := models.NewToken(result, marking.GlobalClock)
-	if err := place.ValidateToken(newToken); err != nil {
-		return
-	}
-	marking.AddToken(place.ID, newToken)
+	// Tokens failing evaluation or color set validation are dropped, as for the other deferred outputs
+	_, _ = m.engine.ProduceOutputArc(cpn, arc, binding, marking)
 }
 
 // engineEvaluator exposes underlying evaluator (package-private compromise)
 func (m *Manager) engineEvaluator() *expression.Evaluator { return m.engine.EvaluatorAccessor() }
 
+// GetCaseMonitorResults returns a snapshot of the monitor results of a case
+func (m *Manager) GetCaseMonitorResults(caseID string) (*models.MonitorResults, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	case_, exists := m.cases[caseID]
+	if !exists {
+		return nil, fmt.Errorf("case with ID %s not found", caseID)
+	}
+	if case_.Marking != nil && case_.Marking.Monitors != nil {
+		return case_.Marking.Monitors.Clone(), nil
+	}
+	var monitors []*models.Monitor
+	if cpn, ok := m.caseCPN(case_); ok {
+		monitors = cpn.Monitors
+	}
+	return models.NewMonitorResults(monitors), nil
+}
+
 // GetEnabledTransitions returns enabled transitions for a case
 func (m *Manager) GetEnabledTransitions(caseID string) ([]*models.Transition, map[string][]engine.TokenBinding, error) {
 	m.mutex.RLock()
@@ -552,7 +830,7 @@ func (m *Manager) GetEnabledTransitions(caseID string) ([]*models.Transition, ma
 		return nil, nil, fmt.Errorf("case %s is not running, current status: %s", caseID, case_.Status)
 	}
 
-	cpn, exists := m.cpns[case_.CPNID]
+	cpn, exists := m.caseCPN(case_)
 	if !exists {
 		return nil, nil, fmt.Errorf("CPN with ID %s not found", case_.CPNID)
 	}
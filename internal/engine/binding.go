@@ -0,0 +1,665 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// Binding search
+//
+// Bindings of a transition are found by a depth-first search over its input arcs. The arcs are
+// ordered by selectivity: arcs whose token is determined by variables bound so far (a variable
+// bound by an earlier arc, or an expression over bound variables) are looked up in the place's
+// value index first, then variables are bound from the places with the fewest distinct values.
+// Guard conjuncts are checked right after the arc that binds their last variable, and equality
+// conjuncts such as "order.id == item.orderId" select candidate tokens through a JSON key index.
+
+// arcStepKind describes how an input arc contributes to a binding
+type arcStepKind int
+
+const (
+	stepBind  arcStepKind = iota // binds a new variable to each candidate token
+	stepMatch                    // variable already bound: a token with its value must be available
+	stepEval                     // expression over bound variables: a token with its value must be available
+	stepScan                     // expression depending on the token itself: every token is tried (bound as `token`)
+)
+
+// bindingStep is one input arc in search order
+type bindingStep struct {
+	arc      *models.Arc
+	arcIndex int // position among the transition's input arcs (binding order)
+	kind     arcStepKind
+	variable string
+	count    int        // tokens consumed by the arc (multiplicity)
+	join     *guardJoin // candidate tokens from an index (stepBind only)
+	guards   []string   // guard conjuncts whose variables are all bound after this step
+}
+
+// guardJoin selects the candidates of a variable through an equality guard conjunct
+type guardJoin struct {
+	field string // "" = whole token value
+	other string // expression over variables bound by earlier steps
+}
+
+// bindingPlan is the search order of a transition's input arcs
+type bindingPlan struct {
+	steps  []*bindingStep
+	guards []string // conjuncts without arc variables, checked once before the search
+	final  string   // rest of the guard, checked on complete bindings
+}
+
+// guardConjunct is a top-level "and" operand of a guard
+type guardConjunct struct {
+	expression string
+	vars       map[string]bool // arc variables read by the conjunct
+	sides      []joinSide      // equality sides usable for index lookups
+}
+
+// joinSide is one side of an equality conjunct that is a variable or variable.field
+type joinSide struct {
+	variable, field string
+	other           string          // the other side of the equality
+	otherVars       map[string]bool // arc variables read by the other side
+}
+
+// transitionAnalysis caches the static part of binding planning for a transition
+type transitionAnalysis struct {
+	fingerprint string
+	arcVars     []string          // variable of each input arc ("" = expression arc)
+	arcCounts   []int             // tokens per evaluation of each variable arc (n'x consumes n)
+	arcExprVars []map[string]bool // arc variables read by each expression arc
+	conjuncts   []*guardConjunct
+	pushable    int  // conjuncts before the first one drawing random numbers (may be pushed down)
+	volatile    bool // guard or input arcs read places, the global clock, random numbers or call net functions (never cached)
+	globals     bool // guard or input arcs read globals of the net (cached until they are assigned)
+}
+
+// FindBindings returns the bindings of a transition in the marking, in input arc order.
+// A positive limit stops the search after that many bindings (in search order).
+func (e *Engine) FindBindings(cpn *models.CPN, transition *models.Transition, marking *models.Marking, limit int) ([]TokenBinding, error) {
+	inputs := cpn.GetInputArcs(transition.ID)
+	plan, err := e.planBindings(cpn, transition, inputs, marking)
+	if err != nil {
+		return nil, err
+	}
+	s := &bindingSearch{
+		engine:  e,
+		cpn:     cpn,
+		marking: marking,
+		plan:    plan,
+		limit:   limit,
+		places:  make(map[string]*placeIndex),
+		used:    make(map[string]map[string]int),
+	}
+	for _, guard := range plan.guards {
+		ok, err := s.checkGuard(guard, TokenBinding{})
+		if err != nil || !ok {
+			return nil, err
+		}
+	}
+	positions := make([]int, len(inputs))
+	for i := range positions {
+		positions[i] = -1
+	}
+	if err := s.search(0, TokenBinding{}, positions); err != nil {
+		return nil, err
+	}
+	if limit <= 0 && len(s.results) > 1 {
+		sort.Stable(s)
+	}
+	return s.results, nil
+}
+
+// hasBinding reports whether a transition has at least one binding (ignoring priorities)
+func (e *Engine) hasBinding(cpn *models.CPN, transition *models.Transition, marking *models.Marking) (bool, error) {
+	if bindings, ok := e.cachedBindings(cpn, transition, marking); ok {
+		return len(bindings) > 0, nil
+	}
+	bindings, err := e.FindBindings(cpn, transition, marking, 1)
+	return len(bindings) > 0, err
+}
+
+// analysisKey identifies a transition of a deployed CPN version
+type analysisKey struct {
+	cpnID        string
+	version      int
+	transitionID string
+}
+
+func keyOf(cpn *models.CPN, transition *models.Transition) analysisKey {
+	return analysisKey{cpnID: cpn.ID, version: cpn.Version, transitionID: transition.ID}
+}
+
+// analyze returns the cached static analysis of a transition's guard and input arcs
+func (e *Engine) analyze(cpn *models.CPN, transition *models.Transition, inputs []*models.Arc) *transitionAnalysis {
+	var fp strings.Builder
+	fp.WriteString(transition.GuardExpression)
+	for _, arc := range inputs {
+		fp.WriteString("\x00" + arc.ID + "\x00" + arc.Expression)
+	}
+	key := keyOf(cpn, transition)
+	if a, ok := e.analyses[key]; ok && a.fingerprint == fp.String() {
+		return a
+	}
+
+	a := &transitionAnalysis{
+		fingerprint: fp.String(),
+		arcVars:     make([]string, len(inputs)),
+		arcCounts:   make([]int, len(inputs)),
+		arcExprVars: make([]map[string]bool, len(inputs)),
+	}
+	known := make(map[string]bool)
+	for i, arc := range inputs {
+		a.arcCounts[i] = 1
+		if isSimpleVariable(arc.Expression) {
+			a.arcVars[i] = arc.Expression
+		} else if terms, ok := expression.SplitMultiset(arc.Expression); ok && len(terms) == 1 && isSimpleVariable(terms[0].Expression) {
+			a.arcVars[i], a.arcCounts[i] = terms[0].Expression, terms[0].Count
+		}
+		if a.arcVars[i] != "" {
+			known[a.arcVars[i]] = true
+		}
+	}
+	for i, arc := range inputs {
+		if a.arcVars[i] != "" {
+			continue
+		}
+		a.arcExprVars[i] = make(map[string]bool)
+		for _, expr := range inscriptionExpressions(arc.Expression) {
+			for v := range readVariables(expr, known) {
+				a.arcExprVars[i][v] = true
+			}
+			a.volatile = a.volatile || e.isVolatile(expr)
+			a.globals = a.globals || e.readsGlobals(expr, known)
+		}
+	}
+	if transition.HasGuard() {
+		a.volatile = a.volatile || e.isVolatile(transition.GuardExpression)
+		a.globals = a.globals || e.readsGlobals(transition.GuardExpression, known)
+	}
+
+	a.pushable = -1
+	if transition.HasGuard() {
+		for i, part := range expression.SplitConjuncts(transition.GuardExpression) {
+			c := &guardConjunct{expression: part, vars: readVariables(part, known)}
+			if a.pushable < 0 && (expression.UsesRandom(part) || e.callsNetFunctions(part)) {
+				a.pushable = i
+			}
+			if lhs, rhs, ok := expression.SplitEquality(part); ok {
+				for _, pair := range [][2]string{{lhs, rhs}, {rhs, lhs}} {
+					if v, field, ok := expression.FieldPath(pair[0]); ok && known[v] {
+						otherVars := readVariables(pair[1], known)
+						if !otherVars[v] {
+							c.sides = append(c.sides, joinSide{variable: v, field: field, other: pair[1], otherVars: otherVars})
+						}
+					}
+				}
+			}
+			a.conjuncts = append(a.conjuncts, c)
+		}
+	}
+	if a.pushable < 0 {
+		a.pushable = len(a.conjuncts)
+	}
+
+	if e.analyses == nil {
+		e.analyses = make(map[analysisKey]*transitionAnalysis)
+	}
+	e.analyses[key] = a
+	return a
+}
+
+// readVariables returns the arc variables an expression reads (including x_timestamp as x).
+// An expression that cannot be analyzed reads all of them.
+func readVariables(expr string, known map[string]bool) map[string]bool {
+	names, ok := expression.Identifiers(expr)
+	if !ok {
+		return known
+	}
+	vars := make(map[string]bool)
+	for _, name := range names {
+		if known[name] {
+			vars[name] = true
+		} else if v := strings.TrimSuffix(name, "_timestamp"); v != name && known[v] {
+			vars[v] = true
+		}
+	}
+	return vars
+}
+
+// inscriptionExpressions returns the term expressions of a multiset inscription, or the
+// inscription itself
+func inscriptionExpressions(inscription string) []string {
+	terms, ok := expression.SplitMultiset(inscription)
+	if !ok {
+		return []string{inscription}
+	}
+	exprs := make([]string, len(terms))
+	for i, term := range terms {
+		exprs[i] = term.Expression
+	}
+	return exprs
+}
+
+// isVolatile reports whether the value of an expression may change without a change of the
+// tokens it is bound to or of the globals of the net. Functions declared by the net may read the
+// clock, places or random numbers, so calling them is volatile; Go functions are not.
+func (e *Engine) isVolatile(expr string) bool {
+	names, ok := expression.Identifiers(expr)
+	if !ok || expression.UsesRandom(expr) {
+		return true
+	}
+	for _, name := range names {
+		if name == "places" || name == "global_clock" {
+			return true
+		}
+	}
+	return e.callsNetFunctions(expr)
+}
+
+// callsNetFunctions reports whether an expression may call a function that is not built in or
+// registered (e.g. one declared by the net)
+func (e *Engine) callsNetFunctions(expr string) bool {
+	names, ok := expression.CalledNames(expr)
+	if !ok {
+		return true
+	}
+	for _, name := range names {
+		if !e.evaluator.IsBuiltin(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// readsGlobals reports whether an expression may read globals of the net: names that are neither
+// arc variables nor built in
+func (e *Engine) readsGlobals(expr string, known map[string]bool) bool {
+	names, ok := expression.Identifiers(expr)
+	if !ok {
+		return true
+	}
+	for _, name := range names {
+		if !known[name] && !known[strings.TrimSuffix(name, "_timestamp")] && !e.evaluator.IsBuiltin(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropAnalyses discards the analyses of the transitions of a CPN, of all versions if version is 0
+func (e *Engine) dropAnalyses(cpnID string, version int) {
+	for key := range e.analyses {
+		if key.cpnID == cpnID && (version == 0 || key.version == version) {
+			delete(e.analyses, key)
+		}
+	}
+}
+
+func subset(vars, bound map[string]bool) bool {
+	for v := range vars {
+		if !bound[v] {
+			return false
+		}
+	}
+	return true
+}
+
+// planBindings orders the input arcs of a transition and distributes its guard conjuncts
+func (e *Engine) planBindings(cpn *models.CPN, transition *models.Transition, inputs []*models.Arc, marking *models.Marking) (*bindingPlan, error) {
+	a := e.analyze(cpn, transition, inputs)
+	plan := &bindingPlan{}
+	bound := make(map[string]bool)
+
+	// Conjuncts are assigned in guard order so that "a and b" never evaluates b where a
+	// would have short-circuited it
+	next := 0
+	assign := func() []string {
+		var guards []string
+		for next < a.pushable && subset(a.conjuncts[next].vars, bound) {
+			guards = append(guards, a.conjuncts[next].expression)
+			next++
+		}
+		return guards
+	}
+	plan.guards = assign()
+
+	remaining := make([]int, len(inputs))
+	for i := range remaining {
+		remaining[i] = i
+	}
+	for len(remaining) > 0 {
+		best, bestCost := -1, math.MaxInt
+		var bestJoin *guardJoin
+		for r, i := range remaining {
+			arc := inputs[i]
+			if cpn.GetPlace(arc.GetPlaceID()) == nil {
+				return nil, fmt.Errorf("failed to find token bindings: place %s not found", arc.GetPlaceID())
+			}
+			variable := a.arcVars[i]
+			var cost int
+			var join *guardJoin
+			switch {
+			case variable != "" && bound[variable]:
+				cost = 0
+			case variable == "" && subset(a.arcExprVars[i], bound):
+				cost = 0
+			case variable != "":
+				if join = a.findJoin(variable, bound, next); join != nil {
+					cost = 1
+				} else {
+					cost = 2 + len(marking.GetMultiset(arc.GetPlaceID())) // distinct values
+				}
+			default:
+				cost = math.MaxInt - 1 // depends on unbound variables: try every token last
+			}
+			if cost < bestCost {
+				best, bestCost, bestJoin = r, cost, join
+			}
+		}
+
+		i := remaining[best]
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		arc := inputs[i]
+		step := &bindingStep{arc: arc, arcIndex: i, variable: a.arcVars[i], count: arc.Multiplicity}
+		if step.count <= 0 {
+			step.count = 1
+		}
+		step.count *= a.arcCounts[i]
+		switch {
+		case step.variable != "" && bound[step.variable]:
+			step.kind = stepMatch
+		case step.variable != "":
+			step.kind = stepBind
+			step.join = bestJoin
+			bound[step.variable] = true
+		case subset(a.arcExprVars[i], bound):
+			step.kind = stepEval
+		default:
+			step.kind = stepScan
+		}
+		step.guards = assign()
+		plan.steps = append(plan.steps, step)
+	}
+
+	var rest []string
+	for _, c := range a.conjuncts[next:] {
+		rest = append(rest, "("+c.expression+")")
+	}
+	if len(rest) == 1 {
+		plan.final = a.conjuncts[next].expression
+	} else if len(rest) > 1 {
+		plan.final = strings.Join(rest, " and ")
+	}
+	return plan, nil
+}
+
+// findJoin returns an equality conjunct (not yet checked) that selects the candidates of variable
+// from the variables bound so far
+func (a *transitionAnalysis) findJoin(variable string, bound map[string]bool, from int) *guardJoin {
+	for _, c := range a.conjuncts[from:a.pushable] {
+		for _, side := range c.sides {
+			if side.variable == variable && subset(side.otherVars, bound) {
+				return &guardJoin{field: side.field, other: side.other}
+			}
+		}
+	}
+	return nil
+}
+
+// placeIndex holds the available tokens of a place for one binding search
+type placeIndex struct {
+	available []*models.Token       // in binding order (see Marking.GetAvailableTokensAtTime); all tokens of untimed places
+	position  map[*models.Token]int // token -> index in available
+	counts    map[string]int        // value key -> available tokens
+	byField   map[string]models.TokenIndex
+	multiset  models.Multiset
+}
+
+// bindingSearch is the state of one FindBindings call
+type bindingSearch struct {
+	engine  *Engine
+	cpn     *models.CPN
+	marking *models.Marking
+	plan    *bindingPlan
+	limit   int
+	places  map[string]*placeIndex
+	used    map[string]map[string]int // place ID -> value key -> tokens taken by the partial binding
+
+	results []TokenBinding
+	order   [][]int // per result: index of the token chosen on each input arc (-1 = looked up)
+}
+
+// sort.Interface orders results like a nested loop over the input arcs in their original order
+func (s *bindingSearch) Len() int { return len(s.results) }
+func (s *bindingSearch) Swap(i, j int) {
+	s.results[i], s.results[j] = s.results[j], s.results[i]
+	s.order[i], s.order[j] = s.order[j], s.order[i]
+}
+func (s *bindingSearch) Less(i, j int) bool {
+	for k := range s.order[i] {
+		if s.order[i][k] != s.order[j][k] {
+			return s.order[i][k] < s.order[j][k]
+		}
+	}
+	return false
+}
+
+func (s *bindingSearch) done() bool {
+	return s.limit > 0 && len(s.results) >= s.limit
+}
+
+// index returns the available tokens of a place, building the index on first use
+func (s *bindingSearch) index(placeID string) *placeIndex {
+	if idx, ok := s.places[placeID]; ok {
+		return idx
+	}
+	idx := &placeIndex{
+		available: s.marking.GetAvailableTokensAtTime(placeID, availableAt(s.cpn, placeID, s.marking.GlobalClock)),
+		position:  make(map[*models.Token]int),
+		counts:    make(map[string]int),
+		multiset:  s.marking.GetMultiset(placeID),
+	}
+	for i, token := range idx.available {
+		idx.position[token] = i
+		idx.counts[token.ValueString()]++
+	}
+	s.places[placeID] = idx
+	return idx
+}
+
+// candidates returns the tokens a binding step may bind, using the join index when possible
+func (s *bindingSearch) candidates(step *bindingStep, idx *placeIndex, binding TokenBinding) []*models.Token {
+	if step.join == nil {
+		return idx.available
+	}
+	value, err := s.engine.evaluator.EvaluateArcExpression(step.join.other, s.engine.createEvaluationContext(s.cpn, binding, s.marking))
+	if err != nil || value == nil {
+		return idx.available // let the guard decide
+	}
+	var tokens []*models.Token
+	if step.join.field == "" {
+		tokens = idx.multiset.GetTokens(value)
+	} else {
+		if idx.byField == nil {
+			idx.byField = make(map[string]models.TokenIndex)
+		}
+		byField, ok := idx.byField[step.join.field]
+		if !ok {
+			byField = idx.multiset.IndexByKey(step.join.field)
+			idx.byField[step.join.field] = byField
+		}
+		tokens = byField.Lookup(value)
+	}
+	var available []*models.Token
+	for _, token := range tokens {
+		if _, ok := idx.position[token]; ok {
+			available = append(available, token)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool { return idx.position[available[i]] < idx.position[available[j]] })
+	return available
+}
+
+// take reserves the tokens of an arc step; false if not enough tokens with the key are available
+func (s *bindingSearch) take(step *bindingStep, idx *placeIndex, key string) bool {
+	placeID := step.arc.GetPlaceID()
+	if s.used[placeID][key]+step.count > idx.counts[key] {
+		return false
+	}
+	if s.used[placeID] == nil {
+		s.used[placeID] = make(map[string]int)
+	}
+	s.used[placeID][key] += step.count
+	return true
+}
+
+func (s *bindingSearch) release(step *bindingStep, key string) {
+	s.used[step.arc.GetPlaceID()][key] -= step.count
+}
+
+func (s *bindingSearch) checkGuard(guard string, binding TokenBinding) (bool, error) {
+	ok, err := s.engine.evaluator.EvaluateGuard(guard, s.engine.createEvaluationContext(s.cpn, binding, s.marking))
+	if err != nil {
+		return false, fmt.Errorf("failed to check guard: %v", err)
+	}
+	return ok, nil
+}
+
+// descend checks the guards of a step and continues with the next one
+func (s *bindingSearch) descend(depth int, binding TokenBinding, positions []int) error {
+	for _, guard := range s.plan.steps[depth].guards {
+		ok, err := s.checkGuard(guard, binding)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return s.search(depth+1, binding, positions)
+}
+
+func (s *bindingSearch) search(depth int, binding TokenBinding, positions []int) error {
+	if s.done() {
+		return nil
+	}
+	if depth == len(s.plan.steps) {
+		if s.plan.final != "" {
+			ok, err := s.checkGuard(s.plan.final, binding)
+			if err != nil || !ok {
+				return err
+			}
+		}
+		s.results = append(s.results, binding)
+		s.order = append(s.order, append([]int(nil), positions...))
+		return nil
+	}
+
+	step := s.plan.steps[depth]
+	idx := s.index(step.arc.GetPlaceID())
+	switch step.kind {
+	case stepMatch:
+		return s.lookup(depth, step, idx, binding, positions, binding[step.variable].Value)
+
+	case stepEval:
+		value, err := s.engine.evaluator.EvaluateArcExpression(step.arc.Expression, s.engine.createEvaluationContext(s.cpn, binding, s.marking))
+		if ms, ok := value.(expression.MultisetValue); ok && err == nil {
+			return s.lookupAll(depth, step, idx, binding, positions, ms)
+		}
+		if err == nil {
+			return s.lookup(depth, step, idx, binding, positions, value)
+		}
+		return s.scan(depth, step, idx, binding, positions) // e.g. the expression refers to `token`
+
+	case stepScan:
+		return s.scan(depth, step, idx, binding, positions)
+	}
+
+	for _, token := range s.candidates(step, idx, binding) {
+		key := token.ValueString()
+		if !s.take(step, idx, key) {
+			continue
+		}
+		next := s.engine.cloneBinding(binding)
+		next[step.variable] = token
+		positions[step.arcIndex] = idx.position[token]
+		err := s.descend(depth, next, positions)
+		s.release(step, key)
+		if err != nil {
+			return err
+		}
+		if s.done() {
+			break
+		}
+	}
+	positions[step.arcIndex] = -1
+	return nil
+}
+
+// lookup continues the search if tokens with the value an arc step requires are available
+func (s *bindingSearch) lookup(depth int, step *bindingStep, idx *placeIndex, binding TokenBinding, positions []int, value interface{}) error {
+	key := models.ValueKey(value)
+	if !s.take(step, idx, key) {
+		return nil
+	}
+	err := s.descend(depth, binding, positions)
+	s.release(step, key)
+	return err
+}
+
+// lookupAll continues the search if all tokens of a multiset value (times the arc's multiplicity)
+// are available
+func (s *bindingSearch) lookupAll(depth int, step *bindingStep, idx *placeIndex, binding TokenBinding, positions []int, ms expression.MultisetValue) error {
+	placeID := step.arc.GetPlaceID()
+	required := make(map[string]int)
+	for _, element := range ms {
+		value, _ := tokenValue(element)
+		required[models.ValueKey(value)] += step.count
+	}
+	for key, n := range required {
+		if s.used[placeID][key]+n > idx.counts[key] {
+			return nil
+		}
+	}
+	if s.used[placeID] == nil {
+		s.used[placeID] = make(map[string]int)
+	}
+	for key, n := range required {
+		s.used[placeID][key] += n
+	}
+	err := s.descend(depth, binding, positions)
+	for key, n := range required {
+		s.used[placeID][key] -= n
+	}
+	return err
+}
+
+// scan tries every available token for an arc whose expression cannot be evaluated without it.
+// Tokens for which the expression fails are skipped.
+func (s *bindingSearch) scan(depth int, step *bindingStep, idx *placeIndex, binding TokenBinding, positions []int) error {
+	for i, token := range idx.available {
+		context := s.engine.createEvaluationContext(s.cpn, binding, s.marking)
+		context.BindVariable("token", token)
+		if _, err := s.engine.evaluator.EvaluateArcExpression(step.arc.Expression, context); err != nil {
+			continue
+		}
+		key := token.ValueString()
+		if !s.take(step, idx, key) {
+			continue
+		}
+		positions[step.arcIndex] = i
+		err := s.descend(depth, s.engine.cloneBinding(binding), positions)
+		s.release(step, key)
+		if err != nil {
+			return err
+		}
+		if s.done() {
+			break
+		}
+	}
+	positions[step.arcIndex] = -1
+	return nil
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"go-petri-flow/internal/models"
+)
+
+// Budget limits a single FireEnabledTransitions run. Zero fields are unlimited.
+type Budget struct {
+	MaxFirings     int           `json:"maxFirings,omitempty"`     // Maximum number of transition firings
+	MaxTimeAdvance int           `json:"maxTimeAdvance,omitempty"` // Maximum advance of the model clock
+	MaxWallTime    time.Duration `json:"maxWallTime,omitempty"`    // Maximum wall clock duration
+}
+
+// DefaultBudget is applied by new engines so that livelocking nets cannot run forever
+var DefaultBudget = Budget{
+	MaxFirings:  10000,
+	MaxWallTime: 10 * time.Second,
+}
+
+// Budget limits reported in BudgetExceededError
+const (
+	BudgetLimitFirings     = "maxFirings"
+	BudgetLimitTimeAdvance = "maxTimeAdvance"
+	BudgetLimitWallTime    = "maxWallTime"
+)
+
+// diagnosisWindow is the number of most recent firings kept for livelock diagnosis
+const diagnosisWindow = 1024
+
+// LivelockDiagnosis explains which transitions kept firing when a budget was exhausted
+type LivelockDiagnosis struct {
+	CyclingTransitions []string       `json:"cyclingTransitions"` // Transition IDs taking part in the cycle
+	Cycle              []string       `json:"cycle,omitempty"`    // Firing sequence of one cycle period
+	RepeatedMarking    bool           `json:"repeatedMarking"`    // The cycle returns to an earlier marking
+	FiringCounts       map[string]int `json:"firingCounts"`       // Firings per transition during the run
+	Message            string         `json:"message"`
+}
+
+// BudgetExceededError is returned when a run stops because a budget was exhausted.
+// The marking keeps the effects of all firings up to that point.
+type BudgetExceededError struct {
+	Limit       string             `json:"limit"`
+	Fired       int                `json:"fired"`
+	TimeAdvance int                `json:"timeAdvance"`
+	WallTimeMs  int64              `json:"wallTimeMs"`
+	Diagnosis   *LivelockDiagnosis `json:"diagnosis"`
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("execution budget %s exceeded after %d firings: %s", e.Limit, e.Fired, e.Diagnosis.Message)
+}
+
+// SetBudget sets the budget used by FireEnabledTransitions
+func (e *Engine) SetBudget(budget Budget) {
+	e.budget = budget
+}
+
+// GetBudget returns the budget used by FireEnabledTransitions
+func (e *Engine) GetBudget() Budget {
+	return e.budget
+}
+
+// budgetTracker accounts firings of one run against a budget
+type budgetTracker struct {
+	budget      Budget
+	start       time.Time
+	startClock  int
+	fired       int
+	counts      map[string]int
+	transitions []string // ring buffer of recently fired transition IDs
+	signatures  []uint64 // marking signature after each recent firing
+}
+
+func newBudgetTracker(budget Budget, marking *models.Marking) *budgetTracker {
+	return &budgetTracker{
+		budget:     budget,
+		start:      time.Now(),
+		startClock: marking.GlobalClock,
+		counts:     make(map[string]int),
+	}
+}
+
+// record accounts a firing
+func (bt *budgetTracker) record(transitionID string, marking *models.Marking) {
+	bt.fired++
+	bt.counts[transitionID]++
+	if len(bt.transitions) == diagnosisWindow {
+		bt.transitions = bt.transitions[1:]
+		bt.signatures = bt.signatures[1:]
+	}
+	bt.transitions = append(bt.transitions, transitionID)
+	bt.signatures = append(bt.signatures, markingSignature(marking))
+}
+
+// check is called while transitions are still enabled and returns a BudgetExceededError once a limit is reached
+func (bt *budgetTracker) check(marking *models.Marking) error {
+	limit := ""
+	elapsed := time.Since(bt.start)
+	advance := marking.GlobalClock - bt.startClock
+	switch {
+	case bt.budget.MaxFirings > 0 && bt.fired >= bt.budget.MaxFirings:
+		limit = BudgetLimitFirings
+	case bt.budget.MaxTimeAdvance > 0 && advance > bt.budget.MaxTimeAdvance:
+		limit = BudgetLimitTimeAdvance
+	case bt.budget.MaxWallTime > 0 && elapsed > bt.budget.MaxWallTime:
+		limit = BudgetLimitWallTime
+	default:
+		return nil
+	}
+	return &BudgetExceededError{
+		Limit:       limit,
+		Fired:       bt.fired,
+		TimeAdvance: advance,
+		WallTimeMs:  elapsed.Milliseconds(),
+		Diagnosis:   bt.diagnose(),
+	}
+}
+
+// diagnose looks for a cycle in the recent firings: first a return to an earlier marking,
+// then a periodic firing sequence, and finally falls back to the transitions that fired recently.
+func (bt *budgetTracker) diagnose() *LivelockDiagnosis {
+	diagnosis := &LivelockDiagnosis{FiringCounts: make(map[string]int, len(bt.counts))}
+	for id, count := range bt.counts {
+		diagnosis.FiringCounts[id] = count
+	}
+
+	// Latest return to an earlier marking; the map keeps the latest index so the cycle is the shortest one
+	seen := make(map[uint64]int)
+	for k, sig := range bt.signatures {
+		if j, ok := seen[sig]; ok {
+			diagnosis.Cycle = bt.transitions[j+1 : k+1]
+			diagnosis.RepeatedMarking = true
+		}
+		seen[sig] = k
+	}
+
+	// Periodic firing sequence at the end of the run (e.g. a cycle that keeps adding tokens)
+	n := len(bt.transitions)
+	for p := 1; diagnosis.Cycle == nil && 2*p <= n; p++ {
+		if equalStrings(bt.transitions[n-2*p:n-p], bt.transitions[n-p:]) {
+			diagnosis.Cycle = bt.transitions[n-p:]
+		}
+	}
+
+	if diagnosis.Cycle != nil {
+		diagnosis.Cycle = append([]string(nil), diagnosis.Cycle...)
+		diagnosis.CyclingTransitions = uniqueSorted(diagnosis.Cycle)
+		if diagnosis.RepeatedMarking {
+			diagnosis.Message = fmt.Sprintf("livelock: transitions %s cycle back to an earlier marking", strings.Join(diagnosis.CyclingTransitions, ", "))
+		} else {
+			diagnosis.Message = fmt.Sprintf("transitions %s keep firing in a repeating sequence", strings.Join(diagnosis.CyclingTransitions, ", "))
+		}
+		return diagnosis
+	}
+
+	diagnosis.CyclingTransitions = uniqueSorted(bt.transitions)
+	diagnosis.Message = fmt.Sprintf("no repeating cycle found; recently fired transitions: %s", strings.Join(diagnosis.CyclingTransitions, ", "))
+	return diagnosis
+}
+
+// markingSignature hashes the token values of a marking (timestamps and clock are ignored)
+func markingSignature(marking *models.Marking) uint64 {
+	placeIDs := make([]string, 0, len(marking.Places))
+	for placeID, multiset := range marking.Places {
+		if !multiset.IsEmpty() {
+			placeIDs = append(placeIDs, placeID)
+		}
+	}
+	sort.Strings(placeIDs)
+
+	h := fnv.New64a()
+	for _, placeID := range placeIDs {
+		h.Write([]byte(placeID))
+		h.Write([]byte{0})
+		h.Write([]byte(marking.Places[placeID].String()))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueSorted(values []string) []string {
+	set := make(map[string]bool)
+	var result []string
+	for _, v := range values {
+		if !set[v] {
+			set[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// CompileCPN compiles the declarations of a CPN and precompiles all of its inscriptions (guards,
+// arc expressions, actions, binding weights and monitor expressions), so evaluations run cached
+// Lua prototypes that stay cached until the version is retired or the CPN is unloaded (see
+// UnloadCPNVersion and UnloadCPN). All compile errors are reported together, each with the
+// transition, arc or monitor it belongs to. Declarations and prototypes are installed for the
+// CPN's version only once everything compiled, so a failed compile leaves loaded versions
+// untouched and pins nothing. The predicates of subset color sets are bound to the CPN's declarations.
+func (e *Engine) CompileCPN(cpn *models.CPN) error {
+	net, err := e.PrepareCPN(cpn)
+	if err != nil {
+		return err
+	}
+	net.Install()
+	return nil
+}
+
+// PrepareCPN compiles a CPN like CompileCPN but leaves installing its declarations and
+// inscriptions to the caller, so several CPNs can be compiled before any of them is loaded
+func (e *Engine) PrepareCPN(cpn *models.CPN) (*expression.NetCompilation, error) {
+	net, err := e.evaluator.CompileNet(cpn)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []string
+	compile := func(owner, source string, kind expression.ExpressionKind) {
+		if strings.TrimSpace(source) == "" {
+			return
+		}
+		if err := net.Compile(source, kind); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", owner, err))
+		}
+	}
+	for _, t := range cpn.Transitions {
+		compile(fmt.Sprintf("transition %s guard", t.ID), t.GuardExpression, expression.GuardExpression)
+		compile(fmt.Sprintf("transition %s action", t.ID), t.ActionExpression, expression.ActionExpression)
+		compile(fmt.Sprintf("transition %s binding weight", t.ID), t.BindingWeight, expression.ArcExpression)
+	}
+	for _, arc := range cpn.Arcs {
+		compile(fmt.Sprintf("arc %s", arc.ID), arc.Expression, expression.ArcExpression)
+	}
+	for _, m := range cpn.Monitors {
+		kind := expression.ArcExpression
+		if m.Type == models.MonitorTypeBreakpoint {
+			kind = expression.GuardExpression
+		}
+		compile(fmt.Sprintf("monitor %s", m.ID), m.Expression, kind)
+	}
+
+	bound := make(map[models.ColorSet]bool)
+	for _, place := range cpn.Places {
+		if err := e.bindSubsetPredicates(cpn, place.ColorSet, bound); err != nil {
+			errs = append(errs, fmt.Sprintf("place %s color set: %v", place.ID, err))
+		}
+	}
+	for _, colorSet := range cpn.ColorSets() {
+		if err := e.bindSubsetPredicates(cpn, colorSet, bound); err != nil {
+			errs = append(errs, fmt.Sprintf("color set %s: %v", colorSet.Name(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to compile expressions of CPN %s: %s", cpn.ID, strings.Join(errs, "; "))
+	}
+	return net, nil
+}
+
+// bindSubsetPredicates sets the predicates of the subset color sets a color set is built from
+func (e *Engine) bindSubsetPredicates(cpn *models.CPN, colorSet models.ColorSet, bound map[models.ColorSet]bool) error {
+	if colorSet == nil || bound[colorSet] {
+		return nil
+	}
+	bound[colorSet] = true
+	switch cs := colorSet.(type) {
+	case *models.SubsetColorSet:
+		predicate, err := e.evaluator.SubsetPredicate(cpn, cs.GetPredicate())
+		if err != nil {
+			return err
+		}
+		cs.SetPredicate(predicate)
+		return e.bindSubsetPredicates(cpn, cs.GetBase(), bound)
+	case *models.ListColorSet:
+		return e.bindSubsetPredicates(cpn, cs.GetElement(), bound)
+	case *models.ProductColorSet:
+		for _, component := range cs.GetComponents() {
+			if err := e.bindSubsetPredicates(cpn, component, bound); err != nil {
+				return err
+			}
+		}
+	case *models.RecordColorSet:
+		for _, field := range cs.GetFields() {
+			if err := e.bindSubsetPredicates(cpn, field.ColorSet, bound); err != nil {
+				return err
+			}
+		}
+	case *models.UnionColorSet:
+		for _, variant := range cs.GetVariants() {
+			if err := e.bindSubsetPredicates(cpn, variant.ColorSet, bound); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
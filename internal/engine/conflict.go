@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"go-petri-flow/internal/models"
+)
+
+// filterByPriority keeps only the enabled transitions of the highest priority class
+// (lowest priority value), implementing CPN Tools priority semantics.
+func filterByPriority(enabled []*models.Transition) []*models.Transition {
+	if len(enabled) == 0 {
+		return enabled
+	}
+	best := enabled[0].Priority
+	for _, t := range enabled[1:] {
+		if t.Priority < best {
+			best = t.Priority
+		}
+	}
+	var result []*models.Transition
+	for _, t := range enabled {
+		if t.Priority == best {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// checkPriority returns an error if a transition with a strictly higher priority is
+// enabled in the marking, i.e. the given transition is disabled by priority.
+func (e *Engine) checkPriority(cpn *models.CPN, transition *models.Transition, marking *models.Marking) error {
+	if !cpn.HasHigherPriorityThan(transition) {
+		return nil
+	}
+	for _, other := range cpn.Transitions {
+		if other.Priority >= transition.Priority {
+			continue
+		}
+		enabled, err := e.hasBinding(cpn, other, marking)
+		if err != nil {
+			return fmt.Errorf("failed to check priority of transition %s: %v", other.Name, err)
+		}
+		if enabled {
+			return fmt.Errorf("transition %s is disabled by higher-priority transition %s", transition.Name, other.Name)
+		}
+	}
+	return nil
+}
+
+// orderTransitions orders a conflict set of transitions according to the CPN's
+// transition policy. The first element is the transition that wins the conflict.
+func (e *Engine) orderTransitions(cpn *models.CPN, transitions []*models.Transition, marking *models.Marking) []*models.Transition {
+	ordered := make([]*models.Transition, len(transitions))
+	copy(ordered, transitions)
+	// Deterministic base order so random choices only depend on the seed
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].ID < ordered[j].ID })
+
+	switch cpn.ConflictResolution.TransitionPolicy() {
+	case models.ConflictPolicyRandom:
+		marking.Random().Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	case models.ConflictPolicyWeighted:
+		weights := make([]float64, len(ordered))
+		for i, t := range ordered {
+			weights[i] = t.GetWeight()
+		}
+		ordered = weightedPermutation(ordered, weights, marking.Random())
+	}
+	return ordered
+}
+
+// selectBinding picks one binding of an enabled transition according to the CPN's binding policy.
+// Returns a nil binding (and no error) when every binding has zero weight.
+func (e *Engine) selectBinding(cpn *models.CPN, transition *models.Transition, bindings []TokenBinding, marking *models.Marking) (TokenBinding, error) {
+	if len(bindings) == 0 {
+		return nil, fmt.Errorf("transition %s has no bindings", transition.Name)
+	}
+	if len(bindings) == 1 {
+		return bindings[0], nil
+	}
+
+	switch cpn.ConflictResolution.BindingPolicy() {
+	case models.ConflictPolicyRandom:
+		return bindings[marking.Random().Intn(len(bindings))], nil
+	case models.ConflictPolicyWeighted:
+		if transition.BindingWeight == "" {
+			return bindings[marking.Random().Intn(len(bindings))], nil
+		}
+		weights := make([]float64, len(bindings))
+		total := 0.0
+		for i, binding := range bindings {
+			context := e.createEvaluationContext(cpn, binding, marking)
+			result, err := e.evaluator.EvaluateArcExpression(transition.BindingWeight, context)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate binding weight of transition %s: %v", transition.Name, err)
+			}
+			weight, ok := toFloat(result)
+			if !ok || weight < 0 {
+				return nil, fmt.Errorf("binding weight of transition %s must be a non-negative number, got %v", transition.Name, result)
+			}
+			weights[i] = weight
+			total += weight
+		}
+		if total == 0 {
+			return nil, nil
+		}
+		return weightedPermutation(bindings, weights, marking.Random())[0], nil
+	default:
+		return bindings[0], nil
+	}
+}
+
+// weightedPermutation draws items without replacement with probability proportional to weight.
+// Items with zero weight are placed last, in their original order.
+func weightedPermutation[T any](items []T, weights []float64, rng *rand.Rand) []T {
+	remaining := make([]int, len(items))
+	for i := range remaining {
+		remaining[i] = i
+	}
+	result := make([]T, 0, len(items))
+	for len(remaining) > 0 {
+		total := 0.0
+		for _, idx := range remaining {
+			total += weights[idx]
+		}
+		pick := 0
+		if total > 0 {
+			r := rng.Float64() * total
+			for i, idx := range remaining {
+				if weights[idx] <= 0 {
+					continue
+				}
+				pick = i // last positive candidate absorbs floating point rounding
+				r -= weights[idx]
+				if r < 0 {
+					break
+				}
+			}
+		}
+		result = append(result, items[remaining[pick]])
+		remaining = append(remaining[:pick], remaining[pick+1:]...)
+	}
+	return result
+}
+
+// toFloat converts a numeric Lua result to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
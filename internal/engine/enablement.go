@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"go-petri-flow/internal/models"
+)
+
+// Incremental enablement: the bindings of each transition are cached on the marking together
+// with the versions of the transition's input places (see models.Marking.PlaceVersion). After a
+// firing only the transitions adjacent to places whose multisets changed are searched again.
+//
+// A cached entry also records whether its input places held tokens that were not yet available;
+// only then does a clock advance invalidate it. Entries of transitions reading globals of the net
+// are invalidated when an action assigns globals. Transitions whose guard or input arcs read the
+// places table, the global clock, draw random numbers or call functions declared by the net are
+// never cached.
+
+// enablementCache holds the cached bindings of the transitions of one CPN in one marking
+type enablementCache struct {
+	engine      *Engine
+	cpn         *models.CPN
+	arcs        int // structure of the CPN when the cache was created
+	transitions int
+	entries     map[*models.Transition]*enablementEntry
+}
+
+// enablementEntry caches the bindings of one transition
+type enablementEntry struct {
+	analysis *transitionAnalysis
+	places   []string // input places
+	timed    []bool   // whether the input places are timed
+	versions []uint64 // versions of the input places when bindings were computed (nil = not computed)
+	globals  uint64   // version of the net globals when bindings were computed (see Evaluator.NetVersion)
+	clock    int
+	pending  bool // timed input places held tokens with a timestamp after clock
+	bindings []TokenBinding
+}
+
+// SetIncrementalEnablement turns the enablement cache on (the default) or off.
+// With the cache off every enablement check searches the bindings of the transition again.
+func (e *Engine) SetIncrementalEnablement(enabled bool) {
+	e.fullRescan = !enabled
+}
+
+// enablement returns the enablement cache of a marking for a CPN, replacing a cache that was
+// built by another engine or for another (or since edited) CPN
+func (e *Engine) enablement(cpn *models.CPN, marking *models.Marking) *enablementCache {
+	cache, ok := marking.EngineState().(*enablementCache)
+	if !ok || cache.engine != e || cache.cpn != cpn || cache.arcs != len(cpn.Arcs) || cache.transitions != len(cpn.Transitions) {
+		cache = &enablementCache{
+			engine:      e,
+			cpn:         cpn,
+			arcs:        len(cpn.Arcs),
+			transitions: len(cpn.Transitions),
+			entries:     make(map[*models.Transition]*enablementEntry),
+		}
+		marking.SetEngineState(cache)
+	}
+	return cache
+}
+
+// entry returns the cache entry of a transition, or nil if its bindings must not be cached
+func (c *enablementCache) entry(transition *models.Transition) *enablementEntry {
+	if entry, ok := c.entries[transition]; ok {
+		if entry == nil || c.engine.analyses[keyOf(c.cpn, transition)] == entry.analysis {
+			return entry
+		}
+	}
+	inputs := c.cpn.GetInputArcs(transition.ID)
+	a := c.engine.analyze(c.cpn, transition, inputs)
+	if a.volatile {
+		c.entries[transition] = nil
+		return nil
+	}
+	entry := &enablementEntry{analysis: a}
+	seen := make(map[string]bool)
+	for _, arc := range inputs {
+		if placeID := arc.GetPlaceID(); !seen[placeID] {
+			seen[placeID] = true
+			entry.places = append(entry.places, placeID)
+			place := c.cpn.GetPlace(placeID)
+			entry.timed = append(entry.timed, place == nil || place.IsTimed())
+		}
+	}
+	c.entries[transition] = entry
+	return entry
+}
+
+// valid reports whether the cached bindings still hold in the marking and with the given version
+// of the net globals
+func (entry *enablementEntry) valid(marking *models.Marking, globals uint64) bool {
+	if entry.versions == nil || (entry.analysis.globals && entry.globals != globals) {
+		return false
+	}
+	if marking.GlobalClock != entry.clock && (entry.pending || marking.GlobalClock < entry.clock) {
+		return false
+	}
+	for i, placeID := range entry.places {
+		if marking.PlaceVersion(placeID) != entry.versions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// store records bindings computed in the marking with the given version of the net globals
+func (entry *enablementEntry) store(bindings []TokenBinding, marking *models.Marking, globals uint64) {
+	entry.bindings = bindings
+	entry.globals = globals
+	entry.clock = marking.GlobalClock
+	entry.pending = false
+	entry.versions = make([]uint64, len(entry.places))
+	for i, placeID := range entry.places {
+		entry.versions[i] = marking.PlaceVersion(placeID)
+		if !entry.timed[i] {
+			continue
+		}
+		for _, tokens := range marking.Places[placeID] {
+			for _, token := range tokens {
+				if token.Timestamp > marking.GlobalClock {
+					entry.pending = true
+				}
+			}
+		}
+	}
+}
+
+// transitionBindings returns all bindings of a transition, from the cache when it is still valid
+func (e *Engine) transitionBindings(cpn *models.CPN, transition *models.Transition, marking *models.Marking) ([]TokenBinding, error) {
+	if e.fullRescan {
+		return e.FindBindings(cpn, transition, marking, 0)
+	}
+	entry := e.enablement(cpn, marking).entry(transition)
+	globals := e.evaluator.NetVersion(cpn)
+	if entry != nil && entry.valid(marking, globals) {
+		return entry.bindings, nil
+	}
+	bindings, err := e.FindBindings(cpn, transition, marking, 0)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		// The search may have loaded the declarations of the net
+		entry.store(bindings, marking, e.evaluator.NetVersion(cpn))
+	}
+	return bindings, nil
+}
+
+// cachedBindings returns the cached bindings of a transition if they are still valid
+func (e *Engine) cachedBindings(cpn *models.CPN, transition *models.Transition, marking *models.Marking) ([]TokenBinding, bool) {
+	if e.fullRescan {
+		return nil, false
+	}
+	entry := e.enablement(cpn, marking).entry(transition)
+	if entry == nil || !entry.valid(marking, e.evaluator.NetVersion(cpn)) {
+		return nil, false
+	}
+	return entry.bindings, true
+}
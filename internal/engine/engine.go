@@ -1,8 +1,10 @@
 package engine
 
 import (
+	"context"
 	"fmt"
-	"sort"
+	"math"
+	"strings"
 
 	"go-petri-flow/internal/expression"
 	"go-petri-flow/internal/models"
@@ -10,13 +12,38 @@ import (
 
 // Engine represents the CPN simulation engine
 type Engine struct {
-	evaluator *expression.Evaluator
+	evaluator      *expression.Evaluator
+	budget         Budget // limits of FireEnabledTransitions runs
+	listeners      []firingListenerEntry
+	nextListenerID int
+	analyses       map[analysisKey]*transitionAnalysis // binding search analysis per transition of a CPN version
+	fullRescan     bool                                // disables the enablement cache
+}
+
+// FiringEvent describes a completed transition firing
+type FiringEvent struct {
+	CPN        *models.CPN
+	Transition *models.Transition
+	Binding    TokenBinding
+	Consumed   map[string][]*models.Token // place ID -> consumed tokens
+	Produced   map[string][]*models.Token // place ID -> produced tokens
+	Clock      int                        // global clock at the time of firing
+	Step       int                        // step counter after the firing
+}
+
+// FiringListener is notified after every successful transition firing
+type FiringListener func(event *FiringEvent)
+
+type firingListenerEntry struct {
+	id       int
+	listener FiringListener
 }
 
 // NewEngine creates a new CPN simulation engine
 func NewEngine() *Engine {
 	return &Engine{
 		evaluator: expression.NewEvaluator(),
+		budget:    DefaultBudget,
 	}
 }
 
@@ -27,300 +54,316 @@ func (e *Engine) Close() {
 	}
 }
 
-// EvaluatorAccessor returns internal evaluator (read-only) for auxiliary operations (e.g., deferred emissions)
-func (e *Engine) EvaluatorAccessor() *expression.Evaluator { return e.evaluator }
-
-// TokenBinding represents a binding of variables to tokens
-type TokenBinding map[string]*models.Token
-
-// IsEnabled checks if a transition is enabled given the current marking
-func (e *Engine) IsEnabled(cpn *models.CPN, transition *models.Transition, marking *models.Marking) (bool, []TokenBinding, error) {
-	// Get input arcs for the transition
-	inputArcs := cpn.GetInputArcs(transition.ID)
-	if len(inputArcs) == 0 {
-		// Transition with no input arcs is always enabled if guard passes
-		guardPassed, err := e.checkGuard(transition, TokenBinding{}, marking)
-		if err != nil {
-			return false, nil, err
-		}
-		if guardPassed {
-			return true, []TokenBinding{{}}, nil
+// AddFiringListener registers a listener for transition firings and returns a function that removes it
+func (e *Engine) AddFiringListener(listener FiringListener) func() {
+	e.nextListenerID++
+	id := e.nextListenerID
+	e.listeners = append(e.listeners, firingListenerEntry{id: id, listener: listener})
+	return func() {
+		for i, entry := range e.listeners {
+			if entry.id == id {
+				e.listeners = append(e.listeners[:i], e.listeners[i+1:]...)
+				return
+			}
 		}
-		return false, nil, nil
-	}
-
-	// Find all possible token bindings
-	bindings, err := e.findTokenBindings(cpn, transition, inputArcs, marking)
-	if err != nil {
-		return false, nil, fmt.Errorf("failed to find token bindings: %v", err)
 	}
+}
 
-	if len(bindings) == 0 {
-		return false, nil, nil
+// RegisterFunction exposes a Go function to guards, arc expressions and actions
+func (e *Engine) RegisterFunction(fn expression.Function) error {
+	if err := e.evaluator.RegisterFunction(fn); err != nil {
+		return err
 	}
+	// Analyses tell Go functions from functions declared by nets
+	e.analyses = nil
+	return nil
+}
 
-	// Filter bindings that satisfy the guard
-	var validBindings []TokenBinding
-	for _, binding := range bindings {
-		guardPassed, err := e.checkGuard(transition, binding, marking)
-		if err != nil {
-			return false, nil, fmt.Errorf("failed to check guard: %v", err)
-		}
-		if guardPassed {
-			validBindings = append(validBindings, binding)
-		}
-	}
+// Functions returns the Go functions registered with the engine
+func (e *Engine) Functions() []expression.Function {
+	return e.evaluator.Functions()
+}
 
-	return len(validBindings) > 0, validBindings, nil
+// LoadDeclarations compiles the net-level Lua declarations of a CPN. Declarations are otherwise
+// compiled on the first evaluation of the CPN; loading them up front reports errors early.
+func (e *Engine) LoadDeclarations(cpn *models.CPN) error {
+	return e.evaluator.LoadDeclarations(cpn)
 }
 
-// FireTransition fires a transition with the given binding
-func (e *Engine) FireTransition(cpn *models.CPN, transition *models.Transition, binding TokenBinding, marking *models.Marking) error {
-	// Verify the transition is enabled with this binding
-	enabled, _, err := e.IsEnabled(cpn, transition, marking)
-	if err != nil {
-		return fmt.Errorf("failed to check if transition is enabled: %v", err)
-	}
-	if !enabled {
-		return fmt.Errorf("transition %s is not enabled", transition.Name)
-	}
+// UnloadDeclarations discards the compiled declarations of all versions of a CPN
+func (e *Engine) UnloadDeclarations(cpnID string) {
+	e.evaluator.UnloadDeclarations(cpnID)
+}
 
-	// Create evaluation context
-	context := e.createEvaluationContext(binding, marking)
+// UnloadCPN discards everything the engine keeps for a CPN: its declarations, the inscriptions
+// compiled for it and the binding search analyses of all its versions
+func (e *Engine) UnloadCPN(cpnID string) {
+	e.evaluator.UnloadDeclarations(cpnID)
+	e.evaluator.ReleaseNet(cpnID)
+	e.dropAnalyses(cpnID, 0)
+}
 
-	// Process input arcs (consume tokens)
-	inputArcs := cpn.GetInputArcs(transition.ID)
-	for _, arc := range inputArcs {
-		count := arc.Multiplicity
-		if count <= 0 {
-			count = 1
-		}
-		for i := 0; i < count; i++ {
-			if err := e.processInputArc(cpn, arc, context, marking); err != nil {
-				return fmt.Errorf("failed to process input arc %s (instance %d/%d): %v", arc.ID, i+1, count, err)
-			}
-		}
+// UnloadCPNVersion discards the declarations, compiled inscriptions and binding search analyses
+// of a retired version of a CPN
+func (e *Engine) UnloadCPNVersion(cpnID string, version int) {
+	if version > 0 {
+		e.evaluator.UnloadDeclarationsVersion(cpnID, version)
+		e.evaluator.ReleaseNetVersion(cpnID, version)
+		e.dropAnalyses(cpnID, version)
 	}
+}
 
-	// Advance global clock if transition has delay
-	if transition.TransitionDelay > 0 {
-		marking.AdvanceGlobalClock(marking.GlobalClock + transition.TransitionDelay)
-	}
+// EvaluatorAccessor returns internal evaluator (read-only) for auxiliary operations (e.g., deferred emissions)
+func (e *Engine) EvaluatorAccessor() *expression.Evaluator { return e.evaluator }
 
-	// Execute transition action (side-effect expression) if present and capture mutated variables
-	if transition.HasAction() {
-		if err := e.evaluator.EvaluateAction(transition.ActionExpression, context); err != nil {
-			return fmt.Errorf("failed to execute action for transition %s: %v", transition.Name, err)
-		}
-		// After action, pull back Lua globals for each bound variable
-		for varName, tk := range context.TokenBindings {
-			if tk == nil {
-				continue
-			}
-			if goVal := e.evaluator.GetGlobalValue(varName); goVal != nil {
-				tk.Value = goVal
-			}
-		}
-	}
+// TokenBinding represents a binding of variables to tokens
+type TokenBinding map[string]*models.Token
 
-	// Skip immediate output arc processing if this transition is a hierarchical call (deferred by manager)
-	if cpn.GetSubWorkflowByTransition(transition.ID) == nil {
-		outputArcs := cpn.GetOutputArcs(transition.ID)
-		for _, arc := range outputArcs {
-			count := arc.Multiplicity
-			if count <= 0 {
-				count = 1
-			}
-			for i := 0; i < count; i++ {
-				if err := e.processOutputArc(cpn, arc, context, marking); err != nil {
-					return fmt.Errorf("failed to process output arc %s (instance %d/%d): %v", arc.ID, i+1, count, err)
-				}
-			}
-		}
+// IsEnabled checks if a transition is enabled given the current marking and returns all of its bindings.
+// Bindings are cached on the marking until a token in one of the transition's input places changes;
+// callers must not modify the returned slice.
+func (e *Engine) IsEnabled(cpn *models.CPN, transition *models.Transition, marking *models.Marking) (bool, []TokenBinding, error) {
+	bindings, err := e.transitionBindings(cpn, transition, marking)
+	if err != nil {
+		return false, nil, err
 	}
+	return len(bindings) > 0, bindings, nil
+}
 
-	// Increment step counter for each successful transition firing
-	marking.StepCounter++
-
-	return nil
+// FireTransition fires a transition with the given binding
+func (e *Engine) FireTransition(cpn *models.CPN, transition *models.Transition, binding TokenBinding, marking *models.Marking) error {
+	return e.fireTransition(cpn, transition, binding, marking, nil, true)
 }
 
 // FireTransitionWithData fires a transition injecting external formData variables into the evaluation context
 func (e *Engine) FireTransitionWithData(cpn *models.CPN, transition *models.Transition, binding TokenBinding, marking *models.Marking, formData map[string]interface{}) error {
-	// Basic path if no extra data
-	if len(formData) == 0 {
-		return e.FireTransition(cpn, transition, binding, marking)
-	}
+	return e.fireTransition(cpn, transition, binding, marking, formData, true)
+}
 
-	// Verify enabled
-	enabled, _, err := e.IsEnabled(cpn, transition, marking)
-	if err != nil {
-		return fmt.Errorf("failed to check if transition is enabled: %v", err)
+// fireTransition implements transition firing. When verify is false the caller guarantees the
+// binding was just computed for this marking (e.g. by GetEnabledTransitions), so enablement and
+// priority are not re-checked; this also keeps guards that draw random numbers from being re-sampled.
+func (e *Engine) fireTransition(cpn *models.CPN, transition *models.Transition, binding TokenBinding, marking *models.Marking, formData map[string]interface{}, verify bool) (err error) {
+	if verify {
+		// Verify the transition is enabled
+		enabled, err := e.hasBinding(cpn, transition, marking)
+		if err != nil {
+			return fmt.Errorf("failed to check if transition is enabled: %v", err)
+		}
+		if !enabled {
+			return fmt.Errorf("transition %s is not enabled", transition.Name)
+		}
+		if err := e.checkPriority(cpn, transition, marking); err != nil {
+			return err
+		}
 	}
-	if !enabled {
-		return fmt.Errorf("transition %s is not enabled", transition.Name)
+
+	// Create evaluation context
+	context := e.createEvaluationContext(cpn, binding, marking)
+
+	// A failed firing leaves no trace: values drawn from the marking's random source and changes
+	// the action or declared functions made to the globals of the CPN are undone
+	random := marking.RandomState()
+	var savepoint *expression.Savepoint
+	if e.mayChangeGlobals(cpn, transition) {
+		if savepoint, err = e.evaluator.Savepoint(context); err != nil {
+			return fmt.Errorf("failed to save the globals of %s: %v", cpn.Name, err)
+		}
 	}
+	defer func() {
+		if err != nil {
+			marking.RestoreRandom(random)
+			savepoint.Rollback()
+		} else {
+			savepoint.Release()
+		}
+	}()
 
-	// Create evaluation context with existing binding
-	context := e.createEvaluationContext(binding, marking)
+	// Actions and output arcs that read places see them as they were before consumption
+	if readsPlaces(cpn, transition) {
+		for placeID := range marking.Places {
+			context.SetPlaceTokens(placeID, marking.GetTokens(placeID))
+		}
+	}
 
 	// Inject form data as variable bindings
-	if len(formData) > 0 {
-		for k, v := range formData {
-			context.SetValue(k, v)
-		}
+	for k, v := range formData {
+		context.SetValue(k, v)
 	}
 
-	// Process input arcs
-	inputArcs := cpn.GetInputArcs(transition.ID)
-	for _, arc := range inputArcs {
+	// A firing is all-or-nothing: inputs, the action and outputs are evaluated and validated
+	// first, and the marking is only changed once nothing can fail anymore
+	firingClock := marking.GlobalClock
+
+	// Evaluate input arcs and check that all of their tokens are available
+	var inputs []arcTokens
+	required := make(map[string]map[string]int) // place ID -> value key -> tokens
+	for _, arc := range cpn.GetInputArcs(transition.ID) {
 		count := arc.Multiplicity
 		if count <= 0 {
 			count = 1
 		}
+		placeID := arc.GetPlaceID()
+		available := availableAt(cpn, placeID, firingClock)
 		for i := 0; i < count; i++ {
-			if err := e.processInputArc(cpn, arc, context, marking); err != nil {
+			values, err := e.inputArcValues(cpn, arc, context)
+			if err == nil {
+				if required[placeID] == nil {
+					required[placeID] = make(map[string]int)
+				}
+				for _, value := range values {
+					key := models.ValueKey(value)
+					required[placeID][key]++
+					if marking.CountAvailableTokensWithValue(placeID, value, available) < required[placeID][key] {
+						err = fmt.Errorf("no token with value %v available in place %s", value, placeID)
+						break
+					}
+				}
+			}
+			if err != nil {
 				return fmt.Errorf("failed to process input arc %s (instance %d/%d): %v", arc.ID, i+1, count, err)
 			}
+			inputs = append(inputs, arcTokens{placeID: placeID, values: values, available: available})
 		}
 	}
 
-	if transition.TransitionDelay > 0 {
-		marking.AdvanceGlobalClock(marking.GlobalClock + transition.TransitionDelay)
-	}
-
+	// Execute transition action (side-effect expression) if present and capture mutated variables.
+	// Its global assignments are committed with the firing.
+	var effects *expression.ActionEffects
+	updated := make(map[*models.Token]interface{})
 	if transition.HasAction() {
-		if err := e.evaluator.EvaluateAction(transition.ActionExpression, context); err != nil {
+		var err error
+		effects, err = e.evaluator.RunAction(transition.ActionExpression, context)
+		if err != nil {
 			return fmt.Errorf("failed to execute action for transition %s: %v", transition.Name, err)
 		}
+		// Output arcs see the variables as the action left them
+		context.Action = effects
 		for varName, tk := range context.TokenBindings {
 			if tk == nil {
 				continue
 			}
-			if goVal := e.evaluator.GetGlobalValue(varName); goVal != nil {
-				tk.Value = goVal
+			if goVal := effects.Value(varName); goVal != nil {
+				updated[tk] = goVal
 			}
 		}
 	}
 
+	// Evaluate and validate output tokens. Skipped if this transition is a hierarchical call (deferred by manager)
+	var outputs []arcTokens
 	if cpn.GetSubWorkflowByTransition(transition.ID) == nil {
-		outputArcs := cpn.GetOutputArcs(transition.ID)
-		for _, arc := range outputArcs {
+		for _, arc := range cpn.GetOutputArcs(transition.ID) {
 			count := arc.Multiplicity
 			if count <= 0 {
 				count = 1
 			}
 			for i := 0; i < count; i++ {
-				if err := e.processOutputArc(cpn, arc, context, marking); err != nil {
+				tokens, err := e.outputArcTokens(cpn, arc, context, firingClock, transition.TransitionDelay)
+				if err != nil {
 					return fmt.Errorf("failed to process output arc %s (instance %d/%d): %v", arc.ID, i+1, count, err)
 				}
+				outputs = append(outputs, arcTokens{placeID: arc.GetPlaceID(), tokens: tokens})
 			}
 		}
 	}
 
-	marking.StepCounter++
-	return nil
-}
-
-// AdvanceGlobalClock advances the global clock to the next earliest token timestamp
-func (e *Engine) AdvanceGlobalClock(marking *models.Marking) {
-	earliest := marking.GetEarliestTimestamp()
-	if earliest > marking.GlobalClock {
-		marking.AdvanceGlobalClock(earliest)
+	// Apply the firing
+	consumed := make(map[string][]*models.Token)
+	produced := make(map[string][]*models.Token)
+	for _, in := range inputs {
+		for _, value := range in.values {
+			consumed[in.placeID] = append(consumed[in.placeID], marking.RemoveAvailableTokenByValue(in.placeID, value, in.available))
+		}
 	}
-}
-
-// findTokenBindings finds all possible token bindings for a transition
-func (e *Engine) findTokenBindings(cpn *models.CPN, transition *models.Transition, inputArcs []*models.Arc, marking *models.Marking) ([]TokenBinding, error) {
-	if len(inputArcs) == 0 {
-		return []TokenBinding{{}}, nil
+	for _, out := range outputs {
+		for _, token := range out.tokens {
+			marking.AddToken(out.placeID, token)
+		}
+		produced[out.placeID] = append(produced[out.placeID], out.tokens...)
 	}
-
-	// Start with the first arc and recursively build bindings
-	return e.findBindingsRecursive(cpn, inputArcs, 0, TokenBinding{}, marking)
-}
-
-// findBindingsRecursive recursively finds token bindings for input arcs
-func (e *Engine) findBindingsRecursive(cpn *models.CPN, arcs []*models.Arc, arcIndex int, currentBinding TokenBinding, marking *models.Marking) ([]TokenBinding, error) {
-	if arcIndex >= len(arcs) {
-		// Base case: all arcs processed
-		return []TokenBinding{currentBinding}, nil
+	if effects != nil {
+		effects.Commit()
 	}
-
-	arc := arcs[arcIndex]
-	place := cpn.GetPlace(arc.GetPlaceID())
-	if place == nil {
-		return nil, fmt.Errorf("place %s not found", arc.GetPlaceID())
+	for tk, value := range updated {
+		tk.Value = value
 	}
 
-	// Get available tokens in the place
-	availableTokens := marking.GetAvailableTokensAtTime(place.ID, marking.GlobalClock)
-	if len(availableTokens) == 0 {
-		return []TokenBinding{}, nil
-	}
+	// Increment step counter for each successful transition firing
+	marking.StepCounter++
 
-	var allBindings []TokenBinding
+	if len(e.listeners) > 0 || len(cpn.Monitors) > 0 {
+		event := &FiringEvent{
+			CPN:        cpn,
+			Transition: transition,
+			Binding:    binding,
+			Consumed:   consumed,
+			Produced:   produced,
+			Clock:      firingClock,
+			Step:       marking.StepCounter,
+		}
+		e.applyMonitors(event, marking)
+		for _, entry := range e.listeners {
+			entry.listener(event)
+		}
+	}
 
-	// Try each available token
-	for _, token := range availableTokens {
-		// Create a new binding with this token
-		newBinding := e.cloneBinding(currentBinding)
+	return nil
+}
 
-		// Fast path: simple variable expression (e.g., "x") binds directly without evaluation
-		if isSimpleVariable(arc.Expression) {
-			newBinding[arc.Expression] = token
-			subBindings, err := e.findBindingsRecursive(cpn, arcs, arcIndex+1, newBinding, marking)
-			if err != nil {
-				continue
-			}
-			allBindings = append(allBindings, subBindings...)
-			continue
+// mayChangeGlobals reports whether firing a transition may change globals of its CPN: actions
+// assign them and declared functions called by the action or arc expressions may do so
+func (e *Engine) mayChangeGlobals(cpn *models.CPN, transition *models.Transition) bool {
+	if transition.HasAction() {
+		return true
+	}
+	for _, arc := range cpn.GetInputArcs(transition.ID) {
+		if e.callsNetFunctions(arc.Expression) {
+			return true
+		}
+	}
+	for _, arc := range cpn.GetOutputArcs(transition.ID) {
+		if e.callsNetFunctions(arc.Expression) {
+			return true
 		}
+	}
+	return false
+}
 
-		// General path: evaluate expression in context
-		context := e.createEvaluationContext(newBinding, marking)
-		context.BindVariable("token", token)
-		result, err := e.evaluator.EvaluateArcExpression(arc.Expression, context)
-		if err != nil {
+// NextEventTime returns the earliest timestamp after the global clock of a token in a timed place,
+// -1 if there is none
+func (e *Engine) NextEventTime(cpn *models.CPN, marking *models.Marking) int {
+	next := -1
+	for _, place := range cpn.Places {
+		if !place.IsTimed() {
 			continue
 		}
-		if e.tokenMatches(token, result) {
-			if err := e.extractVariableBindings(arc.Expression, token, newBinding); err != nil {
-				continue
+		for _, token := range marking.GetTokens(place.ID) {
+			if token.Timestamp > marking.GlobalClock && (next == -1 || token.Timestamp < next) {
+				next = token.Timestamp
 			}
-			subBindings, err := e.findBindingsRecursive(cpn, arcs, arcIndex+1, newBinding, marking)
-			if err != nil {
-				continue
-			}
-			allBindings = append(allBindings, subBindings...)
 		}
 	}
-
-	return allBindings, nil
+	return next
 }
 
-// extractVariableBindings extracts variable bindings from an arc expression
-func (e *Engine) extractVariableBindings(expression string, token *models.Token, binding TokenBinding) error {
-	// For simple expressions like "x", bind the variable to the token
-	// For complex expressions, this would need more sophisticated parsing
-
-	// Simple case: if expression is just a variable name
-	if isSimpleVariable(expression) {
-		binding[expression] = token
-		return nil
+// advanceClock lets time pass to the next event (see NextEventTime). Callers only advance the
+// clock when no transition is enabled at the current time. Reports whether the clock moved.
+func (e *Engine) advanceClock(cpn *models.CPN, marking *models.Marking) bool {
+	next := e.NextEventTime(cpn, marking)
+	if next < 0 {
+		return false
 	}
-
-	// For more complex expressions, we would need to parse and match patterns
-	// For now, we'll handle the most common cases
-
-	return nil
+	marking.AdvanceGlobalClock(next)
+	return true
 }
 
-// tokenMatches checks if a token matches the result of an arc expression
-func (e *Engine) tokenMatches(token *models.Token, result interface{}) bool {
-	// For simple variable expressions, we want to bind the variable to the token
-	// So we return true to indicate a match
-	return true
+// availableAt returns the time up to which tokens of a place are available at clock: untimed
+// places ignore timestamps
+func availableAt(cpn *models.CPN, placeID string, clock int) int {
+	if place := cpn.GetPlace(placeID); place != nil && !place.IsTimed() {
+		return math.MaxInt
+	}
+	return clock
 }
 
 // isSimpleVariable checks if an expression is just a simple variable name
@@ -349,98 +392,147 @@ func contains(s, substr string) bool {
 			(len(s) > 0 && (s[:len(substr)] == substr || contains(s[1:], substr))))
 }
 
-// checkGuard evaluates the guard expression for a transition
-func (e *Engine) checkGuard(transition *models.Transition, binding TokenBinding, marking *models.Marking) (bool, error) {
-	if !transition.HasGuard() {
-		return true, nil
-	}
-
-	context := e.createEvaluationContext(binding, marking)
-	return e.evaluator.EvaluateGuard(transition.GuardExpression, context)
+// arcTokens are the tokens a firing consumes from (values, available up to a time) or produces
+// in (tokens) a place
+type arcTokens struct {
+	placeID   string
+	values    []interface{}
+	available int
+	tokens    []*models.Token
 }
 
-// processInputArc processes an input arc (consumes tokens)
-func (e *Engine) processInputArc(cpn *models.CPN, arc *models.Arc, context *expression.EvaluationContext, marking *models.Marking) error {
-	place := cpn.GetPlace(arc.GetPlaceID())
-	if place == nil {
-		return fmt.Errorf("place %s not found", arc.GetPlaceID())
+// inputArcValues evaluates an input arc and returns the values of the tokens it consumes.
+// A multiset inscription consumes one token per element.
+func (e *Engine) inputArcValues(cpn *models.CPN, arc *models.Arc, context *expression.EvaluationContext) ([]interface{}, error) {
+	if cpn.GetPlace(arc.GetPlaceID()) == nil {
+		return nil, fmt.Errorf("place %s not found", arc.GetPlaceID())
 	}
 
 	// Evaluate the arc expression to determine which tokens to consume
 	result, err := e.evaluator.EvaluateArcExpression(arc.Expression, context)
 	if err != nil {
-		return fmt.Errorf("failed to evaluate input arc expression: %v", err)
+		return nil, fmt.Errorf("failed to evaluate input arc expression: %v", err)
 	}
-
-	// Remove the token from the place
-	token := marking.RemoveTokenByValue(place.ID, result)
-	if token == nil {
-		return fmt.Errorf("no token with value %v found in place %s", result, place.Name)
+	ms, ok := result.(expression.MultisetValue)
+	if !ok {
+		return []interface{}{result}, nil
 	}
-
-	return nil
+	values := make([]interface{}, len(ms))
+	for i, element := range ms {
+		values[i], _ = tokenValue(element)
+	}
+	return values, nil
 }
 
-// processOutputArc processes an output arc (produces tokens)
-func (e *Engine) processOutputArc(cpn *models.CPN, arc *models.Arc, context *expression.EvaluationContext, marking *models.Marking) error {
+// outputArcTokens evaluates an output arc and returns the tokens it produces, validated against the
+// place's color set. A multiset inscription produces one token per element. Tokens of timed places
+// are timestamped clock + delay + their own delay (delay() or @+); those of untimed places carry
+// the clock.
+func (e *Engine) outputArcTokens(cpn *models.CPN, arc *models.Arc, context *expression.EvaluationContext, clock, delay int) ([]*models.Token, error) {
 	place := cpn.GetPlace(arc.GetPlaceID())
 	if place == nil {
-		return fmt.Errorf("place %s not found", arc.GetPlaceID())
+		return nil, fmt.Errorf("place %s not found", arc.GetPlaceID())
 	}
 
 	// Evaluate the arc expression to determine what tokens to produce
 	result, err := e.evaluator.EvaluateArcExpression(arc.Expression, context)
 	if err != nil {
-		return fmt.Errorf("failed to evaluate output arc expression: %v", err)
+		return nil, fmt.Errorf("failed to evaluate output arc expression: %v", err)
 	}
 
-	// Handle delayed tokens (if result contains delay information)
-	timestamp := marking.GlobalClock
-	value := result
+	elements := []interface{}{result}
+	if ms, ok := result.(expression.MultisetValue); ok {
+		elements = ms
+	}
+	tokens := make([]*models.Token, 0, len(elements))
+	for _, element := range elements {
+		value, elementDelay := tokenValue(element)
+		timestamp := clock
+		if place.IsTimed() {
+			timestamp += delay + elementDelay
+		}
+		newToken := models.NewToken(value, timestamp)
+		if err := place.ValidateToken(newToken); err != nil {
+			return nil, fmt.Errorf("invalid token for place %s: %v", place.Name, err)
+		}
+		tokens = append(tokens, newToken)
+	}
+	return tokens, nil
+}
 
-	// Check if result is a delayed token (table with value and delay)
+// tokenValue splits an arc expression result into the token value and its delay
+// (results of delay(value, d) are tables with value and delay)
+func tokenValue(result interface{}) (interface{}, int) {
+	value, delay := result, 0
 	if resultMap, ok := result.(map[string]interface{}); ok {
 		if delayVal, hasDelay := resultMap["delay"]; hasDelay {
-			if delay, ok := delayVal.(int); ok {
-				timestamp += delay
+			if d, ok := toDelay(delayVal); ok {
+				delay = d
 			}
 		}
 		if val, hasValue := resultMap["value"]; hasValue {
 			value = val
 		}
 	}
+	return value, delay
+}
 
-	// Create and add the new token
-	newToken := models.NewToken(value, timestamp)
-
-	// Validate the token against the place's color set
-	if err := place.ValidateToken(newToken); err != nil {
-		return fmt.Errorf("invalid token for place %s: %v", place.Name, err)
+// ProduceOutputArc evaluates an output arc under a binding and adds the produced tokens to the
+// marking. It is used to emit outputs outside a regular firing (e.g. sub-workflow completion).
+func (e *Engine) ProduceOutputArc(cpn *models.CPN, arc *models.Arc, binding TokenBinding, marking *models.Marking) ([]*models.Token, error) {
+	tokens, err := e.outputArcTokens(cpn, arc, e.createEvaluationContext(cpn, binding, marking), marking.GlobalClock, 0)
+	if err != nil {
+		return nil, err
 	}
-
-	marking.AddToken(place.ID, newToken)
-	return nil
+	for _, token := range tokens {
+		marking.AddToken(arc.GetPlaceID(), token)
+	}
+	return tokens, nil
 }
 
-// createEvaluationContext creates an evaluation context from a token binding and marking
-func (e *Engine) createEvaluationContext(binding TokenBinding, marking *models.Marking) *expression.EvaluationContext {
+// createEvaluationContext creates an evaluation context for a CPN from a token binding and marking
+func (e *Engine) createEvaluationContext(cpn *models.CPN, binding TokenBinding, marking *models.Marking) *expression.EvaluationContext {
 	context := expression.NewEvaluationContext()
+	context.CPN = cpn
 	context.SetGlobalClock(marking.GlobalClock)
+	context.Random = marking.Random()
 
 	// Add token bindings
 	for varName, token := range binding {
 		context.BindVariable(varName, token)
 	}
 
-	// Add place tokens for complex expressions
-	for placeID := range marking.Places {
-		tokens := marking.GetTokens(placeID)
-		context.SetPlaceTokens(placeID, tokens)
-	}
+	// Place tokens for complex expressions are read from the marking on access
+	context.Marking = marking
 
 	return context
 }
 
+// readsPlaces reports whether the action or an output arc of a transition refers to the places table
+func readsPlaces(cpn *models.CPN, transition *models.Transition) bool {
+	if strings.Contains(transition.ActionExpression, "places") {
+		return true
+	}
+	for _, arc := range cpn.GetOutputArcs(transition.ID) {
+		if strings.Contains(arc.Expression, "places") {
+			return true
+		}
+	}
+	return false
+}
+
+// toDelay converts a delay value to model time units; real delays (e.g. from exponential())
+// are rounded to the nearest time unit and negative delays are rejected
+func toDelay(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, v >= 0
+	case float64:
+		return int(math.Round(v)), v >= 0
+	}
+	return 0, false
+}
+
 // cloneBinding creates a copy of a token binding
 func (e *Engine) cloneBinding(binding TokenBinding) TokenBinding {
 	clone := make(TokenBinding)
@@ -450,7 +542,8 @@ func (e *Engine) cloneBinding(binding TokenBinding) TokenBinding {
 	return clone
 }
 
-// GetEnabledTransitions returns all enabled transitions in the CPN
+// GetEnabledTransitions returns all enabled transitions in the CPN.
+// Only transitions of the highest enabled priority class are returned (CPN Tools priority semantics).
 func (e *Engine) GetEnabledTransitions(cpn *models.CPN, marking *models.Marking) ([]*models.Transition, map[string][]TokenBinding, error) {
 	var enabledTransitions []*models.Transition
 	bindingsMap := make(map[string][]TokenBinding)
@@ -467,12 +560,40 @@ func (e *Engine) GetEnabledTransitions(cpn *models.CPN, marking *models.Marking)
 		}
 	}
 
+	// Drop transitions disabled by an enabled transition of higher priority
+	enabledTransitions = filterByPriority(enabledTransitions)
+	kept := make(map[string]bool, len(enabledTransitions))
+	for _, t := range enabledTransitions {
+		kept[t.ID] = true
+	}
+	for id := range bindingsMap {
+		if !kept[id] {
+			delete(bindingsMap, id)
+		}
+	}
+
 	return enabledTransitions, bindingsMap, nil
 }
 
-// FireEnabledTransitions fires all enabled automatic transitions
+// FireEnabledTransitions fires all enabled automatic transitions within the engine's budget
+// Stops early when a breakpoint monitor triggers (see models.MonitorResults.PendingBreakpoint).
 func (e *Engine) FireEnabledTransitions(cpn *models.CPN, marking *models.Marking) (int, error) {
+	return e.FireEnabledTransitionsWithBudget(cpn, marking, e.budget)
+}
+
+// FireEnabledTransitionsWithBudget fires all enabled automatic transitions until none is enabled or the
+// budget is exhausted. In the latter case the firings done so far are kept and a *BudgetExceededError
+// with a livelock diagnosis is returned together with the number of firings.
+func (e *Engine) FireEnabledTransitionsWithBudget(cpn *models.CPN, marking *models.Marking, budget Budget) (int, error) {
+	return e.FireEnabledTransitionsContext(context.Background(), cpn, marking, budget)
+}
+
+// FireEnabledTransitionsContext is FireEnabledTransitionsWithBudget that also stops once ctx is done,
+// keeping the firings done so far and returning the context's error.
+func (e *Engine) FireEnabledTransitionsContext(ctx context.Context, cpn *models.CPN, marking *models.Marking, budget Budget) (int, error) {
 	firedCount := 0
+	marking.Monitors.ClearBreakpoint()
+	tracker := newBudgetTracker(budget, marking)
 
 	for {
 		enabledTransitions, bindingsMap, err := e.GetEnabledTransitions(cpn, marking)
@@ -489,24 +610,44 @@ func (e *Engine) FireEnabledTransitions(cpn *models.CPN, marking *models.Marking
 		}
 
 		if len(automaticTransitions) == 0 {
+			// Time passes only when no transition is enabled now
+			if len(enabledTransitions) == 0 && e.advanceClock(cpn, marking) {
+				continue
+			}
 			break // No more automatic transitions to fire
 		}
+		if err := tracker.check(marking); err != nil {
+			return firedCount, err
+		}
+		if err := ctx.Err(); err != nil {
+			return firedCount, err
+		}
 
-		// Sort transitions by priority (for deterministic execution)
-		sort.Slice(automaticTransitions, func(i, j int) bool {
-			return automaticTransitions[i].ID < automaticTransitions[j].ID
-		})
-
-		// Fire the first enabled automatic transition
-		transition := automaticTransitions[0]
-		bindings := bindingsMap[transition.ID]
-
-		if len(bindings) > 0 {
-			// Use the first available binding
-			if err := e.FireTransition(cpn, transition, bindings[0], marking); err != nil {
+		// Resolve the conflict between enabled automatic transitions (all share the highest priority):
+		// fire the first transition in policy order that has a selectable binding
+		fired := false
+		for _, transition := range e.orderTransitions(cpn, automaticTransitions, marking) {
+			bindings := bindingsMap[transition.ID]
+			if len(bindings) == 0 {
+				continue
+			}
+			binding, err := e.selectBinding(cpn, transition, bindings, marking)
+			if err != nil {
+				return firedCount, err
+			}
+			if binding == nil {
+				continue
+			}
+			if err := e.fireTransition(cpn, transition, binding, marking, nil, false); err != nil {
 				return firedCount, fmt.Errorf("failed to fire transition %s: %v", transition.Name, err)
 			}
 			firedCount++
+			fired = true
+			tracker.record(transition.ID, marking)
+			break
+		}
+		if !fired || marking.Monitors.PendingBreakpoint() != nil {
+			break
 		}
 	}
 
@@ -514,9 +655,16 @@ func (e *Engine) FireEnabledTransitions(cpn *models.CPN, marking *models.Marking
 }
 
 // SimulateStep performs one simulation step (fire all enabled automatic transitions)
+// If no transition is enabled at the current time, the clock first advances from token time to
+// token time (see NextEventTime) until a transition is enabled.
+// A triggered breakpoint monitor ends the step after the firing that triggered it.
 func (e *Engine) SimulateStep(cpn *models.CPN, marking *models.Marking) (int, error) {
-	// Advance global clock if needed (bring earliest future tokens into scope)
-	e.AdvanceGlobalClock(marking)
+	return e.simulateStep(cpn, marking, true)
+}
+
+// simulateStep is SimulateStep; advance selects whether the step may let time pass
+func (e *Engine) simulateStep(cpn *models.CPN, marking *models.Marking, advance bool) (int, error) {
+	marking.Monitors.ClearBreakpoint()
 
 	fired := 0
 	// Capture snapshot of enabled automatic transitions at start of step (layer)
@@ -524,21 +672,46 @@ func (e *Engine) SimulateStep(cpn *models.CPN, marking *models.Marking) (int, er
 	if err != nil {
 		return 0, fmt.Errorf("failed to get enabled transitions: %v", err)
 	}
-	// Deterministic ordering
-	sort.Slice(enabled, func(i, j int) bool { return enabled[i].ID < enabled[j].ID })
-	for _, t := range enabled {
+	for len(enabled) == 0 && advance && e.advanceClock(cpn, marking) {
+		if enabled, bindingsMap, err = e.GetEnabledTransitions(cpn, marking); err != nil {
+			return 0, fmt.Errorf("failed to get enabled transitions: %v", err)
+		}
+	}
+	// Conflict resolution decides the firing order within the layer
+	for i, t := range e.orderTransitions(cpn, enabled, marking) {
 		if !t.IsAuto() { // skip manual in step auto firing
 			continue
 		}
 		bindings := bindingsMap[t.ID]
+		if i > 0 {
+			// Earlier firings in this layer may have consumed shared tokens: re-check
+			stillEnabled, fresh, err := e.IsEnabled(cpn, t, marking)
+			if err != nil {
+				return fired, fmt.Errorf("failed to check if transition %s is enabled: %v", t.Name, err)
+			}
+			if !stillEnabled {
+				continue
+			}
+			bindings = fresh
+		}
 		if len(bindings) == 0 {
 			continue
 		}
-		// Fire only first binding for this transition in this layer
-		if err := e.FireTransition(cpn, t, bindings[0], marking); err != nil {
+		// Fire only one binding for this transition in this layer
+		binding, err := e.selectBinding(cpn, t, bindings, marking)
+		if err != nil {
+			return fired, err
+		}
+		if binding == nil {
+			continue
+		}
+		if err := e.fireTransition(cpn, t, binding, marking, nil, false); err != nil {
 			return fired, fmt.Errorf("failed to fire transition %s: %v", t.Name, err)
 		}
 		fired++
+		if marking.Monitors.PendingBreakpoint() != nil {
+			break
+		}
 	}
 	return fired, nil
 }
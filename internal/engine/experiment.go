@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"go-petri-flow/internal/models"
+)
+
+// DefaultExperimentMaxSteps caps every replication when no step limit is configured
+const DefaultExperimentMaxSteps = 10000
+
+// MaxExperimentReplications is the largest number of replications an experiment may request
+const MaxExperimentReplications = 1000
+
+// Stop reasons reported per replication
+const (
+	StopReasonMaxSteps   = "max_steps"
+	StopReasonMaxTime    = "max_time"
+	StopReasonCompleted  = "completed"
+	StopReasonPredicate  = "predicate"
+	StopReasonBreakpoint = "breakpoint" // a breakpoint monitor of the CPN triggered
+	StopReasonDead       = "dead"       // no automatic transition can fire now or after a time advance
+)
+
+// StopCriteria defines when a replication ends; the first criterion that holds stops it.
+// A dead marking always stops a replication.
+type StopCriteria struct {
+	MaxSteps   int    `json:"maxSteps,omitempty"`   // simulation steps (default DefaultExperimentMaxSteps)
+	MaxTime    int    `json:"maxTime,omitempty"`    // model time horizon; no step starts after it
+	Completion bool   `json:"completion,omitempty"` // stop when all end places hold tokens
+	Predicate  string `json:"predicate,omitempty"`  // Lua boolean expression over the marking (e.g. "#places.done >= 5")
+}
+
+// ExperimentConfig configures a batch simulation experiment
+type ExperimentConfig struct {
+	Replications    int          `json:"replications"`              // independent runs (default 10, at most MaxExperimentReplications)
+	Seed            int64        `json:"seed,omitempty"`            // base seed; replication r uses seed+r
+	ConfidenceLevel float64      `json:"confidenceLevel,omitempty"` // 0.90, 0.95 (default) or 0.99
+	Stop            StopCriteria `json:"stop"`
+}
+
+// ReplicationResult holds the performance measures of a single replication
+type ReplicationResult struct {
+	Replication       int                `json:"replication"`
+	Seed              int64              `json:"seed"`
+	Steps             int                `json:"steps"`
+	Firings           int                `json:"firings"`
+	ElapsedTime       int                `json:"elapsedTime"`
+	StopReason        string             `json:"stopReason"`
+	Completed         bool               `json:"completed"`
+	Throughput        float64            `json:"throughput"`        // tokens reaching end places (or firings, without end places) per time unit; per step for untimed runs
+	TransitionFirings map[string]int     `json:"transitionFirings"` // transition ID -> firing count
+	PlaceOccupancyAvg map[string]float64 `json:"placeOccupancyAvg"` // place ID -> time-weighted average token count
+	PlaceOccupancyMax map[string]int     `json:"placeOccupancyMax"` // place ID -> maximum token count
+	WaitingTime       map[string]float64 `json:"waitingTime"`       // place ID -> mean time consumed tokens were available before consumption
+}
+
+// ExperimentSummary aggregates replications into means with confidence intervals
+type ExperimentSummary struct {
+	ConfidenceLevel   float64              `json:"confidenceLevel"`
+	Steps             Statistic            `json:"steps"`
+	ElapsedTime       Statistic            `json:"elapsedTime"`
+	Throughput        Statistic            `json:"throughput"`
+	CompletionRate    float64              `json:"completionRate"`
+	TransitionFirings map[string]Statistic `json:"transitionFirings"`
+	PlaceOccupancyAvg map[string]Statistic `json:"placeOccupancyAvg"`
+	PlaceOccupancyMax map[string]Statistic `json:"placeOccupancyMax"`
+	WaitingTime       map[string]Statistic `json:"waitingTime"`
+}
+
+// ExperimentResult is the outcome of RunExperiment
+type ExperimentResult struct {
+	CPNID        string              `json:"cpnId"`
+	Config       ExperimentConfig    `json:"config"`
+	Replications []ReplicationResult `json:"replications"`
+	Summary      ExperimentSummary   `json:"summary"`
+}
+
+// normalize applies defaults and validates the configuration
+func (c *ExperimentConfig) normalize() error {
+	if c.Replications == 0 {
+		c.Replications = 10
+	}
+	if c.Replications < 0 {
+		return fmt.Errorf("replications must be positive, got %d", c.Replications)
+	}
+	if c.Replications > MaxExperimentReplications {
+		return fmt.Errorf("replications must not exceed %d, got %d", MaxExperimentReplications, c.Replications)
+	}
+	if c.ConfidenceLevel == 0 {
+		c.ConfidenceLevel = 0.95
+	}
+	if err := validateConfidenceLevel(c.ConfidenceLevel); err != nil {
+		return err
+	}
+	if c.Stop.MaxSteps < 0 || c.Stop.MaxTime < 0 {
+		return fmt.Errorf("stop criteria must not be negative")
+	}
+	if c.Stop.MaxSteps == 0 {
+		c.Stop.MaxSteps = DefaultExperimentMaxSteps
+	}
+	return nil
+}
+
+// RunExperiment runs independent replications of a CPN from its initial marking, each driven by
+// SimulateStep until a stop criterion holds, and aggregates the collected performance measures.
+// Replication r is seeded with config.Seed+r (or the CPN's conflict resolution seed when no seed is given),
+// so experiments are reproducible.
+func (e *Engine) RunExperiment(cpn *models.CPN, config ExperimentConfig) (*ExperimentResult, error) {
+	return e.RunExperimentContext(context.Background(), cpn, config)
+}
+
+// RunExperimentContext is RunExperiment that stops with the context's error once ctx is done
+func (e *Engine) RunExperimentContext(ctx context.Context, cpn *models.CPN, config ExperimentConfig) (*ExperimentResult, error) {
+	if err := config.normalize(); err != nil {
+		return nil, fmt.Errorf("invalid experiment configuration: %v", err)
+	}
+	baseSeed := config.Seed
+	if baseSeed == 0 && cpn.ConflictResolution != nil {
+		baseSeed = cpn.ConflictResolution.Seed
+	}
+
+	result := &ExperimentResult{CPNID: cpn.ID, Config: config}
+	for r := 0; r < config.Replications; r++ {
+		replication, err := e.runReplication(ctx, cpn, config.Stop, baseSeed+int64(r))
+		if err != nil {
+			return nil, fmt.Errorf("replication %d failed: %v", r+1, err)
+		}
+		replication.Replication = r + 1
+		result.Replications = append(result.Replications, *replication)
+	}
+	result.Summary = summarizeReplications(cpn, result.Replications, config.ConfidenceLevel)
+	return result, nil
+}
+
+// runReplication simulates one replication and collects its measures
+func (e *Engine) runReplication(ctx context.Context, cpn *models.CPN, stop StopCriteria, seed int64) (*ReplicationResult, error) {
+	marking := cpn.CreateInitialMarking()
+	marking.SetSeed(seed)
+
+	result := &ReplicationResult{
+		Seed:              seed,
+		TransitionFirings: make(map[string]int),
+		PlaceOccupancyAvg: make(map[string]float64),
+		PlaceOccupancyMax: make(map[string]int),
+		WaitingTime:       make(map[string]float64),
+	}
+	for _, t := range cpn.Transitions {
+		result.TransitionFirings[t.ID] = 0
+	}
+
+	endPlaces := make(map[string]bool)
+	for _, idOrName := range cpn.EndPlaces {
+		if pl := cpn.GetPlace(idOrName); pl != nil {
+			endPlaces[pl.ID] = true
+		} else if pl := cpn.GetPlaceByName(idOrName); pl != nil {
+			endPlaces[pl.ID] = true
+		}
+	}
+
+	// Collect firing counts, arrivals at end places and waiting times of consumed tokens
+	arrivals := 0
+	waitSum := make(map[string]float64)
+	waitCount := make(map[string]int)
+	remove := e.AddFiringListener(func(event *FiringEvent) {
+		result.TransitionFirings[event.Transition.ID]++
+		result.Firings++
+		for placeID, tokens := range event.Produced {
+			if endPlaces[placeID] {
+				arrivals += len(tokens)
+			}
+		}
+		for placeID, tokens := range event.Consumed {
+			for _, token := range tokens {
+				if wait := event.Clock - token.Timestamp; wait > 0 {
+					waitSum[placeID] += float64(wait)
+				}
+				waitCount[placeID]++
+			}
+		}
+	})
+	defer remove()
+
+	// Occupancy is integrated over model time; untimed runs fall back to averaging per step
+	startClock := marking.GlobalClock
+	lastClock := startClock
+	counts := make(map[string]int)
+	area := make(map[string]float64)
+	stepSum := make(map[string]float64)
+	observations := 0
+	observe := func() {
+		for _, place := range cpn.Places {
+			count := marking.CountTokens(place.ID)
+			counts[place.ID] = count
+			stepSum[place.ID] += float64(count)
+			if count > result.PlaceOccupancyMax[place.ID] {
+				result.PlaceOccupancyMax[place.ID] = count
+			}
+		}
+		observations++
+	}
+	// integrate accounts for the last observed marking holding until the given time
+	integrate := func(until int) {
+		for placeID, count := range counts {
+			area[placeID] += float64(count * (until - lastClock))
+		}
+		lastClock = until
+	}
+	observe()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		reason, err := e.checkStopCriteria(cpn, stop, marking, result.Steps)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			result.StopReason = reason
+			break
+		}
+
+		fired, err := e.simulateStep(cpn, marking, false)
+		if err != nil {
+			return nil, err
+		}
+		if fired == 0 {
+			// Nothing can fire now: let time pass until the next token becomes available
+			next := e.NextEventTime(cpn, marking)
+			if next < 0 {
+				result.StopReason = StopReasonDead
+				break
+			}
+			if stop.MaxTime > 0 && next > stop.MaxTime {
+				result.StopReason = StopReasonMaxTime
+				break
+			}
+			integrate(next)
+			marking.AdvanceGlobalClock(next)
+			continue
+		}
+		result.Steps++
+		integrate(marking.GlobalClock)
+		observe()
+		if marking.Monitors.PendingBreakpoint() != nil {
+			result.StopReason = StopReasonBreakpoint
+			break
+		}
+	}
+	if result.StopReason == StopReasonMaxTime && stop.MaxTime > lastClock {
+		integrate(stop.MaxTime) // the final marking holds until the horizon
+	}
+
+	result.ElapsedTime = lastClock - startClock
+	result.Completed = cpn.IsCompleted(marking)
+	for _, place := range cpn.Places {
+		if result.ElapsedTime > 0 {
+			result.PlaceOccupancyAvg[place.ID] = area[place.ID] / float64(result.ElapsedTime)
+		} else {
+			result.PlaceOccupancyAvg[place.ID] = stepSum[place.ID] / float64(observations)
+		}
+	}
+	for placeID, count := range waitCount {
+		result.WaitingTime[placeID] = waitSum[placeID] / float64(count)
+	}
+
+	completions := result.Firings
+	if len(endPlaces) > 0 {
+		completions = arrivals
+	}
+	switch {
+	case result.ElapsedTime > 0:
+		result.Throughput = float64(completions) / float64(result.ElapsedTime)
+	case result.Steps > 0:
+		result.Throughput = float64(completions) / float64(result.Steps)
+	}
+	return result, nil
+}
+
+// checkStopCriteria returns the stop reason that holds before the next step, or "" to continue
+func (e *Engine) checkStopCriteria(cpn *models.CPN, stop StopCriteria, marking *models.Marking, steps int) (string, error) {
+	if stop.Completion && cpn.IsCompleted(marking) {
+		return StopReasonCompleted, nil
+	}
+	if stop.Predicate != "" {
+		holds, err := e.evaluator.EvaluateGuard(stop.Predicate, e.createMarkingContext(cpn, marking))
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate stop predicate: %v", err)
+		}
+		if holds {
+			return StopReasonPredicate, nil
+		}
+	}
+	if stop.MaxTime > 0 && marking.GlobalClock > stop.MaxTime {
+		return StopReasonMaxTime, nil
+	}
+	if steps >= stop.MaxSteps {
+		return StopReasonMaxSteps, nil
+	}
+	return "", nil
+}
+
+// summarizeReplications aggregates replication measures into statistics
+func summarizeReplications(cpn *models.CPN, replications []ReplicationResult, confidenceLevel float64) ExperimentSummary {
+	summary := ExperimentSummary{
+		ConfidenceLevel:   confidenceLevel,
+		TransitionFirings: make(map[string]Statistic),
+		PlaceOccupancyAvg: make(map[string]Statistic),
+		PlaceOccupancyMax: make(map[string]Statistic),
+		WaitingTime:       make(map[string]Statistic),
+	}
+
+	collect := func(get func(r ReplicationResult) (float64, bool)) Statistic {
+		var values []float64
+		for _, r := range replications {
+			if v, ok := get(r); ok {
+				values = append(values, v)
+			}
+		}
+		return NewStatistic(values, confidenceLevel)
+	}
+
+	summary.Steps = collect(func(r ReplicationResult) (float64, bool) { return float64(r.Steps), true })
+	summary.ElapsedTime = collect(func(r ReplicationResult) (float64, bool) { return float64(r.ElapsedTime), true })
+	summary.Throughput = collect(func(r ReplicationResult) (float64, bool) { return r.Throughput, true })
+
+	completed := 0
+	for _, r := range replications {
+		if r.Completed {
+			completed++
+		}
+	}
+	if len(replications) > 0 {
+		summary.CompletionRate = float64(completed) / float64(len(replications))
+	}
+
+	for _, t := range cpn.Transitions {
+		id := t.ID
+		summary.TransitionFirings[id] = collect(func(r ReplicationResult) (float64, bool) { return float64(r.TransitionFirings[id]), true })
+	}
+	for _, place := range cpn.Places {
+		id := place.ID
+		summary.PlaceOccupancyAvg[id] = collect(func(r ReplicationResult) (float64, bool) { return r.PlaceOccupancyAvg[id], true })
+		summary.PlaceOccupancyMax[id] = collect(func(r ReplicationResult) (float64, bool) { return float64(r.PlaceOccupancyMax[id]), true })
+		if wait := collect(func(r ReplicationResult) (float64, bool) { v, ok := r.WaitingTime[id]; return v, ok }); wait.Count > 0 {
+			summary.WaitingTime[id] = wait
+		}
+	}
+	return summary
+}
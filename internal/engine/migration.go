@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"sort"
+
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// MigrateMarking carries a marking of source over to target following a migration plan and
+// returns the migrated marking; the marking itself is not changed. Problems such as unmapped
+// places, failing transformers and tokens outside the color set of their new place are recorded
+// in the result, which also receives the diff.
+func (e *Engine) MigrateMarking(source, target *models.CPN, marking *models.Marking, plan *models.MigrationPlan, result *models.MigrationResult) *models.Marking {
+	migrated := marking.Clone()
+	migrated.Places = make(map[string]models.Multiset)
+
+	// Resolve the places of the plan, which may be given by ID or name
+	mapping := make(map[string]*models.Place) // source place ID -> target place (nil = discard)
+	for from, to := range plan.PlaceMapping {
+		place := placeByRef(source, from)
+		if place == nil {
+			result.Add(from, "place %s does not exist in version %d", from, source.Version)
+			continue
+		}
+		if to == "" {
+			mapping[place.ID] = nil
+			continue
+		}
+		mapping[place.ID] = placeByRef(target, to)
+		if mapping[place.ID] == nil {
+			result.Add(place.ID, "target place %s does not exist in version %d", to, target.Version)
+			delete(mapping, place.ID)
+		}
+	}
+	transformers := make(map[string]string)
+	for from, transformer := range plan.Transformers {
+		place := placeByRef(source, from)
+		if place == nil {
+			result.Add(from, "place %s does not exist in version %d", from, source.Version)
+			continue
+		}
+		transformers[place.ID] = transformer
+	}
+
+	placeIDs := marking.GetPlaceIDs()
+	sort.Strings(placeIDs)
+	for _, placeID := range placeIDs {
+		tokens := marking.GetTokens(placeID)
+		if len(tokens) == 0 {
+			continue
+		}
+		to, mapped := mapping[placeID]
+		if !mapped {
+			if to = target.GetPlace(placeID); to == nil {
+				result.Add(placeID, "place %s with %d tokens does not exist in version %d; map or discard it", placeID, len(tokens), target.Version)
+				continue
+			}
+		}
+		if to == nil {
+			continue
+		}
+		for _, token := range tokens {
+			for _, newToken := range e.migrateToken(target, marking, migrated, placeID, transformers[placeID], token, result) {
+				if err := to.ValidateToken(newToken); err != nil {
+					result.Add(placeID, "%v", err)
+					continue
+				}
+				migrated.AddToken(to.ID, newToken)
+			}
+		}
+	}
+
+	result.Diff = models.MarkingDiff(marking, migrated)
+	return migrated
+}
+
+// migrateToken applies the transformer of a place to a token. The transformer sees the token as
+// x and the old marking's places; delayed results are timestamped from the clock.
+func (e *Engine) migrateToken(target *models.CPN, marking, migrated *models.Marking, placeID, transformer string, token *models.Token, result *models.MigrationResult) []*models.Token {
+	if transformer == "" {
+		return []*models.Token{models.NewToken(token.Value, token.Timestamp)}
+	}
+	context := e.createEvaluationContext(target, TokenBinding{"x": token}, migrated)
+	context.Marking = marking
+	value, err := e.evaluator.EvaluateArcExpression(transformer, context)
+	if err != nil {
+		result.Add(placeID, "transformer failed for token %v: %v", token.Value, err)
+		return nil
+	}
+	// Like an empty multiset, nil and an empty table drop the token
+	if m, ok := value.(map[string]interface{}); value == nil || ok && len(m) == 0 {
+		return nil
+	}
+	elements := []interface{}{value}
+	if ms, ok := value.(expression.MultisetValue); ok {
+		elements = ms
+	}
+	tokens := make([]*models.Token, 0, len(elements))
+	for _, element := range elements {
+		newValue, delay := tokenValue(element)
+		timestamp := token.Timestamp
+		if delay > 0 {
+			timestamp = marking.GlobalClock + delay
+		}
+		tokens = append(tokens, models.NewToken(newValue, timestamp))
+	}
+	return tokens
+}
+
+// placeByRef returns the place of a CPN with the given ID or, failing that, name
+func placeByRef(cpn *models.CPN, ref string) *models.Place {
+	if place := cpn.GetPlace(ref); place != nil {
+		return place
+	}
+	return cpn.GetPlaceByName(ref)
+}
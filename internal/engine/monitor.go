@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// applyMonitors evaluates the CPN's monitors after a firing and records their results on the marking.
+// Monitor evaluation errors are recorded on the monitor result and never fail the firing.
+func (e *Engine) applyMonitors(event *FiringEvent, marking *models.Marking) {
+	cpn := event.CPN
+	if len(cpn.Monitors) == 0 {
+		return
+	}
+	if marking.Monitors == nil {
+		marking.Monitors = models.NewMonitorResults(cpn.Monitors)
+	}
+
+	for _, monitor := range cpn.Monitors {
+		result := marking.Monitors.Get(monitor.ID)
+		if result == nil {
+			result = models.NewMonitorResults([]*models.Monitor{monitor}).Get(monitor.ID)
+			marking.Monitors.Results[monitor.ID] = result
+		}
+
+		switch monitor.Type {
+		case models.MonitorTypeDataCollector:
+			if !monitor.ObservesTransition(event.Transition.ID) {
+				continue
+			}
+			context := e.createEvaluationContext(event.CPN, event.Binding, marking)
+			value, err := e.evaluator.EvaluateArcExpression(monitor.Expression, context)
+			if err != nil {
+				result.RecordError(fmt.Errorf("transition %s: %v", event.Transition.ID, err))
+				continue
+			}
+			result.AddObservation(models.MonitorObservation{
+				Step:         event.Step,
+				Clock:        event.Clock,
+				TransitionID: event.Transition.ID,
+				Value:        value,
+			})
+			if number, ok := toFloat(value); ok {
+				if result.Stats == nil {
+					result.Stats = &models.MonitorStats{}
+				}
+				result.Stats.Add(number)
+			}
+
+		case models.MonitorTypeMarkingSize:
+			counts := make(map[string]int)
+			for _, placeID := range monitor.ObservedPlaces(cpn) {
+				count := marking.CountTokens(placeID)
+				counts[placeID] = count
+				if result.PlaceStats[placeID] == nil {
+					result.PlaceStats[placeID] = &models.MonitorStats{}
+				}
+				result.PlaceStats[placeID].Add(float64(count))
+			}
+			result.AddObservation(models.MonitorObservation{
+				Step:         event.Step,
+				Clock:        event.Clock,
+				TransitionID: event.Transition.ID,
+				Counts:       counts,
+			})
+
+		case models.MonitorTypeBreakpoint:
+			holds, err := e.evaluator.EvaluateGuard(monitor.Expression, e.createMarkingContext(cpn, marking))
+			if err != nil {
+				result.RecordError(err)
+				continue
+			}
+			if !holds {
+				continue
+			}
+			result.Triggered++
+			result.AddObservation(models.MonitorObservation{
+				Step:         event.Step,
+				Clock:        event.Clock,
+				TransitionID: event.Transition.ID,
+			})
+			if marking.Monitors.Breakpoint == nil {
+				marking.Monitors.Breakpoint = &models.BreakpointHit{
+					MonitorID:    monitor.ID,
+					Name:         monitor.Name,
+					Step:         event.Step,
+					Clock:        event.Clock,
+					TransitionID: event.Transition.ID,
+				}
+			}
+		}
+	}
+}
+
+// createMarkingContext creates an evaluation context for predicates over a whole marking.
+// Every place of the CPN is visible in the places table, including empty ones.
+func (e *Engine) createMarkingContext(cpn *models.CPN, marking *models.Marking) *expression.EvaluationContext {
+	context := e.createEvaluationContext(cpn, TokenBinding{}, marking)
+	for _, place := range cpn.Places {
+		if !marking.HasTokens(place.ID) {
+			context.SetPlaceTokens(place.ID, nil)
+		}
+	}
+	return context
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-petri-flow/internal/models"
+)
+
+// DefaultPredictionMaxSteps caps every prediction run when no step limit is configured
+const DefaultPredictionMaxSteps = 1000
+
+// MaxPredictionRuns is the largest number of runs a prediction may request
+const MaxPredictionRuns = 1000
+
+// PredictionConfig configures Predict
+type PredictionConfig struct {
+	Runs            int     `json:"runs,omitempty"`            // independent runs (default 1, at most MaxPredictionRuns; use more for random delays or choices)
+	Seed            int64   `json:"seed,omitempty"`            // base seed; run r uses seed+r (default the marking's seed)
+	MaxSteps        int     `json:"maxSteps,omitempty"`        // simulation steps per run (default DefaultPredictionMaxSteps)
+	FireManual      bool    `json:"fireManual,omitempty"`      // fire manual transitions as soon as no automatic one can fire
+	ConfidenceLevel float64 `json:"confidenceLevel,omitempty"` // 0.90, 0.95 (default) or 0.99
+}
+
+// PathStep is a firing on a predicted path
+type PathStep struct {
+	TransitionID string `json:"transitionId"`
+	Clock        int    `json:"clock"`
+	Step         int    `json:"step"`
+}
+
+// PredictedRun is one simulated continuation of a marking
+type PredictedRun struct {
+	Run            int             `json:"run"`
+	Seed           int64           `json:"seed"`
+	Steps          int             `json:"steps"`
+	StopReason     string          `json:"stopReason"`
+	Completed      bool            `json:"completed"`
+	CompletionTime int             `json:"completionTime"` // when the end places' tokens are available (clock at the stop of other runs)
+	Path           []PathStep      `json:"path"`
+	Marking        *models.Marking `json:"marking"` // final marking
+}
+
+// PathFrequency counts the runs that fired the same sequence of transitions
+type PathFrequency struct {
+	Path []string `json:"path"`
+	Runs int      `json:"runs"`
+}
+
+// Prediction is the outcome of Predict
+type Prediction struct {
+	StartTime      int             `json:"startTime"` // clock of the marking the runs started from
+	Runs           []PredictedRun  `json:"runs"`
+	CompletionRate float64         `json:"completionRate"`
+	CompletionTime Statistic       `json:"completionTime"` // over the completed runs
+	Paths          []PathFrequency `json:"paths"`          // most frequent first
+}
+
+// normalize applies defaults and validates the configuration
+func (c *PredictionConfig) normalize() error {
+	if c.Runs == 0 {
+		c.Runs = 1
+	}
+	if c.Runs < 0 || c.MaxSteps < 0 {
+		return fmt.Errorf("runs and steps must not be negative")
+	}
+	if c.Runs > MaxPredictionRuns {
+		return fmt.Errorf("runs must not exceed %d, got %d", MaxPredictionRuns, c.Runs)
+	}
+	if c.MaxSteps == 0 {
+		c.MaxSteps = DefaultPredictionMaxSteps
+	}
+	if c.ConfidenceLevel == 0 {
+		c.ConfidenceLevel = 0.95
+	}
+	return validateConfidenceLevel(c.ConfidenceLevel)
+}
+
+// Predict simulates independent continuations of a marking until the CPN completes, nothing can
+// fire any more or the step limit is reached, and reports when and along which transitions the
+// runs ended. Time passes whenever nothing can fire. The marking itself is not changed.
+func (e *Engine) Predict(ctx context.Context, cpn *models.CPN, marking *models.Marking, config PredictionConfig) (*Prediction, error) {
+	if err := config.normalize(); err != nil {
+		return nil, fmt.Errorf("invalid prediction configuration: %v", err)
+	}
+	baseSeed := config.Seed
+	if baseSeed == 0 {
+		baseSeed = marking.Seed
+	}
+
+	prediction := &Prediction{StartTime: marking.GlobalClock}
+	var completionTimes []float64
+	counts := make(map[string]*PathFrequency)
+	for r := 0; r < config.Runs; r++ {
+		run, err := e.predictRun(ctx, cpn, marking, config, baseSeed+int64(r))
+		if err != nil {
+			return nil, fmt.Errorf("run %d failed: %v", r+1, err)
+		}
+		run.Run = r + 1
+		prediction.Runs = append(prediction.Runs, *run)
+		if run.Completed {
+			completionTimes = append(completionTimes, float64(run.CompletionTime))
+		}
+
+		path := make([]string, len(run.Path))
+		for i, step := range run.Path {
+			path[i] = step.TransitionID
+		}
+		key := strings.Join(path, "\x00")
+		if counts[key] == nil {
+			counts[key] = &PathFrequency{Path: path}
+		}
+		counts[key].Runs++
+	}
+
+	prediction.Paths = make([]PathFrequency, 0, len(counts))
+	for _, frequency := range counts {
+		prediction.Paths = append(prediction.Paths, *frequency)
+	}
+	sort.Slice(prediction.Paths, func(i, j int) bool {
+		a, b := prediction.Paths[i], prediction.Paths[j]
+		if a.Runs != b.Runs {
+			return a.Runs > b.Runs
+		}
+		return strings.Join(a.Path, " ") < strings.Join(b.Path, " ")
+	})
+	prediction.CompletionRate = float64(len(completionTimes)) / float64(config.Runs)
+	prediction.CompletionTime = NewStatistic(completionTimes, config.ConfidenceLevel)
+	return prediction, nil
+}
+
+// predictRun simulates one continuation of a marking
+func (e *Engine) predictRun(ctx context.Context, cpn *models.CPN, start *models.Marking, config PredictionConfig, seed int64) (*PredictedRun, error) {
+	marking := start.Clone()
+	marking.SetSeed(seed)
+	run := &PredictedRun{Seed: seed, Path: []PathStep{}}
+
+	remove := e.AddFiringListener(func(event *FiringEvent) {
+		run.Path = append(run.Path, PathStep{TransitionID: event.Transition.ID, Clock: event.Clock, Step: event.Step})
+	})
+	defer remove()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if cpn.IsCompleted(marking) {
+			run.StopReason = StopReasonCompleted
+			break
+		}
+		if run.Steps >= config.MaxSteps {
+			run.StopReason = StopReasonMaxSteps
+			break
+		}
+
+		fired, err := e.simulateStep(cpn, marking, false)
+		if err != nil {
+			return nil, err
+		}
+		if fired == 0 && config.FireManual {
+			if fired, err = e.fireManual(cpn, marking); err != nil {
+				return nil, err
+			}
+		}
+		if fired == 0 {
+			// Nothing can fire now: let time pass until the next token becomes available
+			if !e.advanceClock(cpn, marking) {
+				run.StopReason = StopReasonDead
+				break
+			}
+			continue
+		}
+		run.Steps++
+		if marking.Monitors.PendingBreakpoint() != nil {
+			run.StopReason = StopReasonBreakpoint
+			break
+		}
+	}
+
+	run.Completed = cpn.IsCompleted(marking)
+	run.CompletionTime = marking.GlobalClock
+	if run.Completed {
+		run.CompletionTime = completionTime(cpn, marking)
+	}
+	run.Marking = marking
+	return run, nil
+}
+
+// completionTime returns the time from which every end place of a completed marking holds an
+// available token: a delayed token reaches its end place only at its timestamp
+func completionTime(cpn *models.CPN, marking *models.Marking) int {
+	completion := marking.GlobalClock
+	for _, idOrName := range cpn.EndPlaces {
+		place := cpn.GetPlace(idOrName)
+		if place == nil {
+			place = cpn.GetPlaceByName(idOrName)
+		}
+		if place == nil || !place.IsTimed() {
+			continue
+		}
+		first := -1
+		for _, token := range marking.GetTokens(place.ID) {
+			if first == -1 || token.Timestamp < first {
+				first = token.Timestamp
+			}
+		}
+		if first > completion {
+			completion = first
+		}
+	}
+	return completion
+}
+
+// fireManual fires the enabled manual transition that wins the conflict, as if a user completed
+// it at once, and returns the number of firings (0 or 1)
+func (e *Engine) fireManual(cpn *models.CPN, marking *models.Marking) (int, error) {
+	transitions, bindingsMap, err := e.GetManualTransitions(cpn, marking)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get enabled transitions: %v", err)
+	}
+	for _, transition := range e.orderTransitions(cpn, transitions, marking) {
+		binding, err := e.selectBinding(cpn, transition, bindingsMap[transition.ID], marking)
+		if err != nil {
+			return 0, err
+		}
+		if binding == nil {
+			continue
+		}
+		if err := e.fireTransition(cpn, transition, binding, marking, nil, false); err != nil {
+			return 0, fmt.Errorf("failed to fire transition %s: %v", transition.Name, err)
+		}
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// Statistic summarizes a sample of per-replication observations with a confidence interval
+type Statistic struct {
+	Count     int     `json:"count"`
+	Mean      float64 `json:"mean"`
+	StdDev    float64 `json:"stdDev"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	HalfWidth float64 `json:"halfWidth"` // half width of the confidence interval (0 for fewer than 2 observations)
+	Lower     float64 `json:"lower"`
+	Upper     float64 `json:"upper"`
+}
+
+// tCritical holds two-sided Student t critical values for degrees of freedom 1..30
+var tCritical = map[float64][]float64{
+	0.90: {6.314, 2.920, 2.353, 2.132, 2.015, 1.943, 1.895, 1.860, 1.833, 1.812,
+		1.796, 1.782, 1.771, 1.761, 1.753, 1.746, 1.740, 1.734, 1.729, 1.725,
+		1.721, 1.717, 1.714, 1.711, 1.708, 1.706, 1.703, 1.701, 1.699, 1.697},
+	0.95: {12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042},
+	0.99: {63.657, 9.925, 5.841, 4.604, 4.032, 3.707, 3.499, 3.355, 3.250, 3.169,
+		3.106, 3.055, 3.012, 2.977, 2.947, 2.921, 2.898, 2.878, 2.861, 2.845,
+		2.831, 2.819, 2.807, 2.797, 2.787, 2.779, 2.771, 2.763, 2.756, 2.750},
+}
+
+// zCritical holds the normal approximation used for more than 30 degrees of freedom
+var zCritical = map[float64]float64{0.90: 1.645, 0.95: 1.960, 0.99: 2.576}
+
+// validateConfidenceLevel checks that a confidence level is supported
+func validateConfidenceLevel(level float64) error {
+	if _, ok := zCritical[level]; !ok {
+		return fmt.Errorf("unsupported confidence level %v (supported: 0.90, 0.95, 0.99)", level)
+	}
+	return nil
+}
+
+// NewStatistic computes mean, standard deviation and the confidence interval of a sample
+func NewStatistic(values []float64, confidenceLevel float64) Statistic {
+	stat := Statistic{Count: len(values)}
+	if len(values) == 0 {
+		return stat
+	}
+
+	stat.Min, stat.Max = values[0], values[0]
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+		stat.Min = math.Min(stat.Min, v)
+		stat.Max = math.Max(stat.Max, v)
+	}
+	stat.Mean = sum / float64(len(values))
+
+	if len(values) > 1 {
+		squares := 0.0
+		for _, v := range values {
+			squares += (v - stat.Mean) * (v - stat.Mean)
+		}
+		stat.StdDev = math.Sqrt(squares / float64(len(values)-1))
+
+		df := len(values) - 1
+		critical := zCritical[confidenceLevel]
+		if table, ok := tCritical[confidenceLevel]; ok && df <= len(table) {
+			critical = table[df-1]
+		}
+		stat.HalfWidth = critical * stat.StdDev / math.Sqrt(float64(len(values)))
+	}
+	stat.Lower = stat.Mean - stat.HalfWidth
+	stat.Upper = stat.Mean + stat.HalfWidth
+	return stat
+}
@@ -0,0 +1,303 @@
+package expression
+
+import "strings"
+
+// Lexical analysis of Lua inscriptions used by the engine to plan binding searches.
+// The analysis is conservative: whenever an expression cannot be understood it is
+// treated as a single opaque conjunct.
+
+type lexKind int
+
+const (
+	lexIdent lexKind = iota
+	lexNumber
+	lexString
+	lexOp
+)
+
+type lexToken struct {
+	kind       lexKind
+	text       string
+	start, end int
+}
+
+// randomFunctions are the built-in functions drawing from the run's random source
+var randomFunctions = map[string]bool{
+	"uniform": true, "exponential": true, "normal": true, "erlang": true,
+	"discrete": true, "bernoulli": true, "poisson": true, "random": true,
+}
+
+// lex splits a Lua expression into tokens, skipping comments. ok is false for unterminated strings.
+func lex(src string) (tokens []lexToken, ok bool) {
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && strings.HasPrefix(src[i:], "--"):
+			if level, found := longBracket(src[i+2:]); found {
+				closing := "]" + strings.Repeat("=", level) + "]"
+				end := strings.Index(src[i+2:], closing)
+				if end < 0 {
+					return nil, false
+				}
+				i += 2 + end + len(closing)
+			} else if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(src)
+			}
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, false
+			}
+			tokens = append(tokens, lexToken{lexString, src[i : j+1], i, j + 1})
+			i = j + 1
+		case c == '[':
+			if level, found := longBracket(src[i:]); found {
+				closing := "]" + strings.Repeat("=", level) + "]"
+				end := strings.Index(src[i:], closing)
+				if end < 0 {
+					return nil, false
+				}
+				tokens = append(tokens, lexToken{lexString, src[i : i+end+len(closing)], i, i + end + len(closing)})
+				i += end + len(closing)
+			} else {
+				tokens = append(tokens, lexToken{lexOp, "[", i, i + 1})
+				i++
+			}
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(src) && (isIdentStart(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, lexToken{lexIdent, src[i:j], i, j})
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || isIdentStart(src[j]) || src[j] == '.' ||
+				((src[j] == '-' || src[j] == '+') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, lexToken{lexNumber, src[i:j], i, j})
+			i = j
+		default:
+			op := string(c)
+			for _, multi := range []string{"...", "..", "==", "~=", "<=", ">=", "::"} {
+				if strings.HasPrefix(src[i:], multi) {
+					op = multi
+					break
+				}
+			}
+			tokens = append(tokens, lexToken{lexOp, op, i, i + len(op)})
+			i += len(op)
+		}
+	}
+	return tokens, true
+}
+
+// longBracket reports whether s starts with a long bracket ([[ or [==[) and returns its level
+func longBracket(s string) (int, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return 0, false
+	}
+	level := 0
+	for level+1 < len(s) && s[level+1] == '=' {
+		level++
+	}
+	return level, level+1 < len(s) && s[level+1] == '['
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// statementKeywords mark inscriptions that are statements rather than a single expression
+var statementKeywords = map[string]bool{
+	"return": true, "local": true, "function": true, "if": true, "for": true, "while": true, "do": true, "repeat": true,
+}
+
+// SplitConjuncts splits a boolean expression into its top-level "and" operands, in order.
+// Expressions with a top-level "or", statements or unbalanced brackets are returned whole.
+func SplitConjuncts(expression string) []string {
+	whole := []string{strings.TrimSpace(expression)}
+	tokens, ok := lex(expression)
+	if !ok {
+		return whole
+	}
+	var parts []string
+	depth, start := 0, 0
+	for _, tok := range tokens {
+		switch {
+		case tok.kind == lexIdent && statementKeywords[tok.text], tok.kind == lexOp && tok.text == ";":
+			return whole
+		case tok.kind == lexOp && (tok.text == "(" || tok.text == "[" || tok.text == "{"):
+			depth++
+		case tok.kind == lexOp && (tok.text == ")" || tok.text == "]" || tok.text == "}"):
+			depth--
+			if depth < 0 {
+				return whole
+			}
+		case depth == 0 && tok.kind == lexIdent && tok.text == "or":
+			return whole
+		case depth == 0 && tok.kind == lexIdent && tok.text == "and":
+			parts = append(parts, strings.TrimSpace(expression[start:tok.start]))
+			start = tok.end
+		}
+	}
+	if depth != 0 {
+		return whole
+	}
+	parts = append(parts, strings.TrimSpace(expression[start:]))
+	for _, part := range parts {
+		if part == "" {
+			return whole
+		}
+	}
+	return parts
+}
+
+// Identifiers returns the names an expression reads as variables: identifiers that are not
+// keywords, field names (a.b, a:b) or table constructor keys. ok is false if the expression
+// cannot be analyzed.
+func Identifiers(expression string) (names []string, ok bool) {
+	tokens, lexed := lex(expression)
+	if !lexed {
+		return nil, false
+	}
+	seen := make(map[string]bool)
+	for i, tok := range tokens {
+		if tok.kind != lexIdent || luaKeywords[tok.text] {
+			continue
+		}
+		if i > 0 && tokens[i-1].kind == lexOp && (tokens[i-1].text == "." || tokens[i-1].text == ":") {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].kind == lexOp && tokens[i+1].text == "=" &&
+			i > 0 && tokens[i-1].kind == lexOp && (tokens[i-1].text == "{" || tokens[i-1].text == ",") {
+			continue
+		}
+		if !seen[tok.text] {
+			seen[tok.text] = true
+			names = append(names, tok.text)
+		}
+	}
+	return names, true
+}
+
+// CalledNames returns the names of the functions an expression calls: f for f(...), and the table
+// a for a.b(...) and a:b(...), including the call forms f "s" and f {...}. ok is false if the
+// expression cannot be analyzed or calls the result of an expression.
+func CalledNames(expression string) (names []string, ok bool) {
+	tokens, lexed := lex(expression)
+	if !lexed {
+		return nil, false
+	}
+	isOp := func(i int, ops ...string) bool {
+		if i < 0 || i >= len(tokens) || tokens[i].kind != lexOp {
+			return false
+		}
+		for _, op := range ops {
+			if tokens[i].text == op {
+				return true
+			}
+		}
+		return false
+	}
+	seen := make(map[string]bool)
+	for i, tok := range tokens {
+		if isOp(i, "(") && isOp(i-1, ")", "]") {
+			return nil, false
+		}
+		if tok.kind != lexIdent || luaKeywords[tok.text] || isOp(i-1, ".", ":") {
+			continue
+		}
+		j := i + 1
+		for isOp(j, ".", ":") && j+1 < len(tokens) && tokens[j+1].kind == lexIdent {
+			j += 2
+		}
+		if j < len(tokens) && (isOp(j, "(", "{") || tokens[j].kind == lexString) && !seen[tok.text] {
+			seen[tok.text] = true
+			names = append(names, tok.text)
+		}
+	}
+	return names, true
+}
+
+// UsesRandom reports whether an expression calls one of the seeded random functions
+// (including math.random). Such expressions must not be evaluated more often than written.
+func UsesRandom(expression string) bool {
+	tokens, ok := lex(expression)
+	if !ok {
+		return true
+	}
+	for i, tok := range tokens {
+		if tok.kind == lexIdent && randomFunctions[tok.text] &&
+			i+1 < len(tokens) && tokens[i+1].kind == lexOp && tokens[i+1].text == "(" {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitEquality splits an expression of the form "lhs == rhs" with a single top-level
+// comparison and no top-level logical operator. ok is false for any other expression.
+func SplitEquality(expression string) (lhs, rhs string, ok bool) {
+	tokens, lexed := lex(expression)
+	if !lexed {
+		return "", "", false
+	}
+	depth, split := 0, -1
+	for i, tok := range tokens {
+		switch {
+		case tok.kind == lexOp && (tok.text == "(" || tok.text == "[" || tok.text == "{"):
+			depth++
+		case tok.kind == lexOp && (tok.text == ")" || tok.text == "]" || tok.text == "}"):
+			depth--
+		case depth != 0:
+		case tok.kind == lexIdent && (tok.text == "and" || tok.text == "or" || tok.text == "not" || statementKeywords[tok.text]):
+			return "", "", false
+		case tok.kind == lexOp && (tok.text == "~=" || tok.text == "<" || tok.text == ">" || tok.text == "<=" || tok.text == ">=" || tok.text == ";"):
+			return "", "", false
+		case tok.kind == lexOp && tok.text == "==":
+			if split >= 0 {
+				return "", "", false
+			}
+			split = i
+		}
+	}
+	if split < 0 || depth != 0 {
+		return "", "", false
+	}
+	lhs = strings.TrimSpace(expression[:tokens[split].start])
+	rhs = strings.TrimSpace(expression[tokens[split].end:])
+	return lhs, rhs, lhs != "" && rhs != ""
+}
+
+// FieldPath recognizes "v" and "v.field" and returns the variable and the (possibly empty) field
+func FieldPath(expression string) (variable, field string, ok bool) {
+	tokens, lexed := lex(expression)
+	if !lexed {
+		return "", "", false
+	}
+	switch {
+	case len(tokens) == 1 && tokens[0].kind == lexIdent && !luaKeywords[tokens[0].text]:
+		return tokens[0].text, "", true
+	case len(tokens) == 3 && tokens[0].kind == lexIdent && !luaKeywords[tokens[0].text] &&
+		tokens[1].kind == lexOp && tokens[1].text == "." && tokens[2].kind == lexIdent:
+		return tokens[0].text, tokens[2].text, true
+	}
+	return "", "", false
+}
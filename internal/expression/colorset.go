@@ -0,0 +1,260 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+
+	"go-petri-flow/internal/models"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// maxColorSetValues bounds the number of values cs.all returns
+const maxColorSetValues = 100000
+
+// registerColorSetFunctions installs the cs table of color set functions. Color sets are looked up
+// by name in the evaluation context and the declared color sets of its CPN. Enumerable color sets
+// are enumerations, ranged integers, booleans and their subsets; values are ordered as declared.
+//
+//	cs.all(name)         list of all values
+//	cs.size(name)        number of values
+//	cs.member(name, v)   whether v is a member (any color set)
+//	cs.ord(name, v)      position of v, starting at 0
+//	cs.col(name, i)      value at position i
+//	cs.succ(name, v)     next value, wrapping around to the first
+//	cs.pred(name, v)     previous value, wrapping around to the last
+func (e *Evaluator) registerColorSetFunctions() {
+	L := e.luaState
+	table := L.NewTable()
+	fns := map[string]lua.LGFunction{
+		"all": func(L *lua.LState) int {
+			values, err := colorSetValues(e.checkColorSet(L))
+			if err != nil {
+				L.RaiseError("%v", err)
+			}
+			e.pushGoValue(L, values)
+			return 1
+		},
+		"size": func(L *lua.LState) int {
+			size, err := colorSetSize(e.checkColorSet(L))
+			if err != nil {
+				L.RaiseError("%v", err)
+			}
+			L.Push(lua.LNumber(size))
+			return 1
+		},
+		"member": func(L *lua.LState) int {
+			colorSet := e.checkColorSet(L)
+			L.Push(lua.LBool(colorSet.IsMember(e.luaValueToGo(L.Get(2)))))
+			return 1
+		},
+		"ord": func(L *lua.LState) int {
+			i, err := colorSetOrd(e.checkColorSet(L), e.luaValueToGo(L.Get(2)))
+			if err != nil {
+				L.RaiseError("%v", err)
+			}
+			L.Push(lua.LNumber(i))
+			return 1
+		},
+		"col": func(L *lua.LState) int {
+			value, err := colorSetCol(e.checkColorSet(L), L.CheckInt(2))
+			if err != nil {
+				L.RaiseError("%v", err)
+			}
+			e.pushGoValue(L, value)
+			return 1
+		},
+		"succ": func(L *lua.LState) int { return e.luaColorSetStep(L, 1) },
+		"pred": func(L *lua.LState) int { return e.luaColorSetStep(L, -1) },
+	}
+	for name, fn := range fns {
+		table.RawSetString(name, L.NewFunction(fn))
+	}
+	L.SetGlobal("cs", table)
+}
+
+// luaColorSetStep implements cs.succ (step 1) and cs.pred (step -1)
+func (e *Evaluator) luaColorSetStep(L *lua.LState, step int) int {
+	colorSet := e.checkColorSet(L)
+	i, err := colorSetOrd(colorSet, e.luaValueToGo(L.Get(2)))
+	if err == nil {
+		var size int
+		if size, err = colorSetSize(colorSet); err == nil {
+			var value interface{}
+			if value, err = colorSetCol(colorSet, ((i+step)%size+size)%size); err == nil {
+				e.pushGoValue(L, value)
+				return 1
+			}
+		}
+	}
+	L.RaiseError("%v", err)
+	return 0
+}
+
+// checkColorSet returns the color set named by the first argument
+func (e *Evaluator) checkColorSet(L *lua.LState) models.ColorSet {
+	name := L.CheckString(1)
+	colorSet, ok := e.colorSet(name)
+	if !ok {
+		L.RaiseError("unknown color set: %s", name)
+	}
+	return colorSet
+}
+
+// colorSet looks up a color set visible to the evaluation in progress
+func (e *Evaluator) colorSet(name string) (models.ColorSet, bool) {
+	if e.context == nil {
+		return nil, false
+	}
+	if colorSet, ok := e.context.ColorSets[name]; ok {
+		return colorSet, true
+	}
+	if e.context.CPN != nil {
+		return e.context.CPN.GetColorSet(name)
+	}
+	return nil, false
+}
+
+func (e *Evaluator) pushGoValue(L *lua.LState, value interface{}) {
+	lv, err := e.goValueToLua(value)
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	L.Push(lv)
+}
+
+// colorSetSize returns the number of values of an enumerable color set
+func colorSetSize(colorSet models.ColorSet) (int, error) {
+	if cs, ok := colorSet.(*models.IntegerColorSet); ok {
+		if minVal, maxVal, bounded := cs.GetRange(); bounded {
+			return maxVal - minVal + 1, nil
+		}
+	}
+	values, err := colorSetValues(colorSet)
+	return len(values), err
+}
+
+// colorSetOrd returns the position of a value in an enumerable color set
+func colorSetOrd(colorSet models.ColorSet, value interface{}) (int, error) {
+	if !colorSet.IsMember(value) {
+		return 0, fmt.Errorf("%v is not a member of color set %s", value, colorSet.Name())
+	}
+	if cs, ok := colorSet.(*models.IntegerColorSet); ok {
+		if minVal, _, bounded := cs.GetRange(); bounded {
+			if n, isInt := value.(int); isInt {
+				return n - minVal, nil
+			}
+		}
+	}
+	values, err := colorSetValues(colorSet)
+	if err != nil {
+		return 0, err
+	}
+	for i, v := range values {
+		if v == value {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not a member of color set %s", value, colorSet.Name())
+}
+
+// colorSetCol returns the value at a position of an enumerable color set
+func colorSetCol(colorSet models.ColorSet, i int) (interface{}, error) {
+	size, err := colorSetSize(colorSet)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= size {
+		return nil, fmt.Errorf("position %d is out of range for color set %s of size %d", i, colorSet.Name(), size)
+	}
+	if cs, ok := colorSet.(*models.IntegerColorSet); ok {
+		minVal, _, _ := cs.GetRange()
+		return minVal + i, nil
+	}
+	values, err := colorSetValues(colorSet)
+	if err != nil {
+		return nil, err
+	}
+	return values[i], nil
+}
+
+// colorSetValues enumerates the values of an enumerable color set
+func colorSetValues(colorSet models.ColorSet) ([]interface{}, error) {
+	switch cs := colorSet.(type) {
+	case *models.EnumeratedColorSet:
+		values := make([]interface{}, len(cs.GetValues()))
+		for i, v := range cs.GetValues() {
+			values[i] = v
+		}
+		return values, nil
+	case *models.IntegerColorSet:
+		minVal, maxVal, bounded := cs.GetRange()
+		if !bounded {
+			return nil, fmt.Errorf("color set %s is not enumerable: integer color set without range", cs.Name())
+		}
+		if maxVal-minVal >= maxColorSetValues {
+			return nil, fmt.Errorf("color set %s has more than %d values", cs.Name(), maxColorSetValues)
+		}
+		values := make([]interface{}, 0, maxVal-minVal+1)
+		for v := minVal; v <= maxVal; v++ {
+			values = append(values, v)
+		}
+		return values, nil
+	case *models.BooleanColorSet:
+		return []interface{}{false, true}, nil
+	case *models.SubsetColorSet:
+		base, err := colorSetValues(cs.GetBase())
+		if err != nil {
+			return nil, err
+		}
+		var values []interface{}
+		for _, v := range base {
+			if cs.IsMember(v) {
+				values = append(values, v)
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("color set %s is not enumerable", colorSet.Name())
+}
+
+// SubsetPredicate compiles the predicate of a subset color set: a Lua function expression, usually
+// the name of a function declared by the CPN. The predicate is called with the declarations of the
+// CPN visible and must return a boolean.
+func (e *Evaluator) SubsetPredicate(cpn *models.CPN, source string) (models.SubsetPredicate, error) {
+	chunk, err := parse.Parse(strings.NewReader("return ("+source+")(...)"), "<predicate>")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile predicate '%s': %v", source, err)
+	}
+	proto, err := lua.Compile(chunk, "<predicate>")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile predicate '%s': %v", source, err)
+	}
+	return func(value interface{}) (bool, error) {
+		L := e.luaState
+		previous := e.active
+		defer func() { e.active = previous }()
+		if err := e.activateDeclarations(&EvaluationContext{CPN: cpn}); err != nil {
+			return false, err
+		}
+		arg, err := e.goValueToLua(value)
+		if err != nil {
+			return false, err
+		}
+		fn := L.NewFunctionFromProto(proto)
+		fn.Env = e.active.env
+		L.Push(fn)
+		L.Push(arg)
+		if err := L.PCall(1, 1, nil); err != nil {
+			return false, fmt.Errorf("failed to evaluate predicate '%s': %v", source, err)
+		}
+		result := L.Get(-1)
+		L.Pop(1)
+		b, ok := result.(lua.LBool)
+		if !ok {
+			return false, fmt.Errorf("predicate '%s' did not return a boolean value, got %s", source, result.Type())
+		}
+		return bool(b), nil
+	}, nil
+}
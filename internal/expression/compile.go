@@ -0,0 +1,256 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+
+	"go-petri-flow/internal/models"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// ExpressionKind selects how an inscription is turned into a Lua chunk
+type ExpressionKind int
+
+const (
+	GuardExpression  ExpressionKind = iota // boolean expression
+	ArcExpression                          // expression (or statements ending in an expression) producing a value
+	ActionExpression                       // statements run for their side effects
+)
+
+// resultVar receives the value of multi-statement expressions
+const resultVar = "__gpf_arc_result"
+
+// maxCompiledExpressions bounds the cache of inscriptions compiled on evaluation; it is cleared
+// when full. Inscriptions compiled for a CPN (see CompileNet) are kept until it is released.
+const maxCompiledExpressions = 4096
+
+// compiledExpression is a precompiled inscription
+type compiledExpression struct {
+	proto     *lua.FunctionProto
+	useResult bool // the value is left in resultVar instead of being returned
+}
+
+// pinnedExpression is an inscription compiled for the CPNs using it
+type pinnedExpression struct {
+	compiled *compiledExpression
+	nets     int // number of CPN versions the inscription was compiled for
+}
+
+// Compile precompiles an inscription so later evaluations run the cached function prototype.
+// Inscriptions not compiled up front are compiled on their first evaluation.
+func (e *Evaluator) Compile(expression string, kind ExpressionKind) error {
+	_, err := e.compiled(expression, kind)
+	return err
+}
+
+// NetCompilation holds the declarations and inscriptions of a CPN compiled by CompileNet until
+// Install makes them the environment and cached prototypes of the CPN's version, so a CPN that
+// fails to compile leaves the loaded ones untouched
+type NetCompilation struct {
+	evaluator *Evaluator
+	key       netKey
+	decl      *netDeclarations
+	codes     map[string]*compiledExpression
+}
+
+// CompileNet compiles the declarations of a CPN without installing them; its inscriptions are
+// added with Compile
+func (e *Evaluator) CompileNet(cpn *models.CPN) (*NetCompilation, error) {
+	decl, err := e.compileDeclarations(cpn)
+	if err != nil {
+		return nil, err
+	}
+	return &NetCompilation{evaluator: e, key: netKeyOf(cpn), decl: decl, codes: make(map[string]*compiledExpression)}, nil
+}
+
+// Compile precompiles an inscription of the CPN
+func (c *NetCompilation) Compile(expression string, kind ExpressionKind) error {
+	compiled, err := c.evaluator.compiled(expression, kind)
+	if err != nil {
+		return err
+	}
+	code, _ := inscriptionChunk(expression, kind)
+	c.codes[code] = compiled
+	return nil
+}
+
+// Install makes the compiled declarations the environment of the CPN's version and keeps the
+// prototypes of its inscriptions cached, independent of the inscriptions compiled on evaluation,
+// until the version is released (see ReleaseNet). Installing a version again replaces both.
+func (c *NetCompilation) Install() {
+	e := c.evaluator
+	e.declarations[c.key] = c.decl
+	e.release(c.key)
+	pins := make(map[string]bool, len(c.codes))
+	for code, compiled := range c.codes {
+		pins[code] = true
+		if p, ok := e.pinned[code]; ok {
+			p.nets++
+		} else {
+			e.pinned[code] = &pinnedExpression{compiled: compiled, nets: 1}
+		}
+	}
+	e.pins[c.key] = pins
+}
+
+// ReleaseNet releases the inscriptions compiled for all versions of a CPN
+func (e *Evaluator) ReleaseNet(netID string) {
+	for key := range e.pins {
+		if key.id == netID {
+			e.release(key)
+		}
+	}
+}
+
+// ReleaseNetVersion releases the inscriptions compiled for a version of a CPN
+func (e *Evaluator) ReleaseNetVersion(netID string, version int) {
+	e.release(netKey{id: netID, version: version})
+}
+
+// release unpins the inscriptions compiled for a version of a CPN
+func (e *Evaluator) release(key netKey) {
+	for code := range e.pins[key] {
+		if p := e.pinned[code]; p != nil {
+			if p.nets--; p.nets == 0 {
+				delete(e.pinned, code)
+			}
+		}
+	}
+	delete(e.pins, key)
+}
+
+// IsCompiled reports whether the prototype of an inscription is cached
+func (e *Evaluator) IsCompiled(expression string, kind ExpressionKind) bool {
+	code, _ := inscriptionChunk(expression, kind)
+	_, pinned := e.pinned[code]
+	_, cached := e.compiledCache[code]
+	return pinned || cached
+}
+
+// compiled returns the cached prototype of an inscription, compiling it on a miss
+func (e *Evaluator) compiled(expression string, kind ExpressionKind) (*compiledExpression, error) {
+	code, useResult := inscriptionChunk(expression, kind)
+	if p, ok := e.pinned[code]; ok {
+		return p.compiled, nil
+	}
+	if c, ok := e.compiledCache[code]; ok {
+		return c, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(code), "<string>")
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, "<string>")
+	if err != nil {
+		return nil, err
+	}
+	if len(e.compiledCache) >= maxCompiledExpressions {
+		e.compiledCache = make(map[string]*compiledExpression)
+	}
+	c := &compiledExpression{proto: proto, useResult: useResult}
+	e.compiledCache[code] = c
+	return c, nil
+}
+
+// inscriptionChunk turns an inscription of a kind into a Lua chunk
+func inscriptionChunk(expression string, kind ExpressionKind) (string, bool) {
+	switch kind {
+	case ActionExpression:
+		return actionChunk(expression), false
+	case ArcExpression:
+		return arcChunk(expression)
+	}
+	return expressionChunk(expression)
+}
+
+// run executes a compiled inscription with env as its global table and returns its value (nil for actions)
+func (e *Evaluator) run(c *compiledExpression, returnsValue bool, env *lua.LTable) (interface{}, error) {
+	L := e.luaState
+	fn := L.NewFunctionFromProto(c.proto)
+	fn.Env = env
+	L.Push(fn)
+	results := 0
+	if returnsValue && !c.useResult {
+		results = 1
+	}
+	if err := L.PCall(0, results, nil); err != nil {
+		return nil, err
+	}
+	if !returnsValue {
+		return nil, nil
+	}
+	if c.useResult {
+		result := e.luaValueToGo(L.GetField(env, resultVar))
+		L.SetField(env, resultVar, lua.LNil)
+		return result, nil
+	}
+	result := e.luaValueToGo(L.Get(-1))
+	L.Pop(1)
+	return result, nil
+}
+
+// arcChunk turns an arc inscription into a Lua chunk, compiling multiset and time inscriptions
+func arcChunk(expression string) (string, bool) {
+	if expr, delay, ok := SplitTimed(expression); ok {
+		code, useResult := arcChunk(expr)
+		if useResult {
+			// Statements leave the value in resultVar, which the delayed function returns
+			code += "; return " + resultVar
+		}
+		return timedChunk(code, delay), false
+	}
+	if terms, ok := SplitMultiset(expression); ok {
+		return multisetChunk(terms), false
+	}
+	return expressionChunk(expression)
+}
+
+// expressionChunk turns an expression into a Lua chunk. Single expressions are returned; for
+// multi-statement expressions (containing 'local ', ';' or newlines) without an explicit return
+// the last expression is captured in resultVar.
+func expressionChunk(expression string) (string, bool) {
+	trimmed := strings.TrimSpace(expression)
+	lower := strings.ToLower(trimmed)
+	if strings.Contains(lower, "return") {
+		return trimmed, false
+	}
+	if !strings.Contains(trimmed, "local ") && !strings.Contains(trimmed, ";") && !strings.Contains(trimmed, "\n") {
+		return "return " + trimmed, false
+	}
+
+	// Split by semicolons to find last expression part
+	parts := strings.Split(trimmed, ";")
+	last := strings.TrimSpace(parts[len(parts)-1])
+	prefix := strings.Join(parts[:len(parts)-1], ";")
+	if last == "" { // handle trailing semicolon: try previous non-empty
+		for i := len(parts) - 2; i >= 0; i-- {
+			candidate := strings.TrimSpace(parts[i])
+			if candidate != "" {
+				last = candidate
+				parts = parts[:i]
+				break
+			}
+		}
+		prefix = strings.Join(parts, ";")
+	}
+	assignment := fmt.Sprintf("%s = (%s)", resultVar, last)
+	if strings.TrimSpace(prefix) != "" {
+		return prefix + "; " + assignment, true
+	}
+	return assignment, true
+}
+
+// actionChunk turns an action into a Lua chunk. Actions are full Lua chunks; plain assignments
+// get an implicit do-end wrapper so single line assignments work uniformly.
+func actionChunk(action string) string {
+	if !strings.HasPrefix(strings.TrimSpace(action), "do") && strings.Contains(action, "=") {
+		// wrap only if it's a plain assignment without control keywords or return
+		lowered := strings.ToLower(action)
+		if !strings.Contains(lowered, "return") && !strings.Contains(lowered, "if ") && !strings.Contains(lowered, "for ") && !strings.Contains(lowered, "while ") {
+			return "do " + action + " end"
+		}
+	}
+	return action
+}
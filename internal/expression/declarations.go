@@ -0,0 +1,143 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+
+	"go-petri-flow/internal/models"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// netDeclarations is the global environment of one CPN: its compiled declarations and the global
+// variables assigned by its actions. Lookups of other names fall through to the built-in globals.
+type netDeclarations struct {
+	source    string
+	env       *lua.LTable // values and functions declared by the net, globals assigned by its actions
+	scopeMeta *lua.LTable // metatable of evaluation scopes, resolving names that are not bound from env
+	version   uint64      // changes whenever the globals of env are assigned
+}
+
+// newNetDeclarations creates an empty net environment
+func (e *Evaluator) newNetDeclarations(source string) *netDeclarations {
+	L := e.luaState
+	env := L.NewTable()
+	meta := L.NewTable()
+	meta.RawSetString("__index", L.G.Global)
+	L.SetMetatable(env, meta)
+	scopeMeta := L.NewTable()
+	scopeMeta.RawSetString("__index", env)
+	e.netVersion++
+	return &netDeclarations{source: source, env: env, scopeMeta: scopeMeta, version: e.netVersion}
+}
+
+// netKey identifies a deployed version of a CPN; CPNs that are not deployed have version 0
+type netKey struct {
+	id      string
+	version int
+}
+
+// netKeyOf returns the key of a CPN's environment
+func netKeyOf(cpn *models.CPN) netKey {
+	return netKey{id: cpn.ID, version: cpn.Version}
+}
+
+// compileDeclarations compiles and runs the declarations of a CPN in a new environment
+func (e *Evaluator) compileDeclarations(cpn *models.CPN) (*netDeclarations, error) {
+	decl := e.newNetDeclarations(cpn.Declarations)
+	if strings.TrimSpace(cpn.Declarations) != "" {
+		L := e.luaState
+		fn, err := L.LoadString(cpn.Declarations)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile declarations of CPN %s: %v", cpn.ID, err)
+		}
+		L.SetFEnv(fn, decl.env)
+		L.Push(fn)
+		if err := L.PCall(0, lua.MultRet, nil); err != nil {
+			L.SetTop(0)
+			return nil, fmt.Errorf("failed to load declarations of CPN %s: %v", cpn.ID, err)
+		}
+		L.SetTop(0)
+	}
+	return decl, nil
+}
+
+// LoadDeclarations compiles and runs the Lua declarations of a version of a CPN (functions,
+// constants and value tables) in an environment of their own. Declarations see the built-in and
+// registered Go functions; their values are visible to the evaluations of that version only.
+// Loading again replaces them, together with the globals assigned by actions of the version.
+func (e *Evaluator) LoadDeclarations(cpn *models.CPN) error {
+	decl, err := e.compileDeclarations(cpn)
+	if err != nil {
+		return err
+	}
+	e.declarations[netKeyOf(cpn)] = decl
+	return nil
+}
+
+// UnloadDeclarations discards the compiled declarations and action globals of all versions of a CPN
+func (e *Evaluator) UnloadDeclarations(netID string) {
+	for key := range e.declarations {
+		if key.id == netID {
+			delete(e.declarations, key)
+		}
+	}
+}
+
+// UnloadDeclarationsVersion discards the compiled declarations and action globals of a version of a CPN
+func (e *Evaluator) UnloadDeclarationsVersion(netID string, version int) {
+	delete(e.declarations, netKey{id: netID, version: version})
+}
+
+// activateDeclarations makes the environment of the context's CPN the one of the next evaluation,
+// compiling its declarations on first use (e.g. for nets evaluated by a fresh engine). Evaluations
+// without a CPN share the evaluator's own environment.
+func (e *Evaluator) activateDeclarations(context *EvaluationContext) error {
+	if context.CPN == nil {
+		e.active = e.unscoped
+		return nil
+	}
+	key := netKeyOf(context.CPN)
+	decl, ok := e.declarations[key]
+	if !ok || decl.source != context.CPN.Declarations {
+		if err := e.LoadDeclarations(context.CPN); err != nil {
+			return err
+		}
+		decl = e.declarations[key]
+	}
+	e.active = decl
+	return nil
+}
+
+// NetVersion returns a number that changes whenever the globals of a CPN are (re)declared or
+// assigned by one of its actions; 0 while the CPN has no environment yet
+func (e *Evaluator) NetVersion(cpn *models.CPN) uint64 {
+	if decl, ok := e.declarations[netKeyOf(cpn)]; ok {
+		return decl.version
+	}
+	return 0
+}
+
+// hiddenGlobals are globals whose values change between evaluations
+var hiddenGlobals = map[string]bool{"places": true, "global_clock": true, "os": true, "io": true}
+
+// IsBuiltin reports whether a name is a global shared by all CPNs whose value is the same for
+// every evaluation: a built-in or registered Go function, namespace or library (math, string, ...)
+func (e *Evaluator) IsBuiltin(name string) bool {
+	return !hiddenGlobals[name] && e.luaState.G.Global.RawGetString(name) != lua.LNil
+}
+
+// netValue returns a global variable of an environment converted to Go, nil if it is not defined
+func (e *Evaluator) netValue(decl *netDeclarations, varName string) interface{} {
+	return e.luaValueToGo(e.luaState.GetField(decl.env, varName))
+}
+
+// GetNetValue returns a global variable of a CPN (declared or assigned by one of its actions)
+// converted to Go. Returns nil if the variable is not defined.
+func (e *Evaluator) GetNetValue(cpn *models.CPN, varName string) interface{} {
+	decl, ok := e.declarations[netKeyOf(cpn)]
+	if !ok {
+		return nil
+	}
+	return e.netValue(decl, varName)
+}
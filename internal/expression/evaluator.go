@@ -2,6 +2,7 @@ package expression
 
 import (
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 
@@ -15,7 +16,11 @@ type EvaluationContext struct {
 	TokenBindings map[string]*models.Token   // Variable name -> Token
 	GlobalClock   int                        // Current global clock
 	PlaceTokens   map[string][]*models.Token // Place name -> Available tokens
-	ColorSets     map[string]models.ColorSet // Color set registry
+	Marking       *models.Marking            // Places not in PlaceTokens are read from this marking on access
+	ColorSets     map[string]models.ColorSet // Color sets visible to cs.* functions, besides those of the CPN
+	Random        *rand.Rand                 // Seeded random source of the simulation run (nil = evaluator default)
+	CPN           *models.CPN                // Net whose declarations are in scope (nil = none)
+	Action        *ActionEffects             // Uncommitted assignments of an action, visible to the evaluation
 }
 
 // NewEvaluationContext creates a new evaluation context
@@ -30,7 +35,21 @@ func NewEvaluationContext() *EvaluationContext {
 
 // Evaluator handles expression evaluation using gopher-lua
 type Evaluator struct {
-	luaState *lua.LState
+	luaState      *lua.LState
+	random        *rand.Rand                     // random source of the evaluation in progress
+	defaultRandom *rand.Rand                     // used when the context carries no random source
+	functions     map[string]*Function           // registered Go functions by qualified name
+	namespaces    map[string]*lua.LTable         // namespace tables created for Go functions
+	declarations  map[netKey]*netDeclarations    // net environments by CPN ID and version
+	unscoped      *netDeclarations               // environment of evaluations without a CPN
+	active        *netDeclarations               // environment of the evaluation in progress
+	netVersion    uint64                         // last version given to a net environment
+	compiledCache map[string]*compiledExpression // inscriptions compiled on evaluation by Lua chunk
+	pinned        map[string]*pinnedExpression   // inscriptions compiled for CPNs by Lua chunk
+	pins          map[netKey]map[string]bool     // Lua chunks compiled per CPN ID and version
+	multisetMeta  *lua.LTable                    // metatable marking multiset values
+	delayMeta     *lua.LTable                    // metatable marking delay() results
+	context       *EvaluationContext             // context of the evaluation in progress
 }
 
 // NewEvaluator creates a new expression evaluator
@@ -38,11 +57,19 @@ func NewEvaluator() *Evaluator {
 	L := lua.NewState()
 
 	evaluator := &Evaluator{
-		luaState: L,
+		luaState:      L,
+		defaultRandom: rand.New(rand.NewSource(0)),
+		functions:     make(map[string]*Function),
+		namespaces:    make(map[string]*lua.LTable),
+		declarations:  make(map[netKey]*netDeclarations),
+		compiledCache: make(map[string]*compiledExpression),
+		pinned:        make(map[string]*pinnedExpression),
+		pins:          make(map[netKey]map[string]bool),
 	}
 
 	// Register CPN-specific functions
 	evaluator.registerCPNFunctions()
+	evaluator.unscoped = evaluator.newNetDeclarations("")
 
 	return evaluator
 }
@@ -54,17 +81,13 @@ func (e *Evaluator) Close() {
 	}
 }
 
-// GetGlobalValue returns the current Lua global value for a variable name converted to Go.
-// Returns nil if the variable is not defined.
+// GetGlobalValue returns the current Lua global value for a variable name converted to Go, as seen by
+// evaluations without a CPN (see GetNetValue). Returns nil if the variable is not defined.
 func (e *Evaluator) GetGlobalValue(varName string) interface{} {
 	if e.luaState == nil {
 		return nil
 	}
-	lv := e.luaState.GetGlobal(varName)
-	if lv == lua.LNil {
-		return nil
-	}
-	return e.luaValueToGo(lv)
+	return e.netValue(e.unscoped, varName)
 }
 
 // EvaluateGuard evaluates a guard expression and returns true/false
@@ -74,12 +97,13 @@ func (e *Evaluator) EvaluateGuard(expression string, context *EvaluationContext)
 	}
 
 	// Set up the Lua environment with context
-	if err := e.setupLuaContext(context); err != nil {
+	scope, err := e.setupLuaContext(context)
+	if err != nil {
 		return false, fmt.Errorf("failed to setup Lua context: %v", err)
 	}
 
 	// Evaluate the expression
-	result, err := e.evaluateLuaExpression(expression)
+	result, err := e.evaluateLuaExpression(expression, GuardExpression, context.env(scope))
 	if err != nil {
 		return false, fmt.Errorf("failed to evaluate guard expression '%s': %v", expression, err)
 	}
@@ -100,11 +124,12 @@ func (e *Evaluator) EvaluateArcExpression(expression string, context *Evaluation
 	}
 
 	// Set up the Lua environment with context
-	if err := e.setupLuaContext(context); err != nil {
+	scope, err := e.setupLuaContext(context)
+	if err != nil {
 		return nil, fmt.Errorf("failed to setup Lua context: %v", err)
 	}
 
-	result, err := e.evaluateLuaExpression(expression)
+	result, err := e.evaluateLuaExpression(expression, ArcExpression, context.env(scope))
 	if err != nil {
 		return nil, fmt.Errorf("failed to evaluate arc expression '%s': %v", expression, err)
 	}
@@ -115,129 +140,164 @@ func (e *Evaluator) EvaluateArcExpression(expression string, context *Evaluation
 // EvaluateAction executes an action expression that may contain statements (assignments, loops, etc.).
 // It doesn't enforce a return value. Any final expression result is ignored.
 func (e *Evaluator) EvaluateAction(action string, context *EvaluationContext) error {
+	effects, err := e.RunAction(action, context)
+	if err != nil {
+		return err
+	}
+	effects.Commit()
+	return nil
+}
+
+// ActionEffects are the global variable assignments of an action run with RunAction
+type ActionEffects struct {
+	evaluator *Evaluator
+	env       *lua.LTable      // the action's global table; reads fall through to the evaluation scope
+	net       *netDeclarations // environment the assignments are committed to
+}
+
+// RunAction executes an action without assigning global variables: its assignments are buffered
+// in the returned effects and only applied to the environment of the context's CPN by Commit, so a
+// firing that fails afterwards can discard them. Mutations of tables reachable from the globals
+// are not buffered; take a Savepoint to undo them.
+func (e *Evaluator) RunAction(action string, context *EvaluationContext) (*ActionEffects, error) {
+	scope, err := e.setupLuaContext(context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup Lua context: %v", err)
+	}
+	L := e.luaState
+	env := L.NewTable()
+	meta := L.NewTable()
+	meta.RawSetString("__index", scope)
+	L.SetMetatable(env, meta)
+	effects := &ActionEffects{evaluator: e, env: env, net: e.active}
 	if action == "" {
-		return nil
+		return effects, nil
 	}
-	if err := e.setupLuaContext(context); err != nil {
-		return fmt.Errorf("failed to setup Lua context: %v", err)
-	}
-	// For actions we allow full Lua chunks. Ensure it compiles by leaving as-is.
-	// Provide implicit do-end wrapper so single line assignment still works uniformly.
-	chunk := action
-	if !strings.HasPrefix(strings.TrimSpace(action), "do") && strings.Contains(action, "=") {
-		// wrap only if it's a plain assignment without control keywords or return
-		lowered := strings.ToLower(action)
-		if !strings.Contains(lowered, "return") && !strings.Contains(lowered, "if ") && !strings.Contains(lowered, "for ") && !strings.Contains(lowered, "while ") {
-			chunk = "do " + action + " end"
-		}
+	// For actions we allow full Lua chunks (see actionChunk)
+	compiled, err := e.compiled(action, ActionExpression)
+	if err == nil {
+		_, err = e.run(compiled, false, env)
 	}
-	if err := e.luaState.DoString(chunk); err != nil {
-		return fmt.Errorf("Lua action execution error: %v", err)
+	if err != nil {
+		return nil, fmt.Errorf("Lua action execution error: %v", err)
 	}
-	return nil
+	return effects, nil
 }
 
-// setupLuaContext sets up the Lua environment with the evaluation context
-func (e *Evaluator) setupLuaContext(context *EvaluationContext) error {
+// env returns the global table of an evaluation: the one of the context's action if there is one,
+// otherwise the evaluation scope
+func (ctx *EvaluationContext) env(scope *lua.LTable) *lua.LTable {
+	if ctx.Action == nil {
+		return scope
+	}
+	return ctx.Action.env
+}
+
+// Value returns a variable as the action left it (its assignment, or the global value)
+func (a *ActionEffects) Value(varName string) interface{} {
+	return a.evaluator.luaValueToGo(a.evaluator.luaState.GetField(a.env, varName))
+}
+
+// Commit assigns the action's global variables in the environment of its CPN
+func (a *ActionEffects) Commit() {
+	assigned := false
+	a.env.ForEach(func(key, value lua.LValue) {
+		a.net.env.RawSet(key, value)
+		assigned = true
+	})
+	if assigned {
+		a.evaluator.netVersion++
+		a.net.version = a.evaluator.netVersion
+	}
+}
+
+// setupLuaContext sets up the Lua environment with the evaluation context and returns the scope of
+// the evaluation: a global table holding the bindings, whose other names resolve from the
+// environment of the evaluated net
+func (e *Evaluator) setupLuaContext(context *EvaluationContext) (*lua.LTable, error) {
 	L := e.luaState
+	e.context = context
+
+	// Make the declarations of the evaluated net visible
+	if err := e.activateDeclarations(context); err != nil {
+		return nil, err
+	}
+	scope := L.NewTable()
+	L.SetMetatable(scope, e.active.scopeMeta)
 
 	// Set global clock
 	L.SetGlobal("global_clock", lua.LNumber(context.GlobalClock))
 
-	// Set token bindings as variables
+	// Random distribution functions draw from the run's seeded source
+	e.random = context.Random
+	if e.random == nil {
+		e.random = e.defaultRandom
+	}
+
+	// Set token bindings as variables of the scope, so they never outlive the evaluation
 	for varName, token := range context.TokenBindings {
 		luaValue, err := e.goValueToLua(token.Value)
 		if err != nil {
-			return fmt.Errorf("failed to convert token value for variable %s: %v", varName, err)
+			return nil, fmt.Errorf("failed to convert token value for variable %s: %v", varName, err)
 		}
-		L.SetGlobal(varName, luaValue)
+		scope.RawSetString(varName, luaValue)
 
 		// Also set timestamp for the variable
-		L.SetGlobal(varName+"_timestamp", lua.LNumber(token.Timestamp))
+		scope.RawSetString(varName+"_timestamp", lua.LNumber(token.Timestamp))
 	}
 
-	// Set place tokens (for more complex expressions that might need to access place contents)
+	// Place tokens (for more complex expressions that might need to access place contents) are
+	// converted on first access, so evaluations do not pay for the whole marking
 	placeTable := L.NewTable()
-	for placeName, tokens := range context.PlaceTokens {
-		tokenTable := L.NewTable()
-		for i, token := range tokens {
-			tokenLuaTable := L.NewTable()
-
-			valueLua, err := e.goValueToLua(token.Value)
-			if err != nil {
-				return fmt.Errorf("failed to convert token value for place %s: %v", placeName, err)
-			}
-
-			tokenLuaTable.RawSetString("value", valueLua)
-			tokenLuaTable.RawSetString("timestamp", lua.LNumber(token.Timestamp))
-
-			tokenTable.RawSetInt(i+1, tokenLuaTable) // Lua arrays are 1-indexed
+	meta := L.NewTable()
+	meta.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		tokens, ok := context.placeTokens(L.CheckString(2))
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
 		}
-		placeTable.RawSetString(placeName, tokenTable)
-	}
+		tokenTable, err := e.tokensToLua(tokens)
+		if err != nil {
+			L.RaiseError("failed to convert token value for place %s: %v", L.CheckString(2), err)
+			return 0
+		}
+		placeTable.RawSet(L.Get(2), tokenTable)
+		L.Push(tokenTable)
+		return 1
+	}))
+	L.SetMetatable(placeTable, meta)
 	L.SetGlobal("places", placeTable)
 
-	return nil
+	return scope, nil
 }
 
-// evaluateLuaExpression evaluates a Lua expression and returns the result
-func (e *Evaluator) evaluateLuaExpression(expression string) (interface{}, error) {
+// tokensToLua converts tokens to a Lua list of {value, timestamp} tables
+func (e *Evaluator) tokensToLua(tokens []*models.Token) (*lua.LTable, error) {
 	L := e.luaState
-
-	trimmed := strings.TrimSpace(expression)
-	lower := strings.ToLower(trimmed)
-	useReturn := true
-	useResultVar := false
-	resultVar := "__gpf_arc_result"
-	luaCode := trimmed
-
-	// Heuristic: if multi-statement (contains 'local ' or ';' or newline) and no explicit return, capture last expr.
-	if !strings.Contains(lower, "return") && (strings.Contains(trimmed, "local ") || strings.Contains(trimmed, ";") || strings.Contains(trimmed, "\n")) {
-		// Split by semicolons to find last expression part
-		parts := strings.Split(trimmed, ";")
-		last := strings.TrimSpace(parts[len(parts)-1])
-		prefix := strings.Join(parts[:len(parts)-1], ";")
-		if last == "" { // handle trailing semicolon: try previous non-empty
-			for i := len(parts) - 2; i >= 0; i-- {
-				candidate := strings.TrimSpace(parts[i])
-				if candidate != "" {
-					last = candidate
-					parts = parts[:i]
-					break
-				}
-			}
-			prefix = strings.Join(parts, ";")
-		}
-		assignment := fmt.Sprintf("%s = (%s)", resultVar, last)
-		if strings.TrimSpace(prefix) != "" {
-			luaCode = prefix + "; " + assignment
-		} else {
-			luaCode = assignment
+	tokenTable := L.NewTable()
+	for i, token := range tokens {
+		valueLua, err := e.goValueToLua(token.Value)
+		if err != nil {
+			return nil, err
 		}
-		useReturn = false
-		useResultVar = true
-	}
-
-	if useReturn && !strings.Contains(lower, "return") {
-		luaCode = "return " + trimmed
+		tokenLuaTable := L.NewTable()
+		tokenLuaTable.RawSetString("value", valueLua)
+		tokenLuaTable.RawSetString("timestamp", lua.LNumber(token.Timestamp))
+		tokenTable.RawSetInt(i+1, tokenLuaTable) // Lua arrays are 1-indexed
 	}
+	return tokenTable, nil
+}
 
-	if err := L.DoString(luaCode); err != nil {
+// evaluateLuaExpression evaluates a Lua expression using its compiled prototype and returns the result
+func (e *Evaluator) evaluateLuaExpression(expression string, kind ExpressionKind, env *lua.LTable) (interface{}, error) {
+	compiled, err := e.compiled(expression, kind)
+	if err != nil {
 		return nil, fmt.Errorf("Lua execution error: %v", err)
 	}
-
-	var result interface{}
-	if useResultVar {
-		lv := L.GetGlobal(resultVar)
-		result = e.luaValueToGo(lv)
-		// Optionally clear the global to avoid leaking (not strictly necessary)
-		L.SetGlobal(resultVar, lua.LNil)
-	} else {
-		lv := L.Get(-1)
-		result = e.luaValueToGo(lv)
-		L.Pop(1)
+	result, err := e.run(compiled, true, env)
+	if err != nil {
+		return nil, fmt.Errorf("Lua execution error: %v", err)
 	}
-
 	return result, nil
 }
 
@@ -283,6 +343,10 @@ func (e *Evaluator) goValueToLua(value interface{}) (lua.LValue, error) {
 		}
 		return table, nil
 	default:
+		// Typed slices, string-keyed maps and sized numbers convert like their generic forms
+		if generic, ok := genericValue(v); ok {
+			return e.goValueToLua(generic)
+		}
 		// For other types, try to convert to string
 		return lua.LString(fmt.Sprintf("%v", v)), nil
 	}
@@ -305,6 +369,9 @@ func (e *Evaluator) luaValueToGo(value lua.LValue) interface{} {
 	case lua.LString:
 		return string(v)
 	case *lua.LTable:
+		if e.isMultiset(v) {
+			return e.luaMultisetToGo(v)
+		}
 		// Check if it's an array or a map
 		if e.isLuaArray(v) {
 			return e.luaTableToSlice(v)
@@ -383,6 +450,11 @@ func (e *Evaluator) registerCPNFunctions() {
 	L.SetGlobal("token", L.NewFunction(e.luaCreateToken))
 	L.SetGlobal("tuple", L.NewFunction(e.luaCreateTuple))
 	L.SetGlobal("delay", L.NewFunction(e.luaDelay))
+	e.registerMultisetFunctions()
+	e.registerColorSetFunctions()
+
+	// Register seeded random distribution functions
+	e.registerRandomFunctions()
 }
 
 // Lua function implementations
@@ -448,15 +520,7 @@ func (e *Evaluator) luaCreateTuple(L *lua.LState) int {
 
 func (e *Evaluator) luaDelay(L *lua.LState) int {
 	// Create a delayed token (for arc expressions with @+delay syntax)
-	value := L.Get(1)
-	delay := L.Get(2)
-
-	// For now, just return a table with value and delay
-	table := L.NewTable()
-	table.RawSetString("value", value)
-	table.RawSetString("delay", delay)
-
-	L.Push(table)
+	L.Push(e.newDelayed(L.Get(1), L.Get(2)))
 	return 1
 }
 
@@ -482,6 +546,19 @@ func (ctx *EvaluationContext) SetPlaceTokens(placeName string, tokens []*models.
 	ctx.PlaceTokens[placeName] = tokens
 }
 
+// placeTokens returns the tokens of a place from PlaceTokens or, failing that, from the marking
+func (ctx *EvaluationContext) placeTokens(placeName string) ([]*models.Token, bool) {
+	if tokens, ok := ctx.PlaceTokens[placeName]; ok {
+		return tokens, true
+	}
+	if ctx.Marking != nil {
+		if _, ok := ctx.Marking.Places[placeName]; ok {
+			return ctx.Marking.GetTokens(placeName), true
+		}
+	}
+	return nil, false
+}
+
 // SetGlobalClock sets the global clock value
 func (ctx *EvaluationContext) SetGlobalClock(clock int) {
 	ctx.GlobalClock = clock
@@ -509,6 +586,10 @@ func (ctx *EvaluationContext) Clone() *EvaluationContext {
 		GlobalClock:   ctx.GlobalClock,
 		PlaceTokens:   make(map[string][]*models.Token),
 		ColorSets:     make(map[string]models.ColorSet),
+		Random:        ctx.Random,
+		CPN:           ctx.CPN,
+		Marking:       ctx.Marking,
+		Action:        ctx.Action,
 	}
 
 	// Copy token bindings
@@ -0,0 +1,342 @@
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ValueType is the declared type of a parameter or result of a Go function exposed to Lua
+type ValueType string
+
+const (
+	TypeAny    ValueType = "any"
+	TypeInt    ValueType = "int"
+	TypeReal   ValueType = "real"
+	TypeString ValueType = "string"
+	TypeBool   ValueType = "bool"
+	TypeList   ValueType = "list" // []interface{}
+	TypeMap    ValueType = "map"  // map[string]interface{}
+)
+
+// Signature declares the parameters and the result of a Go function
+type Signature struct {
+	Params   []ValueType `json:"params"`
+	Variadic bool        `json:"variadic,omitempty"` // the last parameter may repeat (zero or more times)
+	Result   ValueType   `json:"result,omitempty"`   // empty = no result
+}
+
+// String renders the signature as "(int, string...) -> real"
+func (s Signature) String() string {
+	params := make([]string, len(s.Params))
+	for i, p := range s.Params {
+		params[i] = string(p)
+	}
+	if s.Variadic && len(params) > 0 {
+		params[len(params)-1] += "..."
+	}
+	result := "()"
+	if s.Result != "" {
+		result = string(s.Result)
+	}
+	return "(" + strings.Join(params, ", ") + ") -> " + result
+}
+
+// GoFunction implements a function callable from Lua. Arguments are converted from Lua and
+// checked against the declared signature before the call; the result is converted back.
+type GoFunction func(args []interface{}) (interface{}, error)
+
+// Function is a Go function exposed to guards, arc expressions and actions as namespace.name(...)
+type Function struct {
+	Namespace   string     `json:"namespace"` // dotted path of Lua identifiers, e.g. "fx" or "acme.refdata"
+	Name        string     `json:"name"`
+	Signature   Signature  `json:"signature"`
+	Description string     `json:"description,omitempty"`
+	Call        GoFunction `json:"-"`
+}
+
+// QualifiedName returns namespace.name
+func (f *Function) QualifiedName() string {
+	return f.Namespace + "." + f.Name
+}
+
+var luaIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true, "false": true,
+	"for": true, "function": true, "goto": true, "if": true, "in": true, "local": true, "nil": true,
+	"not": true, "or": true, "repeat": true, "return": true, "then": true, "true": true, "until": true, "while": true,
+}
+
+func validIdentifier(name string) bool {
+	return luaIdentifier.MatchString(name) && !luaKeywords[name]
+}
+
+// Validate checks names and signature of a function
+func (f *Function) Validate() error {
+	if f.Namespace == "" {
+		return fmt.Errorf("function %s must have a namespace", f.Name)
+	}
+	for _, part := range strings.Split(f.Namespace, ".") {
+		if !validIdentifier(part) {
+			return fmt.Errorf("invalid namespace %q", f.Namespace)
+		}
+	}
+	if !validIdentifier(f.Name) {
+		return fmt.Errorf("invalid function name %q", f.Name)
+	}
+	if f.Call == nil {
+		return fmt.Errorf("function %s has no implementation", f.QualifiedName())
+	}
+	if f.Signature.Variadic && len(f.Signature.Params) == 0 {
+		return fmt.Errorf("variadic function %s needs at least one parameter", f.QualifiedName())
+	}
+	for _, p := range f.Signature.Params {
+		if !p.valid() {
+			return fmt.Errorf("function %s has invalid parameter type %q", f.QualifiedName(), p)
+		}
+	}
+	if f.Signature.Result != "" && !f.Signature.Result.valid() {
+		return fmt.Errorf("function %s has invalid result type %q", f.QualifiedName(), f.Signature.Result)
+	}
+	return nil
+}
+
+func (t ValueType) valid() bool {
+	switch t {
+	case TypeAny, TypeInt, TypeReal, TypeString, TypeBool, TypeList, TypeMap:
+		return true
+	}
+	return false
+}
+
+// RegisterFunction exposes a Go function to Lua under its namespace. The namespace table is
+// created on first use; namespaces may not shadow existing globals such as math or tuple.
+func (e *Evaluator) RegisterFunction(fn Function) error {
+	if err := fn.Validate(); err != nil {
+		return err
+	}
+	name := fn.QualifiedName()
+	if _, exists := e.functions[name]; exists {
+		return fmt.Errorf("function %s is already registered", name)
+	}
+	table, err := e.namespaceTable(fn.Namespace)
+	if err != nil {
+		return err
+	}
+	if table.RawGetString(fn.Name) != lua.LNil {
+		return fmt.Errorf("%s is already defined", name)
+	}
+
+	registered := fn
+	table.RawSetString(fn.Name, e.luaState.NewFunction(func(L *lua.LState) int {
+		return e.callGoFunction(L, &registered)
+	}))
+	e.functions[name] = &registered
+	return nil
+}
+
+// Functions returns the registered Go functions ordered by qualified name
+func (e *Evaluator) Functions() []Function {
+	functions := make([]Function, 0, len(e.functions))
+	for _, fn := range e.functions {
+		functions = append(functions, *fn)
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].QualifiedName() < functions[j].QualifiedName() })
+	return functions
+}
+
+// namespaceTable returns the table of a (dotted) namespace, creating it if needed.
+// Only tables created for namespaces can be extended.
+func (e *Evaluator) namespaceTable(namespace string) (*lua.LTable, error) {
+	if table, ok := e.namespaces[namespace]; ok {
+		return table, nil
+	}
+	L := e.luaState
+	parts := strings.Split(namespace, ".")
+	var parent *lua.LTable
+	for i := range parts {
+		path := strings.Join(parts[:i+1], ".")
+		if table, ok := e.namespaces[path]; ok {
+			parent = table
+			continue
+		}
+		var existing lua.LValue
+		if parent == nil {
+			existing = L.GetGlobal(parts[i])
+		} else {
+			existing = parent.RawGetString(parts[i])
+		}
+		if existing != lua.LNil {
+			return nil, fmt.Errorf("namespace %s conflicts with existing Lua value %s", namespace, path)
+		}
+		table := L.NewTable()
+		if parent == nil {
+			L.SetGlobal(parts[i], table)
+		} else {
+			parent.RawSetString(parts[i], table)
+		}
+		e.namespaces[path] = table
+		parent = table
+	}
+	return parent, nil
+}
+
+// callGoFunction converts and checks the Lua arguments, calls the Go function and pushes its result
+func (e *Evaluator) callGoFunction(L *lua.LState, fn *Function) int {
+	sig := fn.Signature
+	top := L.GetTop()
+	minArgs := len(sig.Params)
+	if sig.Variadic {
+		minArgs--
+	}
+	if top < minArgs || (!sig.Variadic && top > len(sig.Params)) {
+		L.RaiseError("%s%s called with %d arguments", fn.QualifiedName(), sig, top)
+		return 0
+	}
+
+	args := make([]interface{}, top)
+	for i := 1; i <= top; i++ {
+		paramType := sig.Params[min(i, len(sig.Params))-1]
+		value, ok := convertArgument(e.luaValueToGo(L.Get(i)), paramType)
+		if !ok {
+			L.ArgError(i, fmt.Sprintf("%s expected, got %s", paramType, L.Get(i).Type()))
+			return 0
+		}
+		args[i-1] = value
+	}
+
+	result, err := fn.Call(args)
+	if err != nil {
+		L.RaiseError("%s: %v", fn.QualifiedName(), err)
+		return 0
+	}
+	if sig.Result == "" {
+		return 0
+	}
+	if generic, ok := genericValue(result); ok {
+		result = generic
+	}
+	if result != nil {
+		converted, ok := convertArgument(result, sig.Result)
+		if !ok {
+			L.RaiseError("%s returned %T, declared %s", fn.QualifiedName(), result, sig.Result)
+			return 0
+		}
+		result = converted
+	}
+	lv, err := e.goValueToLua(result)
+	if err != nil {
+		L.RaiseError("%s: %v", fn.QualifiedName(), err)
+		return 0
+	}
+	L.Push(lv)
+	return 1
+}
+
+// convertArgument checks a converted value against a declared type, normalizing numbers
+// (int for TypeInt, float64 for TypeReal) and empty tables. nil only matches TypeAny.
+func convertArgument(value interface{}, t ValueType) (interface{}, bool) {
+	switch t {
+	case TypeAny:
+		return value, true
+	case TypeInt:
+		switch v := value.(type) {
+		case int:
+			return v, true
+		case int64:
+			return int(v), true
+		case int32:
+			return int(v), true
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), true
+			}
+		}
+	case TypeReal:
+		if f, ok := toFloat64(value); ok {
+			return f, true
+		}
+	case TypeString:
+		s, ok := value.(string)
+		return s, ok
+	case TypeBool:
+		b, ok := value.(bool)
+		return b, ok
+	case TypeList:
+		switch v := value.(type) {
+		case []interface{}:
+			return v, true
+		case map[string]interface{}:
+			if len(v) == 0 { // an empty Lua table converts to a map
+				return []interface{}{}, true
+			}
+		}
+	case TypeMap:
+		switch v := value.(type) {
+		case map[string]interface{}:
+			return v, true
+		case []interface{}:
+			if len(v) == 0 {
+				return map[string]interface{}{}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// genericValue converts typed Go slices and string-keyed maps (e.g. []string or
+// map[string]float64 returned by host functions) and sized numbers to the generic
+// forms understood by goValueToLua. Returns false for values that need no conversion.
+func genericValue(value interface{}) (interface{}, bool) {
+	switch value.(type) {
+	case nil, bool, int, int64, float64, string, []interface{}, map[string]interface{}:
+		return nil, false
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+		return items, true
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		entries := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			entries[iter.Key().String()] = iter.Value().Interface()
+		}
+		return entries, true
+	}
+	return nil, false
+}
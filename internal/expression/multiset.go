@@ -0,0 +1,243 @@
+package expression
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Multiset inscriptions
+//
+// An arc inscription may evaluate to a multiset of tokens instead of a single token, written
+// in CPN notation as terms joined by "++", each with an optional count: 2'x ++ 1'(x+1).
+// A Lua list becomes a multiset with multiset{...}. Elements may be delayed with delay(v, d).
+// An inscription ending in "@+ d" delays all of its tokens by d (CPN Tools time inscriptions).
+
+// MultisetValue is the value of a multiset inscription: one element per token, in order
+type MultisetValue []interface{}
+
+// MultisetTerm is one "count'expression" term of a multiset inscription
+type MultisetTerm struct {
+	Count      int
+	Expression string
+}
+
+// multisetBuilder is the Lua function multiset inscriptions are compiled to
+const multisetBuilder = "__gpf_multiset"
+
+// timedBuilder is the Lua function "@+" time inscriptions are compiled to
+const timedBuilder = "__gpf_timed"
+
+var termCount = regexp.MustCompile(`^\s*(\d+)\s*'`)
+
+// SplitMultiset splits a multiset inscription into its terms. ok is false if the inscription
+// has neither a count nor "++", i.e. it is an ordinary expression.
+func SplitMultiset(inscription string) (terms []MultisetTerm, ok bool) {
+	rest := inscription
+	multiset := false
+	for {
+		term := MultisetTerm{Count: 1}
+		if m := termCount.FindStringSubmatch(rest); m != nil {
+			term.Count, _ = strconv.Atoi(m[1])
+			rest = rest[len(m[0]):]
+			multiset = true
+		}
+		end, balanced := nextTopLevel(rest, "++")
+		if !balanced {
+			return nil, false
+		}
+		if end < 0 {
+			end = len(rest)
+		}
+		term.Expression = strings.TrimSpace(rest[:end])
+		if term.Expression == "" {
+			return nil, false
+		}
+		terms = append(terms, term)
+		if end == len(rest) {
+			break
+		}
+		multiset = true
+		rest = rest[end+2:]
+	}
+	if !multiset {
+		return nil, false
+	}
+	return terms, true
+}
+
+// SplitTimed splits an inscription "expr @+ delay" into the expression and the delay expression.
+// ok is false if the inscription has no top-level time inscription.
+func SplitTimed(inscription string) (expr, delay string, ok bool) {
+	offset, balanced := nextTopLevel(inscription, "@+")
+	if !balanced || offset < 0 {
+		return "", "", false
+	}
+	expr, delay = strings.TrimSpace(inscription[:offset]), strings.TrimSpace(inscription[offset+2:])
+	if expr == "" || delay == "" {
+		return "", "", false
+	}
+	return expr, delay, true
+}
+
+// nextTopLevel returns the offset of the first occurrence of sep outside of strings and brackets
+// (-1 if there is none). balanced is false for unbalanced brackets or unterminated strings.
+func nextTopLevel(s, sep string) (offset int, balanced bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return -1, false
+			}
+			i = j
+		case c == '[':
+			if level, found := longBracket(s[i:]); found {
+				end := strings.Index(s[i:], "]"+strings.Repeat("=", level)+"]")
+				if end < 0 {
+					return -1, false
+				}
+				i += end + level + 1
+			} else {
+				depth++
+			}
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			if depth < 0 {
+				return -1, false
+			}
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			return -1, false // comments are not supported in multiset inscriptions
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			return i, true
+		}
+	}
+	return -1, depth == 0
+}
+
+// multisetChunk compiles multiset terms to a call of the multiset builder
+func multisetChunk(terms []MultisetTerm) string {
+	args := make([]string, 0, 2*len(terms))
+	for _, term := range terms {
+		args = append(args, strconv.Itoa(term.Count), "("+term.Expression+")")
+	}
+	return fmt.Sprintf("return %s(%s)", multisetBuilder, strings.Join(args, ", "))
+}
+
+// timedChunk compiles a time inscription: the tokens of the compiled expression are delayed
+func timedChunk(code, delay string) string {
+	return fmt.Sprintf("return %s((function() %s end)(), (%s))", timedBuilder, code, delay)
+}
+
+// registerMultisetFunctions installs the multiset builder, the time inscription builder and multiset{...}
+func (e *Evaluator) registerMultisetFunctions() {
+	L := e.luaState
+	e.multisetMeta = L.NewTable()
+	e.multisetMeta.RawSetString("__name", lua.LString("multiset"))
+	e.delayMeta = L.NewTable()
+	e.delayMeta.RawSetString("__name", lua.LString("delay"))
+
+	// __gpf_multiset(count1, value1, count2, value2, ...)
+	L.SetGlobal(multisetBuilder, L.NewFunction(func(L *lua.LState) int {
+		result := L.NewTable()
+		for i := 1; i+1 <= L.GetTop(); i += 2 {
+			e.appendMultiset(result, L.CheckInt(i), L.Get(i+1))
+		}
+		L.SetMetatable(result, e.multisetMeta)
+		L.Push(result)
+		return 1
+	}))
+	// __gpf_timed(value, delay) delays a token or every element of a multiset
+	L.SetGlobal(timedBuilder, L.NewFunction(func(L *lua.LState) int {
+		value, delay := L.Get(1), L.CheckNumber(2)
+		if !e.isMultiset(value) {
+			L.Push(e.delayed(value, delay))
+			return 1
+		}
+		elements := value.(*lua.LTable)
+		result := L.NewTable()
+		for i := 1; i <= elements.Len(); i++ {
+			result.Append(e.delayed(elements.RawGetInt(i), delay))
+		}
+		L.SetMetatable(result, e.multisetMeta)
+		L.Push(result)
+		return 1
+	}))
+	// multiset(list) returns a multiset with the elements of a Lua list
+	L.SetGlobal("multiset", L.NewFunction(func(L *lua.LState) int {
+		list := L.CheckTable(1)
+		result := L.NewTable()
+		for i := 1; i <= list.Len(); i++ {
+			e.appendMultiset(result, 1, list.RawGetInt(i))
+		}
+		L.SetMetatable(result, e.multisetMeta)
+		L.Push(result)
+		return 1
+	}))
+}
+
+// appendMultiset appends count copies of value to a multiset table, flattening nested multisets
+func (e *Evaluator) appendMultiset(result *lua.LTable, count int, value lua.LValue) {
+	for n := 0; n < count; n++ {
+		if e.isMultiset(value) {
+			nested := value.(*lua.LTable)
+			for i := 1; i <= nested.Len(); i++ {
+				result.Append(nested.RawGetInt(i))
+			}
+			continue
+		}
+		result.Append(value)
+	}
+}
+
+// delayed adds delay to the delay of a token value (see delay())
+func (e *Evaluator) delayed(value lua.LValue, delay lua.LNumber) lua.LValue {
+	if e.isDelayed(value) {
+		t := value.(*lua.LTable)
+		if d, ok := t.RawGetString("delay").(lua.LNumber); ok {
+			return e.newDelayed(t.RawGetString("value"), d+delay)
+		}
+	}
+	return e.newDelayed(value, delay)
+}
+
+// newDelayed returns the result of delay(value, delay): a table with value and delay, marked so
+// that records with such fields are not taken for delayed tokens
+func (e *Evaluator) newDelayed(value, delay lua.LValue) *lua.LTable {
+	table := e.luaState.NewTable()
+	table.RawSetString("value", value)
+	table.RawSetString("delay", delay)
+	e.luaState.SetMetatable(table, e.delayMeta)
+	return table
+}
+
+func (e *Evaluator) isDelayed(value lua.LValue) bool {
+	table, ok := value.(*lua.LTable)
+	return ok && e.luaState.GetMetatable(table) == e.delayMeta
+}
+
+func (e *Evaluator) isMultiset(value lua.LValue) bool {
+	table, ok := value.(*lua.LTable)
+	return ok && e.luaState.GetMetatable(table) == e.multisetMeta
+}
+
+// luaMultisetToGo converts a multiset table to a MultisetValue
+func (e *Evaluator) luaMultisetToGo(table *lua.LTable) MultisetValue {
+	result := make(MultisetValue, table.Len())
+	for i := range result {
+		result[i] = e.luaValueToGo(table.RawGetInt(i + 1))
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package expression
+
+import (
+	"math"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerRandomFunctions registers CPN Tools style random distribution functions.
+// All functions draw from the random source of the current evaluation context, so a
+// simulation run seeded with the same value always produces the same trace.
+func (e *Evaluator) registerRandomFunctions() {
+	L := e.luaState
+
+	L.SetGlobal("uniform", L.NewFunction(e.luaUniform))
+	L.SetGlobal("exponential", L.NewFunction(e.luaExponential))
+	L.SetGlobal("normal", L.NewFunction(e.luaNormal))
+	L.SetGlobal("erlang", L.NewFunction(e.luaErlang))
+	L.SetGlobal("discrete", L.NewFunction(e.luaDiscrete))
+	L.SetGlobal("bernoulli", L.NewFunction(e.luaBernoulli))
+	L.SetGlobal("poisson", L.NewFunction(e.luaPoisson))
+
+	// Route math.random through the seeded source as well; math.randomseed is a no-op
+	// because seeding is controlled per simulation run.
+	if mathLib, ok := L.GetGlobal("math").(*lua.LTable); ok {
+		mathLib.RawSetString("random", L.NewFunction(e.luaMathRandom))
+		mathLib.RawSetString("randomseed", L.NewFunction(func(L *lua.LState) int { return 0 }))
+	}
+}
+
+// uniform(a, b) returns a real number uniformly distributed in [a, b)
+func (e *Evaluator) luaUniform(L *lua.LState) int {
+	a := float64(L.CheckNumber(1))
+	b := float64(L.CheckNumber(2))
+	if b < a {
+		L.ArgError(2, "upper bound must not be smaller than lower bound")
+	}
+	L.Push(lua.LNumber(a + e.random.Float64()*(b-a)))
+	return 1
+}
+
+// exponential(r) returns an exponentially distributed real with rate r (mean 1/r)
+func (e *Evaluator) luaExponential(L *lua.LState) int {
+	r := float64(L.CheckNumber(1))
+	if r <= 0 {
+		L.ArgError(1, "rate must be positive")
+	}
+	L.Push(lua.LNumber(e.random.ExpFloat64() / r))
+	return 1
+}
+
+// normal(mean, variance) returns a normally distributed real
+func (e *Evaluator) luaNormal(L *lua.LState) int {
+	mean := float64(L.CheckNumber(1))
+	variance := float64(L.CheckNumber(2))
+	if variance < 0 {
+		L.ArgError(2, "variance must not be negative")
+	}
+	L.Push(lua.LNumber(mean + math.Sqrt(variance)*e.random.NormFloat64()))
+	return 1
+}
+
+// erlang(n, r) returns the sum of n exponentials with rate r
+func (e *Evaluator) luaErlang(L *lua.LState) int {
+	n := L.CheckInt(1)
+	r := float64(L.CheckNumber(2))
+	if n < 1 {
+		L.ArgError(1, "shape must be at least 1")
+	}
+	if r <= 0 {
+		L.ArgError(2, "rate must be positive")
+	}
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		sum += e.random.ExpFloat64() / r
+	}
+	L.Push(lua.LNumber(sum))
+	return 1
+}
+
+// discrete(a, b) returns an integer uniformly distributed in [a, b]
+func (e *Evaluator) luaDiscrete(L *lua.LState) int {
+	a := L.CheckInt(1)
+	b := L.CheckInt(2)
+	if b < a {
+		L.ArgError(2, "upper bound must not be smaller than lower bound")
+	}
+	L.Push(lua.LNumber(a + e.random.Intn(b-a+1)))
+	return 1
+}
+
+// bernoulli(p) returns 1 with probability p and 0 otherwise (CPN Tools convention).
+// Note that 0 is truthy in Lua, so guards should compare: bernoulli(0.3) == 1
+func (e *Evaluator) luaBernoulli(L *lua.LState) int {
+	p := float64(L.CheckNumber(1))
+	if p < 0 || p > 1 {
+		L.ArgError(1, "probability must be in [0, 1]")
+	}
+	if e.random.Float64() < p {
+		L.Push(lua.LNumber(1))
+	} else {
+		L.Push(lua.LNumber(0))
+	}
+	return 1
+}
+
+// poisson(mean) returns a Poisson distributed integer (Knuth's algorithm, suitable for small means)
+func (e *Evaluator) luaPoisson(L *lua.LState) int {
+	mean := float64(L.CheckNumber(1))
+	if mean < 0 {
+		L.ArgError(1, "mean must not be negative")
+	}
+	limit := math.Exp(-mean)
+	k := 0
+	for p := e.random.Float64(); p > limit; p *= e.random.Float64() {
+		k++
+	}
+	L.Push(lua.LNumber(k))
+	return 1
+}
+
+// math.random([m [, n]]) with standard Lua semantics backed by the seeded source
+func (e *Evaluator) luaMathRandom(L *lua.LState) int {
+	switch L.GetTop() {
+	case 0:
+		L.Push(lua.LNumber(e.random.Float64()))
+	case 1:
+		m := L.CheckInt(1)
+		if m < 1 {
+			L.ArgError(1, "interval is empty")
+		}
+		L.Push(lua.LNumber(1 + e.random.Intn(m)))
+	default:
+		m := L.CheckInt(1)
+		n := L.CheckInt(2)
+		if n < m {
+			L.ArgError(2, "interval is empty")
+		}
+		L.Push(lua.LNumber(m + e.random.Intn(n-m+1)))
+	}
+	return 1
+}
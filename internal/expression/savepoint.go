@@ -0,0 +1,98 @@
+package expression
+
+import lua "github.com/yuin/gopher-lua"
+
+// Savepoint holds the state of the globals of a CPN: the tables and closure upvalues reachable
+// from them. Rolling back undoes assignments that bypass ActionEffects, such as table mutations
+// and globals assigned by functions the net declares.
+type Savepoint struct {
+	evaluator *Evaluator
+	net       *netDeclarations
+	tables    map[*lua.LTable][]lua.LValue // key/value pairs of each table, in pairs
+	upvalues  map[*lua.Upvalue]lua.LValue
+}
+
+// Savepoint captures the globals of the context's CPN (see Rollback)
+func (e *Evaluator) Savepoint(context *EvaluationContext) (*Savepoint, error) {
+	if err := e.activateDeclarations(context); err != nil {
+		return nil, err
+	}
+	builtin := map[*lua.LTable]bool{e.luaState.G.Global: true}
+	e.luaState.G.Global.ForEach(func(_, value lua.LValue) {
+		if table, ok := value.(*lua.LTable); ok {
+			builtin[table] = true
+		}
+	})
+	s := &Savepoint{evaluator: e, net: e.active, tables: make(map[*lua.LTable][]lua.LValue), upvalues: make(map[*lua.Upvalue]lua.LValue)}
+	seen := make(map[*lua.LFunction]bool)
+	var save func(value lua.LValue)
+	save = func(value lua.LValue) {
+		switch v := value.(type) {
+		case *lua.LTable:
+			if builtin[v] {
+				return
+			}
+			if _, ok := s.tables[v]; ok {
+				return
+			}
+			var pairs []lua.LValue
+			v.ForEach(func(key, value lua.LValue) {
+				pairs = append(pairs, key, value)
+			})
+			s.tables[v] = pairs
+			for _, pv := range pairs {
+				save(pv)
+			}
+			save(v.Metatable)
+		case *lua.LFunction:
+			if seen[v] || v.IsG {
+				return
+			}
+			seen[v] = true
+			for _, upvalue := range v.Upvalues {
+				if upvalue == nil {
+					continue
+				}
+				if _, ok := s.upvalues[upvalue]; !ok {
+					s.upvalues[upvalue] = upvalue.Value()
+					save(upvalue.Value())
+				}
+			}
+		}
+	}
+	save(e.active.env)
+	return s, nil
+}
+
+// Release keeps the changes made since the savepoint. Evaluations cached on the globals of the
+// CPN are invalidated (see NetVersion), since declared functions may have assigned them.
+func (s *Savepoint) Release() {
+	if s == nil {
+		return
+	}
+	s.evaluator.netVersion++
+	s.net.version = s.evaluator.netVersion
+}
+
+// Rollback restores the globals captured by the savepoint. Tables created since are left as they
+// are but are no longer reachable from the globals unless a restored value refers to them.
+func (s *Savepoint) Rollback() {
+	if s == nil {
+		return
+	}
+	for table, pairs := range s.tables {
+		var keys []lua.LValue
+		table.ForEach(func(key, _ lua.LValue) {
+			keys = append(keys, key)
+		})
+		for _, key := range keys {
+			table.RawSet(key, lua.LNil)
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			table.RawSet(pairs[i], pairs[i+1])
+		}
+	}
+	for upvalue, value := range s.upvalues {
+		upvalue.SetValue(value)
+	}
+}
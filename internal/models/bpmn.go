@@ -0,0 +1,850 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BPMN 2.0 import.
+//
+// Every process of a document is compiled to a CPN. A process instance is a token of the timed JSON
+// color set CASE holding the process data, bound to the variable data on every arc. Flow nodes
+// become transitions (keeping their BPMN IDs) and the points between them places: a sequence flow
+// into a node that merges its incoming flows (activities, events, exclusive gateways) ends in the
+// node's input place, one into a synchronizing gateway in a place of its own.
+//
+//   - Tasks become Manual (user and manual tasks), Message (receive tasks) or Auto transitions (all
+//     others); Lua script tasks become actions.
+//   - Exclusive gateways become one transition per outgoing flow guarded by the flow's condition
+//     (the default flow by the negation of the others), parallel gateways a single transition,
+//     inclusive gateways one transition per combination of outgoing flows. Event-based gateways
+//     make the following events compete for the gateway's input place.
+//   - Timer events become delays. Timers racing with an activity (boundary events) or with other
+//     events (event-based gateways) are armed by a transition that puts a delayed token on the
+//     timer's place. Message and signal events become Message transitions, fired from outside.
+//   - Embedded subprocesses are inlined; call activities become sub workflows of the called process.
+//
+// Constructs without a counterpart are listed in the conversion report.
+
+const (
+	bpmnColorSet = "CASE"
+	bpmnVariable = "data"
+	bpmnEndPlace = "end"
+)
+
+type bpmnShape struct {
+	x, y, width, height float64
+}
+
+// bpmnImporter holds the state of a BPMN import
+type bpmnImporter struct {
+	report    *ConversionReport
+	processes []*pnmlNode
+	called    map[string]bool // processes called by a call activity
+	nodes     map[string]*pnmlNode
+	incoming  map[string][]*pnmlNode // node ID -> incoming sequence flows
+	outgoing  map[string][]*pnmlNode // node ID -> outgoing sequence flows
+	boundary  map[string][]*pnmlNode // activity ID -> attached boundary events
+	shapes    map[string]bpmnShape
+	edges     map[string][]Position
+
+	def    *CPNDefinitionJSON
+	placed map[string]bool
+}
+
+var (
+	isoDuration        = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+	conditionIdentifer = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[A-Za-z_]\w*`)
+)
+
+// bpmnConditionKeywords are the names a condition may use without referring to the process data
+var bpmnConditionKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "true": true, "false": true, "nil": true, bpmnVariable: true,
+	"math": true, "string": true, "table": true, "cs": true, "tuple": true,
+}
+
+// bpmnTasks maps task elements to the kind of their transitions
+var bpmnTasks = map[string]TransitionKind{
+	"task": TransitionKindAuto, "serviceTask": TransitionKindAuto, "scriptTask": TransitionKindAuto,
+	"businessRuleTask": TransitionKindAuto, "sendTask": TransitionKindAuto, "callActivity": TransitionKindAuto,
+	"userTask": TransitionKindManual, "manualTask": TransitionKindManual, "receiveTask": TransitionKindMessage,
+}
+
+// bpmnIgnored are elements without behavior
+var bpmnIgnored = map[string]bool{
+	"documentation": true, "extensionElements": true, "laneSet": true, "dataObject": true,
+	"dataObjectReference": true, "dataStoreReference": true, "textAnnotation": true, "association": true,
+	"ioSpecification": true, "property": true, "sequenceFlow": true, "group": true, "category": true,
+}
+
+// ParseBPMN compiles the processes of a BPMN 2.0 document to CPN definitions, one per process. The
+// first definition is the main process (the first one not called by a call activity). Constructs
+// that could not be compiled exactly are listed in the report.
+func (p *CPNParser) ParseBPMN(data []byte) ([]*CPNDefinitionJSON, *ConversionReport, error) {
+	var doc pnmlNode
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse BPMN: %v", err)
+	}
+	if doc.XMLName.Local != "definitions" {
+		return nil, nil, fmt.Errorf("root element is <%s>, expected <definitions>", doc.XMLName.Local)
+	}
+	imp := &bpmnImporter{
+		report:   NewConversionReport("bpmn"),
+		called:   make(map[string]bool),
+		nodes:    make(map[string]*pnmlNode),
+		incoming: make(map[string][]*pnmlNode),
+		outgoing: make(map[string][]*pnmlNode),
+		boundary: make(map[string][]*pnmlNode),
+		shapes:   make(map[string]bpmnShape),
+		edges:    make(map[string][]Position),
+	}
+	for _, n := range doc.Children {
+		switch n.XMLName.Local {
+		case "process":
+			imp.processes = append(imp.processes, n)
+			imp.collect(n)
+		case "collaboration":
+			if flows := n.children("messageFlow"); len(flows) > 0 {
+				imp.report.Add(n.attr("id"), "%d message flows are not modeled; fire the Message transitions of the receiving process instead", len(flows))
+			}
+		case "BPMNDiagram":
+			imp.collectDiagram(n)
+		}
+	}
+	if len(imp.processes) == 0 {
+		return nil, imp.report, fmt.Errorf("BPMN document contains no process")
+	}
+
+	// The main process comes first
+	sort.SliceStable(imp.processes, func(i, j int) bool {
+		return !imp.called[imp.processes[i].attr("id")] && imp.called[imp.processes[j].attr("id")]
+	})
+	var defs []*CPNDefinitionJSON
+	for _, process := range imp.processes {
+		def, err := imp.compileProcess(process)
+		if err != nil {
+			return nil, imp.report, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, imp.report, nil
+}
+
+// collect indexes the flow nodes and sequence flows of a process or subprocess
+func (imp *bpmnImporter) collect(container *pnmlNode) {
+	for _, n := range container.Children {
+		id := n.attr("id")
+		switch name := n.XMLName.Local; {
+		case name == "sequenceFlow":
+			imp.outgoing[n.attr("sourceRef")] = append(imp.outgoing[n.attr("sourceRef")], n)
+			imp.incoming[n.attr("targetRef")] = append(imp.incoming[n.attr("targetRef")], n)
+		case name == "boundaryEvent":
+			imp.nodes[id] = n
+			imp.boundary[n.attr("attachedToRef")] = append(imp.boundary[n.attr("attachedToRef")], n)
+		case bpmnIgnored[name]:
+		default:
+			imp.nodes[id] = n
+			if name == "callActivity" {
+				imp.called[n.attr("calledElement")] = true
+			}
+			if name == "subProcess" || name == "transaction" || name == "adHocSubProcess" {
+				imp.collect(n)
+			}
+		}
+	}
+}
+
+// collectDiagram reads the shapes and edges of a diagram
+func (imp *bpmnImporter) collectDiagram(n *pnmlNode) {
+	for _, c := range n.Children {
+		switch c.XMLName.Local {
+		case "BPMNShape":
+			bounds := c.child("Bounds")
+			var shape bpmnShape
+			var errs [4]error
+			shape.x, errs[0] = strconv.ParseFloat(bounds.attr("x"), 64)
+			shape.y, errs[1] = strconv.ParseFloat(bounds.attr("y"), 64)
+			shape.width, errs[2] = strconv.ParseFloat(bounds.attr("width"), 64)
+			shape.height, errs[3] = strconv.ParseFloat(bounds.attr("height"), 64)
+			if errs[0] == nil && errs[1] == nil && errs[2] == nil && errs[3] == nil {
+				imp.shapes[c.attr("bpmnElement")] = shape
+			}
+		case "BPMNEdge":
+			var points []Position
+			for _, w := range c.children("waypoint") {
+				x, errX := strconv.ParseFloat(w.attr("x"), 32)
+				y, errY := strconv.ParseFloat(w.attr("y"), 32)
+				if errX == nil && errY == nil {
+					points = append(points, Position{X: float32(x), Y: float32(y)})
+				}
+			}
+			imp.edges[c.attr("bpmnElement")] = points
+		default:
+			imp.collectDiagram(c)
+		}
+	}
+}
+
+// at returns the center of a node's shape moved by dx, dy, or nil without diagram information
+func (imp *bpmnImporter) at(id string, dx, dy float64) *Position {
+	shape, ok := imp.shapes[id]
+	if !ok {
+		return nil
+	}
+	return &Position{X: float32(shape.x + shape.width/2 + dx), Y: float32(shape.y + shape.height/2 + dy)}
+}
+
+// left returns a position left of a node's shape
+func (imp *bpmnImporter) left(id string, dy float64) *Position {
+	return imp.at(id, -imp.shapes[id].width/2-40, dy)
+}
+
+func (imp *bpmnImporter) compileProcess(process *pnmlNode) (*CPNDefinitionJSON, error) {
+	id := process.attr("id")
+	if id == "" {
+		return nil, fmt.Errorf("process has no id")
+	}
+	name := process.attr("name")
+	if name == "" {
+		name = id
+	}
+	imp.def = &CPNDefinitionJSON{
+		ID:             id,
+		Name:           name,
+		Description:    "Compiled from BPMN",
+		ColorSets:      []string{fmt.Sprintf("colset %s = json timed;", bpmnColorSet)},
+		EndPlaces:      []string{bpmnEndPlace},
+		InitialMarking: make(map[string][]TokenJSON),
+	}
+	imp.placed = make(map[string]bool)
+
+	var starts, ends []*pnmlNode
+	for _, n := range process.Children {
+		switch n.XMLName.Local {
+		case "startEvent":
+			starts = append(starts, n)
+		case "endEvent":
+			ends = append(ends, n)
+		}
+	}
+	if len(starts) == 0 {
+		return nil, fmt.Errorf("process %s has no start event", id)
+	}
+	// All start events share one start token, so exactly one of them starts the instance
+	startPlace := "start"
+	var endPosition *Position
+	if len(ends) > 0 {
+		endPosition = imp.at(ends[0].attr("id"), imp.shapes[ends[0].attr("id")].width/2+40, 0)
+	}
+	imp.place(startPlace, "Start", imp.left(starts[0].attr("id"), 0))
+	imp.place(bpmnEndPlace, "End", endPosition)
+	imp.def.InitialMarking[startPlace] = []TokenJSON{{Value: map[string]interface{}{}}}
+	if err := imp.compileContainer(process, startPlace, []string{bpmnEndPlace}); err != nil {
+		return nil, err
+	}
+	return imp.def, nil
+}
+
+// place adds a place of the case color set once
+func (imp *bpmnImporter) place(id, name string, position *Position) {
+	if imp.placed[id] {
+		return
+	}
+	imp.placed[id] = true
+	imp.def.Places = append(imp.def.Places, PlaceJSON{ID: id, Name: name, ColorSet: bpmnColorSet, Position: position})
+}
+
+// inputPlace returns the place a node takes its token from. Events after an event-based gateway
+// compete for the token waiting at the gateway.
+func (imp *bpmnImporter) inputPlace(node *pnmlNode) string {
+	id := node.attr("id")
+	if in := imp.incoming[id]; len(in) == 1 {
+		if source := imp.nodes[in[0].attr("sourceRef")]; source != nil && source.XMLName.Local == "eventBasedGateway" {
+			return imp.waitPlace(source)
+		}
+	}
+	place := "in_" + id
+	imp.place(place, nodeName(node), imp.left(id, 0))
+	return place
+}
+
+// flowPlace returns the place a sequence flow puts its token on
+func (imp *bpmnImporter) flowPlace(flow *pnmlNode) string {
+	target := imp.nodes[flow.attr("targetRef")]
+	if target == nil {
+		return ""
+	}
+	if imp.synchronizes(target) {
+		place := "flow_" + flow.attr("id")
+		var position *Position
+		if points := imp.edges[flow.attr("id")]; len(points) > 0 {
+			position = &points[len(points)/2]
+		}
+		name := flow.attr("name")
+		if name == "" {
+			name = nodeName(imp.nodes[flow.attr("sourceRef")]) + " to " + nodeName(target)
+		}
+		imp.place(place, name, position)
+		return place
+	}
+	return imp.inputPlace(target)
+}
+
+// synchronizes reports whether a node waits for all its incoming flows
+func (imp *bpmnImporter) synchronizes(node *pnmlNode) bool {
+	switch node.XMLName.Local {
+	case "parallelGateway":
+		return true
+	case "inclusiveGateway":
+		return len(imp.incoming[node.attr("id")]) > 1
+	}
+	return false
+}
+
+func nodeName(node *pnmlNode) string {
+	if node == nil {
+		return ""
+	}
+	if name := strings.Join(strings.Fields(node.attr("name")), " "); name != "" {
+		return name
+	}
+	return node.attr("id")
+}
+
+// addTransition adds a transition consuming the case token from the inputs and producing it on the
+// outputs
+func (imp *bpmnImporter) addTransition(t TransitionJSON, inputs, outputs []string) {
+	if t.GuardExpression != "" {
+		t.Variables = []string{bpmnVariable}
+	}
+	imp.def.Transitions = append(imp.def.Transitions, t)
+	for _, place := range inputs {
+		imp.arc(place, t.ID, bpmnVariable, "IN")
+	}
+	for _, place := range outputs {
+		imp.arc(place, t.ID, bpmnVariable, "OUT")
+	}
+}
+
+func (imp *bpmnImporter) arc(placeID, transitionID, expression, direction string) {
+	arc := ArcJSON{ID: "a_" + placeID + "_" + transitionID, SourceID: placeID, TargetID: transitionID, Expression: expression, Direction: direction}
+	if direction == "OUT" {
+		arc = ArcJSON{ID: "a_" + transitionID + "_" + placeID, SourceID: transitionID, TargetID: placeID, Expression: expression, Direction: direction}
+	}
+	imp.def.Arcs = append(imp.def.Arcs, arc)
+}
+
+// outputs returns the places of a node's outgoing flows
+func (imp *bpmnImporter) outputs(node *pnmlNode) []string {
+	var places []string
+	for _, flow := range imp.outgoing[node.attr("id")] {
+		if place := imp.flowPlace(flow); place != "" {
+			places = append(places, place)
+		} else {
+			imp.report.Add(flow.attr("id"), "sequence flow targets unknown element %s; flow ignored", flow.attr("targetRef"))
+		}
+	}
+	return places
+}
+
+// compileContainer compiles the flow nodes of a process or subprocess. Start events take the token
+// from entry, end events put it on exits.
+func (imp *bpmnImporter) compileContainer(container *pnmlNode, entry string, exits []string) error {
+	for _, n := range container.Children {
+		id := n.attr("id")
+		name := n.XMLName.Local
+		switch {
+		case bpmnIgnored[name], name == "boundaryEvent":
+		case name == "startEvent":
+			t := TransitionJSON{ID: id, Name: nodeName(n), Position: imp.at(id, 0, 0)}
+			imp.event(n, &t)
+			imp.addTransition(t, []string{entry}, imp.outputs(n))
+		case name == "endEvent":
+			switch eventType(n) {
+			case "", "message", "signal":
+			default:
+				imp.report.Add(id, "%s end event compiled as a plain end event", eventType(n))
+			}
+			imp.addTransition(TransitionJSON{ID: id, Name: nodeName(n), Kind: string(TransitionKindAuto), Position: imp.at(id, 0, 0)},
+				[]string{imp.inputPlace(n)}, exits)
+		case name == "intermediateCatchEvent" || name == "intermediateThrowEvent":
+			imp.intermediateEvent(n)
+		case bpmnTasks[name] != "":
+			imp.activity(n, bpmnTasks[name])
+		case name == "subProcess" || name == "transaction" || name == "adHocSubProcess":
+			if err := imp.subProcess(n); err != nil {
+				return err
+			}
+		case name == "exclusiveGateway" || name == "complexGateway":
+			if name == "complexGateway" {
+				imp.report.Review(id, "complex gateway compiled as an exclusive gateway")
+			}
+			imp.exclusiveGateway(n)
+		case name == "parallelGateway":
+			imp.addTransition(TransitionJSON{ID: id, Name: nodeName(n), Kind: string(TransitionKindAuto), Position: imp.at(id, 0, 0)},
+				imp.gatewayInputs(n), imp.outputs(n))
+		case name == "inclusiveGateway":
+			imp.inclusiveGateway(n)
+		case name == "eventBasedGateway":
+			for _, flow := range imp.outgoing[id] {
+				target := imp.nodes[flow.attr("targetRef")]
+				if target == nil || (target.XMLName.Local != "intermediateCatchEvent" && target.XMLName.Local != "receiveTask") {
+					imp.report.Review(id, "event-based gateway is followed by %s, which is not a catching event", flow.attr("targetRef"))
+				}
+			}
+			imp.waitPlace(n)
+		default:
+			imp.report.Add(id, "unsupported element <%s> ignored", name)
+		}
+	}
+	return nil
+}
+
+// eventType returns the kind of an event's definition ("" for none events)
+func eventType(event *pnmlNode) string {
+	for _, c := range event.Children {
+		if kind, ok := strings.CutSuffix(c.XMLName.Local, "EventDefinition"); ok {
+			return kind
+		}
+	}
+	return ""
+}
+
+// timerDelay returns the delay of a timer event in seconds
+func (imp *bpmnImporter) timerDelay(event *pnmlNode) int {
+	timer := event.child("timerEventDefinition")
+	duration := mlText(timer.child("timeDuration"))
+	if duration == "" {
+		imp.report.Review(event.attr("id"), "only timers with a timeDuration are supported; timer fires without delay")
+		return 0
+	}
+	if seconds, err := strconv.Atoi(duration); err == nil {
+		return seconds
+	}
+	m := isoDuration.FindStringSubmatch(duration)
+	if m == nil || duration == "P" || duration == "PT" {
+		imp.report.Review(event.attr("id"), "timer duration '%s' is not supported; timer fires without delay", duration)
+		return 0
+	}
+	seconds := 0
+	for i, unit := range []int{86400, 3600, 60, 1} {
+		n, _ := strconv.Atoi(m[i+1])
+		seconds += n * unit
+	}
+	return seconds
+}
+
+// event sets the kind and delay of a start or intermediate catch event's transition
+func (imp *bpmnImporter) event(n *pnmlNode, t *TransitionJSON) {
+	t.Kind = string(TransitionKindAuto)
+	switch kind := eventType(n); kind {
+	case "":
+	case "timer":
+		t.TransitionDelay = imp.timerDelay(n)
+	case "message", "signal", "conditional":
+		t.Kind = string(TransitionKindMessage)
+		if kind != "message" {
+			imp.report.Add(n.attr("id"), "%s event compiled as a Message transition", kind)
+		}
+	default:
+		imp.report.Review(n.attr("id"), "%s event compiled as a plain event", kind)
+	}
+}
+
+func (imp *bpmnImporter) intermediateEvent(n *pnmlNode) {
+	id := n.attr("id")
+	t := TransitionJSON{ID: id, Name: nodeName(n), Kind: string(TransitionKindAuto), Position: imp.at(id, 0, 0)}
+	if n.XMLName.Local == "intermediateThrowEvent" {
+		if kind := eventType(n); kind != "" && kind != "message" && kind != "signal" {
+			imp.report.Review(id, "%s throw event compiled as a plain event", kind)
+		}
+		imp.addTransition(t, []string{imp.inputPlace(n)}, imp.outputs(n))
+		return
+	}
+
+	// A timer after an event-based gateway races with the other events and needs its own clock
+	if in := imp.incoming[id]; eventType(n) == "timer" && len(in) == 1 {
+		if gateway := imp.nodes[in[0].attr("sourceRef")]; gateway != nil && gateway.XMLName.Local == "eventBasedGateway" {
+			imp.racingTimer(n, imp.waitPlace(gateway), false)
+			return
+		}
+	}
+	imp.event(n, &t)
+	imp.addTransition(t, []string{imp.inputPlace(n)}, imp.outputs(n))
+}
+
+// timers returns the timer events racing at a node: timer boundary events of an activity or timer
+// events following an event-based gateway
+func (imp *bpmnImporter) timers(node *pnmlNode) []*pnmlNode {
+	var timers []*pnmlNode
+	if node.XMLName.Local == "eventBasedGateway" {
+		for _, flow := range imp.outgoing[node.attr("id")] {
+			if target := imp.nodes[flow.attr("targetRef")]; target != nil && eventType(target) == "timer" {
+				timers = append(timers, target)
+			}
+		}
+		return timers
+	}
+	for _, event := range imp.boundary[node.attr("id")] {
+		if eventType(event) == "timer" {
+			timers = append(timers, event)
+		}
+	}
+	return timers
+}
+
+// waitPlace returns the place a token waits in at a node. If timers race at the node, an arming
+// transition moves the token from the input place to a ready place and starts the clocks by
+// putting delayed tokens on the timer places; stale timer tokens are removed when they expire.
+func (imp *bpmnImporter) waitPlace(node *pnmlNode) string {
+	in := imp.inputPlace(node)
+	timers := imp.timers(node)
+	if len(timers) == 0 {
+		return in
+	}
+	id := node.attr("id")
+	ready := "ready_" + id
+	if imp.placed[ready] {
+		return ready
+	}
+	imp.place(ready, nodeName(node)+" (waiting)", imp.left(id, 50))
+	arm := TransitionJSON{ID: "arm_" + id, Name: "Start timers of " + nodeName(node), Kind: string(TransitionKindAuto), Position: imp.left(id, -50)}
+	imp.addTransition(arm, []string{in}, []string{ready})
+	low := PriorityLow
+	for _, timer := range timers {
+		timerID := timer.attr("id")
+		place := "timer_" + timerID
+		imp.place(place, nodeName(timer), imp.at(timerID, 0, 50))
+		imp.arc(place, arm.ID, fmt.Sprintf("%s @+ %d", bpmnVariable, imp.timerDelay(timer)), "OUT")
+		imp.addTransition(TransitionJSON{ID: "expire_" + timerID, Name: "Expire " + nodeName(timer), Kind: string(TransitionKindAuto),
+			Priority: &low, Position: imp.at(timerID, 0, 100)}, []string{place}, nil)
+	}
+	return ready
+}
+
+// racingTimer compiles a timer that fires when its clock runs out while the token still waits in
+// ready. An interrupting timer takes the token, a non-interrupting one leaves it.
+func (imp *bpmnImporter) racingTimer(timer *pnmlNode, ready string, keep bool) {
+	id := timer.attr("id")
+	t := TransitionJSON{ID: id, Name: nodeName(timer), Kind: string(TransitionKindAuto), Position: imp.at(id, 0, 0)}
+	outputs := imp.outputs(timer)
+	if keep {
+		outputs = append(outputs, ready)
+	}
+	imp.addTransition(t, []string{ready, "timer_" + id}, outputs)
+}
+
+// activity compiles a task or call activity with its boundary events
+func (imp *bpmnImporter) activity(n *pnmlNode, kind TransitionKind) {
+	id := n.attr("id")
+	t := TransitionJSON{ID: id, Name: nodeName(n), Kind: string(kind), Position: imp.at(id, 0, 0)}
+	for _, c := range n.Children {
+		switch c.XMLName.Local {
+		case "standardLoopCharacteristics", "multiInstanceLoopCharacteristics":
+			imp.report.Review(id, "loop characteristics ignored; the activity runs once")
+		}
+	}
+	if len(imp.incoming[id]) == 0 {
+		imp.report.Review(id, "activity has no incoming sequence flow and never starts")
+	}
+	imp.unconditional(n)
+
+	switch n.XMLName.Local {
+	case "scriptTask":
+		script := mlText(n.child("script"))
+		if format := strings.ToLower(n.attr("scriptFormat")); format == "lua" || format == "text/x-lua" {
+			t.ActionExpression = script
+		} else if script != "" {
+			imp.report.Review(id, "script in '%s' was not compiled; rewrite it as a Lua action", n.attr("scriptFormat"))
+		}
+	case "callActivity":
+		called := n.attr("calledElement")
+		if called == "" {
+			imp.report.Review(id, "call activity has no calledElement")
+			break
+		}
+		if !imp.processDefined(called) {
+			imp.report.Add(id, "called process %s is not in the document and must be loaded separately", called)
+		}
+		imp.def.SubWorkflows = append(imp.def.SubWorkflows, SubWorkflowJSON{
+			ID:                  "call_" + id,
+			CPNID:               called,
+			CallTransitionID:    id,
+			AutoStart:           true,
+			PropagateOnComplete: true,
+			InputMapping:        map[string]string{bpmnVariable: bpmnVariable},
+			OutputMapping:       map[string]string{bpmnVariable: bpmnVariable},
+		})
+	}
+
+	ready := imp.waitPlace(n)
+	imp.addTransition(t, []string{ready}, imp.outputs(n))
+	for _, event := range imp.boundary[id] {
+		imp.boundaryEvent(event, ready)
+	}
+}
+
+func (imp *bpmnImporter) processDefined(id string) bool {
+	for _, p := range imp.processes {
+		if p.attr("id") == id {
+			return true
+		}
+	}
+	return false
+}
+
+// boundaryEvent compiles an event attached to an activity; it competes with the activity for the
+// waiting token
+func (imp *bpmnImporter) boundaryEvent(event *pnmlNode, ready string) {
+	id := event.attr("id")
+	keep := event.attr("cancelActivity") == "false"
+	if eventType(event) == "timer" {
+		imp.racingTimer(event, ready, keep)
+		return
+	}
+	t := TransitionJSON{ID: id, Name: nodeName(event), Kind: string(TransitionKindMessage), Position: imp.at(id, 0, 0)}
+	switch kind := eventType(event); kind {
+	case "message":
+	case "signal", "conditional":
+		imp.report.Add(id, "%s boundary event compiled as a Message transition", kind)
+	default:
+		imp.report.Review(id, "%s boundary event compiled as a Message transition; fire it when the activity fails", kind)
+	}
+	outputs := imp.outputs(event)
+	if keep {
+		outputs = append(outputs, ready)
+	}
+	imp.addTransition(t, []string{ready}, outputs)
+}
+
+// unconditional reports conditions on flows leaving a node other than a gateway
+func (imp *bpmnImporter) unconditional(n *pnmlNode) {
+	for _, flow := range imp.outgoing[n.attr("id")] {
+		if flow.child("conditionExpression") != nil || n.attr("default") == flow.attr("id") {
+			imp.report.Review(flow.attr("id"), "conditional flows leaving activities are compiled as unconditional flows")
+		}
+	}
+}
+
+// subProcess inlines an embedded subprocess: its start events take the token from the
+// subprocess' input place and its end events continue with the outgoing flows
+func (imp *bpmnImporter) subProcess(n *pnmlNode) error {
+	id := n.attr("id")
+	if n.attr("triggeredByEvent") == "true" {
+		imp.report.Review(id, "event subprocess ignored")
+		return nil
+	}
+	if n.XMLName.Local != "subProcess" {
+		imp.report.Add(id, "%s compiled as an embedded subprocess", n.XMLName.Local)
+	}
+	if len(n.children("startEvent")) == 0 {
+		imp.report.Review(id, "subprocess without a start event ignored")
+		return nil
+	}
+	for _, event := range imp.boundary[id] {
+		imp.report.Review(event.attr("id"), "boundary events of subprocesses are not supported; event ignored")
+	}
+	imp.unconditional(n)
+	return imp.compileContainer(n, imp.inputPlace(n), imp.outputs(n))
+}
+
+// gatewayInputs returns the input places of a gateway
+func (imp *bpmnImporter) gatewayInputs(n *pnmlNode) []string {
+	if !imp.synchronizes(n) {
+		return []string{imp.inputPlace(n)}
+	}
+	var inputs []string
+	for _, flow := range imp.incoming[n.attr("id")] {
+		inputs = append(inputs, imp.flowPlace(flow))
+	}
+	return inputs
+}
+
+// exclusiveGateway compiles one transition per outgoing flow, guarded by the flow's condition
+// unless an earlier flow's condition holds
+func (imp *bpmnImporter) exclusiveGateway(n *pnmlNode) {
+	id := n.attr("id")
+	flows := imp.outgoing[id]
+	inputs := imp.gatewayInputs(n)
+	if len(flows) <= 1 {
+		imp.addTransition(TransitionJSON{ID: id, Name: nodeName(n), Kind: string(TransitionKindAuto), Position: imp.at(id, 0, 0)}, inputs, imp.outputs(n))
+		return
+	}
+	// Only the first flow in document order whose condition holds is taken: each flow is guarded
+	// by its condition and the negation of the conditions before it
+	conditions := imp.conditions(n)
+	var all []string
+	for _, flow := range flows {
+		if c := conditions[flow.attr("id")]; c != "" && flow.attr("id") != n.attr("default") {
+			all = append(all, "("+c+")")
+		}
+	}
+	var earlier []string
+	for i, flow := range flows {
+		flowID := flow.attr("id")
+		guard := conditions[flowID]
+		switch {
+		case flowID == n.attr("default"):
+			guard = ""
+			if len(all) > 0 {
+				guard = "not (" + strings.Join(all, " or ") + ")"
+			}
+		case guard == "":
+			imp.report.Review(flowID, "flow leaving exclusive gateway %s has no condition and is always possible", id)
+			if len(earlier) > 0 {
+				guard = "not (" + strings.Join(earlier, " or ") + ")"
+			}
+		default:
+			if len(earlier) > 0 {
+				guard = "(" + guard + ") and not (" + strings.Join(earlier, " or ") + ")"
+			}
+			earlier = append(earlier, "("+conditions[flowID]+")")
+		}
+		name := flow.attr("name")
+		if name == "" {
+			name = nodeName(imp.nodes[flow.attr("targetRef")])
+		}
+		t := TransitionJSON{ID: id + "_" + flowID, Name: nodeName(n) + ": " + name, Kind: string(TransitionKindAuto), GuardExpression: guard,
+			Position: imp.at(id, 0, float64(i*40-(len(flows)-1)*20))}
+		imp.addTransition(t, inputs, []string{imp.flowPlace(flow)})
+	}
+}
+
+// inclusiveGateway compiles one transition per combination of outgoing flows that can be taken
+// together: the flows whose conditions hold, or the default flow if none holds
+func (imp *bpmnImporter) inclusiveGateway(n *pnmlNode) {
+	id := n.attr("id")
+	flows := imp.outgoing[id]
+	inputs := imp.gatewayInputs(n)
+	if len(inputs) > 1 {
+		imp.report.Review(id, "inclusive join waits for all %d incoming flows", len(inputs))
+	}
+	if len(flows) <= 1 {
+		imp.addTransition(TransitionJSON{ID: id, Name: nodeName(n), Kind: string(TransitionKindAuto), Position: imp.at(id, 0, 0)}, inputs, imp.outputs(n))
+		return
+	}
+	var conditional []*pnmlNode
+	var always []string
+	var defaultFlow *pnmlNode
+	conditions := imp.conditions(n)
+	for _, flow := range flows {
+		switch {
+		case flow.attr("id") == n.attr("default"):
+			defaultFlow = flow
+		case conditions[flow.attr("id")] == "":
+			always = append(always, imp.flowPlace(flow))
+		default:
+			conditional = append(conditional, flow)
+		}
+	}
+	if len(conditional) > 6 {
+		imp.report.Review(id, "inclusive gateway with %d conditional flows compiled as an exclusive gateway", len(conditional))
+		imp.exclusiveGateway(n)
+		return
+	}
+
+	count := 0
+	for mask := 0; mask < 1<<len(conditional); mask++ {
+		outputs := append([]string(nil), always...)
+		var guard []string
+		var names []string
+		for i, flow := range conditional {
+			c := conditions[flow.attr("id")]
+			if mask&(1<<i) != 0 {
+				guard = append(guard, "("+c+")")
+				outputs = append(outputs, imp.flowPlace(flow))
+				names = append(names, flow.attr("id"))
+			} else {
+				guard = append(guard, "not ("+c+")")
+			}
+		}
+		if mask == 0 && defaultFlow != nil {
+			outputs = append(outputs, imp.flowPlace(defaultFlow))
+			names = append(names, defaultFlow.attr("id"))
+		}
+		if len(outputs) == 0 {
+			continue
+		}
+		suffix := strings.Join(names, "_")
+		if suffix == "" {
+			suffix = "none"
+		}
+		t := TransitionJSON{ID: id + "_" + suffix, Name: nodeName(n) + ": " + strings.Join(names, ", "), Kind: string(TransitionKindAuto),
+			GuardExpression: strings.Join(guard, " and "), Position: imp.at(id, 0, float64(count*40))}
+		imp.addTransition(t, inputs, outputs)
+		count++
+	}
+}
+
+// conditions returns the Lua guards of the conditional flows leaving a gateway
+func (imp *bpmnImporter) conditions(n *pnmlNode) map[string]string {
+	conditions := make(map[string]string)
+	for _, flow := range imp.outgoing[n.attr("id")] {
+		expression := flow.child("conditionExpression")
+		if expression == nil || flow.attr("id") == n.attr("default") {
+			continue
+		}
+		if language := strings.ToLower(expression.attr("language")); language != "" && !strings.Contains(language, "lua") &&
+			!strings.Contains(language, "juel") && !strings.Contains(language, "feel") {
+			imp.report.Review(flow.attr("id"), "condition in language '%s' was used as Lua; check it", expression.attr("language"))
+		}
+		if guard := bpmnCondition(expression.Text); guard != "" {
+			conditions[flow.attr("id")] = guard
+		}
+	}
+	return conditions
+}
+
+// bpmnCondition turns a sequence flow condition into a Lua guard. ${...} wrappers are removed,
+// JUEL operators replaced and names that are not Lua keywords, functions or libraries are looked
+// up in the process data: ${amount > 1000 && !approved} becomes
+// data.amount > 1000 and not data.approved.
+func bpmnCondition(text string) string {
+	text = strings.TrimSpace(text)
+	if (strings.HasPrefix(text, "${") || strings.HasPrefix(text, "#{")) && strings.HasSuffix(text, "}") {
+		text = strings.TrimSpace(text[2 : len(text)-1])
+	}
+	if text == "" {
+		return ""
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range conditionIdentifer.FindAllStringIndex(text, -1) {
+		b.WriteString(juelOperators(text[last:m[0]]))
+		last = m[1]
+		word := text[m[0]:m[1]]
+		switch {
+		case word[0] == '"' || word[0] == '\'':
+		case word == "null":
+			word = "nil"
+		case word == "eq" || word == "ne" || word == "lt" || word == "gt" || word == "le" || word == "ge":
+			word = map[string]string{"eq": "==", "ne": "~=", "lt": "<", "gt": ">", "le": "<=", "ge": ">="}[word]
+		case bpmnConditionKeywords[word] || (word[0] >= '0' && word[0] <= '9'):
+		case m[0] > 0 && (text[m[0]-1] == '.' || text[m[0]-1] == ':'):
+		case strings.HasPrefix(strings.TrimSpace(text[m[1]:]), "("):
+		default:
+			word = bpmnVariable + "." + word
+		}
+		b.WriteString(word)
+	}
+	b.WriteString(juelOperators(text[last:]))
+	return strings.TrimSpace(b.String())
+}
+
+var (
+	juelAnd = regexp.MustCompile(`\s*&&\s*`)
+	juelOr  = regexp.MustCompile(`\s*\|\|\s*`)
+	juelNot = regexp.MustCompile(`!\s*`)
+)
+
+// juelOperators replaces the JUEL/Java operators of a text between names
+func juelOperators(s string) string {
+	s = strings.ReplaceAll(s, "!=", "~=")
+	s = juelAnd.ReplaceAllString(s, " and ")
+	s = juelOr.ReplaceAllString(s, " or ")
+	return juelNot.ReplaceAllString(s, "not ")
+}
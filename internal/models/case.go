@@ -20,6 +20,7 @@ const (
 type Case struct {
 	ID           string                 `json:"id"`
 	CPNID        string                 `json:"cpnId"`
+	CPNVersion   int                    `json:"cpnVersion,omitempty"` // deployed CPN version the case is pinned to
 	Name         string                 `json:"name"`
 	Description  string                 `json:"description"`
 	Status       CaseStatus             `json:"status"`
@@ -140,6 +141,7 @@ func (c *Case) Clone() *Case {
 	clone := &Case{
 		ID:           c.ID,
 		CPNID:        c.CPNID,
+		CPNVersion:   c.CPNVersion,
 		Name:         c.Name,
 		Description:  c.Description,
 		Status:       c.Status,
@@ -189,6 +191,7 @@ func (c *Case) String() string {
 // CaseFilter represents filters for case queries
 type CaseFilter struct {
 	CPNID         string     `json:"cpnId,omitempty"`
+	CPNVersion    int        `json:"cpnVersion,omitempty"`
 	Status        CaseStatus `json:"status,omitempty"`
 	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
 	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
@@ -201,6 +204,10 @@ func (f *CaseFilter) Matches(c *Case) bool {
 		return false
 	}
 
+	if f.CPNVersion != 0 && c.CPNVersion != f.CPNVersion {
+		return false
+	}
+
 	if f.Status != "" && c.Status != f.Status {
 		return false
 	}
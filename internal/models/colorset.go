@@ -115,6 +115,14 @@ func (cs *IntegerColorSet) IsMember(value interface{}) bool {
 	return false
 }
 
+// GetRange returns the bounds of a ranged integer color set (ok = false if it is unbounded)
+func (cs *IntegerColorSet) GetRange() (minVal, maxVal int, ok bool) {
+	if cs.minVal == nil || cs.maxVal == nil {
+		return 0, 0, false
+	}
+	return *cs.minVal, *cs.maxVal, true
+}
+
 func (cs *IntegerColorSet) IsTimed() bool {
 	return cs.timed
 }
@@ -126,7 +134,7 @@ func (cs *IntegerColorSet) String() string {
 	}
 	rangeStr := ""
 	if cs.minVal != nil && cs.maxVal != nil {
-		rangeStr = fmt.Sprintf(" [%d..%d]", *cs.minVal, *cs.maxVal)
+		rangeStr = fmt.Sprintf("[%d..%d]", *cs.minVal, *cs.maxVal)
 	}
 	return fmt.Sprintf("colset %s = int%s%s", cs.name, rangeStr, timedStr)
 }
@@ -439,6 +447,19 @@ func ParseColorSetValue(colorSet ColorSet, valueStr string) (interface{}, error)
 		}
 		return nil, fmt.Errorf("value '%s' is not a member of enumerated color set %s", valueStr, cs.Name())
 
+	case *ListColorSet, *RecordColorSet, *UnionColorSet, *ProductColorSet:
+		return parseCompositeValue(colorSet, valueStr)
+
+	case *SubsetColorSet:
+		value, err := ParseColorSetValue(cs.GetBase(), valueStr)
+		if err != nil {
+			return nil, err
+		}
+		if !cs.IsMember(value) {
+			return nil, fmt.Errorf("value '%s' is not a member of subset color set %s", valueStr, cs.Name())
+		}
+		return value, nil
+
 	default:
 		return nil, fmt.Errorf("unsupported color set type for parsing: %T", colorSet)
 	}
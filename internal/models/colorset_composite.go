@@ -0,0 +1,370 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ListColorSet represents lists of values of an element color set, optionally with bounded length
+type ListColorSet struct {
+	name      string
+	timed     bool
+	element   ColorSet
+	minLength int
+	maxLength int // -1 = unbounded
+}
+
+// NewListColorSet creates a new list color set without length bounds
+func NewListColorSet(name string, timed bool, element ColorSet) *ListColorSet {
+	return &ListColorSet{name: name, timed: timed, element: element, maxLength: -1}
+}
+
+// NewListColorSetWithLength creates a new list color set whose lists have minLength..maxLength elements
+func NewListColorSetWithLength(name string, timed bool, element ColorSet, minLength, maxLength int) *ListColorSet {
+	return &ListColorSet{name: name, timed: timed, element: element, minLength: minLength, maxLength: maxLength}
+}
+
+func (cs *ListColorSet) Name() string {
+	return cs.name
+}
+
+func (cs *ListColorSet) IsMember(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+	case v.Kind() == reflect.Map && v.Len() == 0:
+		// An empty Lua table converts to an empty map
+		return cs.minLength == 0
+	default:
+		return false
+	}
+	if v.Len() < cs.minLength || (cs.maxLength >= 0 && v.Len() > cs.maxLength) {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if !cs.element.IsMember(v.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cs *ListColorSet) IsTimed() bool {
+	return cs.timed
+}
+
+// GetElement returns the color set of the list elements
+func (cs *ListColorSet) GetElement() ColorSet {
+	return cs.element
+}
+
+// GetLength returns the length bounds of the lists (max -1 = unbounded)
+func (cs *ListColorSet) GetLength() (int, int) {
+	return cs.minLength, cs.maxLength
+}
+
+func (cs *ListColorSet) String() string {
+	timedStr := ""
+	if cs.timed {
+		timedStr = " timed"
+	}
+	lengthStr := ""
+	if cs.maxLength >= 0 {
+		lengthStr = fmt.Sprintf(" with %d..%d", cs.minLength, cs.maxLength)
+	}
+	return fmt.Sprintf("colset %s = list %s%s%s", cs.name, cs.element.Name(), lengthStr, timedStr)
+}
+
+// RecordField is a named component of a record color set
+type RecordField struct {
+	Name     string
+	ColorSet ColorSet
+}
+
+// RecordColorSet represents records with named fields; values are maps from field name to value
+type RecordColorSet struct {
+	name   string
+	timed  bool
+	fields []RecordField
+}
+
+// NewRecordColorSet creates a new record color set
+func NewRecordColorSet(name string, timed bool, fields []RecordField) *RecordColorSet {
+	return &RecordColorSet{name: name, timed: timed, fields: fields}
+}
+
+func (cs *RecordColorSet) Name() string {
+	return cs.name
+}
+
+func (cs *RecordColorSet) IsMember(value interface{}) bool {
+	record, ok := value.(map[string]interface{})
+	if !ok || len(record) != len(cs.fields) {
+		return false
+	}
+	for _, field := range cs.fields {
+		fieldValue, exists := record[field.Name]
+		if !exists || !field.ColorSet.IsMember(fieldValue) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cs *RecordColorSet) IsTimed() bool {
+	return cs.timed
+}
+
+// GetFields returns the fields of the record
+func (cs *RecordColorSet) GetFields() []RecordField {
+	return cs.fields
+}
+
+func (cs *RecordColorSet) String() string {
+	timedStr := ""
+	if cs.timed {
+		timedStr = " timed"
+	}
+	var fields []string
+	for _, field := range cs.fields {
+		fields = append(fields, field.Name+":"+field.ColorSet.Name())
+	}
+	return fmt.Sprintf("colset %s = record %s%s", cs.name, strings.Join(fields, " * "), timedStr)
+}
+
+// UnionVariant is a constructor of a union color set. Constant constructors have no color set.
+type UnionVariant struct {
+	Name     string
+	ColorSet ColorSet // nil for a constant constructor
+}
+
+// UnionColorSet represents tagged values: a constant constructor B is the string "B", and a
+// constructor A carrying a value v is the single entry map {"A": v} (x.A in Lua)
+type UnionColorSet struct {
+	name     string
+	timed    bool
+	variants []UnionVariant
+}
+
+// NewUnionColorSet creates a new union color set
+func NewUnionColorSet(name string, timed bool, variants []UnionVariant) *UnionColorSet {
+	return &UnionColorSet{name: name, timed: timed, variants: variants}
+}
+
+func (cs *UnionColorSet) Name() string {
+	return cs.name
+}
+
+// variant returns the constructor of a value
+func (cs *UnionColorSet) variant(value interface{}) (UnionVariant, interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, variant := range cs.variants {
+			if variant.Name == v && variant.ColorSet == nil {
+				return variant, nil, true
+			}
+		}
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return UnionVariant{}, nil, false
+		}
+		for _, variant := range cs.variants {
+			if data, ok := v[variant.Name]; ok && variant.ColorSet != nil {
+				return variant, data, true
+			}
+		}
+	}
+	return UnionVariant{}, nil, false
+}
+
+func (cs *UnionColorSet) IsMember(value interface{}) bool {
+	variant, data, ok := cs.variant(value)
+	return ok && (variant.ColorSet == nil || variant.ColorSet.IsMember(data))
+}
+
+func (cs *UnionColorSet) IsTimed() bool {
+	return cs.timed
+}
+
+// GetVariants returns the constructors of the union
+func (cs *UnionColorSet) GetVariants() []UnionVariant {
+	return cs.variants
+}
+
+func (cs *UnionColorSet) String() string {
+	timedStr := ""
+	if cs.timed {
+		timedStr = " timed"
+	}
+	var variants []string
+	for _, variant := range cs.variants {
+		if variant.ColorSet == nil {
+			variants = append(variants, variant.Name)
+		} else {
+			variants = append(variants, variant.Name+":"+variant.ColorSet.Name())
+		}
+	}
+	return fmt.Sprintf("colset %s = union %s%s", cs.name, strings.Join(variants, " + "), timedStr)
+}
+
+// SubsetPredicate decides whether a member of the base color set belongs to a subset
+type SubsetPredicate func(value interface{}) (bool, error)
+
+// SubsetColorSet represents the members of a base color set satisfying a predicate. The predicate
+// is Lua source (a function name from the net's declarations, or a function expression) and is
+// bound by the engine with SetPredicate when the CPN is loaded; until then only base membership
+// is checked.
+type SubsetColorSet struct {
+	name      string
+	timed     bool
+	base      ColorSet
+	source    string
+	predicate SubsetPredicate
+}
+
+// NewSubsetColorSet creates a new subset color set
+func NewSubsetColorSet(name string, timed bool, base ColorSet, predicate string) *SubsetColorSet {
+	return &SubsetColorSet{name: name, timed: timed, base: base, source: predicate}
+}
+
+func (cs *SubsetColorSet) Name() string {
+	return cs.name
+}
+
+func (cs *SubsetColorSet) IsMember(value interface{}) bool {
+	if !cs.base.IsMember(value) {
+		return false
+	}
+	if cs.predicate == nil {
+		return true
+	}
+	ok, err := cs.predicate(value)
+	return err == nil && ok
+}
+
+func (cs *SubsetColorSet) IsTimed() bool {
+	return cs.timed
+}
+
+// GetBase returns the color set the subset is taken from
+func (cs *SubsetColorSet) GetBase() ColorSet {
+	return cs.base
+}
+
+// GetPredicate returns the Lua source of the predicate
+func (cs *SubsetColorSet) GetPredicate() string {
+	return cs.source
+}
+
+// SetPredicate binds the evaluated predicate
+func (cs *SubsetColorSet) SetPredicate(predicate SubsetPredicate) {
+	cs.predicate = predicate
+}
+
+func (cs *SubsetColorSet) String() string {
+	timedStr := ""
+	if cs.timed {
+		timedStr = " timed"
+	}
+	return fmt.Sprintf("colset %s = subset %s by %s%s", cs.name, cs.base.Name(), cs.source, timedStr)
+}
+
+// unboundCopy returns a color set whose subset color sets are new instances with unbound
+// predicates. Color sets built without subsets are shared; copies maps the color sets copied so far.
+func unboundCopy(colorSet ColorSet, copies map[ColorSet]ColorSet) ColorSet {
+	if colorSet == nil {
+		return nil
+	}
+	if c, ok := copies[colorSet]; ok {
+		return c
+	}
+	result := colorSet
+	switch cs := colorSet.(type) {
+	case *SubsetColorSet:
+		result = NewSubsetColorSet(cs.name, cs.timed, unboundCopy(cs.base, copies), cs.source)
+	case *ListColorSet:
+		if element := unboundCopy(cs.element, copies); element != cs.element {
+			result = NewListColorSetWithLength(cs.name, cs.timed, element, cs.minLength, cs.maxLength)
+		}
+	case *ProductColorSet:
+		components := make([]ColorSet, len(cs.components))
+		changed := false
+		for i, component := range cs.components {
+			components[i] = unboundCopy(component, copies)
+			changed = changed || components[i] != component
+		}
+		if changed {
+			result = NewProductColorSet(cs.name, cs.timed, components)
+		}
+	case *RecordColorSet:
+		fields := make([]RecordField, len(cs.fields))
+		changed := false
+		for i, field := range cs.fields {
+			fields[i] = RecordField{Name: field.Name, ColorSet: unboundCopy(field.ColorSet, copies)}
+			changed = changed || fields[i].ColorSet != field.ColorSet
+		}
+		if changed {
+			result = NewRecordColorSet(cs.name, cs.timed, fields)
+		}
+	case *UnionColorSet:
+		variants := make([]UnionVariant, len(cs.variants))
+		changed := false
+		for i, variant := range cs.variants {
+			variants[i] = UnionVariant{Name: variant.Name, ColorSet: unboundCopy(variant.ColorSet, copies)}
+			changed = changed || variants[i].ColorSet != variant.ColorSet
+		}
+		if changed {
+			result = NewUnionColorSet(cs.name, cs.timed, variants)
+		}
+	}
+	copies[colorSet] = result
+	return result
+}
+
+// parseCompositeValue parses the JSON text of a list, record, product or union value.
+// Union values may also be written as a constructor application A(v) or a constant B.
+func parseCompositeValue(colorSet ColorSet, valueStr string) (interface{}, error) {
+	valueStr = strings.TrimSpace(valueStr)
+	if _, ok := colorSet.(*UnionColorSet); ok {
+		if open := strings.IndexByte(valueStr, '('); open > 0 && strings.HasSuffix(valueStr, ")") {
+			valueStr = fmt.Sprintf(`{%q: %s}`, strings.TrimSpace(valueStr[:open]), valueStr[open+1:len(valueStr)-1])
+		} else if !strings.HasPrefix(valueStr, "{") && !strings.HasPrefix(valueStr, `"`) {
+			valueStr = strconv.Quote(valueStr)
+		}
+	}
+	decoder := json.NewDecoder(strings.NewReader(valueStr))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("cannot parse '%s' as a value of color set %s: %v", valueStr, colorSet.Name(), err)
+	}
+	value := normalizeJSONNumbers(raw)
+	if !colorSet.IsMember(value) {
+		return nil, fmt.Errorf("value '%s' is not a member of color set %s", valueStr, colorSet.Name())
+	}
+	return value, nil
+}
+
+// normalizeJSONNumbers turns json.Number values into ints when integral and float64 otherwise
+func normalizeJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSONNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeJSONNumbers(v[k])
+		}
+	}
+	return value
+}
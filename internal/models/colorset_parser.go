@@ -55,6 +55,11 @@ func (p *ColorSetParser) GetColorSet(name string) (ColorSet, bool) {
 //	"colset MyInt = int timed;"
 //	"colset Color = with red | green | blue;"
 //	"colset Pair = product INT * STRING;"
+//	"colset Ints = list INT with 0..10;"
+//	"colset Item = record id:INT * name:STRING;"
+//	"colset Result = union Ok:INT + Failed;"
+//	"colset Even = subset INT by isEven;"
+//	"colset Small = INT with 0..10;"
 func (p *ColorSetParser) ParseColorSetDefinition(definition string) (ColorSet, error) {
 	// Remove extra whitespace and normalize
 	definition = strings.TrimSpace(definition)
@@ -129,6 +134,16 @@ func (p *ColorSetParser) parseTypeDefinition(name, typeDefinition string, timed
 		return p.parseEnumerated(name, typeDefinition, timed)
 	case strings.HasPrefix(typeDefinition, "product "):
 		return p.parseProduct(name, typeDefinition, timed)
+	case strings.HasPrefix(typeDefinition, "list "):
+		return p.parseList(name, typeDefinition, timed)
+	case strings.HasPrefix(typeDefinition, "record "):
+		return p.parseRecord(name, typeDefinition, timed)
+	case strings.HasPrefix(typeDefinition, "union "):
+		return p.parseUnion(name, typeDefinition, timed)
+	case strings.HasPrefix(typeDefinition, "subset "):
+		return p.parseSubset(name, typeDefinition, timed)
+	case aliasWithRange.MatchString(typeDefinition):
+		return p.parseAliasWithRange(name, typeDefinition, timed)
 	default:
 		// Check if it's a reference to an existing color set
 		if existingCS, exists := p.GetColorSet(typeDefinition); exists {
@@ -142,7 +157,7 @@ func (p *ColorSetParser) parseTypeDefinition(name, typeDefinition string, timed
 // parseIntegerRange parses integer range definitions like "int[1..10]"
 func (p *ColorSetParser) parseIntegerRange(name, typeDefinition string, timed bool) (ColorSet, error) {
 	// Extract range from int[min..max]
-	re := regexp.MustCompile(`^int\[(\d+)\.\.(\d+)\]$`)
+	re := regexp.MustCompile(`^int\[(-?\d+)\.\.(-?\d+)\]$`)
 	matches := re.FindStringSubmatch(typeDefinition)
 
 	if len(matches) != 3 {
@@ -222,6 +237,120 @@ func (p *ColorSetParser) parseProduct(name, typeDefinition string, timed bool) (
 	return NewProductColorSet(name, timed, components), nil
 }
 
+// lengthRange matches the "with min..max" suffix of list definitions
+var lengthRange = regexp.MustCompile(`^(.+?)\s+with\s+(\d+)\s*\.\.\s*(\d+)$`)
+
+// aliasWithRange matches constrained aliases of integer color sets like "INT with 0..10"
+var aliasWithRange = regexp.MustCompile(`^(\w+)\s+with\s+(-?\d+)\s*\.\.\s*(-?\d+)$`)
+
+// fieldName matches record field and union constructor names
+var fieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseList parses list definitions like "list INT" or "list INT with 0..10" (length bounds)
+func (p *ColorSetParser) parseList(name, typeDefinition string, timed bool) (ColorSet, error) {
+	elementPart := strings.TrimSpace(strings.TrimPrefix(typeDefinition, "list "))
+	if m := lengthRange.FindStringSubmatch(elementPart); m != nil {
+		element, exists := p.GetColorSet(m[1])
+		if !exists {
+			return nil, fmt.Errorf("unknown list element color set: %s", m[1])
+		}
+		minLength, _ := strconv.Atoi(m[2])
+		maxLength, _ := strconv.Atoi(m[3])
+		if minLength > maxLength {
+			return nil, fmt.Errorf("minimum length %d is greater than maximum length %d", minLength, maxLength)
+		}
+		return NewListColorSetWithLength(name, timed, element, minLength, maxLength), nil
+	}
+	element, exists := p.GetColorSet(elementPart)
+	if !exists {
+		return nil, fmt.Errorf("unknown list element color set: %s", elementPart)
+	}
+	return NewListColorSet(name, timed, element), nil
+}
+
+// parseRecord parses record definitions like "record id:INT * name:STRING"
+func (p *ColorSetParser) parseRecord(name, typeDefinition string, timed bool) (ColorSet, error) {
+	var fields []RecordField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(strings.TrimPrefix(typeDefinition, "record "), "*") {
+		fieldDef := strings.SplitN(part, ":", 2)
+		if len(fieldDef) != 2 {
+			return nil, fmt.Errorf("invalid record field '%s' (expected name:COLORSET)", strings.TrimSpace(part))
+		}
+		field, csName := strings.TrimSpace(fieldDef[0]), strings.TrimSpace(fieldDef[1])
+		if !fieldName.MatchString(field) || seen[field] {
+			return nil, fmt.Errorf("invalid or duplicate record field name '%s'", field)
+		}
+		colorSet, exists := p.GetColorSet(csName)
+		if !exists {
+			return nil, fmt.Errorf("unknown color set of record field %s: %s", field, csName)
+		}
+		seen[field] = true
+		fields = append(fields, RecordField{Name: field, ColorSet: colorSet})
+	}
+	return NewRecordColorSet(name, timed, fields), nil
+}
+
+// parseUnion parses union definitions like "union Ok:INT + Failed"
+func (p *ColorSetParser) parseUnion(name, typeDefinition string, timed bool) (ColorSet, error) {
+	var variants []UnionVariant
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(strings.TrimPrefix(typeDefinition, "union "), "+") {
+		variantDef := strings.SplitN(part, ":", 2)
+		variant := UnionVariant{Name: strings.TrimSpace(variantDef[0])}
+		if !fieldName.MatchString(variant.Name) || seen[variant.Name] {
+			return nil, fmt.Errorf("invalid or duplicate union constructor '%s'", variant.Name)
+		}
+		if len(variantDef) == 2 {
+			csName := strings.TrimSpace(variantDef[1])
+			colorSet, exists := p.GetColorSet(csName)
+			if !exists {
+				return nil, fmt.Errorf("unknown color set of union constructor %s: %s", variant.Name, csName)
+			}
+			variant.ColorSet = colorSet
+		}
+		seen[variant.Name] = true
+		variants = append(variants, variant)
+	}
+	if len(variants) < 2 {
+		return nil, fmt.Errorf("union color set must have at least two constructors")
+	}
+	return NewUnionColorSet(name, timed, variants), nil
+}
+
+// parseSubset parses subset definitions like "subset INT by isEven"; the predicate is Lua source
+// evaluated to a function (see SubsetColorSet)
+func (p *ColorSetParser) parseSubset(name, typeDefinition string, timed bool) (ColorSet, error) {
+	parts := strings.SplitN(strings.TrimPrefix(typeDefinition, "subset "), " by ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil, fmt.Errorf("invalid subset format (expected subset COLORSET by predicate): %s", typeDefinition)
+	}
+	baseName := strings.TrimSpace(parts[0])
+	base, exists := p.GetColorSet(baseName)
+	if !exists {
+		return nil, fmt.Errorf("unknown base color set of subset: %s", baseName)
+	}
+	return NewSubsetColorSet(name, timed, base, strings.TrimSpace(parts[1])), nil
+}
+
+// parseAliasWithRange parses constrained aliases of integer color sets like "INT with 0..10"
+func (p *ColorSetParser) parseAliasWithRange(name, typeDefinition string, timed bool) (ColorSet, error) {
+	m := aliasWithRange.FindStringSubmatch(typeDefinition)
+	base, exists := p.GetColorSet(m[1])
+	if !exists {
+		return nil, fmt.Errorf("unknown color set: %s", m[1])
+	}
+	if _, ok := base.(*IntegerColorSet); !ok {
+		return nil, fmt.Errorf("range constraints require an integer color set, %s is %T", m[1], base)
+	}
+	minVal, _ := strconv.Atoi(m[2])
+	maxVal, _ := strconv.Atoi(m[3])
+	if minVal > maxVal {
+		return nil, fmt.Errorf("minimum value %d is greater than maximum value %d", minVal, maxVal)
+	}
+	return NewIntegerColorSetWithRange(name, timed, minVal, maxVal), nil
+}
+
 // cloneColorSetWithNewName creates a new color set based on an existing one but with different name and timed property
 func (p *ColorSetParser) cloneColorSetWithNewName(original ColorSet, newName string, timed bool) (ColorSet, error) {
 	switch cs := original.(type) {
@@ -249,6 +378,18 @@ func (p *ColorSetParser) cloneColorSetWithNewName(original ColorSet, newName str
 	case *ProductColorSet:
 		return NewProductColorSet(newName, timed, cs.GetComponents()), nil
 
+	case *ListColorSet:
+		return &ListColorSet{name: newName, timed: timed, element: cs.element, minLength: cs.minLength, maxLength: cs.maxLength}, nil
+
+	case *RecordColorSet:
+		return NewRecordColorSet(newName, timed, cs.GetFields()), nil
+
+	case *UnionColorSet:
+		return NewUnionColorSet(newName, timed, cs.GetVariants()), nil
+
+	case *SubsetColorSet:
+		return NewSubsetColorSet(newName, timed, cs.GetBase(), cs.GetPredicate()), nil
+
 	default:
 		return nil, fmt.Errorf("unsupported color set type for cloning: %T", original)
 	}
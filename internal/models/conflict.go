@@ -0,0 +1,58 @@
+package models
+
+import "fmt"
+
+// ConflictPolicy selects how the engine chooses between transitions (or bindings)
+// that are enabled at the same time and compete for the same step.
+type ConflictPolicy string
+
+const (
+	ConflictPolicyDeterministic ConflictPolicy = "deterministic" // Lowest transition ID / first binding wins
+	ConflictPolicyRandom        ConflictPolicy = "random"        // Uniform choice from the marking's seeded random source
+	ConflictPolicyWeighted      ConflictPolicy = "weighted"      // Choice proportional to transition Weight / BindingWeight
+)
+
+// ConflictResolution configures conflict resolution for a CPN.
+// JSON: { "transitions": "random", "bindings": "deterministic", "seed": 42 }
+type ConflictResolution struct {
+	Transitions ConflictPolicy `json:"transitions,omitempty"`
+	Bindings    ConflictPolicy `json:"bindings,omitempty"`
+	Seed        int64          `json:"seed,omitempty"`
+}
+
+// TransitionPolicy returns the transition policy, defaulting to deterministic
+func (cr *ConflictResolution) TransitionPolicy() ConflictPolicy {
+	if cr == nil || cr.Transitions == "" {
+		return ConflictPolicyDeterministic
+	}
+	return cr.Transitions
+}
+
+// BindingPolicy returns the binding policy, defaulting to deterministic
+func (cr *ConflictResolution) BindingPolicy() ConflictPolicy {
+	if cr == nil || cr.Bindings == "" {
+		return ConflictPolicyDeterministic
+	}
+	return cr.Bindings
+}
+
+// Validate checks that both policies are known
+func (cr *ConflictResolution) Validate() error {
+	for _, p := range []ConflictPolicy{cr.TransitionPolicy(), cr.BindingPolicy()} {
+		switch p {
+		case ConflictPolicyDeterministic, ConflictPolicyRandom, ConflictPolicyWeighted:
+		default:
+			return fmt.Errorf("unknown conflict policy '%s'", p)
+		}
+	}
+	return nil
+}
+
+// Clone creates a copy of the conflict resolution configuration
+func (cr *ConflictResolution) Clone() *ConflictResolution {
+	if cr == nil {
+		return nil
+	}
+	clone := *cr
+	return &clone
+}
@@ -0,0 +1,48 @@
+package models
+
+import "fmt"
+
+// ConversionIssue describes a construct of an external model format that could not be
+// converted exactly
+type ConversionIssue struct {
+	Element string `json:"element,omitempty"` // ID of the affected element (empty for the whole net)
+	Message string `json:"message"`
+	// ManualReview marks elements that were converted approximately or replaced by a placeholder
+	ManualReview bool `json:"manualReview,omitempty"`
+}
+
+// ConversionReport lists the issues found while converting a net from or to an external format
+type ConversionReport struct {
+	Format string            `json:"format"`
+	Issues []ConversionIssue `json:"issues"`
+}
+
+// NewConversionReport creates an empty report for a format
+func NewConversionReport(format string) *ConversionReport {
+	return &ConversionReport{Format: format, Issues: []ConversionIssue{}}
+}
+
+// Add records an issue for an element
+func (r *ConversionReport) Add(element, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ConversionIssue{Element: element, Message: fmt.Sprintf(format, args...)})
+}
+
+// Review records an issue for an element that needs a manual review
+func (r *ConversionReport) Review(element, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ConversionIssue{Element: element, Message: fmt.Sprintf(format, args...), ManualReview: true})
+}
+
+// NeedsReview reports whether any element needs a manual review
+func (r *ConversionReport) NeedsReview() bool {
+	for _, issue := range r.Issues {
+		if issue.ManualReview {
+			return true
+		}
+	}
+	return false
+}
+
+// Exact reports whether the conversion was lossless
+func (r *ConversionReport) Exact() bool {
+	return len(r.Issues) == 0
+}
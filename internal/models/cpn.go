@@ -16,6 +16,16 @@ type CPN struct {
 	InitialMarking map[string][]*Token `json:"initialMarking"`         // Initial tokens by place ID
 	EndPlaces      []string            `json:"endPlaces"`              // Places that signify case completion (still by name for UX)
 	SubWorkflows   []*SubWorkflowLink  `json:"subWorkflows,omitempty"` // Hierarchical substitution transitions
+	// ConflictResolution selects how competing transitions and bindings are chosen (nil = deterministic)
+	ConflictResolution *ConflictResolution `json:"conflictResolution,omitempty"`
+	Monitors           []*Monitor          `json:"monitors,omitempty"` // Data collectors, breakpoints and marking size monitors
+	// Declarations is Lua source declaring functions, constants and value tables shared by all inscriptions of the net
+	Declarations string `json:"declarations,omitempty"`
+	// Version and Hash identify the deployment of the CPN (see CPNVersion); 0 and "" until deployed
+	Version int    `json:"version,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+
+	colorSets map[string]ColorSet // declared color sets by name (see RegisterColorSet)
 }
 
 // NewCPN creates a new CPN with the given ID, name, and description
@@ -38,6 +48,42 @@ func (cpn *CPN) AddPlace(place *Place) {
 	cpn.Places = append(cpn.Places, place)
 }
 
+// RegisterColorSet makes a declared color set available by name, also when no place uses it
+func (cpn *CPN) RegisterColorSet(colorSet ColorSet) {
+	if cpn.colorSets == nil {
+		cpn.colorSets = make(map[string]ColorSet)
+	}
+	cpn.colorSets[colorSet.Name()] = colorSet
+}
+
+// ColorSets returns the registered color sets of the CPN
+func (cpn *CPN) ColorSets() []ColorSet {
+	colorSets := make([]ColorSet, 0, len(cpn.colorSets))
+	for _, cs := range cpn.colorSets {
+		colorSets = append(colorSets, cs)
+	}
+	return colorSets
+}
+
+// GetColorSet returns a color set of the CPN by name: a registered color set, the color set of a
+// place or a built-in color set
+func (cpn *CPN) GetColorSet(name string) (ColorSet, bool) {
+	if cs, ok := cpn.colorSets[name]; ok {
+		return cs, true
+	}
+	for _, place := range cpn.Places {
+		if place.ColorSet != nil && place.ColorSet.Name() == name {
+			return place.ColorSet, true
+		}
+	}
+	for _, cs := range []ColorSet{INT, STRING, BOOL, REAL, UNIT} {
+		if cs.Name() == name {
+			return cs, true
+		}
+	}
+	return nil, false
+}
+
 // AddTransition adds a transition to the CPN
 func (cpn *CPN) AddTransition(transition *Transition) {
 	cpn.Transitions = append(cpn.Transitions, transition)
@@ -150,6 +196,9 @@ func (cpn *CPN) GetArcsForPlace(placeID string) []*Arc {
 // CreateInitialMarking creates a marking based on the initial marking definition
 func (cpn *CPN) CreateInitialMarking() *Marking {
 	marking := NewMarking()
+	if cpn.ConflictResolution != nil {
+		marking.SetSeed(cpn.ConflictResolution.Seed)
+	}
 	for placeID, tokens := range cpn.InitialMarking {
 		for _, token := range tokens {
 			marking.AddToken(placeID, token.Clone())
@@ -276,6 +325,10 @@ func (cpn *CPN) Clone() *CPN {
 		InitialMarking: make(map[string][]*Token),
 		EndPlaces:      make([]string, len(cpn.EndPlaces)),
 		SubWorkflows:   make([]*SubWorkflowLink, len(cpn.SubWorkflows)),
+		Declarations:   cpn.Declarations,
+		Version:        cpn.Version,
+		Hash:           cpn.Hash,
+		colorSets:      cpn.colorSets, // color sets are immutable
 	}
 
 	// Clone places
@@ -312,9 +365,53 @@ func (cpn *CPN) Clone() *CPN {
 		}
 	}
 
+	clone.ConflictResolution = cpn.ConflictResolution.Clone()
+
+	// Clone monitors
+	for _, m := range cpn.Monitors {
+		clone.Monitors = append(clone.Monitors, m.Clone())
+	}
+
+	return clone
+}
+
+// CloneUnbound creates a deep copy of the CPN with new instances of its subset color sets (and of
+// the color sets built from them), whose predicates are not bound yet. Unlike Clone, the copy can
+// be compiled by another engine without affecting the original.
+func (cpn *CPN) CloneUnbound() *CPN {
+	clone := cpn.Clone()
+	copies := make(map[ColorSet]ColorSet)
+	clone.colorSets = make(map[string]ColorSet, len(cpn.colorSets))
+	for name, colorSet := range cpn.colorSets {
+		clone.colorSets[name] = unboundCopy(colorSet, copies)
+	}
+	for _, place := range clone.Places {
+		place.ColorSet = unboundCopy(place.ColorSet, copies)
+	}
 	return clone
 }
 
+// HasHigherPriorityThan reports whether any transition has a strictly higher priority
+// (lower priority value) than the given one. Used to skip priority checks in flat nets.
+func (cpn *CPN) HasHigherPriorityThan(transition *Transition) bool {
+	for _, t := range cpn.Transitions {
+		if t.Priority < transition.Priority {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMonitor returns a monitor by ID
+func (cpn *CPN) GetMonitor(id string) *Monitor {
+	for _, m := range cpn.Monitors {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
 // GetSubWorkflowByTransition returns the sub workflow link for a given call transition id
 func (cpn *CPN) GetSubWorkflowByTransition(transitionID string) *SubWorkflowLink {
 	for _, sw := range cpn.SubWorkflows {
@@ -33,6 +33,12 @@ type CPNDefinitionJSON struct {
 	InitialMarking map[string][]TokenJSON `json:"initialMarking,omitempty"` // Keys: place IDs (preferred) or legacy place names
 	EndPlaces      []string               `json:"endPlaces,omitempty"`
 	SubWorkflows   []SubWorkflowJSON      `json:"subWorkflows,omitempty"`
+	// ConflictResolution selects transition/binding conflict policies (default deterministic)
+	ConflictResolution *ConflictResolution `json:"conflictResolution,omitempty"`
+	// Monitors observe firings: data collectors, breakpoints and marking size monitors
+	Monitors []*Monitor `json:"monitors,omitempty"`
+	// Declarations holds Lua functions, constants and value tables available to every inscription
+	Declarations string `json:"declarations,omitempty"`
 }
 
 // JsonSchemaDef represents a named JSON Schema definition
@@ -92,6 +98,9 @@ type TransitionJSON struct {
 	ActionExpression string    `json:"actionExpression,omitempty"`
 	FormSchema       string    `json:"formSchema,omitempty"`
 	LayoutSchema     string    `json:"layoutSchema,omitempty"`
+	Priority         *int      `json:"priority,omitempty"` // Lower value = higher priority; omitted = PriorityNormal
+	Weight           *float64  `json:"weight,omitempty"`   // Omitted = 1; 0 removes the transition from weighted selection
+	BindingWeight    string    `json:"bindingWeight,omitempty"`
 }
 
 // ArcJSON represents the JSON structure for arcs
@@ -136,6 +145,7 @@ func (p *CPNParser) ParseCPNFromJSON(jsonData []byte) (*CPN, error) {
 func (p *CPNParser) ParseCPNFromDefinition(cpnDef *CPNDefinitionJSON) (*CPN, error) {
 	// Create the CPN
 	cpn := NewCPN(cpnDef.ID, cpnDef.Name, cpnDef.Description)
+	cpn.Declarations = cpnDef.Declarations
 
 	// Load JSON Schemas first so color sets can reference them
 	if err := p.parseJsonSchemas(cpnDef.JsonSchemas); err != nil {
@@ -146,6 +156,9 @@ func (p *CPNParser) ParseCPNFromDefinition(cpnDef *CPNDefinitionJSON) (*CPN, err
 	if err := p.parseColorSets(cpnDef.ColorSets); err != nil {
 		return nil, fmt.Errorf("failed to parse color sets: %v", err)
 	}
+	for _, colorSet := range p.colorSetParser.colorSets {
+		cpn.RegisterColorSet(colorSet)
+	}
 
 	// Parse places
 	if err := p.parsePlaces(cpn, cpnDef.Places); err != nil {
@@ -177,6 +190,27 @@ func (p *CPNParser) ParseCPNFromDefinition(cpnDef *CPNDefinitionJSON) (*CPN, err
 		return nil, fmt.Errorf("failed to parse subWorkflows: %v", err)
 	}
 
+	// Conflict resolution policies
+	if cpnDef.ConflictResolution != nil {
+		if err := cpnDef.ConflictResolution.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid conflictResolution: %v", err)
+		}
+		cpn.ConflictResolution = cpnDef.ConflictResolution.Clone()
+	}
+
+	// Monitors
+	seenMonitors := make(map[string]bool)
+	for _, m := range cpnDef.Monitors {
+		if err := m.Validate(cpn); err != nil {
+			return nil, fmt.Errorf("invalid monitor: %v", err)
+		}
+		if seenMonitors[m.ID] {
+			return nil, fmt.Errorf("invalid monitor: duplicate monitor id %s", m.ID)
+		}
+		seenMonitors[m.ID] = true
+		cpn.Monitors = append(cpn.Monitors, m.Clone())
+	}
+
 	// Validate the CPN structure
 	if errors := cpn.ValidateStructure(); len(errors) > 0 {
 		return nil, fmt.Errorf("CPN validation failed: %v", errors)
@@ -263,6 +297,18 @@ func (p *CPNParser) parseTransitions(cpn *CPN, transitionDefs []TransitionJSON)
 			transition.Position = &Position{X: transitionDef.Position.X, Y: transitionDef.Position.Y}
 		}
 
+		// Priority / weights for conflict resolution
+		if transitionDef.Priority != nil {
+			transition.SetPriority(*transitionDef.Priority)
+		}
+		if transitionDef.Weight != nil {
+			if *transitionDef.Weight < 0 {
+				return fmt.Errorf("negative weight for transition '%s'", transitionDef.Name)
+			}
+			transition.Weight = *transitionDef.Weight
+		}
+		transition.BindingWeight = transitionDef.BindingWeight
+
 		cpn.AddTransition(transition)
 	}
 	return nil
@@ -345,6 +391,13 @@ func (p *CPNParser) CPNToJSON(cpn *CPN) ([]byte, error) {
 		InitialMarking: make(map[string][]TokenJSON),
 		EndPlaces:      cpn.EndPlaces,
 		SubWorkflows:   make([]SubWorkflowJSON, len(cpn.SubWorkflows)),
+
+		ConflictResolution: cpn.ConflictResolution.Clone(),
+		Declarations:       cpn.Declarations,
+	}
+
+	for _, m := range cpn.Monitors {
+		cpnDef.Monitors = append(cpnDef.Monitors, m.Clone())
 	}
 
 	// Use preserved original definitions if available
@@ -376,6 +429,9 @@ func (p *CPNParser) CPNToJSON(cpn *CPN) ([]byte, error) {
 			ActionExpression: transition.ActionExpression,
 			FormSchema:       transition.FormSchema,
 			LayoutSchema:     transition.LayoutSchema,
+			Priority:         transition.priorityJSON(),
+			Weight:           transition.weightJSON(),
+			BindingWeight:    transition.BindingWeight,
 		}
 	}
 
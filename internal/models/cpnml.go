@@ -0,0 +1,896 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Translation of CPN ML inscriptions (as written in CPN Tools) to Lua.
+//
+// The translator covers the expression subset inscriptions usually use: constants, variables,
+// enumeration and union constants, tuples, records, lists, arithmetic, comparisons, boolean
+// operators, string concatenation, record selectors (#a r), multisets (n`e ++ ...), time
+// inscriptions (@+ d) and a few library functions (color set functions, Int.toString, length,
+// hd, abs, Int.min/max). Anything else (if/case/let/fn, list construction, user functions) is
+// reported as untranslatable.
+
+type mlKind int
+
+const (
+	mlNumber mlKind = iota
+	mlString
+	mlIdent
+	mlUnit
+	mlTuple
+	mlList
+	mlRecord
+	mlApply
+	mlBinary
+	mlUnary
+	mlField
+)
+
+// mlExpr is a node of a parsed CPN ML expression
+type mlExpr struct {
+	kind   mlKind
+	text   string // literal, identifier, operator, field or function name
+	args   []*mlExpr
+	fields []string // record field names, parallel to args
+}
+
+type mlToken struct {
+	text   string
+	kind   mlKind // mlNumber, mlString, mlIdent; operators and punctuation use mlBinary
+	offset int
+}
+
+// mlKeywords are reserved words of CPN ML that the translator does not support as identifiers
+var mlKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "let": true, "in": true, "end": true, "case": true,
+	"of": true, "fn": true, "val": true, "fun": true, "local": true, "raise": true, "handle": true,
+	"andalso": true, "orelse": true, "div": true, "mod": true, "not": true,
+}
+
+// mlSymbols are the operators and punctuation of CPN ML, longest first
+var mlSymbols = []string{"@+", "++", "::", "^^", "<=", ">=", "<>", "=", "<", ">", "+", "-", "*", "/", "^", "~", "`", "@", "(", ")", "[", "]", "{", "}", ",", "#"}
+
+// lexML splits CPN ML source into tokens; comments (* ... *) are skipped
+func lexML(source string) ([]mlToken, error) {
+	var tokens []mlToken
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' && i+1 < len(runes) && runes[i+1] == '*':
+			end := strings.Index(string(runes[i+2:]), "*)")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += 2 + len([]rune(string(runes[i+2:])[:end])) + 2
+		case r == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+					switch runes[j] {
+					case 'n':
+						b.WriteRune('\n')
+					case 't':
+						b.WriteRune('\t')
+					default:
+						b.WriteRune(runes[j])
+					}
+					continue
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, mlToken{text: b.String(), kind: mlString, offset: i})
+			i = j + 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || (runes[j] == '.' && j+1 < len(runes) && unicode.IsDigit(runes[j+1]))) {
+				j++
+			}
+			tokens = append(tokens, mlToken{text: string(runes[i:j]), kind: mlNumber, offset: i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '\'' ||
+				(runes[j] == '.' && j+1 < len(runes) && unicode.IsLetter(runes[j+1]))) {
+				j++
+			}
+			tokens = append(tokens, mlToken{text: string(runes[i:j]), kind: mlIdent, offset: i})
+			i = j
+		default:
+			matched := false
+			for _, symbol := range mlSymbols {
+				if strings.HasPrefix(string(runes[i:]), symbol) {
+					tokens = append(tokens, mlToken{text: symbol, kind: mlBinary, offset: i})
+					i += len([]rune(symbol))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c'", r)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// mlParser is a precedence climbing parser over CPN ML tokens
+type mlParser struct {
+	tokens []mlToken
+	pos    int
+}
+
+// mlBinaryLevels are the binary operators by increasing precedence; "::" is right associative
+var mlBinaryLevels = [][]string{
+	{"++"},
+	{"@+", "@"},
+	{"`"},
+	{"orelse"},
+	{"andalso"},
+	{"=", "<>", "<", ">", "<=", ">="},
+	{"::", "^^"},
+	{"+", "-", "^"},
+	{"*", "/", "div", "mod"},
+}
+
+// parseML parses a CPN ML expression
+func parseML(source string) (*mlExpr, error) {
+	tokens, err := lexML(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &mlParser{tokens: tokens}
+	expr, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+func (p *mlParser) peek() *mlToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// accept consumes the next token if it is the symbol or keyword text
+func (p *mlParser) accept(text string) bool {
+	if t := p.peek(); t != nil && t.kind != mlString && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *mlParser) expect(text string) error {
+	if !p.accept(text) {
+		if t := p.peek(); t != nil {
+			return fmt.Errorf("expected '%s', found '%s'", text, t.text)
+		}
+		return fmt.Errorf("expected '%s' at end of expression", text)
+	}
+	return nil
+}
+
+func (p *mlParser) binary(level int) (*mlExpr, error) {
+	if level == len(mlBinaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t == nil || t.kind == mlString || !containsString(mlBinaryLevels[level], t.text) {
+			return left, nil
+		}
+		p.pos++
+		var right *mlExpr
+		if t.text == "::" {
+			right, err = p.binary(level)
+		} else {
+			right, err = p.binary(level + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		left = &mlExpr{kind: mlBinary, text: t.text, args: []*mlExpr{left, right}}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *mlParser) unary() (*mlExpr, error) {
+	switch {
+	case p.accept("~"):
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &mlExpr{kind: mlUnary, text: "~", args: []*mlExpr{operand}}, nil
+	case p.accept("not"):
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &mlExpr{kind: mlUnary, text: "not", args: []*mlExpr{operand}}, nil
+	case p.accept("#"):
+		t := p.peek()
+		if t == nil || t.kind != mlIdent {
+			return nil, fmt.Errorf("expected a field name after '#'")
+		}
+		p.pos++
+		record, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &mlExpr{kind: mlField, text: t.text, args: []*mlExpr{record}}, nil
+	}
+	return p.application()
+}
+
+// application parses a function application f x (or a single atom)
+func (p *mlParser) application() (*mlExpr, error) {
+	head, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	if head.kind != mlIdent || !p.startsAtom() {
+		return head, nil
+	}
+	arg, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &mlExpr{kind: mlApply, text: head.text, args: []*mlExpr{arg}}, nil
+}
+
+func (p *mlParser) startsAtom() bool {
+	t := p.peek()
+	if t == nil {
+		return false
+	}
+	switch t.kind {
+	case mlNumber, mlString:
+		return true
+	case mlIdent:
+		return !mlKeywords[t.text] || t.text == "not"
+	}
+	return t.text == "(" || t.text == "[" || t.text == "{" || t.text == "#" || t.text == "~"
+}
+
+func (p *mlParser) atom() (*mlExpr, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch {
+	case t.kind == mlNumber:
+		return &mlExpr{kind: mlNumber, text: t.text}, nil
+	case t.kind == mlString:
+		return &mlExpr{kind: mlString, text: t.text}, nil
+	case t.kind == mlIdent:
+		if mlKeywords[t.text] {
+			return nil, fmt.Errorf("'%s' expressions are not supported", t.text)
+		}
+		return &mlExpr{kind: mlIdent, text: t.text}, nil
+	case t.text == "(":
+		if p.accept(")") {
+			return &mlExpr{kind: mlUnit}, nil
+		}
+		items, err := p.sequence(")")
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 1 {
+			return items[0], nil
+		}
+		return &mlExpr{kind: mlTuple, args: items}, nil
+	case t.text == "[":
+		if p.accept("]") {
+			return &mlExpr{kind: mlList}, nil
+		}
+		items, err := p.sequence("]")
+		if err != nil {
+			return nil, err
+		}
+		return &mlExpr{kind: mlList, args: items}, nil
+	case t.text == "{":
+		record := &mlExpr{kind: mlRecord}
+		for {
+			field := p.peek()
+			if field == nil || field.kind != mlIdent {
+				return nil, fmt.Errorf("expected a record field name")
+			}
+			p.pos++
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.binary(0)
+			if err != nil {
+				return nil, err
+			}
+			record.fields = append(record.fields, field.text)
+			record.args = append(record.args, value)
+			if p.accept("}") {
+				return record, nil
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s'", t.text)
+}
+
+// sequence parses comma separated expressions up to the closing bracket
+func (p *mlParser) sequence(closing string) ([]*mlExpr, error) {
+	var items []*mlExpr
+	for {
+		item, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.accept(closing) {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// mlTranslator translates CPN ML expressions of one model to Lua
+type mlTranslator struct {
+	variables    map[string]bool     // declared variables
+	values       map[string]bool     // names declared with val
+	constants    map[string]bool     // enumeration constants and constant union constructors
+	constructors map[string]bool     // union constructors carrying a value
+	colorSets    map[string]ColorSet // color sets by name
+}
+
+func newMLTranslator() *mlTranslator {
+	return &mlTranslator{
+		variables:    make(map[string]bool),
+		values:       make(map[string]bool),
+		constants:    make(map[string]bool),
+		constructors: make(map[string]bool),
+		colorSets:    make(map[string]ColorSet),
+	}
+}
+
+// registerColorSet makes the constants and constructors of a color set known
+func (t *mlTranslator) registerColorSet(cs ColorSet) {
+	t.colorSets[cs.Name()] = cs
+	switch c := cs.(type) {
+	case *EnumeratedColorSet:
+		for _, v := range c.GetValues() {
+			t.constants[v] = true
+		}
+	case *UnionColorSet:
+		for _, v := range c.GetVariants() {
+			if v.ColorSet == nil {
+				t.constants[v.Name] = true
+			} else {
+				t.constructors[v.Name] = true
+			}
+		}
+	}
+}
+
+// Inscription translates an arc inscription. empty is true for the empty multiset.
+func (t *mlTranslator) Inscription(source string) (lua string, empty bool, err error) {
+	expr, err := parseML(source)
+	if err != nil {
+		return "", false, err
+	}
+	if expr.kind == mlBinary && expr.text == "@+" {
+		inner, empty, err := t.multiset(expr.args[0])
+		if err != nil || empty {
+			return "", empty, err
+		}
+		delay, err := t.lua(expr.args[1], 0)
+		if err != nil {
+			return "", false, err
+		}
+		return inner + " @+ " + delay, false, nil
+	}
+	return t.multiset(expr)
+}
+
+// multiset translates a (multiset) inscription, dropping empty terms
+func (t *mlTranslator) multiset(expr *mlExpr) (string, bool, error) {
+	var terms []*mlExpr
+	var flatten func(e *mlExpr)
+	flatten = func(e *mlExpr) {
+		if e.kind == mlBinary && e.text == "++" {
+			flatten(e.args[0])
+			flatten(e.args[1])
+			return
+		}
+		if e.kind == mlIdent && e.text == "empty" {
+			return
+		}
+		terms = append(terms, e)
+	}
+	flatten(expr)
+	if len(terms) == 0 {
+		return "", true, nil
+	}
+
+	var parts []string
+	for _, term := range terms {
+		delay := ""
+		if term.kind == mlBinary && term.text == "@+" {
+			d, err := t.lua(term.args[1], 0)
+			if err != nil {
+				return "", false, err
+			}
+			delay, term = d, term.args[0]
+		}
+		count := ""
+		if term.kind == mlBinary && term.text == "`" {
+			if term.args[0].kind != mlNumber || strings.Contains(term.args[0].text, ".") {
+				return "", false, fmt.Errorf("multiset coefficients must be integer constants")
+			}
+			count, term = term.args[0].text, term.args[1]
+		}
+		value, err := t.lua(term, 0)
+		if err != nil {
+			return "", false, err
+		}
+		if delay != "" {
+			value = fmt.Sprintf("delay(%s, %s)", value, delay)
+		}
+		if count != "" {
+			if !simpleTerm.MatchString(value) && !strings.HasSuffix(value, ")") {
+				value = "(" + value + ")"
+			}
+			value = count + "'" + value
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, " ++ "), false, nil
+}
+
+// Guard translates a transition guard; a list of conditions is their conjunction
+func (t *mlTranslator) Guard(source string) (string, error) {
+	expr, err := parseML(source)
+	if err != nil {
+		return "", err
+	}
+	conditions := []*mlExpr{expr}
+	if expr.kind == mlList {
+		conditions = expr.args
+	}
+	var parts []string
+	for _, c := range conditions {
+		lua, err := t.lua(c, 0)
+		if err != nil {
+			return "", err
+		}
+		if len(conditions) > 1 && mlPrecedence(c) >= 0 && mlPrecedence(c) <= mlLevel("andalso") {
+			lua = "(" + lua + ")"
+		}
+		parts = append(parts, lua)
+	}
+	return strings.Join(parts, " and "), nil
+}
+
+// Expression translates a plain expression
+func (t *mlTranslator) Expression(source string) (string, error) {
+	expr, err := parseML(source)
+	if err != nil {
+		return "", err
+	}
+	return t.lua(expr, 0)
+}
+
+// Variables returns the declared variables an expression uses
+func (t *mlTranslator) Variables(source string) []string {
+	expr, err := parseML(source)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var names []string
+	var visit func(e *mlExpr)
+	visit = func(e *mlExpr) {
+		if e.kind == mlIdent && t.variables[e.text] && !seen[e.text] {
+			seen[e.text] = true
+			names = append(names, e.text)
+		}
+		for _, a := range e.args {
+			visit(a)
+		}
+	}
+	visit(expr)
+	return names
+}
+
+// mlLevel returns the precedence level of a binary operator
+func mlLevel(op string) int {
+	for level, ops := range mlBinaryLevels {
+		if containsString(ops, op) {
+			return level
+		}
+	}
+	return -1
+}
+
+// mlPrecedence returns the level of a binary expression, or -1 for other expressions
+func mlPrecedence(e *mlExpr) int {
+	if e.kind != mlBinary {
+		return -1
+	}
+	return mlLevel(e.text)
+}
+
+var mlOperators = map[string]string{
+	"orelse": "or", "andalso": "and", "=": "==", "<>": "~=", "<": "<", ">": ">", "<=": "<=", ">=": ">=",
+	"+": "+", "-": "-", "*": "*", "/": "/", "mod": "%", "^": "..",
+}
+
+// lua translates an expression; level is the precedence level of the enclosing operator
+func (t *mlTranslator) lua(e *mlExpr, level int) (string, error) {
+	switch e.kind {
+	case mlNumber:
+		return e.text, nil
+	case mlString:
+		return luaQuote(e.text), nil
+	case mlUnit:
+		return luaQuote(pnmlUnitToken), nil
+	case mlIdent:
+		return t.identifier(e.text)
+	case mlTuple, mlList:
+		var items []string
+		for _, a := range e.args {
+			item, err := t.lua(a, 0)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		if e.kind == mlTuple {
+			return "tuple(" + strings.Join(items, ", ") + ")", nil
+		}
+		return "{" + strings.Join(items, ", ") + "}", nil
+	case mlRecord:
+		var items []string
+		for i, a := range e.args {
+			item, err := t.lua(a, 0)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, e.fields[i]+" = "+item)
+		}
+		return "{" + strings.Join(items, ", ") + "}", nil
+	case mlField:
+		record, err := t.lua(e.args[0], len(mlBinaryLevels))
+		if err != nil {
+			return "", err
+		}
+		return record + "." + e.text, nil
+	case mlUnary:
+		operand, err := t.lua(e.args[0], len(mlBinaryLevels))
+		if err != nil {
+			return "", err
+		}
+		if e.text == "~" {
+			// Parenthesized, so that negating a negation does not start a Lua comment
+			return "-(" + operand + ")", nil
+		}
+		return "not " + operand, nil
+	case mlApply:
+		return t.apply(e)
+	}
+
+	// Binary operators
+	switch e.text {
+	case "++", "`", "@+", "@":
+		return "", fmt.Errorf("multiset and time operators are only supported at the top of an inscription")
+	case "::", "^^":
+		return "", fmt.Errorf("list operator '%s' is not supported", e.text)
+	}
+	own := mlLevel(e.text)
+	left, err := t.lua(e.args[0], own)
+	if err != nil {
+		return "", err
+	}
+	right, err := t.lua(e.args[1], own+1)
+	if err != nil {
+		return "", err
+	}
+	if e.text == "div" {
+		return fmt.Sprintf("math.floor(%s / %s)", left, right), nil
+	}
+	lua := left + " " + mlOperators[e.text] + " " + right
+	if own < level {
+		lua = "(" + lua + ")"
+	}
+	return lua, nil
+}
+
+// identifier translates a variable, value or constant
+func (t *mlTranslator) identifier(name string) (string, error) {
+	switch {
+	case name == "true" || name == "false":
+		return name, nil
+	case t.variables[name] || t.values[name]:
+		return name, nil
+	case t.constants[name]:
+		return luaQuote(name), nil
+	}
+	return "", fmt.Errorf("unknown identifier '%s'", name)
+}
+
+// apply translates a function application
+func (t *mlTranslator) apply(e *mlExpr) (string, error) {
+	arg := e.args[0]
+	args := []*mlExpr{arg}
+	if arg.kind == mlTuple {
+		args = arg.args
+	} else if arg.kind == mlUnit {
+		args = nil
+	}
+	var lua []string
+	for _, a := range args {
+		s, err := t.lua(a, 0)
+		if err != nil {
+			return "", err
+		}
+		lua = append(lua, s)
+	}
+	one := func(format string) (string, error) {
+		if len(lua) != 1 {
+			return "", fmt.Errorf("%s expects one argument", e.text)
+		}
+		return fmt.Sprintf(format, lua[0]), nil
+	}
+	// operand is one for Lua operators applied to the argument, which is parenthesized unless it
+	// is a name
+	operand := func(format string) (string, error) {
+		if len(lua) == 1 && !isLuaName(lua[0]) {
+			lua[0] = "(" + lua[0] + ")"
+		}
+		return one(format)
+	}
+
+	if t.constructors[e.text] {
+		if len(lua) == 0 {
+			return "", fmt.Errorf("constructor %s expects a value", e.text)
+		}
+		value := strings.Join(lua, ", ")
+		if len(lua) > 1 {
+			value = "tuple(" + value + ")"
+		}
+		return fmt.Sprintf("{%s = %s}", e.text, value), nil
+	}
+	if dot := strings.LastIndex(e.text, "."); dot > 0 {
+		if _, ok := t.colorSets[e.text[:dot]]; ok {
+			name := luaQuote(e.text[:dot])
+			switch e.text[dot+1:] {
+			case "all":
+				return "cs.all(" + name + ")", nil
+			case "size":
+				return "cs.size(" + name + ")", nil
+			case "mem", "legal":
+				return one("cs.member(" + name + ", %s)")
+			case "ord":
+				return one("cs.ord(" + name + ", %s)")
+			case "col":
+				return one("cs.col(" + name + ", %s)")
+			case "succ":
+				return one("cs.succ(" + name + ", %s)")
+			case "pred":
+				return one("cs.pred(" + name + ", %s)")
+			}
+		}
+	}
+	switch e.text {
+	case "Int.toString", "Real.toString", "Bool.toString", "IntInf.toString":
+		return one("tostring(%s)")
+	case "length", "List.length", "size", "String.size":
+		return operand("#%s")
+	case "hd", "List.hd":
+		return operand("%s[1]")
+	case "abs", "Int.abs", "Real.abs":
+		return one("math.abs(%s)")
+	case "Int.max", "Int.min", "Real.max", "Real.min":
+		if len(lua) != 2 {
+			return "", fmt.Errorf("%s expects two arguments", e.text)
+		}
+		return fmt.Sprintf("math.%s(%s, %s)", e.text[strings.Index(e.text, ".")+1:], lua[0], lua[1]), nil
+	}
+	return "", fmt.Errorf("function '%s' is not supported", e.text)
+}
+
+// isLuaName reports whether s is a Lua name, possibly with fields (e.g. r.items)
+func isLuaName(s string) bool {
+	for i, r := range s {
+		if r != '_' && r != '.' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != "" && s[0] != '.'
+}
+
+// luaQuote writes a Lua string literal
+func luaQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// MarkingTokens evaluates an initial marking expression (n`v ++ ..., with optional @t timestamps)
+func (t *mlTranslator) MarkingTokens(source string) ([]TokenJSON, error) {
+	expr, err := parseML(source)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []TokenJSON
+	var collect func(e *mlExpr) error
+	collect = func(e *mlExpr) error {
+		if e.kind == mlBinary && e.text == "++" {
+			if err := collect(e.args[0]); err != nil {
+				return err
+			}
+			return collect(e.args[1])
+		}
+		if e.kind == mlIdent && e.text == "empty" {
+			return nil
+		}
+		timestamp := 0
+		if e.kind == mlBinary && e.text == "@" {
+			value, err := t.value(e.args[1])
+			ts, ok := value.(int)
+			if err != nil || !ok {
+				return fmt.Errorf("timestamps must be integer constants")
+			}
+			timestamp, e = ts, e.args[0]
+		}
+		count := 1
+		if e.kind == mlBinary && e.text == "`" {
+			n, err := strconv.Atoi(e.args[0].text)
+			if e.args[0].kind != mlNumber || err != nil {
+				return fmt.Errorf("multiset coefficients must be integer constants")
+			}
+			count, e = n, e.args[1]
+		}
+		if count == 0 {
+			return nil
+		}
+		if e.kind == mlApply && strings.HasSuffix(e.text, ".all") {
+			cs, ok := t.colorSets[strings.TrimSuffix(e.text, ".all")]
+			if !ok {
+				return fmt.Errorf("unknown color set in %s", e.text)
+			}
+			values, err := enumerateColorSet(cs)
+			if err != nil {
+				return err
+			}
+			for _, v := range values {
+				tokens = append(tokens, TokenJSON{Value: v, Timestamp: timestamp, Count: count})
+			}
+			return nil
+		}
+		value, err := t.value(e)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, TokenJSON{Value: value, Timestamp: timestamp, Count: count})
+		return nil
+	}
+	if err := collect(expr); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// value evaluates a constant expression to a token value
+func (t *mlTranslator) value(e *mlExpr) (interface{}, error) {
+	switch e.kind {
+	case mlNumber:
+		if i, err := strconv.Atoi(e.text); err == nil {
+			return i, nil
+		}
+		return strconv.ParseFloat(e.text, 64)
+	case mlString:
+		return e.text, nil
+	case mlUnit:
+		return pnmlUnitToken, nil
+	case mlIdent:
+		switch {
+		case e.text == "true" || e.text == "false":
+			return e.text == "true", nil
+		case t.constants[e.text]:
+			return e.text, nil
+		}
+		return nil, fmt.Errorf("'%s' is not a constant", e.text)
+	case mlUnary:
+		if e.text == "~" {
+			v, err := t.value(e.args[0])
+			switch n := v.(type) {
+			case int:
+				return -n, err
+			case float64:
+				return -n, err
+			}
+		}
+	case mlTuple, mlList:
+		items := []interface{}{}
+		for _, a := range e.args {
+			item, err := t.value(a)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case mlRecord:
+		record := make(map[string]interface{})
+		for i, a := range e.args {
+			item, err := t.value(a)
+			if err != nil {
+				return nil, err
+			}
+			record[e.fields[i]] = item
+		}
+		return record, nil
+	case mlApply:
+		if t.constructors[e.text] {
+			item, err := t.value(e.args[0])
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{e.text: item}, nil
+		}
+	}
+	return nil, fmt.Errorf("initial marking values must be constants")
+}
@@ -0,0 +1,633 @@
+package models
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CPN Tools (.cpn) import.
+//
+// Color set declarations of the globbox map to color set definitions, variables to inscription
+// variables and val/globref declarations to Lua declarations. Every prime page becomes the main net
+// (several prime pages are merged); every page used by a substitution transition becomes a child
+// net linked by a SubWorkflowLink on the substitution transition. Inscriptions, guards, time
+// inscriptions and code segments are translated from CPN ML to Lua (see cpnml.go); whatever cannot
+// be translated is replaced by a placeholder that raises an error and flagged for manual review.
+
+// cpnToolsImporter holds the state of a CPN Tools import
+type cpnToolsImporter struct {
+	report    *ConversionReport
+	colorSets *ColorSetParser
+	ml        *mlTranslator
+
+	colorSetDefs []string
+	declarations []string
+	pages        map[string]*pnmlNode // page ID -> page
+	pageOrder    []string
+	netIDs       map[string]string // subpage ID -> child net ID
+	placeSets    map[string]string // place ID -> color set name
+}
+
+var (
+	mlValDeclaration = regexp.MustCompile(`(?s)^val\s+([A-Za-z_][\w']*)\s*=\s*(.+?)\s*;?\s*$`)
+	mlCodeSegment    = regexp.MustCompile(`(?s)^(?:input\s*\(([^)]*)\)\s*;)?\s*(?:output\s*\(([^)]*)\)\s*;)?\s*action\s+(.+?)\s*;?\s*$`)
+	mlPortSocket     = regexp.MustCompile(`\(\s*([^,()\s]+)\s*,\s*([^,()\s]+)\s*\)`)
+	mlTimeDelay      = regexp.MustCompile(`^@\+\s*(\d+)$`)
+)
+
+// mlPriorities are the standard priorities of CPN Tools
+var mlPriorities = map[string]int{"P_HIGH": PriorityHigh, "P_NORMAL": PriorityNormal, "P_LOW": PriorityLow}
+
+// ParseCPNTools converts a CPN Tools model to CPN definitions. The first definition is the main
+// net (with the given ID, or one derived from the name of its page); the others are the nets of
+// the pages used by substitution transitions. Constructs that could not be converted exactly are
+// listed in the report, those that need a manual check are flagged for review.
+func (p *CPNParser) ParseCPNTools(data []byte, id string) ([]*CPNDefinitionJSON, *ConversionReport, error) {
+	var doc pnmlNode
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = latin1Reader
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CPN Tools model: %v", err)
+	}
+	net := &doc
+	if doc.XMLName.Local == "workspaceElements" {
+		net = doc.child("cpnet")
+	}
+	if net == nil || net.XMLName.Local != "cpnet" {
+		return nil, nil, fmt.Errorf("root element is <%s>, expected <workspaceElements> with a <cpnet>", doc.XMLName.Local)
+	}
+
+	imp := &cpnToolsImporter{
+		report:    NewConversionReport("cpntools"),
+		colorSets: NewColorSetParser(),
+		ml:        newMLTranslator(),
+		pages:     make(map[string]*pnmlNode),
+		netIDs:    make(map[string]string),
+		placeSets: make(map[string]string),
+	}
+	for _, cs := range imp.colorSets.GetAllColorSets() {
+		imp.ml.registerColorSet(cs)
+	}
+	imp.importBlock(net.child("globbox"))
+	imp.collectPages(net)
+	if len(imp.pageOrder) == 0 {
+		return nil, imp.report, fmt.Errorf("model contains no page")
+	}
+	for _, n := range net.Children {
+		switch n.XMLName.Local {
+		case "globbox", "page", "instances", "options", "binders", "monitorblock", "IndexNode", "fusion":
+		default:
+			imp.report.Add("", "unsupported element <%s> ignored", n.XMLName.Local)
+		}
+	}
+	for _, fusion := range net.children("fusion") {
+		imp.report.Review(fusion.attr("id"), "fusion set '%s' is not supported; its places were imported as separate places", fusion.attr("name"))
+	}
+
+	// Pages used by substitution transitions become child nets, all others form the main net
+	var primes []string
+	subpages := make(map[string]bool)
+	for _, pageID := range imp.pageOrder {
+		for _, trans := range imp.pages[pageID].children("trans") {
+			if subst := trans.child("subst"); subst != nil {
+				subpages[subst.attr("subpage")] = true
+			}
+		}
+	}
+	for _, pageID := range imp.pageOrder {
+		if !subpages[pageID] {
+			primes = append(primes, pageID)
+		}
+	}
+	if len(primes) == 0 {
+		return nil, imp.report, fmt.Errorf("model has no prime page (every page is a subpage)")
+	}
+	if id == "" {
+		id = pnmlIdentifier(imp.pageName(primes[0]))
+	}
+	for _, pageID := range imp.pageOrder {
+		if subpages[pageID] {
+			imp.netIDs[pageID] = id + "_" + pnmlIdentifier(imp.pageName(pageID))
+		}
+	}
+	if len(primes) > 1 {
+		imp.report.Add(id, "%d prime pages were merged into a single net", len(primes))
+	}
+
+	main := imp.newDefinition(id, imp.pageName(primes[0]))
+	for _, pageID := range primes {
+		if err := imp.importPage(imp.pages[pageID], main); err != nil {
+			return nil, imp.report, err
+		}
+	}
+	defs := []*CPNDefinitionJSON{main}
+	for _, pageID := range imp.pageOrder {
+		if !subpages[pageID] {
+			continue
+		}
+		def := imp.newDefinition(imp.netIDs[pageID], imp.pageName(pageID))
+		if err := imp.importPage(imp.pages[pageID], def); err != nil {
+			return nil, imp.report, err
+		}
+		for _, place := range imp.pages[pageID].children("place") {
+			if place.child("port").attr("type") == "Out" {
+				def.EndPlaces = append(def.EndPlaces, place.attr("id"))
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, imp.report, nil
+}
+
+// latin1Reader decodes the ISO-8859-1 encoding CPN Tools saves models in
+func latin1Reader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "us-ascii":
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", charset)
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+func (imp *cpnToolsImporter) newDefinition(id, name string) *CPNDefinitionJSON {
+	return &CPNDefinitionJSON{
+		ID:             id,
+		Name:           name,
+		Description:    "Imported from CPN Tools",
+		ColorSets:      imp.colorSetDefs,
+		Declarations:   strings.Join(imp.declarations, "\n"),
+		InitialMarking: make(map[string][]TokenJSON),
+	}
+}
+
+// collectPages gathers the pages of the model, including pages nested in pages
+func (imp *cpnToolsImporter) collectPages(container *pnmlNode) {
+	for _, page := range container.children("page") {
+		imp.pages[page.attr("id")] = page
+		imp.pageOrder = append(imp.pageOrder, page.attr("id"))
+		imp.collectPages(page)
+	}
+}
+
+func (imp *cpnToolsImporter) pageName(pageID string) string {
+	if name := imp.pages[pageID].child("pageattr").attr("name"); name != "" {
+		return name
+	}
+	return pageID
+}
+
+// mlText returns the CPN ML text of an element, without its layout
+func mlText(n *pnmlNode) string {
+	if n == nil {
+		return ""
+	}
+	return strings.TrimSpace(n.Text)
+}
+
+// importBlock converts the declarations of a globbox block and its nested blocks
+func (imp *cpnToolsImporter) importBlock(block *pnmlNode) {
+	if block == nil {
+		return
+	}
+	for _, n := range block.Children {
+		id := n.attr("id")
+		switch n.XMLName.Local {
+		case "id", "layout":
+		case "block":
+			imp.importBlock(n)
+		case "color":
+			imp.importColor(n)
+		case "var":
+			for _, name := range n.children("id") {
+				imp.ml.variables[mlText(name)] = true
+			}
+		case "ml":
+			text := mlText(n)
+			m := mlValDeclaration.FindStringSubmatch(text)
+			if m == nil {
+				imp.report.Review(id, "declaration '%s' was not translated; translate it to Lua declarations manually", firstLine(text))
+				continue
+			}
+			imp.declareValue(id, m[1], m[2])
+		case "globref":
+			imp.declareValue(id, mlText(n.child("id")), mlText(n.child("ml")))
+		default:
+			imp.report.Review(id, "unsupported declaration <%s> ignored", n.XMLName.Local)
+		}
+	}
+}
+
+// declareValue translates a val or globref declaration to a Lua global
+func (imp *cpnToolsImporter) declareValue(element, name, source string) {
+	lua, err := imp.ml.Expression(source)
+	if err != nil {
+		imp.report.Review(element, "value %s = %s was not translated: %v", name, source, err)
+		return
+	}
+	imp.ml.values[name] = true
+	imp.declarations = append(imp.declarations, name+" = "+lua)
+}
+
+// importColor converts a color set declaration
+func (imp *cpnToolsImporter) importColor(n *pnmlNode) {
+	id := n.attr("id")
+	name := mlText(n.child("id"))
+	definition, err := imp.colorDefinition(n, name)
+	if err != nil {
+		layout := mlText(n.child("layout"))
+		if _, layoutErr := imp.colorSets.ParseColorSetDefinition(layout); layout == "" || layoutErr != nil {
+			imp.report.Review(id, "color set %s was not converted: %v", name, err)
+			return
+		}
+		definition = strings.TrimSuffix(layout, ";") + ";"
+	} else if _, err := imp.colorSets.ParseColorSetDefinition(definition); err != nil {
+		imp.report.Review(id, "color set %s was not converted: %v", name, err)
+		return
+	}
+	imp.colorSetDefs = append(imp.colorSetDefs, definition)
+	if cs, ok := imp.colorSets.GetColorSet(name); ok {
+		imp.ml.registerColorSet(cs)
+	}
+}
+
+// colorDefinition builds the color set definition of a CPN Tools color element
+func (imp *cpnToolsImporter) colorDefinition(n *pnmlNode, name string) (string, error) {
+	var typ *pnmlNode
+	timed := false
+	for _, c := range n.Children {
+		switch c.XMLName.Local {
+		case "id", "layout", "declare":
+		case "timed":
+			timed = true
+		default:
+			if typ == nil {
+				typ = c
+			}
+		}
+	}
+	if typ == nil {
+		return "", fmt.Errorf("no type")
+	}
+	ids := func(parent *pnmlNode) []string {
+		var names []string
+		for _, c := range parent.children("id") {
+			names = append(names, mlText(c))
+		}
+		return names
+	}
+
+	var definition string
+	switch typ.XMLName.Local {
+	case "unit", "bool", "string", "real":
+		definition = typ.XMLName.Local
+	case "int", "intinf", "time":
+		definition = "int"
+		if with := typ.child("with"); with != nil {
+			bounds := with.children("ml")
+			if len(bounds) != 2 {
+				return "", fmt.Errorf("invalid integer range")
+			}
+			definition = fmt.Sprintf("int[%s..%s]", mlText(bounds[0]), mlText(bounds[1]))
+		}
+		if typ.XMLName.Local != "int" {
+			imp.report.Add(n.attr("id"), "%s color set %s is represented by int", typ.XMLName.Local, name)
+		}
+	case "enum":
+		definition = "with " + strings.Join(ids(typ), " | ")
+	case "product":
+		definition = "product " + strings.Join(ids(typ), " * ")
+	case "record":
+		var fields []string
+		for _, f := range typ.children("recordfield") {
+			if parts := ids(f); len(parts) == 2 {
+				fields = append(fields, parts[0]+":"+parts[1])
+			}
+		}
+		definition = "record " + strings.Join(fields, " * ")
+	case "list":
+		parts := ids(typ)
+		if len(parts) != 1 {
+			return "", fmt.Errorf("invalid list color set")
+		}
+		definition = "list " + parts[0]
+		if with := typ.child("with"); with != nil {
+			if bounds := with.children("ml"); len(bounds) == 2 {
+				definition += fmt.Sprintf(" with %s..%s", mlText(bounds[0]), mlText(bounds[1]))
+			}
+		}
+	case "union":
+		var variants []string
+		for _, f := range typ.children("unionfield") {
+			variant := mlText(f.child("id"))
+			if t := f.child("type"); t != nil {
+				variant += ":" + mlText(t.child("id"))
+			}
+			variants = append(variants, variant)
+		}
+		definition = "union " + strings.Join(variants, " + ")
+	case "alias":
+		parts := ids(typ)
+		if len(parts) != 1 {
+			return "", fmt.Errorf("invalid alias")
+		}
+		definition = parts[0]
+	case "subset":
+		parts := ids(typ)
+		if len(parts) != 1 {
+			return "", fmt.Errorf("invalid subset")
+		}
+		imp.report.Review(n.attr("id"), "subset color set %s was imported as its base color set %s; add the restriction as a subset predicate", name, parts[0])
+		definition = parts[0]
+	default:
+		return "", fmt.Errorf("unsupported color set type <%s>", typ.XMLName.Local)
+	}
+	if timed {
+		definition += " timed"
+	}
+	return fmt.Sprintf("colset %s = %s;", name, definition), nil
+}
+
+// cpnPosition returns the position of a page object; CPN Tools' y axis points up
+func cpnPosition(n *pnmlNode) *Position {
+	pos := n.child("posattr")
+	x, errX := strconv.ParseFloat(pos.attr("x"), 32)
+	y, errY := strconv.ParseFloat(pos.attr("y"), 32)
+	if errX != nil || errY != nil {
+		return nil
+	}
+	return &Position{X: float32(x), Y: float32(-y)}
+}
+
+// objectName returns the name of a place or transition, on a single line
+func objectName(n *pnmlNode) string {
+	if name := strings.Join(strings.Fields(n.text()), " "); name != "" {
+		return name
+	}
+	return n.attr("id")
+}
+
+// firstLine shortens source text for report messages
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i] + " ..."
+	}
+	return text
+}
+
+// untranslated is the placeholder for CPN ML that could not be translated; it fails when evaluated
+func untranslated(source string) string {
+	return "error(" + luaQuote("untranslated CPN ML: "+strings.Join(strings.Fields(source), " ")) + ")"
+}
+
+// importPage adds the places, transitions and arcs of a page to a definition
+func (imp *cpnToolsImporter) importPage(page *pnmlNode, def *CPNDefinitionJSON) error {
+	for _, n := range page.children("place") {
+		if err := imp.importPlace(n, def); err != nil {
+			return err
+		}
+	}
+	inputs := make(map[string][]string) // transition ID -> input inscriptions
+	for _, n := range page.children("arc") {
+		imp.importArc(n, def, inputs)
+	}
+	for _, n := range page.children("trans") {
+		imp.importTransition(n, page, def, inputs[n.attr("id")])
+	}
+	for _, n := range page.Children {
+		switch n.XMLName.Local {
+		case "pageattr", "place", "trans", "arc", "page", "constraints":
+		case "Aux":
+			imp.report.Add(n.attr("id"), "auxiliary graphics ignored")
+		default:
+			imp.report.Add(page.attr("id"), "unsupported page element <%s> ignored", n.XMLName.Local)
+		}
+	}
+	return nil
+}
+
+func (imp *cpnToolsImporter) importPlace(n *pnmlNode, def *CPNDefinitionJSON) error {
+	id := n.attr("id")
+	place := PlaceJSON{ID: id, Name: objectName(n), Position: cpnPosition(n)}
+	place.ColorSet = n.child("type").text()
+	if place.ColorSet == "" {
+		return fmt.Errorf("place %s has no color set", place.Name)
+	}
+	if _, ok := imp.colorSets.GetColorSet(place.ColorSet); !ok {
+		return fmt.Errorf("place %s: unknown color set '%s'", place.Name, place.ColorSet)
+	}
+	imp.placeSets[id] = place.ColorSet
+	def.Places = append(def.Places, place)
+
+	if text := n.child("initmark").text(); text != "" {
+		tokens, err := imp.ml.MarkingTokens(text)
+		if err != nil {
+			imp.report.Review(id, "initial marking '%s' was not translated: %v", firstLine(text), err)
+		} else if len(tokens) > 0 {
+			def.InitialMarking[id] = tokens
+		}
+	}
+	if fusion := n.child("fusioninfo"); fusion != nil {
+		imp.report.Review(id, "place %s belongs to fusion set '%s', which is not supported", place.Name, fusion.attr("name"))
+	}
+	return nil
+}
+
+func (imp *cpnToolsImporter) importArc(n *pnmlNode, def *CPNDefinitionJSON, inputs map[string][]string) {
+	id := n.attr("id")
+	transitionID := n.child("transend").attr("idref")
+	placeID := n.child("placeend").attr("idref")
+	text := n.child("annot").text()
+
+	expression, empty, err := imp.ml.Inscription(text)
+	switch {
+	case text == "":
+		expression = strconv.Quote(pnmlUnitToken)
+		if cs, _ := imp.colorSets.GetColorSet(imp.placeSets[placeID]); cs == nil || !isUnitColorSet(cs) {
+			imp.report.Review(id, "arc has no inscription; () was used")
+		}
+	case empty:
+		imp.report.Add(id, "arc inscribed with the empty multiset omitted")
+		return
+	case err != nil:
+		imp.report.Review(id, "inscription '%s' was not translated: %v", firstLine(text), err)
+		expression = untranslated(text)
+	}
+	if len(n.children("bendpoint")) > 0 {
+		imp.report.Add(id, "arc bend points ignored")
+	}
+
+	in := ArcJSON{ID: id, SourceID: placeID, TargetID: transitionID, Expression: expression, Direction: "IN"}
+	out := ArcJSON{ID: id, SourceID: transitionID, TargetID: placeID, Expression: expression, Direction: "OUT"}
+	switch n.attr("orientation") {
+	case "PtoT":
+		def.Arcs = append(def.Arcs, in)
+		inputs[transitionID] = append(inputs[transitionID], text)
+	case "TtoP":
+		def.Arcs = append(def.Arcs, out)
+	case "BOTHDIR":
+		out.ID = id + "_out"
+		def.Arcs = append(def.Arcs, in, out)
+		inputs[transitionID] = append(inputs[transitionID], text)
+	default:
+		imp.report.Review(id, "arc orientation '%s' is not supported; arc ignored", n.attr("orientation"))
+	}
+}
+
+func isUnitColorSet(cs ColorSet) bool {
+	_, ok := cs.(*UnitColorSet)
+	return ok
+}
+
+func (imp *cpnToolsImporter) importTransition(n, page *pnmlNode, def *CPNDefinitionJSON, inputs []string) {
+	id := n.attr("id")
+	transition := TransitionJSON{ID: id, Name: objectName(n), Position: cpnPosition(n), Kind: "Auto"}
+
+	if text := n.child("cond").text(); text != "" {
+		guard, err := imp.ml.Guard(text)
+		if err != nil {
+			imp.report.Review(id, "guard '%s' was not translated: %v", firstLine(text), err)
+			guard = untranslated(text)
+		}
+		transition.GuardExpression = guard
+		seen := make(map[string]bool)
+		for _, source := range append([]string{text}, inputs...) {
+			for _, name := range imp.ml.Variables(source) {
+				if !seen[name] {
+					seen[name] = true
+					transition.Variables = append(transition.Variables, name)
+				}
+			}
+		}
+	}
+	if text := n.child("time").text(); text != "" {
+		if m := mlTimeDelay.FindStringSubmatch(strings.Join(strings.Fields(text), "")); m != nil {
+			transition.TransitionDelay, _ = strconv.Atoi(m[1])
+		} else {
+			imp.report.Review(id, "time inscription '%s' was not translated; only constant delays @+n are supported", text)
+		}
+	}
+	if text := n.child("code").text(); text != "" {
+		action, err := imp.codeSegment(text)
+		if err != nil {
+			imp.report.Review(id, "code segment was not translated: %v", err)
+		} else {
+			transition.ActionExpression = action
+		}
+	}
+	if text := n.child("priority").text(); text != "" {
+		if priority, ok := mlPriorities[text]; ok {
+			transition.Priority = &priority
+		} else if priority, err := strconv.Atoi(text); err == nil {
+			transition.Priority = &priority
+		} else {
+			imp.report.Review(id, "priority '%s' was not translated", text)
+		}
+	}
+	def.Transitions = append(def.Transitions, transition)
+
+	if subst := n.child("subst"); subst != nil {
+		imp.substitution(n, subst, page, def)
+	}
+}
+
+// codeSegment translates "input (...); output (...); action e" to a Lua action assigning the
+// output variables
+func (imp *cpnToolsImporter) codeSegment(text string) (string, error) {
+	m := mlCodeSegment.FindStringSubmatch(text)
+	if m == nil {
+		return "", fmt.Errorf("unsupported code segment '%s'", firstLine(text))
+	}
+	var outputs []string
+	for _, name := range strings.Split(m[2], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			outputs = append(outputs, name)
+		}
+	}
+	if len(outputs) == 0 {
+		return "", fmt.Errorf("code segments without output variables have no effect in Lua")
+	}
+	expr, err := parseML(m[3])
+	if err != nil {
+		return "", err
+	}
+	values := []*mlExpr{expr}
+	if len(outputs) > 1 {
+		if expr.kind != mlTuple || len(expr.args) != len(outputs) {
+			return "", fmt.Errorf("the action must return a tuple of %d values", len(outputs))
+		}
+		values = expr.args
+	}
+	var lua []string
+	for _, v := range values {
+		s, err := imp.ml.lua(v, 0)
+		if err != nil {
+			return "", err
+		}
+		lua = append(lua, s)
+	}
+	return strings.Join(outputs, ", ") + " = " + strings.Join(lua, ", "), nil
+}
+
+// substitution links a substitution transition to the net of its subpage. Values of socket arcs
+// inscribed with a variable are mapped to the variable of the matching port arc.
+func (imp *cpnToolsImporter) substitution(trans, subst, parent *pnmlNode, def *CPNDefinitionJSON) {
+	id := trans.attr("id")
+	subpage := imp.pages[subst.attr("subpage")]
+	if subpage == nil {
+		imp.report.Review(id, "subpage %s of substitution transition not found", subst.attr("subpage"))
+		return
+	}
+	link := SubWorkflowJSON{
+		ID:                  "sub_" + id,
+		CPNID:               imp.netIDs[subpage.attr("id")],
+		CallTransitionID:    id,
+		AutoStart:           true,
+		PropagateOnComplete: true,
+		InputMapping:        make(map[string]string),
+		OutputMapping:       make(map[string]string),
+	}
+
+	// variables inscribed on the arcs of a page between a place and a transition (any if empty)
+	variables := func(page *pnmlNode, placeID, transitionID, orientation string) []string {
+		var names []string
+		for _, arc := range page.children("arc") {
+			if arc.child("placeend").attr("idref") != placeID ||
+				(transitionID != "" && arc.child("transend").attr("idref") != transitionID) ||
+				(arc.attr("orientation") != orientation && arc.attr("orientation") != "BOTHDIR") {
+				continue
+			}
+			if name := arc.child("annot").text(); imp.ml.variables[name] {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	for _, pair := range mlPortSocket.FindAllStringSubmatch(subst.attr("portsock"), -1) {
+		port, socket := pair[1], pair[2]
+		for _, parentVar := range variables(parent, socket, id, "PtoT") {
+			for _, childVar := range variables(subpage, port, "", "PtoT") {
+				link.InputMapping[parentVar] = childVar
+			}
+		}
+		for _, parentVar := range variables(parent, socket, id, "TtoP") {
+			for _, childVar := range variables(subpage, port, "", "TtoP") {
+				link.OutputMapping[childVar] = parentVar
+			}
+		}
+	}
+	def.SubWorkflows = append(def.SubWorkflows, link)
+	imp.report.Review(id, "substitution transition linked to sub workflow %s; check the variable mappings, port places are not filled from socket places", link.CPNID)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CPNVersion describes an immutable deployment of a CPN definition. Every load of a CPN deploys a
+// new version; new cases use the latest version unless another one is requested and stay pinned
+// to the version they were created on.
+type CPNVersion struct {
+	CPNID       string     `json:"cpnId"`
+	Version     int        `json:"version"`
+	Hash        string     `json:"hash"` // SHA-256 of the JSON definition (see DefinitionHash)
+	DeployedAt  time.Time  `json:"deployedAt"`
+	RetiredAt   *time.Time `json:"retiredAt,omitempty"`
+	Latest      bool       `json:"latest"`
+	ActiveCases int        `json:"activeCases"` // cases pinned to the version that have not terminated
+}
+
+// IsRetired returns true if the version was retired and can no longer run cases
+func (v *CPNVersion) IsRetired() bool {
+	return v.RetiredAt != nil
+}
+
+// DefinitionHash returns the hex encoded SHA-256 of the JSON encoding of a CPN definition, so
+// equal definitions get equal hashes whatever the formatting of their source
+func DefinitionHash(definition *CPNDefinitionJSON) (string, error) {
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode definition: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
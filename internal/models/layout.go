@@ -0,0 +1,340 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	layoutLayerSpacing = 120 // horizontal distance between layers
+	layoutNodeSpacing  = 100 // vertical distance between nodes of a layer
+	layoutMargin       = 80
+	layoutSweeps       = 24 // barycenter sweeps of the crossing reduction
+)
+
+// layoutGraph is the layered graph of a Sugiyama layout. Arcs spanning several layers are split by
+// dummy nodes, which take a slot in their layer but get no position.
+type layoutGraph struct {
+	layer   map[string]int
+	succ    map[string][]string
+	pred    map[string][]string
+	dummies int
+}
+
+// AutoLayout computes a layered (Sugiyama-style) layout of a CPN's places and transitions, flowing
+// from left to right: from the places of the initial marking (or the nodes without inputs) to the
+// end places, which form the last layer. Cycles are broken by reversing their back arcs, each node
+// sits one layer after its furthest predecessor and the order within the layers is chosen by
+// barycenter sweeps to reduce crossing arcs.
+func AutoLayout(cpn *CPN) map[string]Position {
+	nodes, successors, hasInput := netGraph(cpn)
+	if len(nodes) == 0 {
+		return map[string]Position{}
+	}
+	var starts []string
+	for _, id := range nodes {
+		if len(cpn.InitialMarking[id]) > 0 {
+			starts = append(starts, id)
+		}
+	}
+	for _, id := range nodes {
+		if len(cpn.InitialMarking[id]) == 0 && !hasInput[id] {
+			starts = append(starts, id)
+		}
+	}
+
+	// 1. Remove cycles: a depth-first search from the start nodes reverses the arcs closing a cycle
+	dag, discovery := acyclicArcs(nodes, successors, append(starts, nodes...))
+
+	// 2. Assign layers by longest path
+	g := &layoutGraph{layer: make(map[string]int), succ: make(map[string][]string), pred: make(map[string][]string)}
+	last := 0
+	for _, id := range topologicalOrder(discovery, dag) {
+		for _, next := range dag[id] {
+			if g.layer[id]+1 > g.layer[next] {
+				g.layer[next] = g.layer[id] + 1
+			}
+		}
+		if g.layer[id] > last {
+			last = g.layer[id]
+		}
+	}
+	for _, idOrName := range cpn.EndPlaces {
+		place := cpn.GetPlace(idOrName)
+		if place == nil {
+			place = cpn.GetPlaceByName(idOrName)
+		}
+		if place != nil && len(dag[place.ID]) == 0 {
+			g.layer[place.ID] = last
+		}
+	}
+
+	// 3. Split long arcs by dummy nodes
+	for _, from := range discovery {
+		for _, to := range dag[from] {
+			g.connect(from, to)
+		}
+	}
+
+	// 4. Order the layers
+	layers := make([][]string, last+1)
+	for _, id := range discovery {
+		layers[g.layer[id]] = append(layers[g.layer[id]], id)
+	}
+	for i := 0; i < g.dummies; i++ {
+		id := dummyID(i)
+		layers[g.layer[id]] = append(layers[g.layer[id]], id)
+	}
+	layers = g.reduceCrossings(layers)
+
+	// 5. Assign coordinates: layers are centered on the tallest one
+	tallest := 0
+	for _, layer := range layers {
+		if len(layer) > tallest {
+			tallest = len(layer)
+		}
+	}
+	positions := make(map[string]Position, len(nodes))
+	for l, layer := range layers {
+		offset := float32(tallest-len(layer)) * layoutNodeSpacing / 2
+		for i, id := range layer {
+			if g.isDummy(id) {
+				continue
+			}
+			positions[id] = Position{
+				X: float32(layoutMargin + l*layoutLayerSpacing),
+				Y: float32(layoutMargin+i*layoutNodeSpacing) + offset,
+			}
+		}
+	}
+	return positions
+}
+
+// ApplyLayout sets the positions of AutoLayout on a CPN's places and transitions. A CPN whose nodes
+// all have a position is left unchanged unless force is set. Reports whether positions were set.
+func ApplyLayout(cpn *CPN, force bool) bool {
+	if !force && hasAllPositions(cpn) {
+		return false
+	}
+	positions := AutoLayout(cpn)
+	for _, place := range cpn.Places {
+		pos := positions[place.ID]
+		place.Position = &pos
+	}
+	for _, transition := range cpn.Transitions {
+		pos := positions[transition.ID]
+		transition.Position = &pos
+	}
+	return true
+}
+
+// hasAllPositions reports whether every place and transition of a CPN has a position
+func hasAllPositions(cpn *CPN) bool {
+	for _, place := range cpn.Places {
+		if place.Position == nil {
+			return false
+		}
+	}
+	for _, transition := range cpn.Transitions {
+		if transition.Position == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// netGraph returns the node IDs of a CPN in declaration order (places first), the successors of
+// each node and which nodes have incoming arcs
+func netGraph(cpn *CPN) ([]string, map[string][]string, map[string]bool) {
+	nodes := make([]string, 0, len(cpn.Places)+len(cpn.Transitions))
+	for _, place := range cpn.Places {
+		nodes = append(nodes, place.ID)
+	}
+	for _, transition := range cpn.Transitions {
+		nodes = append(nodes, transition.ID)
+	}
+	successors := make(map[string][]string)
+	hasInput := make(map[string]bool)
+	for _, arc := range cpn.Arcs {
+		successors[arc.SourceID] = append(successors[arc.SourceID], arc.TargetID)
+		hasInput[arc.TargetID] = true
+	}
+	return nodes, successors, hasInput
+}
+
+// acyclicArcs returns the arcs of a graph without the arcs closing a cycle, which are reversed,
+// and the nodes in the order a depth-first search from roots discovers them
+func acyclicArcs(nodes []string, successors map[string][]string, roots []string) (map[string][]string, []string) {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[string]int, len(nodes))
+	dag := make(map[string][]string)
+	seen := make(map[[2]string]bool)
+	add := func(from, to string) {
+		if from != to && !seen[[2]string{from, to}] {
+			seen[[2]string{from, to}] = true
+			dag[from] = append(dag[from], to)
+		}
+	}
+	var discovery []string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = active
+		discovery = append(discovery, id)
+		for _, next := range successors[id] {
+			switch state[next] {
+			case unvisited:
+				add(id, next)
+				visit(next)
+			case active:
+				add(next, id) // back arc
+			default:
+				add(id, next)
+			}
+		}
+		state[id] = done
+	}
+	for _, id := range roots {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return dag, discovery
+}
+
+// topologicalOrder returns the nodes of a directed acyclic graph in topological order, ties broken
+// by the given order
+func topologicalOrder(nodes []string, dag map[string][]string) []string {
+	indegree := make(map[string]int)
+	for _, id := range nodes {
+		for _, next := range dag[id] {
+			indegree[next]++
+		}
+	}
+	var order, queue []string
+	for _, id := range nodes {
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		order = append(order, id)
+		for _, next := range dag[id] {
+			if indegree[next]--; indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+	return order
+}
+
+// connect adds an arc to the layered graph, through a dummy node in each layer it crosses
+func (g *layoutGraph) connect(from, to string) {
+	for g.layer[to]-g.layer[from] > 1 {
+		dummy := dummyID(g.dummies)
+		g.dummies++
+		g.layer[dummy] = g.layer[from] + 1
+		g.succ[from] = append(g.succ[from], dummy)
+		g.pred[dummy] = append(g.pred[dummy], from)
+		from = dummy
+	}
+	g.succ[from] = append(g.succ[from], to)
+	g.pred[to] = append(g.pred[to], from)
+}
+
+// dummyID returns the ID of the i-th dummy node; it cannot clash with a node ID
+func dummyID(i int) string {
+	return fmt.Sprintf("\x00dummy%d", i)
+}
+
+func (g *layoutGraph) isDummy(id string) bool {
+	return len(id) > 0 && id[0] == 0
+}
+
+// reduceCrossings reorders the layers by alternating downward and upward barycenter sweeps and
+// returns the ordering with the fewest crossings
+func (g *layoutGraph) reduceCrossings(layers [][]string) [][]string {
+	best := cloneLayers(layers)
+	fewest := g.crossings(layers)
+	for sweep := 0; sweep < layoutSweeps && fewest > 0; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				orderByBarycenter(layers[l], layers[l-1], g.pred)
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				orderByBarycenter(layers[l], layers[l+1], g.succ)
+			}
+		}
+		if c := g.crossings(layers); c < fewest {
+			fewest = c
+			best = cloneLayers(layers)
+		}
+	}
+	return best
+}
+
+// orderByBarycenter sorts a layer by the average index of each node's neighbors in the fixed
+// adjacent layer; nodes without neighbors there keep their index
+func orderByBarycenter(layer, fixed []string, neighbors map[string][]string) {
+	index := make(map[string]int, len(fixed))
+	for i, id := range fixed {
+		index[id] = i
+	}
+	barycenter := make(map[string]float64, len(layer))
+	for i, id := range layer {
+		sum, count := 0, 0
+		for _, n := range neighbors[id] {
+			if j, ok := index[n]; ok {
+				sum += j
+				count++
+			}
+		}
+		if count == 0 {
+			barycenter[id] = float64(i)
+		} else {
+			barycenter[id] = float64(sum) / float64(count)
+		}
+	}
+	sort.SliceStable(layer, func(a, b int) bool { return barycenter[layer[a]] < barycenter[layer[b]] })
+}
+
+// crossings counts the pairs of crossing arcs between adjacent layers
+func (g *layoutGraph) crossings(layers [][]string) int {
+	count := 0
+	for l := 0; l+1 < len(layers); l++ {
+		index := make(map[string]int, len(layers[l+1]))
+		for i, id := range layers[l+1] {
+			index[id] = i
+		}
+		var arcs [][2]int
+		for i, id := range layers[l] {
+			for _, next := range g.succ[id] {
+				if j, ok := index[next]; ok {
+					arcs = append(arcs, [2]int{i, j})
+				}
+			}
+		}
+		for a := range arcs {
+			for b := a + 1; b < len(arcs); b++ {
+				if (arcs[a][0]-arcs[b][0])*(arcs[a][1]-arcs[b][1]) < 0 {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func cloneLayers(layers [][]string) [][]string {
+	clone := make([][]string, len(layers))
+	for i, layer := range layers {
+		clone[i] = append([]string(nil), layer...)
+	}
+	return clone
+}
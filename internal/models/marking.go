@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"math/rand"
+	randv2 "math/rand/v2"
 	"sort"
 	"strings"
 )
@@ -12,6 +14,15 @@ type Marking struct {
 	Places      map[string]Multiset `json:"places"` // Key: Place ID
 	GlobalClock int                 `json:"globalClock"`
 	StepCounter int                 `json:"currentStep"`
+	Seed        int64               `json:"seed,omitempty"` // Seed of the random source used by this simulation run
+	Monitors    *MonitorResults     `json:"-"`              // Results of the CPN's monitors for this run (nil until a monitor records)
+
+	rng    *rand.Rand // lazily created from Seed
+	source *pcgSource // source of rng, whose state clones copy
+
+	version     uint64            // incremented on every token change
+	versions    map[string]uint64 // place ID -> version of its last token change
+	engineState interface{}       // state the engine derives from this marking (not cloned)
 }
 
 // NewMarking creates a new empty marking
@@ -32,12 +43,114 @@ func NewMarkingWithClock(globalClock int) *Marking {
 	}
 }
 
+// SetSeed (re)seeds the random source of this marking so that a run is reproducible
+func (m *Marking) SetSeed(seed int64) {
+	m.Seed = seed
+	m.setSource(newPCGSource(seed))
+}
+
+// Random returns the marking's seeded random source, creating it on first use
+func (m *Marking) Random() *rand.Rand {
+	if m.rng == nil {
+		m.setSource(newPCGSource(m.Seed))
+	}
+	return m.rng
+}
+
+// RandomState returns the state of the marking's random source, nil while it is unused
+// (see RestoreRandom)
+func (m *Marking) RandomState() []byte {
+	if m.source == nil {
+		return nil
+	}
+	state, _ := m.source.pcg.MarshalBinary()
+	return state
+}
+
+// RestoreRandom resets the marking's random source to a state returned by RandomState, undoing
+// the values drawn since
+func (m *Marking) RestoreRandom(state []byte) {
+	if state == nil {
+		m.rng, m.source = nil, nil
+		return
+	}
+	source := newPCGSource(m.Seed)
+	if err := source.pcg.UnmarshalBinary(state); err == nil {
+		m.setSource(source)
+	}
+}
+
+// setSource makes source the marking's random source
+func (m *Marking) setSource(source *pcgSource) {
+	m.source = source
+	m.rng = rand.New(source)
+}
+
+// pcgSource is a random source whose state can be copied, so clones continue the sequence
+// without replaying it
+type pcgSource struct {
+	pcg *randv2.PCG
+}
+
+// newPCGSource creates a source seeded with seed
+func newPCGSource(seed int64) *pcgSource {
+	return &pcgSource{pcg: randv2.NewPCG(uint64(seed), pcgStream)}
+}
+
+// pcgStream is the second PCG seed word of all marking sources
+const pcgStream = 0x9e3779b97f4a7c15
+
+func (s *pcgSource) Int63() int64 {
+	return int64(s.pcg.Uint64() >> 1)
+}
+
+func (s *pcgSource) Uint64() uint64 {
+	return s.pcg.Uint64()
+}
+
+func (s *pcgSource) Seed(seed int64) {
+	s.pcg.Seed(uint64(seed), pcgStream)
+}
+
+// clone returns a source in the same state
+func (s *pcgSource) clone() *pcgSource {
+	pcg := *s.pcg
+	return &pcgSource{pcg: &pcg}
+}
+
 // AddToken adds a token to the specified place
 func (m *Marking) AddToken(placeID string, token *Token) {
 	if m.Places[placeID] == nil {
 		m.Places[placeID] = NewMultiset()
 	}
 	m.Places[placeID].Add(token)
+	m.touch(placeID)
+}
+
+// touch records a change of the tokens in a place
+func (m *Marking) touch(placeID string) {
+	if m.versions == nil {
+		m.versions = make(map[string]uint64)
+	}
+	m.version++
+	m.versions[placeID] = m.version
+}
+
+// PlaceVersion returns a counter that changes whenever tokens are added to or removed from
+// the place through the marking's methods. It is 0 for places that never changed.
+func (m *Marking) PlaceVersion(placeID string) uint64 {
+	return m.versions[placeID]
+}
+
+// EngineState returns the state the engine attached to this marking with SetEngineState
+func (m *Marking) EngineState() interface{} {
+	return m.engineState
+}
+
+// SetEngineState attaches engine state derived from this marking (e.g. cached enablement).
+// The state is not copied by Clone.
+func (m *Marking) SetEngineState(state interface{}) {
+	m.engineState = state
 }
 
 // RemoveToken removes a token from the specified place
@@ -46,6 +159,9 @@ func (m *Marking) AddToken(placeID string, token *Token) {
 func (m *Marking) RemoveToken(placeID string, token *Token) bool {
 	if multiset, exists := m.Places[placeID]; exists {
 		removed := multiset.Remove(token)
+		if removed {
+			m.touch(placeID)
+		}
 		// If the place becomes empty, we can optionally remove it from the map
 		if multiset.IsEmpty() {
 			delete(m.Places, placeID)
@@ -61,6 +177,9 @@ func (m *Marking) RemoveToken(placeID string, token *Token) bool {
 func (m *Marking) RemoveTokenByValue(placeID string, value interface{}) *Token {
 	if multiset, exists := m.Places[placeID]; exists {
 		token := multiset.RemoveByValue(value)
+		if token != nil {
+			m.touch(placeID)
+		}
 		// If the place becomes empty, we can optionally remove it from the map
 		if multiset.IsEmpty() {
 			delete(m.Places, placeID)
@@ -70,6 +189,48 @@ func (m *Marking) RemoveTokenByValue(placeID string, value interface{}) *Token {
 	return nil
 }
 
+// RemoveAvailableTokenByValue removes the token with the given value and the earliest timestamp
+// not after time from the specified place. Returns the removed token if found, nil otherwise
+func (m *Marking) RemoveAvailableTokenByValue(placeID string, value interface{}, time int) *Token {
+	var earliest *Token
+	for _, token := range m.GetTokensWithValue(placeID, value) {
+		if token.Timestamp <= time && (earliest == nil || token.Timestamp < earliest.Timestamp) {
+			earliest = token
+		}
+	}
+	if earliest == nil {
+		return nil
+	}
+	multiset := m.Places[placeID]
+	key := earliest.ValueString()
+	for i, token := range multiset[key] {
+		if token == earliest {
+			multiset[key] = append(multiset[key][:i:i], multiset[key][i+1:]...)
+			if len(multiset[key]) == 0 {
+				delete(multiset, key)
+			}
+			break
+		}
+	}
+	if multiset.IsEmpty() {
+		delete(m.Places, placeID)
+	}
+	m.touch(placeID)
+	return earliest
+}
+
+// CountAvailableTokensWithValue returns the number of tokens with the given value and a timestamp
+// not after time in the specified place
+func (m *Marking) CountAvailableTokensWithValue(placeID string, value interface{}, time int) int {
+	count := 0
+	for _, token := range m.GetTokensWithValue(placeID, value) {
+		if token.Timestamp <= time {
+			count++
+		}
+	}
+	return count
+}
+
 // GetMultiset returns the multiset for the specified place
 // Returns an empty multiset if the place doesn't exist
 func (m *Marking) GetMultiset(placeID string) Multiset {
@@ -152,6 +313,7 @@ func (m *Marking) IsEmpty() bool {
 func (m *Marking) Clear() {
 	for name := range m.Places {
 		delete(m.Places, name)
+		m.touch(name)
 	}
 }
 
@@ -178,13 +340,29 @@ func (m *Marking) GetEarliestTimestamp() int {
 	return earliest
 }
 
+// GetNextTimestampAfter returns the earliest token timestamp strictly after the given time
+// Returns -1 if no such token exists
+func (m *Marking) GetNextTimestampAfter(time int) int {
+	next := -1
+	for _, multiset := range m.Places {
+		for _, tokens := range multiset {
+			for _, token := range tokens {
+				if token.Timestamp > time && (next == -1 || token.Timestamp < next) {
+					next = token.Timestamp
+				}
+			}
+		}
+	}
+	return next
+}
+
 // GetAvailableTokensAtTime returns all tokens that are available at the given time
-// (i.e., tokens with timestamp <= time)
+// (i.e., tokens with timestamp <= time), ordered by value key so binding order is stable
 func (m *Marking) GetAvailableTokensAtTime(placeName string, time int) []*Token {
 	var availableTokens []*Token
 	if multiset, exists := m.Places[placeName]; exists {
-		for _, tokens := range multiset {
-			for _, token := range tokens {
+		for _, key := range multiset.SortedKeys() {
+			for _, token := range multiset[key] {
 				if token.Timestamp <= time {
 					availableTokens = append(availableTokens, token)
 				}
@@ -199,11 +377,18 @@ func (m *Marking) Clone() *Marking {
 	clone := &Marking{
 		Places:      make(map[string]Multiset),
 		GlobalClock: m.GlobalClock,
+		StepCounter: m.StepCounter,
+		Seed:        m.Seed,
+		Monitors:    m.Monitors.Clone(),
 	}
 
 	for placeID, multiset := range m.Places {
 		clone.Places[placeID] = multiset.Clone()
 	}
+	// The clone continues the random sequence where the original is
+	if m.source != nil {
+		clone.setSource(m.source.clone())
+	}
 
 	return clone
 }
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// MigrationPlan describes how the marking of a case is carried over to another version of its CPN.
+// Places are given by ID or name. Tokens of places without a mapping move to the place with the
+// same ID in the target version; a mapping to "" discards them.
+type MigrationPlan struct {
+	TargetVersion int               `json:"targetVersion,omitempty"` // 0 = latest
+	PlaceMapping  map[string]string `json:"placeMapping,omitempty"`  // source place -> target place
+	// Transformers are Lua expressions per source place that compute the migrated token from the
+	// old token bound to x, like an output arc: they may return a multiset (several tokens, an empty
+	// multiset, {} or nil to drop the token) or delay(value, d)
+	Transformers map[string]string `json:"transformers,omitempty"`
+}
+
+// MigrationIssue describes why a case cannot be migrated
+type MigrationIssue struct {
+	PlaceID string `json:"placeId,omitempty"` // source place of the affected tokens
+	Message string `json:"message"`
+}
+
+// PlaceChange lists the tokens of a place before and after a migration
+type PlaceChange struct {
+	PlaceID string   `json:"placeId"`
+	Before  []*Token `json:"before"`
+	After   []*Token `json:"after"`
+}
+
+// MigrationResult reports the migration of a case; the diff holds the places whose tokens change
+type MigrationResult struct {
+	CaseID      string           `json:"caseId"`
+	FromVersion int              `json:"fromVersion"`
+	ToVersion   int              `json:"toVersion"`
+	DryRun      bool             `json:"dryRun"`
+	Applied     bool             `json:"applied"`
+	Diff        []PlaceChange    `json:"diff"`
+	Issues      []MigrationIssue `json:"issues"`
+	Marking     *Marking         `json:"-"` // migrated marking (nil for cases that have not started)
+	// Open work items refer to transitions and bindings of the old version: they are cancelled
+	// (for dry runs: listed) and work items are derived anew from the migrated marking
+	CancelledWorkItems []string `json:"cancelledWorkItems,omitempty"`
+	CreatedWorkItems   []string `json:"createdWorkItems,omitempty"`
+}
+
+// Valid reports whether the case can be migrated
+func (r *MigrationResult) Valid() bool {
+	return len(r.Issues) == 0
+}
+
+// Add records an issue for a source place
+func (r *MigrationResult) Add(placeID, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, MigrationIssue{PlaceID: placeID, Message: fmt.Sprintf(format, args...)})
+}
+
+// MarkingDiff returns the places whose tokens differ between two markings, sorted by place ID
+func MarkingDiff(before, after *Marking) []PlaceChange {
+	ids := make(map[string]bool)
+	for _, marking := range []*Marking{before, after} {
+		for placeID := range marking.Places {
+			ids[placeID] = true
+		}
+	}
+	changes := []PlaceChange{}
+	for placeID := range ids {
+		old, migrated := before.GetTokens(placeID), after.GetTokens(placeID)
+		if sameTokens(old, migrated) {
+			continue
+		}
+		changes = append(changes, PlaceChange{PlaceID: placeID, Before: old, After: migrated})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].PlaceID < changes[j].PlaceID })
+	return changes
+}
+
+// sameTokens reports whether two token lists hold the same values and timestamps in order
+func sameTokens(a, b []*Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Timestamp != b[i].Timestamp || !reflect.DeepEqual(a[i].Value, b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MonitorType identifies the kind of a CPN monitor
+type MonitorType string
+
+const (
+	MonitorTypeDataCollector MonitorType = "DataCollector" // Records a Lua value per firing of selected transitions
+	MonitorTypeBreakpoint    MonitorType = "Breakpoint"    // Stops simulation when a Lua predicate over the marking holds
+	MonitorTypeMarkingSize   MonitorType = "MarkingSize"   // Tracks token counts of selected places
+)
+
+// MaxMonitorObservations bounds the observations kept per monitor (oldest are dropped; statistics keep counting)
+const MaxMonitorObservations = 10000
+
+// Monitor is a user-defined observer evaluated after transition firings (CPN Tools monitor concept).
+// JSON: { "id": "m1", "name": "Amounts", "type": "DataCollector", "transitions": ["t1"], "expression": "x.amount" }
+type Monitor struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Type        MonitorType `json:"type"`
+	Transitions []string    `json:"transitions,omitempty"` // Data collectors: observed transition IDs (empty = all)
+	Places      []string    `json:"places,omitempty"`      // Marking size: observed place IDs (empty = all)
+	Expression  string      `json:"expression,omitempty"`  // Data collector value / breakpoint predicate (Lua)
+}
+
+// Validate checks the monitor definition against the CPN
+func (m *Monitor) Validate(cpn *CPN) error {
+	if m.ID == "" {
+		return fmt.Errorf("monitor id is required")
+	}
+	switch m.Type {
+	case MonitorTypeDataCollector, MonitorTypeBreakpoint:
+		if m.Expression == "" {
+			return fmt.Errorf("monitor %s: expression is required for %s monitors", m.ID, m.Type)
+		}
+	case MonitorTypeMarkingSize:
+	default:
+		return fmt.Errorf("monitor %s: unknown monitor type '%s'", m.ID, m.Type)
+	}
+	for _, id := range m.Transitions {
+		if cpn.GetTransition(id) == nil {
+			return fmt.Errorf("monitor %s: transition %s not found", m.ID, id)
+		}
+	}
+	for _, id := range m.Places {
+		if cpn.GetPlace(id) == nil {
+			return fmt.Errorf("monitor %s: place %s not found", m.ID, id)
+		}
+	}
+	return nil
+}
+
+// ObservesTransition reports whether the monitor observes firings of the given transition
+func (m *Monitor) ObservesTransition(transitionID string) bool {
+	if len(m.Transitions) == 0 {
+		return true
+	}
+	for _, id := range m.Transitions {
+		if id == transitionID {
+			return true
+		}
+	}
+	return false
+}
+
+// ObservedPlaces returns the place IDs tracked by a marking size monitor
+func (m *Monitor) ObservedPlaces(cpn *CPN) []string {
+	if len(m.Places) > 0 {
+		return m.Places
+	}
+	ids := make([]string, 0, len(cpn.Places))
+	for _, place := range cpn.Places {
+		ids = append(ids, place.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Clone creates a deep copy of the monitor
+func (m *Monitor) Clone() *Monitor {
+	if m == nil {
+		return nil
+	}
+	clone := *m
+	clone.Transitions = append([]string(nil), m.Transitions...)
+	clone.Places = append([]string(nil), m.Places...)
+	return &clone
+}
+
+// MonitorStats accumulates numeric observations
+type MonitorStats struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+}
+
+// Add records a numeric observation
+func (s *MonitorStats) Add(value float64) {
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+	s.Avg = s.Sum / float64(s.Count)
+}
+
+// MonitorObservation is a single observation recorded by a monitor
+type MonitorObservation struct {
+	Step         int            `json:"step"`
+	Clock        int            `json:"clock"`
+	TransitionID string         `json:"transitionId,omitempty"`
+	Value        interface{}    `json:"value,omitempty"`  // Data collector value
+	Counts       map[string]int `json:"counts,omitempty"` // Marking size: place ID -> token count
+}
+
+// MonitorResult holds what a monitor has recorded during a run
+type MonitorResult struct {
+	MonitorID    string                   `json:"monitorId"`
+	Name         string                   `json:"name"`
+	Type         MonitorType              `json:"type"`
+	Observations []MonitorObservation     `json:"observations"`
+	Stats        *MonitorStats            `json:"stats,omitempty"`      // Numeric data collector values
+	PlaceStats   map[string]*MonitorStats `json:"placeStats,omitempty"` // Marking size per place
+	Triggered    int                      `json:"triggered,omitempty"`  // Breakpoint hits
+	Errors       int                      `json:"errors,omitempty"`
+	LastError    string                   `json:"lastError,omitempty"`
+}
+
+// AddObservation appends an observation, dropping the oldest beyond MaxMonitorObservations
+func (r *MonitorResult) AddObservation(observation MonitorObservation) {
+	if len(r.Observations) >= MaxMonitorObservations {
+		r.Observations = r.Observations[1:]
+	}
+	r.Observations = append(r.Observations, observation)
+}
+
+// RecordError counts a failed monitor evaluation
+func (r *MonitorResult) RecordError(err error) {
+	r.Errors++
+	r.LastError = err.Error()
+}
+
+// BreakpointHit describes the breakpoint monitor that stopped a simulation
+type BreakpointHit struct {
+	MonitorID    string `json:"monitorId"`
+	Name         string `json:"name"`
+	Step         int    `json:"step"`
+	Clock        int    `json:"clock"`
+	TransitionID string `json:"transitionId"`
+}
+
+// MonitorResults holds the results of all monitors of a run, keyed by monitor ID
+type MonitorResults struct {
+	Results    map[string]*MonitorResult `json:"results"`
+	Breakpoint *BreakpointHit            `json:"breakpoint,omitempty"` // Pending breakpoint stop, if any
+}
+
+// NewMonitorResults creates an empty result set for the given monitors
+func NewMonitorResults(monitors []*Monitor) *MonitorResults {
+	results := &MonitorResults{Results: make(map[string]*MonitorResult)}
+	for _, m := range monitors {
+		result := &MonitorResult{MonitorID: m.ID, Name: m.Name, Type: m.Type, Observations: []MonitorObservation{}}
+		if m.Type == MonitorTypeMarkingSize {
+			result.PlaceStats = make(map[string]*MonitorStats)
+		}
+		results.Results[m.ID] = result
+	}
+	return results
+}
+
+// Get returns the result of a monitor, or nil
+func (mr *MonitorResults) Get(monitorID string) *MonitorResult {
+	if mr == nil {
+		return nil
+	}
+	return mr.Results[monitorID]
+}
+
+// Clone creates a deep copy of the results
+func (mr *MonitorResults) Clone() *MonitorResults {
+	if mr == nil {
+		return nil
+	}
+	clone := &MonitorResults{Results: make(map[string]*MonitorResult, len(mr.Results))}
+	if mr.Breakpoint != nil {
+		hit := *mr.Breakpoint
+		clone.Breakpoint = &hit
+	}
+	for id, r := range mr.Results {
+		rc := *r
+		rc.Observations = append([]MonitorObservation(nil), r.Observations...)
+		if r.Stats != nil {
+			stats := *r.Stats
+			rc.Stats = &stats
+		}
+		if r.PlaceStats != nil {
+			rc.PlaceStats = make(map[string]*MonitorStats, len(r.PlaceStats))
+			for placeID, s := range r.PlaceStats {
+				stats := *s
+				rc.PlaceStats[placeID] = &stats
+			}
+		}
+		clone.Results[id] = &rc
+	}
+	return clone
+}
+
+// PendingBreakpoint returns the breakpoint hit that stopped the current execution, or nil
+func (mr *MonitorResults) PendingBreakpoint() *BreakpointHit {
+	if mr == nil {
+		return nil
+	}
+	return mr.Breakpoint
+}
+
+// ClearBreakpoint clears a pending breakpoint so execution can resume
+func (mr *MonitorResults) ClearBreakpoint() {
+	if mr != nil {
+		mr.Breakpoint = nil
+	}
+}
@@ -117,6 +117,16 @@ func (ms Multiset) GetAllTokens() []*Token {
 	return result
 }
 
+// SortedKeys returns the value keys of the multiset in sorted order
+func (ms Multiset) SortedKeys() []string {
+	keys := make([]string, 0, len(ms))
+	for k := range ms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // GetValues returns all unique values in the multiset
 func (ms Multiset) GetValues() []interface{} {
 	var values []interface{}
@@ -155,15 +165,9 @@ func (ms Multiset) String() string {
 	}
 
 	var parts []string
-	
-	// Sort keys for consistent output
-	keys := make([]string, 0, len(ms))
-	for k := range ms {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
 
-	for _, key := range keys {
+	// Sort keys for consistent output
+	for _, key := range ms.SortedKeys() {
 		tokens := ms[key]
 		if len(tokens) == 1 {
 			parts = append(parts, key)
@@ -181,3 +185,34 @@ func tokenValueToString(value interface{}) string {
 	return token.ValueString()
 }
 
+// TokenIndex maps value keys (see Token.ValueString) to tokens
+type TokenIndex map[string][]*Token
+
+// Lookup returns the indexed tokens whose key equals the key of value
+func (idx TokenIndex) Lookup(value interface{}) []*Token {
+	return idx[tokenValueToString(value)]
+}
+
+// IndexByKey indexes the tokens of the multiset by the value of a JSON key of their
+// (map valued) value. Tokens whose value is not a map or lacks the key are not indexed.
+func (ms Multiset) IndexByKey(key string) TokenIndex {
+	index := make(TokenIndex)
+	for _, tokens := range ms {
+		for _, token := range tokens {
+			record, ok := token.Value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if field, exists := record[key]; exists {
+				k := tokenValueToString(field)
+				index[k] = append(index[k], token)
+			}
+		}
+	}
+	return index
+}
+
+// ValueKey returns the key under which tokens with the given value are stored
+func ValueKey(value interface{}) string {
+	return tokenValueToString(value)
+}
@@ -20,6 +20,12 @@ func NewPlace(id, name string, colorSet ColorSet) *Place {
 	}
 }
 
+// IsTimed reports whether the tokens of the place carry timestamps. Tokens in untimed places are
+// available regardless of their timestamp.
+func (p *Place) IsTimed() bool {
+	return p.ColorSet != nil && p.ColorSet.IsTimed()
+}
+
 // ValidateToken checks if a token's value is valid for this place's color set
 func (p *Place) ValidateToken(token *Token) error {
 	if p.ColorSet == nil {
@@ -54,5 +60,6 @@ func (p *Place) Clone() *Place {
 		ID:       p.ID,
 		Name:     p.Name,
 		ColorSet: p.ColorSet, // ColorSet is typically immutable, so shallow copy is fine
+		Position: p.Position.Clone(),
 	}
 }
@@ -0,0 +1,1046 @@
+package models
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PNML (ISO/IEC 15909-2) import and export.
+//
+// P/T nets map to places of color set UNIT whose tokens are "()", with arc weights as multiset
+// inscriptions n'"()". Symmetric and high-level nets map sorts to color sets, variable
+// declarations to inscription variables and terms to Lua inscriptions, guards and initial
+// markings. Data without a PNML counterpart (color sets without a sort, actions, transition kinds,
+// delays, declarations, monitors, ...) is kept in <toolspecific tool="go-petri-flow"> elements, so
+// exported nets import back unchanged. Everything else that cannot be converted is listed in the
+// conversion report.
+
+const (
+	pnmlNamespace   = "http://www.pnml.org/version-2009/grammar/pnml"
+	pnmlTypePT      = "http://www.pnml.org/version-2009/grammar/ptnet"
+	pnmlTypeHL      = "http://www.pnml.org/version-2009/grammar/highlevelnet"
+	pnmlTool        = "go-petri-flow"
+	pnmlToolVersion = "1.0"
+	pnmlUnitToken   = "()"
+)
+
+// pnmlNode is a generic PNML element, used for reading and writing documents
+type pnmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr  `xml:",any,attr"`
+	Text     string      `xml:",chardata"`
+	Children []*pnmlNode `xml:",any"`
+}
+
+// pnmlNetData is the tool-specific data of a net
+type pnmlNetData struct {
+	Description        string              `json:"description,omitempty"`
+	ColorSets          []string            `json:"colorSets,omitempty"`
+	JsonSchemas        []JsonSchemaDef     `json:"jsonSchemas,omitempty"`
+	Declarations       string              `json:"declarations,omitempty"`
+	EndPlaces          []string            `json:"endPlaces,omitempty"`
+	SubWorkflows       []SubWorkflowJSON   `json:"subWorkflows,omitempty"`
+	ConflictResolution *ConflictResolution `json:"conflictResolution,omitempty"`
+	Monitors           []*Monitor          `json:"monitors,omitempty"`
+}
+
+// pnmlPlaceData is the tool-specific data of a place
+type pnmlPlaceData struct {
+	ColorSet string      `json:"colorSet,omitempty"`
+	Tokens   []TokenJSON `json:"tokens,omitempty"`
+}
+
+// pnmlArcData is the tool-specific data of an arc
+type pnmlArcData struct {
+	Multiplicity int `json:"multiplicity,omitempty"`
+}
+
+func newPNMLNode(name string, attrs ...string) *pnmlNode {
+	n := &pnmlNode{XMLName: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+	return n
+}
+
+// add appends child elements and returns the node
+func (n *pnmlNode) add(children ...*pnmlNode) *pnmlNode {
+	for _, c := range children {
+		if c != nil {
+			n.Children = append(n.Children, c)
+		}
+	}
+	return n
+}
+
+func (n *pnmlNode) attr(name string) string {
+	if n == nil {
+		return ""
+	}
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the given name
+func (n *pnmlNode) child(name string) *pnmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// children returns the child elements with the given name
+func (n *pnmlNode) children(name string) []*pnmlNode {
+	if n == nil {
+		return nil
+	}
+	var result []*pnmlNode
+	for _, c := range n.Children {
+		if c.XMLName.Local == name {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// text returns the content of the <text> child of a label
+func (n *pnmlNode) text() string {
+	if t := n.child("text"); t != nil {
+		return strings.TrimSpace(t.Text)
+	}
+	return ""
+}
+
+// structure returns the term or sort in the <structure> child of a label
+func (n *pnmlNode) structure() *pnmlNode {
+	if s := n.child("structure"); s != nil && len(s.Children) > 0 {
+		return s.Children[0]
+	}
+	return nil
+}
+
+// subterms returns the terms of the <subterm> children of an operator
+func (n *pnmlNode) subterms() []*pnmlNode {
+	var terms []*pnmlNode
+	for _, s := range n.children("subterm") {
+		if len(s.Children) > 0 {
+			terms = append(terms, s.Children[0])
+		}
+	}
+	return terms
+}
+
+// toolData returns the JSON content of the go-petri-flow <toolspecific> child
+func (n *pnmlNode) toolData() string {
+	for _, t := range n.children("toolspecific") {
+		if t.attr("tool") == pnmlTool {
+			return strings.TrimSpace(t.Text)
+		}
+	}
+	return ""
+}
+
+// position returns the position in the <graphics> child
+func (n *pnmlNode) position() *Position {
+	p := n.child("graphics").child("position")
+	if p == nil {
+		return nil
+	}
+	x, errX := strconv.ParseFloat(p.attr("x"), 32)
+	y, errY := strconv.ParseFloat(p.attr("y"), 32)
+	if errX != nil || errY != nil {
+		return nil
+	}
+	return &Position{X: float32(x), Y: float32(y)}
+}
+
+var (
+	nonIdentifierChars = regexp.MustCompile(`\W`)
+	simpleTerm         = regexp.MustCompile(`^[\w"()]+$`)
+)
+
+// pnmlIdentifier turns a PNML name into an identifier usable for color sets, values and variables
+func pnmlIdentifier(name string) string {
+	id := nonIdentifierChars.ReplaceAllString(strings.TrimSpace(name), "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "_" + id
+	}
+	return id
+}
+
+// unitInscription is the inscription of a P/T arc of weight n
+func unitInscription(weight int) string {
+	if weight == 1 {
+		return strconv.Quote(pnmlUnitToken)
+	}
+	return fmt.Sprintf("%d'%s", weight, strconv.Quote(pnmlUnitToken))
+}
+
+// pnmlImporter holds the state of a PNML import
+type pnmlImporter struct {
+	report    *ConversionReport
+	colorSets *ColorSetParser
+	def       *CPNDefinitionJSON
+	pt        bool
+	native    bool // the net carries go-petri-flow data (an exported net)
+
+	sortDecls  map[string]*pnmlNode // sort declaration ID -> namedsort
+	sorts      map[string]string    // sort declaration ID -> color set name
+	converting map[string]bool
+	constants  map[string]string // feconstant ID -> value
+	constSorts map[string]string // feconstant ID -> color set name
+	variables  map[string]string // variable declaration ID -> name
+	varSorts   map[string]string // variable declaration ID -> sort declaration ID
+	refs       map[string]string // reference node ID -> referenced node ID
+
+	places, transitions, arcs, declarations []*pnmlNode
+	pages                                   int
+}
+
+// ParsePNML converts the first net of a PNML document to a CPN definition. P/T nets, symmetric
+// nets and high-level nets are supported; constructs that cannot be converted are listed in the
+// report.
+func (p *CPNParser) ParsePNML(data []byte) (*CPNDefinitionJSON, *ConversionReport, error) {
+	var doc pnmlNode
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse PNML: %v", err)
+	}
+	if doc.XMLName.Local != "pnml" {
+		return nil, nil, fmt.Errorf("root element is <%s>, expected <pnml>", doc.XMLName.Local)
+	}
+	nets := doc.children("net")
+	if len(nets) == 0 {
+		return nil, nil, fmt.Errorf("PNML document contains no net")
+	}
+	report := NewConversionReport("pnml")
+	for _, net := range nets[1:] {
+		report.Add(net.attr("id"), "only the first net of a document is imported; net ignored")
+	}
+	imp := &pnmlImporter{
+		report:     report,
+		colorSets:  NewColorSetParser(),
+		sortDecls:  make(map[string]*pnmlNode),
+		sorts:      make(map[string]string),
+		converting: make(map[string]bool),
+		constants:  make(map[string]string),
+		constSorts: make(map[string]string),
+		variables:  make(map[string]string),
+		varSorts:   make(map[string]string),
+		refs:       make(map[string]string),
+	}
+	def, err := imp.importNet(nets[0])
+	if err != nil {
+		return nil, report, err
+	}
+	return def, report, nil
+}
+
+func (imp *pnmlImporter) importNet(net *pnmlNode) (*CPNDefinitionJSON, error) {
+	netType := net.attr("type")
+	switch netType[strings.LastIndex(netType, "/")+1:] {
+	case "ptnet", "pnmlcoremodel":
+		imp.pt = true
+	case "symmetricnet", "highlevelnet", "hlpng":
+	default:
+		return nil, fmt.Errorf("unsupported PNML net type '%s'", netType)
+	}
+
+	imp.def = &CPNDefinitionJSON{
+		ID:             net.attr("id"),
+		Name:           net.child("name").text(),
+		InitialMarking: make(map[string][]TokenJSON),
+	}
+	if imp.def.ID == "" {
+		return nil, fmt.Errorf("net has no id")
+	}
+	if imp.def.Name == "" {
+		imp.def.Name = imp.def.ID
+	}
+	if data := net.toolData(); data != "" {
+		var extras pnmlNetData
+		if err := json.Unmarshal([]byte(data), &extras); err != nil {
+			return nil, fmt.Errorf("invalid %s data of net %s: %v", pnmlTool, imp.def.ID, err)
+		}
+		imp.native = true
+		imp.def.Description = extras.Description
+		imp.def.ColorSets = extras.ColorSets
+		imp.def.JsonSchemas = extras.JsonSchemas
+		imp.def.Declarations = extras.Declarations
+		imp.def.EndPlaces = extras.EndPlaces
+		imp.def.SubWorkflows = extras.SubWorkflows
+		imp.def.ConflictResolution = extras.ConflictResolution
+		imp.def.Monitors = extras.Monitors
+	}
+
+	imp.collect(net)
+	if imp.pages > 1 {
+		imp.report.Add(imp.def.ID, "%d pages were flattened into a single net", imp.pages)
+	}
+	imp.importDeclarations()
+	if err := imp.importPlaces(); err != nil {
+		return nil, err
+	}
+	variables, err := imp.importArcs()
+	if err != nil {
+		return nil, err
+	}
+	if err := imp.importTransitions(variables); err != nil {
+		return nil, err
+	}
+	return imp.def, nil
+}
+
+// collect gathers the objects of a net or page, flattening nested pages
+func (imp *pnmlImporter) collect(container *pnmlNode) {
+	for _, n := range container.Children {
+		switch n.XMLName.Local {
+		case "page":
+			imp.pages++
+			imp.collect(n)
+		case "place":
+			imp.places = append(imp.places, n)
+		case "transition":
+			imp.transitions = append(imp.transitions, n)
+		case "arc":
+			imp.arcs = append(imp.arcs, n)
+		case "referencePlace", "referenceTransition":
+			imp.refs[n.attr("id")] = n.attr("ref")
+		case "declaration":
+			imp.declarations = append(imp.declarations, n)
+		case "name", "graphics":
+		case "toolspecific":
+			if tool := n.attr("tool"); tool != pnmlTool {
+				imp.report.Add(container.attr("id"), "tool-specific data of %s ignored", tool)
+			}
+		default:
+			imp.report.Add(container.attr("id"), "unsupported element <%s> ignored", n.XMLName.Local)
+		}
+	}
+}
+
+// resolve follows reference places and transitions to the node they refer to
+func (imp *pnmlImporter) resolve(id string) string {
+	for i := 0; i <= len(imp.refs); i++ {
+		ref, ok := imp.refs[id]
+		if !ok {
+			break
+		}
+		id = ref
+	}
+	return id
+}
+
+// importDeclarations converts sort, constant and variable declarations
+func (imp *pnmlImporter) importDeclarations() {
+	var sorts []*pnmlNode
+	for _, declaration := range imp.declarations {
+		decls := declaration.child("structure").child("declarations")
+		for _, d := range decls.Children {
+			id := d.attr("id")
+			switch d.XMLName.Local {
+			case "namedsort":
+				imp.sortDecls[id] = d
+				sorts = append(sorts, d)
+			case "variabledecl":
+				imp.variables[id] = pnmlIdentifier(d.attr("name"))
+				imp.varSorts[id] = d.child("usersort").attr("declaration")
+			default:
+				imp.report.Add(id, "unsupported declaration <%s> ignored", d.XMLName.Local)
+			}
+		}
+	}
+	for _, s := range sorts {
+		if _, err := imp.sortName(s.attr("id")); err != nil {
+			imp.report.Add(s.attr("id"), "sort %s not converted: %v", s.attr("name"), err)
+		}
+	}
+}
+
+// sortName returns the color set of a sort declaration, converting it on first use
+func (imp *pnmlImporter) sortName(id string) (string, error) {
+	if name, ok := imp.sorts[id]; ok {
+		return name, nil
+	}
+	decl, ok := imp.sortDecls[id]
+	if !ok {
+		return "", fmt.Errorf("unknown sort declaration '%s'", id)
+	}
+	if imp.converting[id] {
+		return "", fmt.Errorf("sort declaration '%s' is recursive", id)
+	}
+	imp.converting[id] = true
+	defer delete(imp.converting, id)
+
+	name := pnmlIdentifier(decl.attr("name"))
+	if decl.attr("name") == "" {
+		name = pnmlIdentifier(id)
+	}
+	if len(decl.Children) == 0 {
+		return "", fmt.Errorf("sort declaration '%s' has no sort", id)
+	}
+	sort := decl.Children[0]
+	if sort.XMLName.Local == "finiteenumeration" || sort.XMLName.Local == "cyclicenumeration" {
+		for _, c := range sort.children("feconstant") {
+			imp.constSorts[c.attr("id")] = name
+		}
+	}
+	if imp.native {
+		// Exported nets carry their color set definitions; sorts only name them
+		imp.sortConstants(sort)
+		imp.sorts[id] = name
+		return name, nil
+	}
+	typeDefinition, err := imp.sortDefinition(sort, name)
+	if err != nil {
+		return "", err
+	}
+	if err := imp.define(name, typeDefinition); err != nil {
+		return "", err
+	}
+	imp.sorts[id] = name
+	return name, nil
+}
+
+// sortConstants registers the constants of an enumeration sort
+func (imp *pnmlImporter) sortConstants(sort *pnmlNode) []string {
+	var values []string
+	for _, c := range sort.children("feconstant") {
+		value := pnmlIdentifier(c.attr("name"))
+		if c.attr("name") == "" {
+			value = pnmlIdentifier(c.attr("id"))
+		}
+		imp.constants[c.attr("id")] = value
+		values = append(values, value)
+	}
+	return values
+}
+
+// sortDefinition converts a sort to the type part of a color set definition
+func (imp *pnmlImporter) sortDefinition(sort *pnmlNode, name string) (string, error) {
+	switch sort.XMLName.Local {
+	case "dot":
+		return "unit", nil
+	case "bool":
+		return "bool", nil
+	case "integer":
+		return "int", nil
+	case "natural":
+		return "subset INT by function(n) return n >= 0 end", nil
+	case "positive":
+		return "subset INT by function(n) return n >= 1 end", nil
+	case "string":
+		return "string", nil
+	case "finiteintrange":
+		start, errStart := strconv.Atoi(sort.attr("start"))
+		end, errEnd := strconv.Atoi(sort.attr("end"))
+		if errStart != nil || errEnd != nil {
+			return "", fmt.Errorf("invalid finite integer range %s..%s", sort.attr("start"), sort.attr("end"))
+		}
+		return fmt.Sprintf("int[%d..%d]", start, end), nil
+	case "finiteenumeration", "cyclicenumeration":
+		values := imp.sortConstants(sort)
+		if len(values) == 0 {
+			return "", fmt.Errorf("enumeration has no constants")
+		}
+		return "with " + strings.Join(values, " | "), nil
+	case "productsort":
+		var components []string
+		for i, c := range sort.Children {
+			component, err := imp.componentSort(c, fmt.Sprintf("%s_%d", name, i+1))
+			if err != nil {
+				return "", err
+			}
+			components = append(components, component)
+		}
+		if len(components) < 2 {
+			return "", fmt.Errorf("product sort needs at least two components")
+		}
+		return "product " + strings.Join(components, " * "), nil
+	case "list":
+		if len(sort.Children) == 0 {
+			return "", fmt.Errorf("list sort has no element sort")
+		}
+		element, err := imp.componentSort(sort.Children[0], name+"_element")
+		if err != nil {
+			return "", err
+		}
+		return "list " + element, nil
+	case "usersort":
+		return imp.sortName(sort.attr("declaration"))
+	default:
+		return "", fmt.Errorf("unsupported sort <%s>", sort.XMLName.Local)
+	}
+}
+
+// componentSort returns the color set of a sort used inside another sort or as a place type.
+// Built-in sorts map to the built-in color sets; other anonymous sorts are defined under name.
+func (imp *pnmlImporter) componentSort(sort *pnmlNode, name string) (string, error) {
+	switch sort.XMLName.Local {
+	case "usersort":
+		return imp.sortName(sort.attr("declaration"))
+	case "dot":
+		return UNIT.Name(), nil
+	case "bool":
+		return BOOL.Name(), nil
+	case "integer":
+		return INT.Name(), nil
+	case "string":
+		return STRING.Name(), nil
+	}
+	typeDefinition, err := imp.sortDefinition(sort, name)
+	if err != nil {
+		return "", err
+	}
+	if err := imp.define(name, typeDefinition); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// define adds a color set definition after validating it
+func (imp *pnmlImporter) define(name, typeDefinition string) error {
+	definition := fmt.Sprintf("colset %s = %s;", name, typeDefinition)
+	if _, err := imp.colorSets.ParseColorSetDefinition(definition); err != nil {
+		return err
+	}
+	imp.def.ColorSets = append(imp.def.ColorSets, definition)
+	return nil
+}
+
+// importPlaces converts places, their types and initial markings
+func (imp *pnmlImporter) importPlaces() error {
+	for _, n := range imp.places {
+		id := n.attr("id")
+		place := PlaceJSON{ID: id, Name: n.child("name").text(), Position: n.position()}
+		if place.Name == "" {
+			place.Name = id
+		}
+		var data pnmlPlaceData
+		if raw := n.toolData(); raw != "" {
+			decoder := json.NewDecoder(strings.NewReader(raw))
+			decoder.UseNumber()
+			if err := decoder.Decode(&data); err != nil {
+				return fmt.Errorf("invalid %s data of place %s: %v", pnmlTool, id, err)
+			}
+			for i := range data.Tokens {
+				data.Tokens[i].Value = normalizeJSONNumbers(data.Tokens[i].Value)
+			}
+		}
+
+		switch {
+		case data.ColorSet != "":
+			place.ColorSet = data.ColorSet
+		case imp.pt:
+			place.ColorSet = UNIT.Name()
+		default:
+			typ := n.child("type")
+			if sort := typ.structure(); sort != nil {
+				name, err := imp.componentSort(sort, "Sort_"+pnmlIdentifier(id))
+				if err != nil {
+					return fmt.Errorf("type of place %s: %v", id, err)
+				}
+				place.ColorSet = name
+			} else if text := typ.text(); text != "" {
+				if _, ok := imp.colorSets.GetColorSet(text); !ok && !imp.native {
+					return fmt.Errorf("type of place %s: unknown sort '%s'", id, text)
+				}
+				place.ColorSet = text
+			} else {
+				return fmt.Errorf("place %s has no type", id)
+			}
+		}
+		imp.def.Places = append(imp.def.Places, place)
+
+		switch {
+		case data.Tokens != nil:
+			imp.def.InitialMarking[id] = data.Tokens
+		case imp.pt:
+			if text := n.child("initialMarking").text(); text != "" {
+				count, err := strconv.Atoi(text)
+				if err != nil || count < 0 {
+					imp.report.Add(id, "invalid initial marking '%s' ignored", text)
+				} else if count > 0 {
+					imp.def.InitialMarking[id] = []TokenJSON{{Value: pnmlUnitToken, Count: count}}
+				}
+			}
+		default:
+			marking := n.child("hlinitialMarking")
+			if term := marking.structure(); term != nil {
+				values, err := imp.termValues(term)
+				if err != nil {
+					imp.report.Add(id, "initial marking not converted: %v", err)
+				} else if len(values) > 0 {
+					imp.def.InitialMarking[id] = groupTokens(values)
+				}
+			} else if text := marking.text(); text != "" {
+				imp.report.Add(id, "initial marking '%s' has no term structure and was ignored", text)
+			}
+		}
+	}
+	return nil
+}
+
+// groupTokens turns a list of values into tokens, counting consecutive equal values once
+func groupTokens(values []interface{}) []TokenJSON {
+	var tokens []TokenJSON
+	for _, v := range values {
+		if last := len(tokens) - 1; last >= 0 && ValueKey(tokens[last].Value) == ValueKey(v) {
+			tokens[last].Count++
+			continue
+		}
+		tokens = append(tokens, TokenJSON{Value: v, Count: 1})
+	}
+	return tokens
+}
+
+// importArcs converts arcs and returns the variables used by the arcs of each transition
+func (imp *pnmlImporter) importArcs() (map[string]map[string]bool, error) {
+	places := make(map[string]bool)
+	for _, place := range imp.def.Places {
+		places[place.ID] = true
+	}
+	transitions := make(map[string]bool)
+	for _, n := range imp.transitions {
+		transitions[n.attr("id")] = true
+	}
+
+	variables := make(map[string]map[string]bool)
+	for _, n := range imp.arcs {
+		id := n.attr("id")
+		var data pnmlArcData
+		if raw := n.toolData(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &data); err != nil {
+				return nil, fmt.Errorf("invalid %s data of arc %s: %v", pnmlTool, id, err)
+			}
+		}
+		arc := ArcJSON{
+			ID:           id,
+			SourceID:     imp.resolve(n.attr("source")),
+			TargetID:     imp.resolve(n.attr("target")),
+			Multiplicity: data.Multiplicity,
+		}
+		var transitionID string
+		switch {
+		case places[arc.SourceID] && transitions[arc.TargetID]:
+			arc.Direction = "IN"
+			transitionID = arc.TargetID
+		case transitions[arc.SourceID] && places[arc.TargetID]:
+			arc.Direction = "OUT"
+			transitionID = arc.SourceID
+		default:
+			return nil, fmt.Errorf("arc %s must connect a place and a transition (%s -> %s)", id, arc.SourceID, arc.TargetID)
+		}
+		if len(n.child("graphics").children("position")) > 0 {
+			imp.report.Add(id, "arc bend points are not supported and were dropped")
+		}
+
+		if imp.pt {
+			weight := 1
+			if text := n.child("inscription").text(); text != "" {
+				w, err := strconv.Atoi(text)
+				if err != nil || w < 1 {
+					imp.report.Add(id, "invalid arc weight '%s', using 1", text)
+				} else {
+					weight = w
+				}
+			}
+			arc.Expression = unitInscription(weight)
+		} else {
+			if variables[transitionID] == nil {
+				variables[transitionID] = make(map[string]bool)
+			}
+			expr, ok := imp.expression(n.child("hlinscription"), id, variables[transitionID])
+			if !ok {
+				return nil, fmt.Errorf("arc %s has no inscription", id)
+			}
+			arc.Expression = expr
+		}
+		imp.def.Arcs = append(imp.def.Arcs, arc)
+	}
+	return variables, nil
+}
+
+// importTransitions converts transitions and their conditions
+func (imp *pnmlImporter) importTransitions(arcVariables map[string]map[string]bool) error {
+	for _, n := range imp.transitions {
+		id := n.attr("id")
+		var transition TransitionJSON
+		if raw := n.toolData(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &transition); err != nil {
+				return fmt.Errorf("invalid %s data of transition %s: %v", pnmlTool, id, err)
+			}
+		}
+		transition.ID = id
+		transition.Name = n.child("name").text()
+		if transition.Name == "" {
+			transition.Name = id
+		}
+		transition.Position = n.position()
+
+		if condition := n.child("condition"); condition != nil {
+			if imp.pt {
+				imp.report.Add(id, "P/T nets have no transition conditions; condition ignored")
+			} else {
+				variables := arcVariables[id]
+				if variables == nil {
+					variables = make(map[string]bool)
+				}
+				if guard, ok := imp.expression(condition, id, variables); ok {
+					transition.GuardExpression = guard
+					if len(transition.Variables) == 0 {
+						for name := range variables {
+							transition.Variables = append(transition.Variables, name)
+						}
+						slices.Sort(transition.Variables)
+					}
+				}
+			}
+		}
+		imp.def.Transitions = append(imp.def.Transitions, transition)
+	}
+	return nil
+}
+
+// expression converts an inscription or condition label to Lua. The term structure is preferred;
+// without one (or if it cannot be converted) the text is used verbatim.
+func (imp *pnmlImporter) expression(label *pnmlNode, element string, variables map[string]bool) (string, bool) {
+	if label == nil {
+		return "", false
+	}
+	text := label.text()
+	if term := label.structure(); term != nil {
+		expr, err := imp.luaTerm(term, variables)
+		if err == nil {
+			return expr, true
+		}
+		if text == "" {
+			imp.report.Add(element, "term not converted: %v", err)
+			return "", false
+		}
+		imp.report.Add(element, "term not converted (%v); text '%s' used verbatim", err, text)
+		return text, true
+	}
+	if text == "" {
+		return "", false
+	}
+	if !imp.native {
+		imp.report.Add(element, "'%s' has no term structure; text used verbatim", text)
+	}
+	return text, true
+}
+
+// pnmlOperators maps PNML operators to Lua operators
+var pnmlOperators = map[string]string{
+	"equality":           "==",
+	"inequality":         "~=",
+	"lessthan":           "<",
+	"lessthanorequal":    "<=",
+	"greaterthan":        ">",
+	"greaterthanorequal": ">=",
+	"and":                "and",
+	"or":                 "or",
+	"addition":           "+",
+	"subtraction":        "-",
+	"mult":               "*",
+	"mod":                "%",
+}
+
+// luaTerm converts a PNML term to a Lua expression, recording the variables it uses
+func (imp *pnmlImporter) luaTerm(term *pnmlNode, variables map[string]bool) (string, error) {
+	subterms := term.subterms()
+	operand := func(t *pnmlNode) (string, error) {
+		expr, err := imp.luaTerm(t, variables)
+		if err != nil {
+			return "", err
+		}
+		if _, op := pnmlOperators[t.XMLName.Local]; op || t.XMLName.Local == "imply" || t.XMLName.Local == "not" {
+			expr = "(" + expr + ")"
+		}
+		return expr, nil
+	}
+
+	switch name := term.XMLName.Local; name {
+	case "variable":
+		variable, ok := imp.variables[term.attr("refvariable")]
+		if !ok {
+			return "", fmt.Errorf("unknown variable '%s'", term.attr("refvariable"))
+		}
+		variables[variable] = true
+		return variable, nil
+	case "numberconstant", "finiteintrangeconstant":
+		value, err := strconv.Atoi(term.attr("value"))
+		if err != nil {
+			return "", fmt.Errorf("invalid number '%s'", term.attr("value"))
+		}
+		return strconv.Itoa(value), nil
+	case "booleanconstant":
+		value, err := strconv.ParseBool(term.attr("value"))
+		if err != nil {
+			return "", fmt.Errorf("invalid boolean '%s'", term.attr("value"))
+		}
+		return strconv.FormatBool(value), nil
+	case "dotconstant":
+		return strconv.Quote(pnmlUnitToken), nil
+	case "stringconstant":
+		return strconv.Quote(term.child("value").Text), nil
+	case "useroperator":
+		value, ok := imp.constants[term.attr("declaration")]
+		if !ok {
+			return "", fmt.Errorf("unsupported operator '%s'", term.attr("declaration"))
+		}
+		return strconv.Quote(value), nil
+	case "tuple":
+		var components []string
+		for _, t := range subterms {
+			component, err := imp.luaTerm(t, variables)
+			if err != nil {
+				return "", err
+			}
+			components = append(components, component)
+		}
+		return "tuple(" + strings.Join(components, ", ") + ")", nil
+	case "numberof":
+		if len(subterms) != 2 {
+			return "", fmt.Errorf("numberof needs a count and a term")
+		}
+		count, err := strconv.Atoi(subterms[0].attr("value"))
+		if subterms[0].XMLName.Local != "numberconstant" || err != nil || count < 0 {
+			return "", fmt.Errorf("numberof needs a constant count")
+		}
+		value, err := imp.luaTerm(subterms[1], variables)
+		if err != nil {
+			return "", err
+		}
+		if !simpleTerm.MatchString(value) {
+			value = "(" + value + ")"
+		}
+		return fmt.Sprintf("%d'%s", count, value), nil
+	case "add":
+		var terms []string
+		for _, t := range subterms {
+			expr, err := imp.luaTerm(t, variables)
+			if err != nil {
+				return "", err
+			}
+			terms = append(terms, expr)
+		}
+		return strings.Join(terms, " ++ "), nil
+	case "all":
+		sort, err := imp.sortName(term.child("usersort").attr("declaration"))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("multiset(cs.all(%s))", strconv.Quote(sort)), nil
+	case "successor", "predecessor":
+		if len(subterms) != 1 {
+			return "", fmt.Errorf("%s needs one operand", name)
+		}
+		sort, err := imp.termSort(subterms[0])
+		if err != nil {
+			return "", err
+		}
+		value, err := imp.luaTerm(subterms[0], variables)
+		if err != nil {
+			return "", err
+		}
+		function := "succ"
+		if name == "predecessor" {
+			function = "pred"
+		}
+		return fmt.Sprintf("cs.%s(%s, %s)", function, strconv.Quote(sort), value), nil
+	case "not":
+		if len(subterms) != 1 {
+			return "", fmt.Errorf("not needs one operand")
+		}
+		value, err := operand(subterms[0])
+		if err != nil {
+			return "", err
+		}
+		return "not " + value, nil
+	case "imply":
+		if len(subterms) != 2 {
+			return "", fmt.Errorf("imply needs two operands")
+		}
+		left, err := operand(subterms[0])
+		if err != nil {
+			return "", err
+		}
+		right, err := operand(subterms[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("not %s or %s", left, right), nil
+	case "div":
+		if len(subterms) != 2 {
+			return "", fmt.Errorf("div needs two operands")
+		}
+		left, err := operand(subterms[0])
+		if err != nil {
+			return "", err
+		}
+		right, err := operand(subterms[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("math.floor(%s / %s)", left, right), nil
+	default:
+		op, ok := pnmlOperators[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported term <%s>", name)
+		}
+		if len(subterms) < 2 {
+			return "", fmt.Errorf("%s needs at least two operands", name)
+		}
+		var operands []string
+		for _, t := range subterms {
+			value, err := operand(t)
+			if err != nil {
+				return "", err
+			}
+			operands = append(operands, value)
+		}
+		return strings.Join(operands, " "+op+" "), nil
+	}
+}
+
+// termSort returns the color set of a variable or enumeration constant
+func (imp *pnmlImporter) termSort(term *pnmlNode) (string, error) {
+	switch term.XMLName.Local {
+	case "variable":
+		return imp.sortName(imp.varSorts[term.attr("refvariable")])
+	case "useroperator":
+		if sort, ok := imp.constSorts[term.attr("declaration")]; ok {
+			return sort, nil
+		}
+	}
+	return "", fmt.Errorf("cannot determine the sort of <%s>", term.XMLName.Local)
+}
+
+// termValues evaluates a ground multiset term of an initial marking to its token values
+func (imp *pnmlImporter) termValues(term *pnmlNode) ([]interface{}, error) {
+	subterms := term.subterms()
+	switch term.XMLName.Local {
+	case "numberof":
+		if len(subterms) != 2 {
+			return nil, fmt.Errorf("numberof needs a count and a term")
+		}
+		count, err := strconv.Atoi(subterms[0].attr("value"))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("numberof needs a constant count")
+		}
+		values, err := imp.termValues(subterms[1])
+		if err != nil {
+			return nil, err
+		}
+		var result []interface{}
+		for i := 0; i < count; i++ {
+			result = append(result, values...)
+		}
+		return result, nil
+	case "add":
+		var result []interface{}
+		for _, t := range subterms {
+			values, err := imp.termValues(t)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, values...)
+		}
+		return result, nil
+	case "all":
+		sort, err := imp.sortName(term.child("usersort").attr("declaration"))
+		if err != nil {
+			return nil, err
+		}
+		cs, ok := imp.colorSets.GetColorSet(sort)
+		if !ok {
+			return nil, fmt.Errorf("unknown sort '%s'", sort)
+		}
+		return enumerateColorSet(cs)
+	default:
+		value, err := imp.termValue(term)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+}
+
+// termValue evaluates a ground term to a token value
+func (imp *pnmlImporter) termValue(term *pnmlNode) (interface{}, error) {
+	switch term.XMLName.Local {
+	case "numberconstant", "finiteintrangeconstant":
+		value, err := strconv.Atoi(term.attr("value"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", term.attr("value"))
+		}
+		return value, nil
+	case "booleanconstant":
+		value, err := strconv.ParseBool(term.attr("value"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean '%s'", term.attr("value"))
+		}
+		return value, nil
+	case "dotconstant":
+		return pnmlUnitToken, nil
+	case "stringconstant":
+		return term.child("value").Text, nil
+	case "useroperator":
+		if value, ok := imp.constants[term.attr("declaration")]; ok {
+			return value, nil
+		}
+		return nil, fmt.Errorf("unsupported operator '%s'", term.attr("declaration"))
+	case "tuple":
+		var components []interface{}
+		for _, t := range term.subterms() {
+			component, err := imp.termValue(t)
+			if err != nil {
+				return nil, err
+			}
+			components = append(components, component)
+		}
+		return components, nil
+	default:
+		return nil, fmt.Errorf("unsupported term <%s> in initial marking", term.XMLName.Local)
+	}
+}
+
+// enumerateColorSet returns the values of a small finite color set
+func enumerateColorSet(cs ColorSet) ([]interface{}, error) {
+	var values []interface{}
+	switch c := cs.(type) {
+	case *EnumeratedColorSet:
+		for _, v := range c.GetValues() {
+			values = append(values, v)
+		}
+	case *IntegerColorSet:
+		minVal, maxVal, ok := c.GetRange()
+		if !ok {
+			return nil, fmt.Errorf("color set %s is infinite", cs.Name())
+		}
+		for v := minVal; v <= maxVal; v++ {
+			values = append(values, v)
+		}
+	case *BooleanColorSet:
+		values = []interface{}{false, true}
+	case *UnitColorSet:
+		values = []interface{}{pnmlUnitToken}
+	default:
+		return nil, fmt.Errorf("cannot enumerate color set %s", cs.Name())
+	}
+	return values, nil
+}
@@ -0,0 +1,583 @@
+package models
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	unitTerm     = regexp.MustCompile(`^(?:(\d+)')?\s*(?:"\(\)"|'\(\)')$`)
+	variableTerm = regexp.MustCompile(`^(?:(\d+)')?\s*([A-Za-z_]\w*)$`)
+)
+
+// pnmlExporter holds the state of a PNML export
+type pnmlExporter struct {
+	cpn       *CPN
+	report    *ConversionReport
+	sorts     map[string]bool // color sets declared as named sorts
+	sortNodes []*pnmlNode
+	variables map[string]string // variable name -> color set name
+	textOnly  int
+}
+
+// CPNToPNML converts a CPN to a PNML document. Nets whose places are all of a unit color set and
+// whose inscriptions are unit multisets become P/T nets, all others high-level nets.
+func (p *CPNParser) CPNToPNML(cpn *CPN) ([]byte, *ConversionReport, error) {
+	exp := &pnmlExporter{
+		cpn:       cpn,
+		report:    NewConversionReport("pnml"),
+		sorts:     make(map[string]bool),
+		variables: make(map[string]string),
+	}
+	pt := isPTNet(cpn)
+	netType := pnmlTypeHL
+	if pt {
+		netType = pnmlTypePT
+	}
+
+	data := pnmlNetData{
+		Description:        cpn.Description,
+		Declarations:       cpn.Declarations,
+		EndPlaces:          cpn.EndPlaces,
+		ConflictResolution: cpn.ConflictResolution.Clone(),
+		Monitors:           cpn.Monitors,
+	}
+	for _, cs := range exportedColorSets(cpn) {
+		data.ColorSets = append(data.ColorSets, cs.String()+";")
+	}
+	if p.colorSetParser != nil {
+		data.JsonSchemas = p.colorSetParser.GetOriginalJsonSchemas()
+	}
+	for _, sw := range cpn.SubWorkflows {
+		if sw == nil {
+			continue
+		}
+		data.SubWorkflows = append(data.SubWorkflows, SubWorkflowJSON{
+			ID:                  sw.ID,
+			CPNID:               sw.CPNID,
+			CallTransitionID:    sw.CallTransitionID,
+			AutoStart:           sw.AutoStart,
+			PropagateOnComplete: sw.PropagateOnComplete,
+			InputMapping:        sw.InputMapping,
+			OutputMapping:       sw.OutputMapping,
+		})
+	}
+	netData, err := pnmlToolNode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cpn.Declarations != "" || len(cpn.Monitors) > 0 || len(data.SubWorkflows) > 0 || cpn.ConflictResolution != nil {
+		exp.report.Add(cpn.ID, "declarations, monitors, sub workflows and conflict resolution are kept as %s tool-specific data only", pnmlTool)
+	}
+
+	net := newPNMLNode("net", "id", cpn.ID, "type", netType).add(pnmlName(cpn.Name), netData)
+	if !pt {
+		net.add(exp.declarations())
+	}
+	page := newPNMLNode("page", "id", cpn.ID+"_page")
+	for _, place := range cpn.Places {
+		node, err := exp.place(place, pt)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.add(node)
+	}
+	extras := 0
+	for _, transition := range cpn.Transitions {
+		node, extra, err := exp.transition(transition)
+		if err != nil {
+			return nil, nil, err
+		}
+		if extra {
+			extras++
+		}
+		page.add(node)
+	}
+	for _, arc := range cpn.Arcs {
+		node, err := exp.arc(arc, pt)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.add(node)
+	}
+	net.add(page)
+
+	if extras > 0 {
+		exp.report.Add(cpn.ID, "actions, kinds, delays, priorities, weights and forms of %d transitions are kept as %s tool-specific data only", extras, pnmlTool)
+	}
+	if exp.textOnly > 0 {
+		exp.report.Add(cpn.ID, "%d inscriptions and conditions have no PNML term structure and are exported as text only", exp.textOnly)
+	}
+
+	doc := &pnmlNode{
+		XMLName: xml.Name{Local: "pnml"},
+		Attrs:   []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: pnmlNamespace}},
+	}
+	doc.add(net)
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write PNML: %v", err)
+	}
+	return append([]byte(xml.Header), out...), exp.report, nil
+}
+
+// isPTNet reports whether a CPN can be written as a P/T net
+func isPTNet(cpn *CPN) bool {
+	for _, place := range cpn.Places {
+		if _, ok := place.ColorSet.(*UnitColorSet); !ok {
+			return false
+		}
+	}
+	for _, transition := range cpn.Transitions {
+		if transition.GuardExpression != "" {
+			return false
+		}
+	}
+	for _, arc := range cpn.Arcs {
+		if _, ok := unitWeight(arc.Expression); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// unitWeight returns the number of unit tokens of an inscription like "()" or 2'"()" ++ 1'"()"
+func unitWeight(expr string) (int, bool) {
+	weight := 0
+	for _, term := range strings.Split(expr, "++") {
+		m := unitTerm.FindStringSubmatch(strings.TrimSpace(term))
+		if m == nil {
+			return 0, false
+		}
+		count := 1
+		if m[1] != "" {
+			count, _ = strconv.Atoi(m[1])
+		}
+		weight += count
+	}
+	return weight, weight > 0
+}
+
+// exportedColorSets returns the color sets of the places with the color sets they depend on,
+// dependencies first. Built-in color sets are left out.
+func exportedColorSets(cpn *CPN) []ColorSet {
+	var result []ColorSet
+	seen := make(map[string]bool)
+	var visit func(cs ColorSet)
+	visit = func(cs ColorSet) {
+		if cs == nil || seen[cs.Name()] {
+			return
+		}
+		seen[cs.Name()] = true
+		for _, dependency := range colorSetDependencies(cs) {
+			visit(dependency)
+		}
+		switch cs {
+		case INT, STRING, BOOL, REAL, UNIT:
+			return
+		}
+		result = append(result, cs)
+	}
+	for _, place := range cpn.Places {
+		visit(place.ColorSet)
+	}
+	return result
+}
+
+// colorSetDependencies returns the color sets a color set is built from
+func colorSetDependencies(cs ColorSet) []ColorSet {
+	switch c := cs.(type) {
+	case *ProductColorSet:
+		return c.GetComponents()
+	case *ListColorSet:
+		return []ColorSet{c.GetElement()}
+	case *SubsetColorSet:
+		return []ColorSet{c.GetBase()}
+	case *RecordColorSet:
+		var dependencies []ColorSet
+		for _, field := range c.GetFields() {
+			dependencies = append(dependencies, field.ColorSet)
+		}
+		return dependencies
+	case *UnionColorSet:
+		var dependencies []ColorSet
+		for _, variant := range c.GetVariants() {
+			if variant.ColorSet != nil {
+				dependencies = append(dependencies, variant.ColorSet)
+			}
+		}
+		return dependencies
+	}
+	return nil
+}
+
+func pnmlName(name string) *pnmlNode {
+	return newPNMLNode("name").add(pnmlText(name))
+}
+
+func pnmlText(text string) *pnmlNode {
+	node := newPNMLNode("text")
+	node.Text = text
+	return node
+}
+
+// pnmlToolNode wraps data in a go-petri-flow <toolspecific> element
+func pnmlToolNode(data interface{}) (*pnmlNode, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s data: %v", pnmlTool, err)
+	}
+	node := newPNMLNode("toolspecific", "tool", pnmlTool, "version", pnmlToolVersion)
+	node.Text = string(raw)
+	return node, nil
+}
+
+func pnmlGraphics(position *Position) *pnmlNode {
+	if position == nil {
+		return nil
+	}
+	return newPNMLNode("graphics").add(newPNMLNode("position",
+		"x", strconv.FormatFloat(float64(position.X), 'f', -1, 32),
+		"y", strconv.FormatFloat(float64(position.Y), 'f', -1, 32)))
+}
+
+func sortID(name string) string {
+	return "sort_" + name
+}
+
+func usersort(name string) *pnmlNode {
+	return newPNMLNode("usersort", "declaration", sortID(name))
+}
+
+func pnmlSubterm(term *pnmlNode) *pnmlNode {
+	return newPNMLNode("subterm").add(term)
+}
+
+// declarations declares the sorts of the places and the variables of the input arcs
+func (exp *pnmlExporter) declarations() *pnmlNode {
+	for _, place := range exp.cpn.Places {
+		exp.declareSort(place.ColorSet)
+	}
+
+	// Variables are inferred from input arcs that bind a plain variable
+	var variableNodes []*pnmlNode
+	for _, arc := range exp.cpn.Arcs {
+		if !arc.IsInputArc() {
+			continue
+		}
+		m := variableTerm.FindStringSubmatch(strings.TrimSpace(arc.Expression))
+		if m == nil || m[2] == "true" || m[2] == "false" || m[2] == "nil" {
+			continue
+		}
+		place := exp.cpn.GetPlace(arc.GetPlaceID())
+		if place == nil || !exp.sorts[place.ColorSet.Name()] {
+			continue
+		}
+		name, sort := m[2], place.ColorSet.Name()
+		if declared, ok := exp.variables[name]; ok {
+			if declared != sort {
+				exp.report.Add(arc.ID, "variable %s is bound to both %s and %s; declared as %s", name, declared, sort, declared)
+			}
+			continue
+		}
+		exp.variables[name] = sort
+		variableNodes = append(variableNodes, newPNMLNode("variabledecl", "id", "var_"+name, "name", name).add(usersort(sort)))
+	}
+
+	declarations := newPNMLNode("declarations").add(exp.sortNodes...).add(variableNodes...)
+	return newPNMLNode("declaration").add(newPNMLNode("structure").add(declarations))
+}
+
+// declareSort declares a color set and its components as named sorts. It returns false if the
+// color set has no PNML sort.
+func (exp *pnmlExporter) declareSort(cs ColorSet) bool {
+	name := cs.Name()
+	if declared, ok := exp.sorts[name]; ok {
+		return declared
+	}
+	exp.sorts[name] = false
+	var sort *pnmlNode
+	switch c := cs.(type) {
+	case *UnitColorSet:
+		sort = newPNMLNode("dot")
+	case *BooleanColorSet:
+		sort = newPNMLNode("bool")
+	case *StringColorSet:
+		sort = newPNMLNode("string")
+	case *IntegerColorSet:
+		if minVal, maxVal, ok := c.GetRange(); ok {
+			sort = newPNMLNode("finiteintrange", "start", strconv.Itoa(minVal), "end", strconv.Itoa(maxVal))
+		} else {
+			sort = newPNMLNode("integer")
+		}
+	case *EnumeratedColorSet:
+		sort = newPNMLNode("finiteenumeration")
+		for _, v := range c.GetValues() {
+			sort.add(newPNMLNode("feconstant", "id", sortID(name)+"_"+v, "name", v))
+		}
+	case *ProductColorSet:
+		sort = newPNMLNode("productsort")
+		for _, component := range c.GetComponents() {
+			if !exp.declareSort(component) {
+				exp.report.Add(name, "component %s of color set %s has no PNML sort", component.Name(), name)
+				return false
+			}
+			sort.add(usersort(component.Name()))
+		}
+	case *ListColorSet:
+		if !exp.declareSort(c.GetElement()) {
+			exp.report.Add(name, "element color set %s of color set %s has no PNML sort", c.GetElement().Name(), name)
+			return false
+		}
+		if minLength, maxLength := c.GetLength(); minLength > 0 || maxLength >= 0 {
+			exp.report.Add(name, "length bounds of list color set %s are not exported", name)
+		}
+		sort = newPNMLNode("list").add(usersort(c.GetElement().Name()))
+	default:
+		exp.report.Add(name, "color set %s (%s) has no PNML sort; it is kept as %s tool-specific data", name, strings.TrimPrefix(cs.String(), "colset "+name+" = "), pnmlTool)
+		return false
+	}
+	if cs.IsTimed() {
+		exp.report.Add(name, "timed color set %s is exported as an untimed sort", name)
+	}
+	exp.sorts[name] = true
+	exp.sortNodes = append(exp.sortNodes, newPNMLNode("namedsort", "id", sortID(name), "name", name).add(sort))
+	return true
+}
+
+func (exp *pnmlExporter) place(place *Place, pt bool) (*pnmlNode, error) {
+	node := newPNMLNode("place", "id", place.ID).add(pnmlName(place.Name), pnmlGraphics(place.Position))
+	tokens := exp.cpn.InitialMarking[place.ID]
+	var data pnmlPlaceData
+	timestamps := false
+	for _, token := range tokens {
+		timestamps = timestamps || token.Timestamp != 0
+	}
+
+	if place.ColorSet.Name() != UNIT.Name() || !pt {
+		data.ColorSet = place.ColorSet.Name()
+	}
+	if pt {
+		if len(tokens) > 0 {
+			node.add(newPNMLNode("initialMarking").add(pnmlText(strconv.Itoa(len(tokens)))))
+		}
+		if timestamps {
+			data.Tokens = tokenDefinitions(tokens)
+		}
+	} else {
+		typ := newPNMLNode("type").add(pnmlText(place.ColorSet.Name()))
+		if exp.sorts[place.ColorSet.Name()] {
+			typ.add(newPNMLNode("structure").add(usersort(place.ColorSet.Name())))
+		}
+		node.add(typ)
+		if len(tokens) > 0 {
+			node.add(exp.marking(place, tokens))
+			data.Tokens = tokenDefinitions(tokens)
+		}
+	}
+
+	if data.ColorSet != "" || data.Tokens != nil {
+		tool, err := pnmlToolNode(data)
+		if err != nil {
+			return nil, err
+		}
+		node.add(tool)
+	}
+	return node, nil
+}
+
+func tokenDefinitions(tokens []*Token) []TokenJSON {
+	definitions := make([]TokenJSON, len(tokens))
+	for i, token := range tokens {
+		definitions[i] = TokenJSON{Value: token.Value, Timestamp: token.Timestamp}
+	}
+	return definitions
+}
+
+// marking writes a high-level initial marking as n'v ++ ... text and, if every value has a
+// PNML term, as a term
+func (exp *pnmlExporter) marking(place *Place, tokens []*Token) *pnmlNode {
+	var values []interface{}
+	for _, token := range tokens {
+		values = append(values, token.Value)
+	}
+	groups := groupTokens(values)
+
+	var texts []string
+	var terms []*pnmlNode
+	structured := exp.sorts[place.ColorSet.Name()]
+	for _, group := range groups {
+		texts = append(texts, fmt.Sprintf("%d'%s", group.Count, luaLiteral(group.Value)))
+		term := valueTerm(place.ColorSet, group.Value)
+		if term == nil {
+			structured = false
+			continue
+		}
+		terms = append(terms, newPNMLNode("numberof").add(
+			pnmlSubterm(newPNMLNode("numberconstant", "value", strconv.Itoa(group.Count)).add(newPNMLNode("positive"))),
+			pnmlSubterm(term)))
+	}
+
+	marking := newPNMLNode("hlinitialMarking").add(pnmlText(strings.Join(texts, " ++ ")))
+	if !structured {
+		exp.report.Add(place.ID, "initial marking has no PNML term and is exported as text and %s tool-specific data", pnmlTool)
+		return marking
+	}
+	term := terms[0]
+	if len(terms) > 1 {
+		term = newPNMLNode("add")
+		for _, t := range terms {
+			term.add(pnmlSubterm(t))
+		}
+	}
+	return marking.add(newPNMLNode("structure").add(term))
+}
+
+// valueTerm returns the PNML term of a value of a color set, or nil if there is none
+func valueTerm(cs ColorSet, value interface{}) *pnmlNode {
+	if !cs.IsMember(value) {
+		return nil
+	}
+	switch c := cs.(type) {
+	case *UnitColorSet:
+		return newPNMLNode("dotconstant")
+	case *BooleanColorSet:
+		return newPNMLNode("booleanconstant", "value", strconv.FormatBool(value.(bool)))
+	case *StringColorSet:
+		node := newPNMLNode("value")
+		node.Text = value.(string)
+		return newPNMLNode("stringconstant").add(node, newPNMLNode("string"))
+	case *IntegerColorSet:
+		v := fmt.Sprint(value)
+		if minVal, maxVal, ok := c.GetRange(); ok {
+			return newPNMLNode("finiteintrangeconstant", "value", v).add(
+				newPNMLNode("finiteintrange", "start", strconv.Itoa(minVal), "end", strconv.Itoa(maxVal)))
+		}
+		return newPNMLNode("numberconstant", "value", v).add(newPNMLNode("integer"))
+	case *EnumeratedColorSet:
+		return newPNMLNode("useroperator", "declaration", sortID(cs.Name())+"_"+value.(string))
+	case *ProductColorSet:
+		components, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		tuple := newPNMLNode("tuple")
+		for i, component := range c.GetComponents() {
+			term := valueTerm(component, components[i])
+			if term == nil {
+				return nil
+			}
+			tuple.add(pnmlSubterm(term))
+		}
+		return tuple
+	}
+	return nil
+}
+
+// luaLiteral formats a token value as an inscription literal
+func luaLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		var components []string
+		for _, c := range v {
+			components = append(components, luaLiteral(c))
+		}
+		return "tuple(" + strings.Join(components, ", ") + ")"
+	case map[string]interface{}:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+	return fmt.Sprint(value)
+}
+
+// transition writes a transition; extra is true if it has data without a PNML counterpart
+func (exp *pnmlExporter) transition(transition *Transition) (*pnmlNode, bool, error) {
+	node := newPNMLNode("transition", "id", transition.ID).add(pnmlName(transition.Name), pnmlGraphics(transition.Position))
+	if transition.GuardExpression != "" {
+		exp.textOnly++
+		node.add(newPNMLNode("condition").add(pnmlText(transition.GuardExpression)))
+	}
+	data := TransitionJSON{
+		ID:               transition.ID,
+		Name:             transition.Name,
+		Variables:        transition.Variables,
+		TransitionDelay:  transition.TransitionDelay,
+		Kind:             string(transition.Kind),
+		ActionExpression: transition.ActionExpression,
+		FormSchema:       transition.FormSchema,
+		LayoutSchema:     transition.LayoutSchema,
+		Priority:         transition.priorityJSON(),
+		Weight:           transition.weightJSON(),
+		BindingWeight:    transition.BindingWeight,
+	}
+	tool, err := pnmlToolNode(data)
+	if err != nil {
+		return nil, false, err
+	}
+	extra := transition.Kind != TransitionKindAuto || transition.ActionExpression != "" || transition.TransitionDelay != 0 ||
+		transition.Priority != PriorityNormal || transition.Weight != 1 || transition.BindingWeight != "" ||
+		transition.FormSchema != "" || transition.LayoutSchema != ""
+	return node.add(tool), extra, nil
+}
+
+func (exp *pnmlExporter) arc(arc *Arc, pt bool) (*pnmlNode, error) {
+	node := newPNMLNode("arc", "id", arc.ID, "source", arc.SourceID, "target", arc.TargetID)
+	if pt {
+		if weight, _ := unitWeight(arc.Expression); weight != 1 {
+			node.add(newPNMLNode("inscription").add(pnmlText(strconv.Itoa(weight))))
+		}
+	} else {
+		inscription := newPNMLNode("hlinscription").add(pnmlText(arc.Expression))
+		if term := exp.inscriptionTerm(arc.Expression); term != nil {
+			inscription.add(newPNMLNode("structure").add(term))
+		} else {
+			exp.textOnly++
+		}
+		node.add(inscription)
+	}
+	if arc.Multiplicity > 1 {
+		tool, err := pnmlToolNode(pnmlArcData{Multiplicity: arc.Multiplicity})
+		if err != nil {
+			return nil, err
+		}
+		node.add(tool)
+		exp.report.Add(arc.ID, "arc multiplicity %d is kept as %s tool-specific data only", arc.Multiplicity, pnmlTool)
+	}
+	return node, nil
+}
+
+// inscriptionTerm returns the PNML term of an inscription made of declared variables, e.g.
+// x or 2'x ++ 1'y, or nil for any other inscription
+func (exp *pnmlExporter) inscriptionTerm(expr string) *pnmlNode {
+	var terms []*pnmlNode
+	for _, part := range strings.Split(expr, "++") {
+		m := variableTerm.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil
+		}
+		if _, ok := exp.variables[m[2]]; !ok {
+			return nil
+		}
+		term := newPNMLNode("variable", "refvariable", "var_"+m[2])
+		if m[1] != "" {
+			term = newPNMLNode("numberof").add(
+				pnmlSubterm(newPNMLNode("numberconstant", "value", m[1]).add(newPNMLNode("positive"))),
+				pnmlSubterm(term))
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	sum := newPNMLNode("add")
+	for _, t := range terms {
+		sum.add(pnmlSubterm(t))
+	}
+	return sum
+}
@@ -7,3 +7,12 @@ type Position struct {
 	X float32 `json:"x"`
 	Y float32 `json:"y"`
 }
+
+// Clone returns a copy of the position, nil if it is nil
+func (p *Position) Clone() *Position {
+	if p == nil {
+		return nil
+	}
+	clone := *p
+	return &clone
+}
@@ -0,0 +1,277 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// RenderFormat selects the output of RenderCPN
+type RenderFormat string
+
+const (
+	RenderFormatDOT RenderFormat = "dot" // Graphviz DOT source
+	RenderFormatSVG RenderFormat = "svg" // standalone SVG document
+)
+
+// RenderState is the live state drawn on a rendered net
+type RenderState struct {
+	Marking *Marking        // tokens shown on places (nil = none)
+	Enabled map[string]bool // IDs of the enabled transitions, highlighted
+}
+
+const (
+	renderPlaceRadius      = 24
+	renderTransitionWidth  = 60
+	renderTransitionHeight = 36
+	renderMargin           = 80
+	renderMaxLabel         = 40
+	renderEnabledFill      = "#c8f7c5"
+	renderEnabledStroke    = "#2e7d32"
+)
+
+// RenderCPN draws a CPN with its marking and enabled transitions. Places and transitions are drawn
+// at their positions when every node has one, otherwise the whole net is laid out by AutoLayout.
+func RenderCPN(cpn *CPN, state *RenderState, format RenderFormat) ([]byte, error) {
+	if state == nil {
+		state = &RenderState{}
+	}
+	switch format {
+	case RenderFormatDOT:
+		return []byte(renderDOT(cpn, state)), nil
+	case RenderFormatSVG:
+		return []byte(renderSVG(cpn, state)), nil
+	default:
+		return nil, fmt.Errorf("unsupported render format %q (expected dot or svg)", format)
+	}
+}
+
+// NetLayout returns the position of every place and transition: the stored positions when all
+// nodes have one, otherwise the positions computed by AutoLayout
+func NetLayout(cpn *CPN) map[string]Position {
+	if !hasAllPositions(cpn) {
+		return AutoLayout(cpn)
+	}
+	positions := make(map[string]Position, len(cpn.Places)+len(cpn.Transitions))
+	for _, place := range cpn.Places {
+		positions[place.ID] = *place.Position
+	}
+	for _, transition := range cpn.Transitions {
+		positions[transition.ID] = *transition.Position
+	}
+	return positions
+}
+
+// placeTokens returns the token count of a place and its values, shortened to renderMaxLabel
+func placeTokens(state *RenderState, placeID string) (int, string) {
+	if state.Marking == nil || state.Marking.CountTokens(placeID) == 0 {
+		return 0, ""
+	}
+	return state.Marking.CountTokens(placeID), shorten(state.Marking.GetMultiset(placeID).String())
+}
+
+// shorten cuts a label to renderMaxLabel characters
+func shorten(label string) string {
+	runes := []rune(label)
+	if len(runes) <= renderMaxLabel {
+		return label
+	}
+	return string(runes[:renderMaxLabel-1]) + "…"
+}
+
+// substitutionTransitions returns the IDs of the transitions linked to a sub workflow
+func substitutionTransitions(cpn *CPN) map[string]bool {
+	ids := make(map[string]bool)
+	for _, sw := range cpn.SubWorkflows {
+		if sw != nil {
+			ids[sw.CallTransitionID] = true
+		}
+	}
+	return ids
+}
+
+// renderDOT writes a CPN as a Graphviz digraph. Nodes are pinned to their layout positions, so
+// the graph is meant for neato (set as the graph layout); DOT's y axis points up.
+func renderDOT(cpn *CPN, state *RenderState) string {
+	positions := NetLayout(cpn)
+	substitutions := substitutionTransitions(cpn)
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(cpn.ID))
+	fmt.Fprintf(&b, "  graph [layout=neato, splines=true, overlap=false, label=%s, labelloc=t];\n", dotQuote(cpn.Name))
+	b.WriteString("  node [fontname=\"Helvetica\", fontsize=10];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=9];\n")
+	for _, place := range cpn.Places {
+		label := place.Name
+		if count, values := placeTokens(state, place.ID); count > 0 {
+			label += fmt.Sprintf("\n%d: %s", count, values)
+		}
+		attrs := []string{"shape=ellipse", "label=" + dotQuote(label), dotPosition(positions[place.ID])}
+		if place.ColorSet != nil {
+			attrs = append(attrs, "xlabel="+dotQuote(place.ColorSet.Name()))
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(place.ID), strings.Join(attrs, ", "))
+	}
+	for _, transition := range cpn.Transitions {
+		label := transition.Name
+		if transition.HasGuard() {
+			label += "\n[" + shorten(transition.GuardExpression) + "]"
+		}
+		attrs := []string{"shape=box", "label=" + dotQuote(label), dotPosition(positions[transition.ID])}
+		if state.Enabled[transition.ID] {
+			attrs = append(attrs, "style=\"filled,bold\"", "fillcolor=\""+renderEnabledFill+"\"", "color=\""+renderEnabledStroke+"\"")
+		}
+		if substitutions[transition.ID] {
+			attrs = append(attrs, "peripheries=2")
+		}
+		if !transition.IsAuto() {
+			attrs = append(attrs, "xlabel="+dotQuote(string(transition.Kind)))
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(transition.ID), strings.Join(attrs, ", "))
+	}
+	for _, arc := range cpn.Arcs {
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(arc.SourceID), dotQuote(arc.TargetID))
+		if arc.Expression != "" {
+			fmt.Fprintf(&b, " [label=%s]", dotQuote(shorten(arc.Expression)))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote returns s as a quoted DOT ID; newlines become centered line breaks
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// dotPosition returns the pinned position attribute of a node in points
+func dotPosition(pos Position) string {
+	return fmt.Sprintf("pos=\"%g,%g!\"", pos.X, -pos.Y)
+}
+
+// renderSVG draws a CPN as a standalone SVG document: places are circles with their token count,
+// transitions boxes, enabled transitions highlighted and arcs arrows labeled with their inscription
+func renderSVG(cpn *CPN, state *RenderState) string {
+	positions := NetLayout(cpn)
+	substitutions := substitutionTransitions(cpn)
+	isPlace := make(map[string]bool)
+	for _, place := range cpn.Places {
+		isPlace[place.ID] = true
+	}
+
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, pos := range positions {
+		minX, maxX = math.Min(minX, float64(pos.X)), math.Max(maxX, float64(pos.X))
+		minY, maxY = math.Min(minY, float64(pos.Y)), math.Max(maxY, float64(pos.Y))
+	}
+	if len(positions) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+	minX, minY = minX-renderMargin, minY-renderMargin
+	width, height := maxX+renderMargin-minX, maxY+renderMargin-minY
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="%g %g %g %g" font-family="Helvetica, Arial, sans-serif" font-size="11">`+"\n",
+		width, height, minX, minY, width, height)
+	fmt.Fprintf(&b, "<title>%s</title>\n", xmlEscape(cpn.Name))
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="#333"/></marker></defs>` + "\n")
+
+	for _, arc := range cpn.Arcs {
+		from, ok1 := positions[arc.SourceID]
+		to, ok2 := positions[arc.TargetID]
+		if !ok1 || !ok2 {
+			continue
+		}
+		x1, y1 := clipToNode(from, to, isPlace[arc.SourceID])
+		x2, y2 := clipToNode(to, from, isPlace[arc.TargetID])
+		fmt.Fprintf(&b, `<g class="arc" id="%s"><line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#333" marker-end="url(#arrow)"/>`,
+			xmlEscape(arc.ID), x1, y1, x2, y2)
+		if arc.Expression != "" {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#1a237e">%s</text>`,
+				(x1+x2)/2, (y1+y2)/2-4, xmlEscape(shorten(arc.Expression)))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	for _, place := range cpn.Places {
+		pos := positions[place.ID]
+		fmt.Fprintf(&b, `<g class="place" id="%s"><circle cx="%g" cy="%g" r="%d" fill="#fff" stroke="#333"/>`,
+			xmlEscape(place.ID), pos.X, pos.Y, renderPlaceRadius)
+		if place.ColorSet != nil {
+			fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle" font-size="9" fill="#555">%s</text>`,
+				pos.X, pos.Y-renderPlaceRadius-6, xmlEscape(place.ColorSet.Name()))
+		}
+		count, values := placeTokens(state, place.ID)
+		if count > 0 {
+			fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle" font-weight="bold">%d</text>`, pos.X, pos.Y+4, count)
+		}
+		fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle">%s</text>`, pos.X, pos.Y+renderPlaceRadius+14, xmlEscape(place.Name))
+		if values != "" {
+			fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle" fill="#b71c1c">%s</text>`, pos.X, pos.Y+renderPlaceRadius+28, xmlEscape(values))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	for _, transition := range cpn.Transitions {
+		pos := positions[transition.ID]
+		fill, stroke, strokeWidth := "#eee", "#333", 1
+		if state.Enabled[transition.ID] {
+			fill, stroke, strokeWidth = renderEnabledFill, renderEnabledStroke, 3
+		}
+		class := "transition"
+		if state.Enabled[transition.ID] {
+			class += " enabled"
+		}
+		fmt.Fprintf(&b, `<g class="%s" id="%s"><rect x="%g" y="%g" width="%d" height="%d" fill="%s" stroke="%s" stroke-width="%d"/>`,
+			class, xmlEscape(transition.ID), pos.X-renderTransitionWidth/2, pos.Y-renderTransitionHeight/2,
+			renderTransitionWidth, renderTransitionHeight, fill, stroke, strokeWidth)
+		if substitutions[transition.ID] {
+			fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%d" height="%d" fill="none" stroke="%s"/>`,
+				pos.X-renderTransitionWidth/2+3, pos.Y-renderTransitionHeight/2+3, renderTransitionWidth-6, renderTransitionHeight-6, stroke)
+		}
+		if !transition.IsAuto() {
+			fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle" font-size="9" fill="#555">%s</text>`, pos.X, pos.Y+4, xmlEscape(string(transition.Kind)))
+		}
+		fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle">%s</text>`, pos.X, pos.Y+renderTransitionHeight/2+14, xmlEscape(transition.Name))
+		if transition.HasGuard() {
+			fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle" fill="#4a148c">[%s]</text>`,
+				pos.X, pos.Y+renderTransitionHeight/2+28, xmlEscape(shorten(transition.GuardExpression)))
+		}
+		b.WriteString("</g>\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// clipToNode returns where the line from a node's center towards another point leaves the node's
+// circle (places) or box (transitions)
+func clipToNode(node, towards Position, place bool) (float64, float64) {
+	x, y := float64(node.X), float64(node.Y)
+	dx, dy := float64(towards.X)-x, float64(towards.Y)-y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return x, y
+	}
+	if place {
+		return x + dx/length*renderPlaceRadius, y + dy/length*renderPlaceRadius
+	}
+	scale := math.Inf(1)
+	if dx != 0 {
+		scale = math.Abs(renderTransitionWidth / 2 / dx)
+	}
+	if dy != 0 {
+		scale = math.Min(scale, math.Abs(renderTransitionHeight/2/dy))
+	}
+	return x + dx*scale, y + dy*scale
+}
+
+// xmlEscape escapes text for XML content and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -12,6 +12,15 @@ const (
 	TransitionKindLLM     TransitionKind = "LLM"
 )
 
+// Transition priorities follow CPN Tools conventions: a lower value means a higher
+// priority, and a transition is only enabled when no transition with a strictly
+// higher priority is enabled in the same marking.
+const (
+	PriorityHigh   = 100
+	PriorityNormal = 1000
+	PriorityLow    = 10000
+)
+
 // Transition represents a transition in the CPN
 type Transition struct {
 	ID               string         `json:"id"`
@@ -24,6 +33,9 @@ type Transition struct {
 	ActionExpression string         `json:"actionExpression,omitempty"` // Optional Lua action executed when firing (after inputs consumed, before outputs)
 	FormSchema       string         `json:"formSchema,omitempty"`       // Name of JSON Schema for manual transition form
 	LayoutSchema     string         `json:"layoutSchema,omitempty"`     // Name of JSON Schema for manual transition layout/UX
+	Priority         int            `json:"priority"`                   // Lower value = higher priority (default PriorityNormal)
+	Weight           float64        `json:"weight"`                     // Relative weight for weighted conflict resolution (default 1, 0 = never chosen while others are enabled)
+	BindingWeight    string         `json:"bindingWeight,omitempty"`    // Optional Lua expression weighting each binding for weighted binding selection
 }
 
 // NewTransition creates a new transition with the given parameters
@@ -39,6 +51,8 @@ func NewTransition(id, name string) *Transition {
 		ActionExpression: "",
 		FormSchema:       "",
 		LayoutSchema:     "",
+		Priority:         PriorityNormal,
+		Weight:           1,
 	}
 }
 
@@ -54,6 +68,8 @@ func NewTransitionWithGuard(id, name, guardExpression string, variables []string
 		ActionExpression: "",
 		FormSchema:       "",
 		LayoutSchema:     "",
+		Priority:         PriorityNormal,
+		Weight:           1,
 	}
 }
 
@@ -73,6 +89,34 @@ func (t *Transition) SetKind(kind TransitionKind) {
 	t.Kind = kind
 }
 
+// SetPriority sets the transition priority (lower value = higher priority)
+func (t *Transition) SetPriority(priority int) {
+	t.Priority = priority
+}
+
+// GetWeight returns the weight used by weighted conflict resolution (negative weights count as 0)
+func (t *Transition) GetWeight() float64 {
+	if t.Weight < 0 {
+		return 0
+	}
+	return t.Weight
+}
+
+// priorityJSON returns the priority of the transition for its JSON definition
+func (t *Transition) priorityJSON() *int {
+	priority := t.Priority
+	return &priority
+}
+
+// weightJSON returns the weight of the transition for its JSON definition, nil for the default weight
+func (t *Transition) weightJSON() *float64 {
+	if t.Weight == 1 {
+		return nil
+	}
+	weight := t.Weight
+	return &weight
+}
+
 // SetAction sets the action expression for the transition
 func (t *Transition) SetAction(action string) {
 	t.ActionExpression = action
@@ -112,8 +156,8 @@ func (t *Transition) String() string {
 	if t.HasGuard() {
 		guard = t.GuardExpression
 	}
-	return fmt.Sprintf("Transition{ID: %s, Name: %s, Guard: %s, Delay: %d, Kind: %s}",
-		t.ID, t.Name, guard, t.TransitionDelay, t.Kind)
+	return fmt.Sprintf("Transition{ID: %s, Name: %s, Guard: %s, Delay: %d, Kind: %s, Priority: %d}",
+		t.ID, t.Name, guard, t.TransitionDelay, t.Kind, t.Priority)
 }
 
 // Clone creates a copy of the transition
@@ -128,8 +172,12 @@ func (t *Transition) Clone() *Transition {
 		Variables:        variables,
 		TransitionDelay:  t.TransitionDelay,
 		Kind:             t.Kind,
+		Position:         t.Position.Clone(),
 		ActionExpression: t.ActionExpression,
 		FormSchema:       t.FormSchema,
 		LayoutSchema:     t.LayoutSchema,
+		Priority:         t.Priority,
+		Weight:           t.Weight,
+		BindingWeight:    t.BindingWeight,
 	}
 }
@@ -532,6 +532,56 @@ func (m *Manager) GetWorkItemCount() int {
 
 // CreateWorkItemsForCase creates work items for all manual transitions in a case
 func (m *Manager) CreateWorkItemsForCase(caseID string) ([]*models.WorkItem, error) {
+	return m.createWorkItemsForCase(caseID, func(transitionID string, index int) string {
+		return fmt.Sprintf("%s-%s-%d", caseID, transitionID, index)
+	})
+}
+
+// RederiveWorkItemsForCase cancels the open work items of a case and, if the case is running,
+// creates work items for the manual transitions enabled in its marking. Used after a case migrated
+// to another version of its CPN, whose transitions and bindings the old work items do not refer
+// to. Re-derived work items are named after that version, so they do not clash with cancelled ones.
+func (m *Manager) RederiveWorkItemsForCase(caseID string) ([]*models.WorkItem, []*models.WorkItem, error) {
+	m.mutex.Lock()
+	var cancelled []*models.WorkItem
+	for _, workItem := range m.workItems {
+		if workItem.CaseID == caseID && !workItem.IsTerminated() {
+			workItem.Cancel()
+			cancelled = append(cancelled, workItem.Clone())
+		}
+	}
+	m.mutex.Unlock()
+	sort.Slice(cancelled, func(i, j int) bool { return cancelled[i].ID < cancelled[j].ID })
+	
+	case_, err := m.caseManager.GetCase(caseID)
+	if err != nil {
+		return cancelled, nil, err
+	}
+	if case_.Status != models.CaseStatusRunning {
+		return cancelled, nil, nil
+	}
+	created, err := m.createWorkItemsForCase(caseID, func(transitionID string, index int) string {
+		workItemID := fmt.Sprintf("%s-%s-%d-v%d", caseID, transitionID, index, case_.CPNVersion)
+		// Cases migrated back and forth derive work items for a version more than once
+		for n := 2; m.exists(workItemID); n++ {
+			workItemID = fmt.Sprintf("%s-%s-%d-v%d-%d", caseID, transitionID, index, case_.CPNVersion, n)
+		}
+		return workItemID
+	})
+	return cancelled, created, err
+}
+
+// exists reports whether a work item ID is taken
+func (m *Manager) exists(workItemID string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	_, exists := m.workItems[workItemID]
+	return exists
+}
+
+// createWorkItemsForCase creates a work item with the given ID for each binding of the enabled
+// manual transitions of a case, skipping IDs that exist
+func (m *Manager) createWorkItemsForCase(caseID string, workItemIDFor func(transitionID string, index int) string) ([]*models.WorkItem, error) {
 	// Get enabled transitions for the case
 	enabledTransitions, bindingsMap, err := m.caseManager.GetEnabledTransitions(caseID)
 	if err != nil {
@@ -547,10 +597,10 @@ func (m *Manager) CreateWorkItemsForCase(caseID string) ([]*models.WorkItem, err
 			
 			// Create a work item for each binding
 			for i := range bindings {
-				workItemID := fmt.Sprintf("%s-%s-%d", caseID, transition.ID, i)
+				workItemID := workItemIDFor(transition.ID, i)
 				
 				// Check if work item already exists
-				if _, exists := m.workItems[workItemID]; exists {
+				if m.exists(workItemID) {
 					continue
 				}
 				
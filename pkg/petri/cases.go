@@ -0,0 +1,307 @@
+package petri
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go-petri-flow/internal/models"
+)
+
+// caseStatus returns the status of a case, or "" if it does not exist; the lock must be held
+func (r *Runtime) caseStatus(caseID string) models.CaseStatus {
+	case_, err := r.cases.GetCase(caseID)
+	if err != nil {
+		return ""
+	}
+	return case_.Status
+}
+
+// advanceCase runs an operation that may fire transitions of a case and emits EventCaseCompleted
+// when it completes the case, plus breakpoint and budget events; the lock must be held
+func (r *Runtime) advanceCase(caseID string, fn func() error) error {
+	before := r.caseStatus(caseID)
+	err := fn()
+	case_, getErr := r.cases.GetCase(caseID)
+	if getErr != nil {
+		return err
+	}
+	if case_.Marking != nil {
+		r.emitStop(case_.CPNID, case_.Marking, err)
+	}
+	if before != models.CaseStatusCompleted && case_.Status == models.CaseStatusCompleted {
+		r.emit(Event{Type: EventCaseCompleted, CPNID: case_.CPNID, CaseID: caseID})
+	}
+	return err
+}
+
+// caseEvent returns an event about a case; the lock must be held
+func (r *Runtime) caseEvent(eventType EventType, caseID string) Event {
+	event := Event{Type: eventType, CaseID: caseID}
+	if case_, err := r.cases.GetCase(caseID); err == nil {
+		event.CPNID = case_.CPNID
+	}
+	return event
+}
+
+// CreateCase creates a case of a loaded CPN
+func (r *Runtime) CreateCase(ctx context.Context, caseID, cpnID, name string, opts ...CaseOption) (*Case, error) {
+	var config caseConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var created *models.Case
+	err := r.run(ctx, caseID, func() error {
+		var err error
+		created, err = r.cases.CreateCaseAtVersion(caseID, cpnID, config.version, name, config.description, config.variables)
+		if err != nil {
+			return err
+		}
+		r.emit(Event{Type: EventCaseCreated, CPNID: cpnID})
+		return nil
+	})
+	return created, err
+}
+
+// GetCase returns a snapshot of a case
+func (r *Runtime) GetCase(caseID string) (*Case, error) {
+	var case_ *models.Case
+	err := r.run(context.Background(), caseID, func() error {
+		var err error
+		case_, err = r.cases.GetCase(caseID)
+		return err
+	})
+	return case_, err
+}
+
+// UpdateCase merges variables and metadata into a case
+func (r *Runtime) UpdateCase(ctx context.Context, caseID string, variables, metadata map[string]interface{}) error {
+	return r.run(ctx, caseID, func() error {
+		if err := r.cases.UpdateCase(caseID, variables, metadata); err != nil {
+			return err
+		}
+		r.emit(r.caseEvent(EventCaseUpdated, caseID))
+		return nil
+	})
+}
+
+// StartCase starts a case from the initial marking of its CPN
+func (r *Runtime) StartCase(ctx context.Context, caseID string) error {
+	return r.run(ctx, caseID, func() error {
+		return r.advanceCase(caseID, func() error {
+			if err := r.cases.StartCase(caseID); err != nil {
+				return err
+			}
+			r.emit(r.caseEvent(EventCaseStarted, caseID))
+			return nil
+		})
+	})
+}
+
+// SuspendCase suspends a running case
+func (r *Runtime) SuspendCase(ctx context.Context, caseID string) error {
+	return r.run(ctx, caseID, func() error {
+		if err := r.cases.SuspendCase(caseID); err != nil {
+			return err
+		}
+		r.emit(r.caseEvent(EventCaseSuspended, caseID))
+		return nil
+	})
+}
+
+// ResumeCase resumes a suspended case
+func (r *Runtime) ResumeCase(ctx context.Context, caseID string) error {
+	return r.run(ctx, caseID, func() error {
+		if err := r.cases.ResumeCase(caseID); err != nil {
+			return err
+		}
+		r.emit(r.caseEvent(EventCaseResumed, caseID))
+		return nil
+	})
+}
+
+// AbortCase aborts a case
+func (r *Runtime) AbortCase(ctx context.Context, caseID string) error {
+	return r.run(ctx, caseID, func() error {
+		if err := r.cases.AbortCase(caseID); err != nil {
+			return err
+		}
+		r.emit(r.caseEvent(EventCaseAborted, caseID))
+		return nil
+	})
+}
+
+// DeleteCase deletes a terminated case
+func (r *Runtime) DeleteCase(ctx context.Context, caseID string) error {
+	return r.run(ctx, caseID, func() error {
+		event := r.caseEvent(EventCaseDeleted, caseID)
+		if err := r.cases.DeleteCase(caseID); err != nil {
+			return err
+		}
+		r.emit(event)
+		return nil
+	})
+}
+
+// MigrateCase moves a case to another version of its CPN (plan.TargetVersion, 0 = latest),
+// mapping and transforming its tokens as planned. With dryRun the case is left unchanged and the
+// result only reports the diff and issues. Invalid migrations return ErrMigrationInvalid.
+func (r *Runtime) MigrateCase(ctx context.Context, caseID string, plan *MigrationPlan, dryRun bool) (*MigrationResult, error) {
+	var result *models.MigrationResult
+	err := r.run(ctx, caseID, func() error {
+		var err error
+		result, err = r.cases.MigrateCase(caseID, plan, dryRun)
+		if err != nil {
+			return err
+		}
+		return r.migrateWorkItems(result)
+	})
+	return result, err
+}
+
+// MigrateCases applies a migration plan to every case matching a filter that has not
+// terminated. The filter must select a CPN; either all cases are migrated or none.
+func (r *Runtime) MigrateCases(ctx context.Context, filter *CaseFilter, plan *MigrationPlan, dryRun bool) ([]*MigrationResult, error) {
+	var results []*models.MigrationResult
+	err := r.run(ctx, "", func() error {
+		var err error
+		results, err = r.cases.MigrateCases(filter, plan, dryRun)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if err := r.migrateWorkItems(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+// migrateWorkItems emits EventCaseMigrated for an applied migration, cancels the open work items
+// of the case, which refer to transitions and bindings of its old version, and derives new ones
+// from the migrated marking. Dry runs list the work items that would be cancelled. The lock must be held.
+func (r *Runtime) migrateWorkItems(result *models.MigrationResult) error {
+	if result.DryRun {
+		workItems, _ := r.workItems.GetWorkItemsByCase(result.CaseID)
+		for _, workItem := range workItems {
+			if !workItem.IsTerminated() {
+				result.CancelledWorkItems = append(result.CancelledWorkItems, workItem.ID)
+			}
+		}
+		sort.Strings(result.CancelledWorkItems)
+		return nil
+	}
+	if !result.Applied {
+		return nil
+	}
+	event := r.caseEvent(EventCaseMigrated, result.CaseID)
+	event.Version = result.ToVersion
+	r.emit(event)
+
+	cancelled, created, err := r.workItems.RederiveWorkItemsForCase(result.CaseID)
+	for _, workItem := range cancelled {
+		result.CancelledWorkItems = append(result.CancelledWorkItems, workItem.ID)
+		r.emit(r.workItemEvent(EventWorkItemCancelled, workItem.ID))
+	}
+	for _, workItem := range created {
+		result.CreatedWorkItems = append(result.CreatedWorkItems, workItem.ID)
+		r.emit(r.workItemEvent(EventWorkItemCreated, workItem.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("case %s was migrated, but its work items could not be derived: %v", result.CaseID, err)
+	}
+	return nil
+}
+
+// ExecuteStep executes one simulation step of a running case and returns the number of firings
+func (r *Runtime) ExecuteStep(ctx context.Context, caseID string) (int, error) {
+	fired := 0
+	err := r.run(ctx, caseID, func() error {
+		return r.advanceCase(caseID, func() error {
+			var err error
+			fired, err = r.cases.ExecuteStep(caseID)
+			return err
+		})
+	})
+	return fired, err
+}
+
+// ExecuteAll fires automatic transitions of a running case until none is enabled. When the budget
+// is exhausted or ctx is done the firings done so far are kept and a *BudgetExceededError (or the
+// context's error) is returned together with the number of firings.
+func (r *Runtime) ExecuteAll(ctx context.Context, caseID string, opts ...ExecuteOption) (int, error) {
+	var config executeConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	fired := 0
+	err := r.run(ctx, caseID, func() error {
+		budget := config.budget
+		if !config.hasBudget {
+			budget = r.engine.GetBudget()
+		}
+		return r.advanceCase(caseID, func() error {
+			var err error
+			fired, err = r.cases.ExecuteAllContext(ctx, caseID, budget)
+			return err
+		})
+	})
+	return fired, err
+}
+
+// FireCaseTransition fires a transition of a running case with the given binding candidate
+func (r *Runtime) FireCaseTransition(ctx context.Context, caseID, transitionID string, bindingIndex int) error {
+	return r.run(ctx, caseID, func() error {
+		return r.advanceCase(caseID, func() error {
+			return r.cases.FireTransition(caseID, transitionID, bindingIndex)
+		})
+	})
+}
+
+// CaseEnabledTransitions returns the enabled transitions of a case with their bindings
+func (r *Runtime) CaseEnabledTransitions(ctx context.Context, caseID string) ([]TransitionStatus, error) {
+	var statuses []TransitionStatus
+	err := r.run(ctx, caseID, func() error {
+		transitions, bindingsMap, err := r.cases.GetEnabledTransitions(caseID)
+		if err != nil {
+			return err
+		}
+		statuses = enabledStatuses(transitions, bindingsMap)
+		return nil
+	})
+	return statuses, err
+}
+
+// CaseMonitorResults returns a snapshot of the monitor results of a case
+func (r *Runtime) CaseMonitorResults(caseID string) (*MonitorResults, error) {
+	var results *models.MonitorResults
+	err := r.run(context.Background(), caseID, func() error {
+		var err error
+		results, err = r.cases.GetCaseMonitorResults(caseID)
+		return err
+	})
+	return results, err
+}
+
+// QueryCases returns the cases matching a query
+func (r *Runtime) QueryCases(ctx context.Context, query *CaseQuery) ([]*Case, error) {
+	var cases []*models.Case
+	err := r.run(ctx, "", func() error {
+		var err error
+		cases, err = r.cases.QueryCases(query)
+		return err
+	})
+	return cases, err
+}
+
+// CaseStatistics returns statistics about cases
+func (r *Runtime) CaseStatistics() map[string]interface{} {
+	var stats map[string]interface{}
+	r.run(context.Background(), "", func() error {
+		stats = r.cases.GetCaseStatistics()
+		return nil
+	})
+	return stats
+}
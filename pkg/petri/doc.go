@@ -0,0 +1,23 @@
+// Package petri is the embeddable Go API of the CPN workflow engine.
+//
+// A Runtime holds loaded Coloured Petri Nets together with their current simulation
+// marking, the cases (workflow instances) created from them and the work items of those
+// cases. Everything the HTTP server offers is available as Go methods:
+//
+//	rt := petri.New(petri.WithBudget(petri.Budget{MaxFirings: 1000}))
+//	defer rt.Close()
+//
+//	cpn, err := rt.LoadCPNJSON(ctx, definition)
+//	...
+//	_, err = rt.CreateCase(ctx, "order-1", cpn.ID, "Order 1", petri.WithCaseVariables(vars))
+//	err = rt.StartCase(ctx, "order-1")
+//	fired, err := rt.ExecuteAll(ctx, "order-1")
+//
+// Methods that run the engine take a context.Context; long running operations
+// (ExecuteAll, SimulateSteps, RunExperiment) stop as soon as the context is done and
+// return its error. Subscribe registers hooks that are called for every transition
+// firing and lifecycle change of CPNs, cases and work items.
+//
+// A Runtime is safe for concurrent use. Values returned by it (CPNs, cases, work items,
+// markings) must be treated as read-only.
+package petri
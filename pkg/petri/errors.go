@@ -0,0 +1,25 @@
+package petri
+
+import (
+	"errors"
+
+	case_manager "go-petri-flow/internal/case"
+)
+
+// Errors returned by Runtime methods; match them with errors.Is
+var (
+	ErrClosed               = errors.New("runtime is closed")
+	ErrCPNNotFound          = errors.New("CPN not found")
+	ErrTransitionNotFound   = errors.New("transition not found")
+	ErrTransitionNotEnabled = errors.New("transition not enabled")
+	ErrInvalidBinding       = errors.New("binding index out of range")
+	ErrChildCPNNotLoaded    = errors.New("child CPN not loaded")
+	ErrSubWorkflowFailed    = errors.New("sub workflow failed")
+	ErrSandboxNotFound      = errors.New("sandbox not found")
+	ErrTooManySandboxes     = errors.New("too many sandboxes")
+	ErrStepNotInHistory     = errors.New("step not in history")
+	ErrVersionNotFound      = case_manager.ErrVersionNotFound
+	ErrVersionRetired       = case_manager.ErrVersionRetired
+	ErrVersionInUse         = case_manager.ErrVersionInUse
+	ErrMigrationInvalid     = case_manager.ErrMigrationInvalid
+)
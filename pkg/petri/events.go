@@ -0,0 +1,106 @@
+package petri
+
+import (
+	"time"
+)
+
+// EventType identifies the kind of an Event
+type EventType string
+
+const (
+	EventCPNLoaded         EventType = "cpn.loaded"
+	EventCPNReset          EventType = "cpn.reset"
+	EventCPNDeleted        EventType = "cpn.deleted"
+	EventCPNVersionRetired EventType = "cpn.version.retired"
+	EventMarkingRestored   EventType = "marking.restored"
+	EventTransitionFired   EventType = "transition.fired"
+	EventBreakpoint        EventType = "breakpoint"
+	EventBudgetExceeded    EventType = "budget.exceeded"
+	EventCaseCreated       EventType = "case.created"
+	EventCaseUpdated       EventType = "case.updated"
+	EventCaseStarted       EventType = "case.started"
+	EventCaseSuspended     EventType = "case.suspended"
+	EventCaseResumed       EventType = "case.resumed"
+	EventCaseAborted       EventType = "case.aborted"
+	EventCaseCompleted     EventType = "case.completed"
+	EventCaseDeleted       EventType = "case.deleted"
+	EventCaseMigrated      EventType = "case.migrated"
+	EventWorkItemCreated   EventType = "workitem.created"
+	EventWorkItemUpdated   EventType = "workitem.updated"
+	EventWorkItemOffered   EventType = "workitem.offered"
+	EventWorkItemAllocated EventType = "workitem.allocated"
+	EventWorkItemStarted   EventType = "workitem.started"
+	EventWorkItemCompleted EventType = "workitem.completed"
+	EventWorkItemFailed    EventType = "workitem.failed"
+	EventWorkItemCancelled EventType = "workitem.cancelled"
+	EventWorkItemDeleted   EventType = "workitem.deleted"
+)
+
+// Event describes something that happened in a Runtime
+type Event struct {
+	Type         EventType
+	Time         time.Time
+	CPNID        string
+	Version      int    // deployed CPN version (EventCPNLoaded, EventCPNVersionRetired, EventCaseMigrated)
+	CaseID       string // case the operation was invoked on; empty for CPN simulation
+	WorkItemID   string
+	TransitionID string                 // fired transition (EventTransitionFired)
+	Binding      map[string]interface{} // variable -> token value of the firing
+	Step         int                    // step counter after the firing
+	Clock        int                    // global clock of the firing
+	Breakpoint   *BreakpointHit         // EventBreakpoint
+	Budget       *BudgetExceededError   // EventBudgetExceeded
+}
+
+// EventHandler is called for every event. Handlers run synchronously after the operation
+// that caused the event has finished, so they may call back into the Runtime.
+type EventHandler func(Event)
+
+type subscriber struct {
+	id      int
+	handler EventHandler
+}
+
+// Subscribe registers an event handler and returns a function that unsubscribes it
+func (r *Runtime) Subscribe(handler EventHandler) func() {
+	r.subMutex.Lock()
+	defer r.subMutex.Unlock()
+	r.nextSubscriberID++
+	id := r.nextSubscriberID
+	r.subscribers = append(r.subscribers, subscriber{id: id, handler: handler})
+	return func() {
+		r.subMutex.Lock()
+		defer r.subMutex.Unlock()
+		for i, s := range r.subscribers {
+			if s.id == id {
+				r.subscribers = append(r.subscribers[:i:i], r.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit queues an event; it is delivered once the current operation has released the runtime lock
+func (r *Runtime) emit(event Event) {
+	event.Time = time.Now()
+	if event.CaseID == "" {
+		event.CaseID = r.scopeCase
+	}
+	r.pending = append(r.pending, event)
+}
+
+// dispatch delivers events to the current subscribers
+func (r *Runtime) dispatch(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	r.subMutex.Lock()
+	subscribers := make([]subscriber, len(r.subscribers))
+	copy(subscribers, r.subscribers)
+	r.subMutex.Unlock()
+	for _, event := range events {
+		for _, s := range subscribers {
+			s.handler(event)
+		}
+	}
+}
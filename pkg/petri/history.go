@@ -0,0 +1,142 @@
+package petri
+
+import (
+	"context"
+	"fmt"
+
+	"go-petri-flow/internal/models"
+)
+
+// DefaultHistoryLimit is the number of simulation markings kept per CPN for stepping back
+const DefaultHistoryLimit = 100
+
+// history is the bounded undo/redo list of a CPN's simulation markings. entries[position] is the
+// current marking; the entries after it are the markings that were stepped back from.
+type history struct {
+	entries  []*models.Marking
+	position int
+}
+
+// HistoryEntry describes a marking in the history of a CPN simulation
+type HistoryEntry struct {
+	Step    int  `json:"step"` // step counter of the marking
+	Clock   int  `json:"clock"`
+	Current bool `json:"current,omitempty"`
+}
+
+// History lists the markings a CPN simulation can step back or forward to, oldest first
+type History struct {
+	CPNID   string         `json:"cpnId"`
+	Limit   int            `json:"limit"`
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// resetHistory starts the history of a CPN over from its current simulation marking; the lock
+// must be held
+func (r *Runtime) resetHistory(cpnID string) {
+	r.histories[cpnID] = &history{entries: []*models.Marking{r.states[cpnID].Clone()}}
+}
+
+// record appends the current simulation marking of a CPN to its history, dropping the markings
+// that were stepped back from and the oldest ones beyond the limit; the lock must be held
+func (r *Runtime) record(cpnID string) {
+	h, exists := r.histories[cpnID]
+	if !exists {
+		r.resetHistory(cpnID)
+		return
+	}
+	h.entries = append(h.entries[:h.position+1], r.states[cpnID].Clone())
+	if excess := len(h.entries) - r.historyLimit; excess > 0 {
+		h.entries = append([]*models.Marking{}, h.entries[excess:]...)
+	}
+	h.position = len(h.entries) - 1
+}
+
+// History returns the markings of a CPN simulation that StepBack, StepForward and GoToStep can
+// restore
+func (r *Runtime) History(cpnID string) (*History, error) {
+	var result *History
+	err := r.run(context.Background(), "", func() error {
+		if _, _, err := r.lookup(cpnID); err != nil {
+			return err
+		}
+		h := r.histories[cpnID]
+		result = &History{CPNID: cpnID, Limit: r.historyLimit, Entries: make([]HistoryEntry, len(h.entries))}
+		for i, marking := range h.entries {
+			result.Entries[i] = HistoryEntry{Step: marking.StepCounter, Clock: marking.GlobalClock, Current: i == h.position}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// StepBack undoes up to steps firings or simulation steps of a CPN simulation, as far as the
+// history reaches. Restored markings continue their random source from the state it had when they
+// were recorded. Globals assigned by actions are not restored: they belong to the CPN version,
+// which the simulation shares with the cases, and keep their latest values.
+func (r *Runtime) StepBack(ctx context.Context, cpnID string, steps int) (*StepResult, error) {
+	return r.restore(ctx, cpnID, func(h *history) (int, error) {
+		if steps < 1 {
+			return 0, fmt.Errorf("steps must be positive")
+		}
+		if h.position == 0 {
+			return 0, fmt.Errorf("%w: no earlier marking", ErrStepNotInHistory)
+		}
+		return max(h.position-steps, 0), nil
+	})
+}
+
+// StepForward redoes up to steps firings or simulation steps that were stepped back from. Firing
+// or simulating after stepping back discards them.
+func (r *Runtime) StepForward(ctx context.Context, cpnID string, steps int) (*StepResult, error) {
+	return r.restore(ctx, cpnID, func(h *history) (int, error) {
+		if steps < 1 {
+			return 0, fmt.Errorf("steps must be positive")
+		}
+		if h.position == len(h.entries)-1 {
+			return 0, fmt.Errorf("%w: no later marking", ErrStepNotInHistory)
+		}
+		return min(h.position+steps, len(h.entries)-1), nil
+	})
+}
+
+// GoToStep restores the marking of a CPN simulation whose step counter is step. When time passed
+// without a firing, the latest marking of that step is restored.
+func (r *Runtime) GoToStep(ctx context.Context, cpnID string, step int) (*StepResult, error) {
+	return r.restore(ctx, cpnID, func(h *history) (int, error) {
+		for i := len(h.entries) - 1; i >= 0; i-- {
+			if h.entries[i].StepCounter == step {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: %d", ErrStepNotInHistory, step)
+	})
+}
+
+// restore makes the history entry chosen by target the simulation marking of a CPN
+func (r *Runtime) restore(ctx context.Context, cpnID string, target func(h *history) (int, error)) (*StepResult, error) {
+	var result *StepResult
+	err := r.run(ctx, "", func() error {
+		cpn, _, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		h := r.histories[cpnID]
+		position, err := target(h)
+		if err != nil {
+			return err
+		}
+		h.position = position
+		marking := h.entries[position].Clone()
+		r.states[cpnID] = marking
+		r.emit(Event{Type: EventMarkingRestored, CPNID: cpnID, Step: marking.StepCounter, Clock: marking.GlobalClock})
+		result = &StepResult{
+			Completed:  r.engine.IsCompleted(cpn, marking),
+			Marking:    marking.Clone(),
+			Step:       marking.StepCounter,
+			Breakpoint: marking.Monitors.PendingBreakpoint(),
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,140 @@
+package petri
+
+// Option configures a Runtime
+type Option func(*Runtime)
+
+// WithBudget sets the default budget of automatic execution (ExecuteAll, sub workflow auto start)
+func WithBudget(budget Budget) Option {
+	return func(r *Runtime) {
+		r.engine.SetBudget(budget)
+	}
+}
+
+// WithEventHandler subscribes an event handler for the lifetime of the Runtime
+func WithEventHandler(handler EventHandler) Option {
+	return func(r *Runtime) {
+		r.Subscribe(handler)
+	}
+}
+
+// WithHistoryLimit sets how many simulation markings are kept per CPN for StepBack, StepForward
+// and GoToStep (default DefaultHistoryLimit). Limits below 1 keep only the current marking.
+func WithHistoryLimit(limit int) Option {
+	return func(r *Runtime) {
+		r.historyLimit = max(limit, 1)
+	}
+}
+
+// WithSandboxLimit sets how many sandboxes ForkCase keeps open at a time (default
+// DefaultSandboxLimit). Discard sandboxes with DiscardSandbox to fork again.
+func WithSandboxLimit(limit int) Option {
+	return func(r *Runtime) {
+		r.sandboxLimit = max(limit, 1)
+	}
+}
+
+// ResetOption configures ResetCPN
+type ResetOption func(*resetConfig)
+
+type resetConfig struct {
+	seed    int64
+	hasSeed bool
+}
+
+// WithSeed seeds the random source of the new simulation run
+func WithSeed(seed int64) ResetOption {
+	return func(c *resetConfig) {
+		c.seed = seed
+		c.hasSeed = true
+	}
+}
+
+// FireOption configures FireTransition
+type FireOption func(*fireConfig)
+
+type fireConfig struct {
+	bindingIndex int
+	formData     map[string]interface{}
+}
+
+// WithBindingIndex selects the binding to fire among the transition's binding candidates (default 0)
+func WithBindingIndex(index int) FireOption {
+	return func(c *fireConfig) {
+		c.bindingIndex = index
+	}
+}
+
+// WithFormData passes user-provided data to the transition's action (manual transitions)
+func WithFormData(data map[string]interface{}) FireOption {
+	return func(c *fireConfig) {
+		c.formData = data
+	}
+}
+
+// ExecuteOption configures ExecuteAll
+type ExecuteOption func(*executeConfig)
+
+type executeConfig struct {
+	budget    Budget
+	hasBudget bool
+}
+
+// WithExecutionBudget overrides the Runtime's default budget for one ExecuteAll call
+func WithExecutionBudget(budget Budget) ExecuteOption {
+	return func(c *executeConfig) {
+		c.budget = budget
+		c.hasBudget = true
+	}
+}
+
+// CaseOption configures CreateCase
+type CaseOption func(*caseConfig)
+
+type caseConfig struct {
+	description string
+	variables   map[string]interface{}
+	version     int
+}
+
+// WithCaseDescription sets the description of a new case
+func WithCaseDescription(description string) CaseOption {
+	return func(c *caseConfig) {
+		c.description = description
+	}
+}
+
+// WithCaseVariables sets the initial variables of a new case
+func WithCaseVariables(variables map[string]interface{}) CaseOption {
+	return func(c *caseConfig) {
+		c.variables = variables
+	}
+}
+
+// WithCPNVersion pins a new case to a deployed version of its CPN instead of the latest one
+func WithCPNVersion(version int) CaseOption {
+	return func(c *caseConfig) {
+		c.version = version
+	}
+}
+
+// WorkItemOption configures CreateWorkItem
+type WorkItemOption func(*workItemConfig)
+
+type workItemConfig struct {
+	description  string
+	bindingIndex int
+}
+
+// WithWorkItemDescription sets the description of a new work item
+func WithWorkItemDescription(description string) WorkItemOption {
+	return func(c *workItemConfig) {
+		c.description = description
+	}
+}
+
+// WithWorkItemBinding selects the binding the work item fires when completed (default 0)
+func WithWorkItemBinding(index int) WorkItemOption {
+	return func(c *workItemConfig) {
+		c.bindingIndex = index
+	}
+}
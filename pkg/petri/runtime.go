@@ -0,0 +1,822 @@
+package petri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	case_manager "go-petri-flow/internal/case"
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/internal/workitem"
+)
+
+// Runtime hosts CPNs, their simulation markings, cases and work items
+type Runtime struct {
+	mutex     sync.Mutex // serializes all use of the engine
+	engine    *engine.Engine
+	parser    *models.CPNParser
+	cpns      map[string]*models.CPN     // CPN registry by ID
+	states    map[string]*models.Marking // Current simulation markings by CPN ID
+	histories map[string]*history        // Earlier simulation markings by CPN ID
+	cases     *case_manager.Manager
+	workItems *workitem.Manager
+	closed    bool
+
+	sandboxes     map[string]*sandbox // forks of cases by sandbox ID
+	nextSandboxID int
+	sandboxLimit  int // sandboxes open at a time
+
+	historyLimit int // markings kept per CPN simulation
+
+	// Events are queued while the lock is held and dispatched after it is released
+	pending   []Event
+	scopeCase string // case of the running operation, attached to firing events
+
+	subMutex         sync.Mutex
+	subscribers      []subscriber
+	nextSubscriberID int
+}
+
+// New creates a Runtime
+func New(opts ...Option) *Runtime {
+	eng := engine.NewEngine()
+	cases := case_manager.NewManager(eng)
+	r := &Runtime{
+		engine:    eng,
+		parser:    models.NewCPNParser(),
+		cpns:      make(map[string]*models.CPN),
+		states:    make(map[string]*models.Marking),
+		histories: make(map[string]*history),
+		cases:     cases,
+		workItems: workitem.NewManager(cases),
+		sandboxes: make(map[string]*sandbox),
+
+		historyLimit: DefaultHistoryLimit,
+		sandboxLimit: DefaultSandboxLimit,
+	}
+	eng.AddFiringListener(r.onFiring)
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Close releases the engine; every later call returns ErrClosed
+func (r *Runtime) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.engine.Close()
+	for _, s := range r.sandboxes {
+		s.close()
+	}
+}
+
+// run executes fn holding the runtime lock, then dispatches the events it emitted
+func (r *Runtime) run(ctx context.Context, caseID string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	events, err := r.locked(caseID, fn)
+	r.dispatch(events)
+	return err
+}
+
+// locked executes fn holding the runtime lock and returns the events it emitted.
+// The lock is released even if fn panics.
+func (r *Runtime) locked(caseID string, fn func() error) (events []Event, err error) {
+	r.mutex.Lock()
+	defer func() {
+		events = r.pending
+		r.pending = nil
+		r.scopeCase = ""
+		r.mutex.Unlock()
+	}()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	r.scopeCase = caseID
+	return nil, fn()
+}
+
+// onFiring turns engine firings into events
+func (r *Runtime) onFiring(event *engine.FiringEvent) {
+	r.emit(Event{
+		Type:         EventTransitionFired,
+		CPNID:        event.CPN.ID,
+		TransitionID: event.Transition.ID,
+		Binding:      bindingValues(event.Binding),
+		Step:         event.Step,
+		Clock:        event.Clock,
+	})
+}
+
+// emitStop emits breakpoint and budget events for a run that stopped early
+func (r *Runtime) emitStop(cpnID string, marking *models.Marking, err error) {
+	if hit := marking.Monitors.PendingBreakpoint(); hit != nil {
+		r.emit(Event{Type: EventBreakpoint, CPNID: cpnID, Breakpoint: hit, Step: marking.StepCounter, Clock: marking.GlobalClock})
+	}
+	var budgetErr *BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		r.emit(Event{Type: EventBudgetExceeded, CPNID: cpnID, Budget: budgetErr, Step: marking.StepCounter, Clock: marking.GlobalClock})
+	}
+}
+
+func bindingValues(binding engine.TokenBinding) map[string]interface{} {
+	values := make(map[string]interface{}, len(binding))
+	for name, token := range binding {
+		if token != nil {
+			values[name] = token.Value
+		}
+	}
+	return values
+}
+
+// lookup returns a loaded CPN and its simulation marking; the lock must be held
+func (r *Runtime) lookup(cpnID string) (*models.CPN, *models.Marking, error) {
+	cpn, exists := r.cpns[cpnID]
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCPNNotFound, cpnID)
+	}
+	marking, exists := r.states[cpnID]
+	if !exists {
+		return nil, nil, fmt.Errorf("marking for CPN %s not found", cpnID)
+	}
+	return cpn, marking, nil
+}
+
+// SetBudget sets the default budget of automatic execution
+func (r *Runtime) SetBudget(budget Budget) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.engine.SetBudget(budget)
+}
+
+// Budget returns the default budget of automatic execution
+func (r *Runtime) Budget() Budget {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.engine.GetBudget()
+}
+
+// RegisterFunction exposes a Go function to guards, arc expressions and actions of all CPNs
+// as namespace.name(...). Arguments are checked against the declared signature.
+func (r *Runtime) RegisterFunction(fn Function) error {
+	return r.run(context.Background(), "", func() error {
+		return r.engine.RegisterFunction(fn)
+	})
+}
+
+// Functions returns the registered Go functions ordered by qualified name
+func (r *Runtime) Functions() []Function {
+	var functions []Function
+	r.run(context.Background(), "", func() error {
+		functions = r.engine.Functions()
+		return nil
+	})
+	return functions
+}
+
+// LoadCPN parses a CPN definition, stores it with a fresh simulation marking and makes it
+// available for cases. Every load deploys a new immutable version of the CPN's ID with the hash of
+// its definition: the simulation and new cases use the latest version, existing cases keep theirs.
+func (r *Runtime) LoadCPN(ctx context.Context, definition *CPNDefinition) (*CPN, error) {
+	var cpn *models.CPN
+	err := r.run(ctx, "", func() error {
+		var net *expression.NetCompilation
+		var err error
+		if cpn, net, err = r.compileDefinition(definition, r.cases.NextVersion(definition.ID)); err != nil {
+			return err
+		}
+		net.Install()
+		r.register(cpn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cpn, nil
+}
+
+// compileDefinition parses a CPN definition and compiles it as the given version of its ID
+// without loading the CPN; the returned compilation installs it in the engine
+func (r *Runtime) compileDefinition(definition *CPNDefinition, version int) (*models.CPN, *expression.NetCompilation, error) {
+	hash, err := models.DefinitionHash(definition)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpn, err := r.parser.ParseCPNFromDefinition(definition)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpn.Version = version
+	net, err := r.engine.PrepareCPN(cpn)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpn.Hash = hash
+	return cpn, net, nil
+}
+
+// register loads a compiled CPN with its initial marking as the latest version of its ID
+func (r *Runtime) register(cpn *models.CPN) {
+	r.cpns[cpn.ID] = cpn
+	r.states[cpn.ID] = cpn.CreateInitialMarking()
+	r.resetHistory(cpn.ID)
+	r.cases.RegisterCPN(cpn)
+	r.emit(Event{Type: EventCPNLoaded, CPNID: cpn.ID, Version: cpn.Version})
+}
+
+// LoadCPNJSON loads a CPN from its JSON definition
+func (r *Runtime) LoadCPNJSON(ctx context.Context, data []byte) (*CPN, error) {
+	var definition models.CPNDefinitionJSON
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	return r.LoadCPN(ctx, &definition)
+}
+
+// GetCPN returns a loaded CPN
+func (r *Runtime) GetCPN(cpnID string) (*CPN, error) {
+	var cpn *models.CPN
+	err := r.run(context.Background(), "", func() error {
+		var err error
+		cpn, _, err = r.lookup(cpnID)
+		return err
+	})
+	return cpn, err
+}
+
+// ExportCPN serializes a loaded CPN to its JSON definition
+func (r *Runtime) ExportCPN(cpnID string) ([]byte, error) {
+	var data []byte
+	err := r.run(context.Background(), "", func() error {
+		cpn, _, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		data, err = r.parser.CPNToJSON(cpn)
+		return err
+	})
+	return data, err
+}
+
+// CPNVersions returns the deployed versions of a CPN, oldest first
+func (r *Runtime) CPNVersions(cpnID string) ([]CPNVersion, error) {
+	var versions []CPNVersion
+	err := r.run(context.Background(), "", func() error {
+		if _, _, err := r.lookup(cpnID); err != nil {
+			return err
+		}
+		var err error
+		versions, err = r.cases.Versions(cpnID)
+		return err
+	})
+	return versions, err
+}
+
+// GetCPNVersion returns a deployed version of a CPN (0 = latest)
+func (r *Runtime) GetCPNVersion(cpnID string, version int) (*CPN, error) {
+	var cpn *models.CPN
+	err := r.run(context.Background(), "", func() error {
+		if _, _, err := r.lookup(cpnID); err != nil {
+			return err
+		}
+		var err error
+		cpn, err = r.cases.GetCPNVersion(cpnID, version)
+		return err
+	})
+	return cpn, err
+}
+
+// ExportCPNVersion serializes a deployed version of a CPN (0 = latest) to its JSON definition
+func (r *Runtime) ExportCPNVersion(cpnID string, version int) ([]byte, error) {
+	var data []byte
+	err := r.run(context.Background(), "", func() error {
+		if _, _, err := r.lookup(cpnID); err != nil {
+			return err
+		}
+		cpn, err := r.cases.GetCPNVersion(cpnID, version)
+		if err != nil {
+			return err
+		}
+		data, err = r.parser.CPNToJSON(cpn)
+		return err
+	})
+	return data, err
+}
+
+// RetireCPNVersion retires a version of a CPN that is no longer needed. The latest version and
+// versions with cases that have not terminated cannot be retired (ErrVersionInUse).
+func (r *Runtime) RetireCPNVersion(ctx context.Context, cpnID string, version int) error {
+	return r.run(ctx, "", func() error {
+		if _, _, err := r.lookup(cpnID); err != nil {
+			return err
+		}
+		if err := r.cases.RetireVersion(cpnID, version); err != nil {
+			return err
+		}
+		r.engine.UnloadCPNVersion(cpnID, version)
+		r.emit(Event{Type: EventCPNVersionRetired, CPNID: cpnID, Version: version})
+		return nil
+	})
+}
+
+// ImportPNML converts the first net of a PNML document and loads it like LoadCPN. The report
+// lists the constructs that could not be converted exactly.
+func (r *Runtime) ImportPNML(ctx context.Context, data []byte) (*CPN, *ConversionReport, error) {
+	definition, report, err := r.parser.ParsePNML(data)
+	if err != nil {
+		return nil, report, err
+	}
+	cpn, err := r.LoadCPN(ctx, definition)
+	if err != nil {
+		return nil, report, err
+	}
+	return cpn, report, nil
+}
+
+// ImportCPNTools converts a CPN Tools model and loads its nets like LoadCPN: the nets of the
+// subpages first, then the main net. The returned CPNs start with the main net. The report lists
+// the constructs that could not be converted exactly and flags those that need a manual review.
+func (r *Runtime) ImportCPNTools(ctx context.Context, data []byte, id string) ([]*CPN, *ConversionReport, error) {
+	definitions, report, err := r.parser.ParseCPNTools(data, id)
+	if err != nil {
+		return nil, report, err
+	}
+	cpns, err := r.loadNets(ctx, definitions)
+	return cpns, report, err
+}
+
+// ImportBPMN compiles the processes of a BPMN 2.0 document to CPNs and loads them like LoadCPN:
+// called processes first, then the main process. The returned CPNs start with the main process.
+func (r *Runtime) ImportBPMN(ctx context.Context, data []byte) ([]*CPN, *ConversionReport, error) {
+	definitions, report, err := r.parser.ParseBPMN(data)
+	if err != nil {
+		return nil, report, err
+	}
+	cpns, err := r.loadNets(ctx, definitions)
+	return cpns, report, err
+}
+
+// loadNets loads imported nets in reverse order, so child nets are loaded before the nets
+// linking to them. All nets are compiled before any of them is installed in the engine: if one
+// fails, none is loaded and the engine is left as it was.
+func (r *Runtime) loadNets(ctx context.Context, definitions []*CPNDefinition) ([]*CPN, error) {
+	cpns := make([]*CPN, len(definitions))
+	err := r.run(ctx, "", func() error {
+		// Nets are registered last to first, which decides the versions of repeated IDs
+		versions := make([]int, len(definitions))
+		next := make(map[string]int)
+		for i := len(definitions) - 1; i >= 0; i-- {
+			id := definitions[i].ID
+			if _, ok := next[id]; !ok {
+				next[id] = r.cases.NextVersion(id)
+			}
+			versions[i] = next[id]
+			next[id]++
+		}
+		nets := make([]*expression.NetCompilation, len(definitions))
+		for i, definition := range definitions {
+			cpn, net, err := r.compileDefinition(definition, versions[i])
+			if err != nil {
+				return fmt.Errorf("failed to load net %s: %v", definition.ID, err)
+			}
+			cpns[i], nets[i] = cpn, net
+		}
+		for i := len(cpns) - 1; i >= 0; i-- {
+			nets[i].Install()
+			r.register(cpns[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cpns, nil
+}
+
+// ExportPNML serializes a loaded CPN to a PNML document
+func (r *Runtime) ExportPNML(cpnID string) ([]byte, *ConversionReport, error) {
+	var data []byte
+	var report *ConversionReport
+	err := r.run(context.Background(), "", func() error {
+		cpn, _, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		data, report, err = r.parser.CPNToPNML(cpn)
+		return err
+	})
+	return data, report, err
+}
+
+// LayoutCPN computes positions for the places and transitions of a loaded CPN and of the child
+// CPNs of its sub workflows (see models.AutoLayout). Nets whose nodes all have a position keep them
+// unless force is set. Returns laid out copies of the CPN followed by the loaded child CPNs; the
+// loaded CPNs are unchanged until the copies are loaded as new versions.
+func (r *Runtime) LayoutCPN(ctx context.Context, cpnID string, force bool) ([]*CPN, error) {
+	var cpns []*CPN
+	err := r.run(ctx, "", func() error {
+		cpn, _, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{cpn.ID: true}
+		for queue := []*models.CPN{cpn}; len(queue) > 0; queue = queue[1:] {
+			current := queue[0].Clone()
+			models.ApplyLayout(current, force)
+			cpns = append(cpns, current)
+			for _, sw := range current.SubWorkflows {
+				if sw == nil {
+					continue
+				}
+				if child, exists := r.cpns[sw.CPNID]; exists && !seen[sw.CPNID] {
+					seen[sw.CPNID] = true
+					queue = append(queue, child)
+				}
+			}
+		}
+		return nil
+	})
+	return cpns, err
+}
+
+// Render draws a loaded CPN with its simulation marking and enabled transitions as Graphviz DOT
+// or standalone SVG (see models.RenderCPN)
+func (r *Runtime) Render(ctx context.Context, cpnID string, format RenderFormat) ([]byte, error) {
+	var data []byte
+	err := r.run(ctx, "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		enabled, _, err := r.engine.GetEnabledTransitions(cpn, marking)
+		if err != nil {
+			return fmt.Errorf("failed to get enabled transitions: %v", err)
+		}
+		data, err = models.RenderCPN(cpn, &models.RenderState{Marking: marking, Enabled: transitionIDs(enabled)}, format)
+		return err
+	})
+	return data, err
+}
+
+// RenderCase draws the CPN of a case with the case's marking. Transitions are only highlighted
+// while the case is running; a case that has not started is drawn without tokens.
+func (r *Runtime) RenderCase(ctx context.Context, caseID string, format RenderFormat) ([]byte, error) {
+	var data []byte
+	err := r.run(ctx, caseID, func() error {
+		case_, err := r.cases.GetCase(caseID)
+		if err != nil {
+			return err
+		}
+		cpn, err := r.cases.GetCaseCPN(caseID)
+		if err != nil {
+			return err
+		}
+		state := &models.RenderState{Marking: case_.Marking}
+		if case_.Status == models.CaseStatusRunning {
+			enabled, _, err := r.cases.GetEnabledTransitions(caseID)
+			if err != nil {
+				return err
+			}
+			state.Enabled = transitionIDs(enabled)
+		}
+		data, err = models.RenderCPN(cpn, state, format)
+		return err
+	})
+	return data, err
+}
+
+// transitionIDs returns the set of IDs of transitions
+func transitionIDs(transitions []*models.Transition) map[string]bool {
+	ids := make(map[string]bool, len(transitions))
+	for _, t := range transitions {
+		ids[t.ID] = true
+	}
+	return ids
+}
+
+// ListCPNs returns all loaded CPNs ordered by ID
+func (r *Runtime) ListCPNs() []CPNSummary {
+	var summaries []CPNSummary
+	r.run(context.Background(), "", func() error {
+		for _, cpn := range r.cpns {
+			summaries = append(summaries, CPNSummary{
+				ID:          cpn.ID,
+				Name:        cpn.Name,
+				Description: cpn.Description,
+				Completed:   r.engine.IsCompleted(cpn, r.states[cpn.ID]),
+				Version:     cpn.Version,
+				Hash:        cpn.Hash,
+			})
+		}
+		return nil
+	})
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries
+}
+
+// DeleteCPN removes a CPN together with its cases
+func (r *Runtime) DeleteCPN(ctx context.Context, cpnID string) error {
+	return r.run(ctx, "", func() error {
+		if _, _, err := r.lookup(cpnID); err != nil {
+			return err
+		}
+		delete(r.cpns, cpnID)
+		delete(r.states, cpnID)
+		delete(r.histories, cpnID)
+		r.cases.UnregisterCPN(cpnID)
+		r.engine.UnloadCPN(cpnID)
+		r.emit(Event{Type: EventCPNDeleted, CPNID: cpnID})
+		return nil
+	})
+}
+
+// ResetCPN resets the simulation marking of a CPN to its initial marking
+func (r *Runtime) ResetCPN(ctx context.Context, cpnID string, opts ...ResetOption) (*Marking, error) {
+	var config resetConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var marking *models.Marking
+	err := r.run(ctx, "", func() error {
+		cpn, _, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		fresh := cpn.CreateInitialMarking()
+		if config.hasSeed {
+			fresh.SetSeed(config.seed)
+		}
+		r.states[cpnID] = fresh
+		r.resetHistory(cpnID)
+		marking = fresh.Clone()
+		r.emit(Event{Type: EventCPNReset, CPNID: cpnID})
+		return nil
+	})
+	return marking, err
+}
+
+// Marking returns a snapshot of the simulation marking of a CPN
+func (r *Runtime) Marking(cpnID string) (*Marking, error) {
+	var marking *models.Marking
+	err := r.run(context.Background(), "", func() error {
+		_, current, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		marking = current.Clone()
+		return nil
+	})
+	return marking, err
+}
+
+// Transitions returns every transition of a CPN with its enablement in the simulation marking
+func (r *Runtime) Transitions(ctx context.Context, cpnID string) ([]TransitionStatus, error) {
+	var statuses []TransitionStatus
+	err := r.run(ctx, "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		enabled, bindingsMap, err := r.engine.GetEnabledTransitions(cpn, marking)
+		if err != nil {
+			return fmt.Errorf("failed to get enabled transitions: %v", err)
+		}
+		enabledIDs := make(map[string]bool)
+		for _, t := range enabled {
+			enabledIDs[t.ID] = true
+		}
+		for _, t := range cpn.Transitions {
+			status := TransitionStatus{Transition: t, Enabled: enabledIDs[t.ID]}
+			if status.Enabled {
+				status.Bindings = bindingsMap[t.ID]
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// EnabledTransitions returns the enabled transitions of a CPN's simulation marking with their bindings
+func (r *Runtime) EnabledTransitions(ctx context.Context, cpnID string) ([]TransitionStatus, error) {
+	var statuses []TransitionStatus
+	err := r.run(ctx, "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		enabled, bindingsMap, err := r.engine.GetEnabledTransitions(cpn, marking)
+		if err != nil {
+			return fmt.Errorf("failed to get enabled transitions: %v", err)
+		}
+		statuses = enabledStatuses(enabled, bindingsMap)
+		return nil
+	})
+	return statuses, err
+}
+
+func enabledStatuses(transitions []*models.Transition, bindingsMap map[string][]engine.TokenBinding) []TransitionStatus {
+	statuses := make([]TransitionStatus, 0, len(transitions))
+	for _, t := range transitions {
+		statuses = append(statuses, TransitionStatus{Transition: t, Enabled: true, Bindings: bindingsMap[t.ID]})
+	}
+	return statuses
+}
+
+// FireTransition fires a transition in the simulation marking of a CPN and returns the new marking.
+// A transition linked to a sub workflow runs a fresh instance of the child CPN.
+func (r *Runtime) FireTransition(ctx context.Context, cpnID, transitionID string, opts ...FireOption) (*Marking, error) {
+	var config fireConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var result *models.Marking
+	err := r.run(ctx, "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		transition := cpn.GetTransition(transitionID)
+		if transition == nil {
+			return fmt.Errorf("%w: %s", ErrTransitionNotFound, transitionID)
+		}
+		enabled, bindings, err := r.engine.IsEnabled(cpn, transition, marking)
+		if err != nil {
+			return fmt.Errorf("failed to check if transition is enabled: %v", err)
+		}
+		if !enabled {
+			return fmt.Errorf("%w: %s", ErrTransitionNotEnabled, transition.Name)
+		}
+		if config.bindingIndex < 0 || config.bindingIndex >= len(bindings) {
+			return fmt.Errorf("%w: %d", ErrInvalidBinding, config.bindingIndex)
+		}
+		binding := bindings[config.bindingIndex]
+		if sw := cpn.GetSubWorkflowByTransition(transition.ID); sw != nil {
+			err = r.fireSubWorkflow(cpn, transition, sw, binding, marking, config.formData)
+		} else if err = r.engine.FireTransitionWithData(cpn, transition, binding, marking, config.formData); err != nil {
+			err = fmt.Errorf("failed to fire transition: %v", err)
+		}
+		if err != nil {
+			return err
+		}
+		r.record(cpnID)
+		result = marking.Clone()
+		return nil
+	})
+	return result, err
+}
+
+// fireSubWorkflow fires a hierarchical transition of a CPN simulation; the lock must be held
+func (r *Runtime) fireSubWorkflow(cpn *models.CPN, transition *models.Transition, sw *models.SubWorkflowLink, binding engine.TokenBinding, marking *models.Marking, formData map[string]interface{}) error {
+	// Step 1: Fire inputs + action only (engine suppresses outputs automatically for hierarchical transitions)
+	if err := r.engine.FireTransitionWithData(cpn, transition, binding, marking, formData); err != nil {
+		return fmt.Errorf("failed to fire hierarchical transition: %v", err)
+	}
+	// Step 2: Execute child net (fresh instance) with autoStart semantics
+	childCPN, ok := r.cpns[sw.CPNID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrChildCPNNotLoaded, sw.CPNID)
+	}
+	childMarking := childCPN.CreateInitialMarking()
+	// Apply simple inputMapping: parent binding var -> child variable as temporary variable tokens (not yet token injection into places)
+	// (Improvement pending: inject tokens directly in mapped child input places.)
+	if sw.AutoStart {
+		if _, err := r.engine.FireEnabledTransitions(childCPN, childMarking); err != nil {
+			return fmt.Errorf("%w: %v", ErrSubWorkflowFailed, err)
+		}
+	}
+	// Step 3: If propagateOnComplete and child completed, map outputs and produce deferred parent outputs now.
+	if !sw.PropagateOnComplete || !r.engine.IsCompleted(childCPN, childMarking) {
+		return nil
+	}
+	parentBinding := engine.TokenBinding{}
+	// Build parentBinding from outputMapping; naive: pick first token from child output places for each mapping
+	for _, parentVar := range sw.OutputMapping {
+		var val interface{}
+		// Heuristic: first token anywhere (since variable scoping not tracked in CPN-level path)
+		for placeID := range childMarking.Places {
+			toks := childMarking.GetTokens(placeID)
+			if len(toks) > 0 {
+				val = toks[0].Value
+				break
+			}
+		}
+		if val != nil {
+			parentBinding[parentVar] = models.NewToken(val, marking.GlobalClock)
+		}
+	}
+	if len(parentBinding) == 0 {
+		return nil
+	}
+	// Produce each output arc expression with built binding
+	for _, arc := range cpn.GetOutputArcs(transition.ID) {
+		// Arcs failing evaluation or color set validation produce nothing
+		_, _ = r.engine.ProduceOutputArc(cpn, arc, parentBinding, marking)
+	}
+	return nil
+}
+
+// SimulateStep performs one simulation step on the simulation marking of a CPN
+func (r *Runtime) SimulateStep(ctx context.Context, cpnID string) (*StepResult, error) {
+	return r.simulate(ctx, cpnID, 1, false)
+}
+
+// SimulateSteps performs up to steps simulation steps. It stops early when the CPN completes,
+// nothing fires, a breakpoint monitor triggers or ctx is done.
+func (r *Runtime) SimulateSteps(ctx context.Context, cpnID string, steps int) (*StepResult, error) {
+	return r.simulate(ctx, cpnID, steps, true)
+}
+
+func (r *Runtime) simulate(ctx context.Context, cpnID string, steps int, stopWhenCompleted bool) (*StepResult, error) {
+	var result *StepResult
+	err := r.run(ctx, "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		totalFired := 0
+		for i := 0; i < steps; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if stopWhenCompleted && r.engine.IsCompleted(cpn, marking) {
+				break
+			}
+			clock := marking.GlobalClock
+			fired, err := r.engine.SimulateStep(cpn, marking)
+			if err != nil {
+				return fmt.Errorf("failed to simulate step: %v", err)
+			}
+			if fired > 0 || marking.GlobalClock != clock {
+				r.record(cpnID)
+			}
+			totalFired += fired
+			if fired == 0 || marking.Monitors.PendingBreakpoint() != nil {
+				break
+			}
+		}
+		r.emitStop(cpnID, marking, nil)
+		result = &StepResult{
+			TransitionsFired: totalFired,
+			Completed:        r.engine.IsCompleted(cpn, marking),
+			Marking:          marking.Clone(),
+			Step:             marking.StepCounter,
+			Breakpoint:       marking.Monitors.PendingBreakpoint(),
+		}
+		return nil
+	})
+	return result, err
+}
+
+// RunExperiment runs a batch simulation experiment of a CPN. Experiments run on a dedicated
+// engine with their own copy of the CPN from the initial marking and never touch the simulation
+// marking.
+func (r *Runtime) RunExperiment(ctx context.Context, cpnID string, config ExperimentConfig) (*ExperimentResult, error) {
+	cpn, err := r.GetCPN(cpnID)
+	if err != nil {
+		return nil, err
+	}
+	experimentEngine := engine.NewEngine()
+	defer experimentEngine.Close()
+	for _, fn := range r.Functions() {
+		if err := experimentEngine.RegisterFunction(fn); err != nil {
+			return nil, err
+		}
+	}
+	// Like a sandbox, the experiment compiles its own copy of the CPN: the predicates of the
+	// loaded CPN's subset color sets are bound to the Runtime's engine
+	cpn = cpn.CloneUnbound()
+	if err := experimentEngine.CompileCPN(cpn); err != nil {
+		return nil, err
+	}
+	return experimentEngine.RunExperimentContext(ctx, cpn, config)
+}
+
+// MonitorResults returns a snapshot of the monitor results of the current simulation run of a CPN
+func (r *Runtime) MonitorResults(cpnID string) (*MonitorResults, error) {
+	var results *models.MonitorResults
+	err := r.run(context.Background(), "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		if marking.Monitors == nil {
+			results = models.NewMonitorResults(cpn.Monitors)
+		} else {
+			results = marking.Monitors.Clone()
+		}
+		return nil
+	})
+	return results, err
+}
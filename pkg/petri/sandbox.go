@@ -0,0 +1,253 @@
+package petri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+)
+
+// DefaultSandboxLimit is the number of sandboxes a Runtime keeps open at a time
+const DefaultSandboxLimit = 100
+
+// sandbox is a fork of a case. It runs on a dedicated engine, so its firings emit no events and
+// create no work items, and the case it was forked from never changes.
+type sandbox struct {
+	mutex     sync.Mutex
+	info      SandboxState
+	engine    *engine.Engine
+	cpn       *models.CPN
+	marking   *models.Marking
+	variables map[string]interface{}
+	path      []PathStep
+	closed    bool
+}
+
+// SandboxState is a snapshot of a sandbox
+type SandboxState struct {
+	ID         string                 `json:"id"`
+	CaseID     string                 `json:"caseId"` // case the sandbox was forked from
+	CPNID      string                 `json:"cpnId"`
+	CPNVersion int                    `json:"cpnVersion"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	Completed  bool                   `json:"completed"`
+	Marking    *Marking               `json:"marking"`
+	Variables  map[string]interface{} `json:"variables"`
+	Path       []PathStep             `json:"path"`    // firings since the fork
+	Enabled    []string               `json:"enabled"` // IDs of the enabled transitions
+}
+
+// ForkCase copies the marking and variables of a running or suspended case into a sandbox, where
+// transitions can be fired and simulated without side effects. Fails with ErrTooManySandboxes
+// while the sandbox limit is reached (see WithSandboxLimit).
+func (r *Runtime) ForkCase(ctx context.Context, caseID string) (*SandboxState, error) {
+	var fork *sandbox
+	err := r.run(ctx, "", func() error {
+		if len(r.sandboxes) >= r.sandboxLimit {
+			return fmt.Errorf("%w: %d sandboxes are open", ErrTooManySandboxes, len(r.sandboxes))
+		}
+		case_, err := r.cases.GetCase(caseID)
+		if err != nil {
+			return err
+		}
+		if !case_.IsActive() || case_.Marking == nil {
+			return fmt.Errorf("case %s is not running, current status: %s", caseID, case_.Status)
+		}
+		cpn, err := r.cases.GetCaseCPN(caseID)
+		if err != nil {
+			return err
+		}
+		sandboxEngine := engine.NewEngine()
+		sandboxEngine.SetBudget(r.engine.GetBudget())
+		for _, fn := range r.engine.Functions() {
+			if err := sandboxEngine.RegisterFunction(fn); err != nil {
+				sandboxEngine.Close()
+				return err
+			}
+		}
+		// The predicates of the case's subset color sets are bound to the Runtime's engine: the
+		// sandbox compiles its own copy of the CPN
+		cpn = cpn.CloneUnbound()
+		if err := sandboxEngine.CompileCPN(cpn); err != nil {
+			sandboxEngine.Close()
+			return err
+		}
+		r.nextSandboxID++
+		fork = &sandbox{
+			info: SandboxState{
+				ID:         fmt.Sprintf("%s-fork-%d", caseID, r.nextSandboxID),
+				CaseID:     caseID,
+				CPNID:      case_.CPNID,
+				CPNVersion: case_.CPNVersion,
+				CreatedAt:  time.Now(),
+			},
+			engine:    sandboxEngine,
+			cpn:       cpn,
+			marking:   case_.Marking,
+			variables: case_.Variables,
+			path:      []PathStep{},
+		}
+		r.sandboxes[fork.info.ID] = fork
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.withSandbox(fork.info.ID, func(s *sandbox) error { return nil })
+}
+
+// Sandbox returns a snapshot of a sandbox
+func (r *Runtime) Sandbox(sandboxID string) (*SandboxState, error) {
+	return r.withSandbox(sandboxID, func(s *sandbox) error { return nil })
+}
+
+// SandboxFire fires an enabled transition of a sandbox, manual ones included, with the given
+// binding candidate
+func (r *Runtime) SandboxFire(ctx context.Context, sandboxID, transitionID string, opts ...FireOption) (*SandboxState, error) {
+	var config fireConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return r.withSandbox(sandboxID, func(s *sandbox) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		transition := s.cpn.GetTransition(transitionID)
+		if transition == nil {
+			return fmt.Errorf("%w: %s", ErrTransitionNotFound, transitionID)
+		}
+		if s.cpn.GetSubWorkflowByTransition(transitionID) != nil {
+			return fmt.Errorf("sub workflow transition %s cannot run in a sandbox", transition.Name)
+		}
+		enabled, bindings, err := s.engine.IsEnabled(s.cpn, transition, s.marking)
+		if err != nil {
+			return fmt.Errorf("failed to check if transition is enabled: %v", err)
+		}
+		if !enabled {
+			return fmt.Errorf("%w: %s", ErrTransitionNotEnabled, transition.Name)
+		}
+		if config.bindingIndex < 0 || config.bindingIndex >= len(bindings) {
+			return fmt.Errorf("%w: %d", ErrInvalidBinding, config.bindingIndex)
+		}
+		return s.record(func() error {
+			if err := s.engine.FireTransitionWithData(s.cpn, transition, bindings[config.bindingIndex], s.marking, config.formData); err != nil {
+				return fmt.Errorf("failed to fire transition: %v", err)
+			}
+			return nil
+		})
+	})
+}
+
+// SandboxSimulate performs up to steps simulation steps in a sandbox, letting time pass like
+// SimulateSteps. It stops early when the CPN completes or nothing fires.
+func (r *Runtime) SandboxSimulate(ctx context.Context, sandboxID string, steps int) (*SandboxState, error) {
+	return r.withSandbox(sandboxID, func(s *sandbox) error {
+		return s.record(func() error {
+			for i := 0; i < steps && !s.cpn.IsCompleted(s.marking); i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				fired, err := s.engine.SimulateStep(s.cpn, s.marking)
+				if err != nil {
+					return fmt.Errorf("failed to simulate step: %v", err)
+				}
+				if fired == 0 || s.marking.Monitors.PendingBreakpoint() != nil {
+					break
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// SandboxPredict simulates continuations of a sandbox's marking (see engine.Predict) and reports
+// the predicted completion times and paths. The sandbox is left unchanged.
+func (r *Runtime) SandboxPredict(ctx context.Context, sandboxID string, config PredictionConfig) (*Prediction, error) {
+	var prediction *Prediction
+	_, err := r.withSandbox(sandboxID, func(s *sandbox) error {
+		var err error
+		prediction, err = s.engine.Predict(ctx, s.cpn, s.marking, config)
+		return err
+	})
+	return prediction, err
+}
+
+// DiscardSandbox closes a sandbox and releases its engine
+func (r *Runtime) DiscardSandbox(sandboxID string) error {
+	return r.run(context.Background(), "", func() error {
+		s, exists := r.sandboxes[sandboxID]
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrSandboxNotFound, sandboxID)
+		}
+		delete(r.sandboxes, sandboxID)
+		s.close()
+		return nil
+	})
+}
+
+// close releases the engine of a sandbox
+func (s *sandbox) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.engine.Close()
+	}
+}
+
+// record runs fn and appends its firings to the sandbox's path; its lock must be held
+func (s *sandbox) record(fn func() error) error {
+	remove := s.engine.AddFiringListener(func(event *engine.FiringEvent) {
+		s.path = append(s.path, PathStep{TransitionID: event.Transition.ID, Clock: event.Clock, Step: event.Step})
+	})
+	defer remove()
+	return fn()
+}
+
+// withSandbox runs fn on a sandbox under its own lock, so long simulations do not hold up the
+// Runtime, and returns a snapshot afterwards
+func (r *Runtime) withSandbox(sandboxID string, fn func(s *sandbox) error) (*SandboxState, error) {
+	var s *sandbox
+	err := r.run(context.Background(), "", func() error {
+		var exists bool
+		if s, exists = r.sandboxes[sandboxID]; !exists {
+			return fmt.Errorf("%w: %s", ErrSandboxNotFound, sandboxID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil, fmt.Errorf("%w: %s", ErrSandboxNotFound, sandboxID)
+	}
+	if err := fn(s); err != nil {
+		return nil, err
+	}
+	return s.state(), nil
+}
+
+// state returns a snapshot of the sandbox; its lock must be held
+func (s *sandbox) state() *SandboxState {
+	state := s.info
+	state.Completed = s.cpn.IsCompleted(s.marking)
+	state.Marking = s.marking.Clone()
+	state.Variables = make(map[string]interface{}, len(s.variables))
+	for k, v := range s.variables {
+		state.Variables[k] = v
+	}
+	state.Path = append([]PathStep{}, s.path...)
+	state.Enabled = []string{}
+	if transitions, _, err := s.engine.GetEnabledTransitions(s.cpn, s.marking); err == nil {
+		for _, t := range transitions {
+			state.Enabled = append(state.Enabled, t.ID)
+		}
+	}
+	return &state
+}
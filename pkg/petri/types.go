@@ -0,0 +1,120 @@
+package petri
+
+import (
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// Model types of the engine, re-exported so embedding applications can use them
+type (
+	CPN              = models.CPN
+	CPNDefinition    = models.CPNDefinitionJSON
+	Place            = models.Place
+	Transition       = models.Transition
+	Arc              = models.Arc
+	Marking          = models.Marking
+	Token            = models.Token
+	Case             = models.Case
+	CaseStatus       = models.CaseStatus
+	CaseQuery        = models.CaseQuery
+	CaseFilter       = models.CaseFilter
+	WorkItem         = models.WorkItem
+	WorkItemStatus   = models.WorkItemStatus
+	WorkItemPriority = models.WorkItemPriority
+	WorkItemQuery    = models.WorkItemQuery
+	MonitorResults   = models.MonitorResults
+	MonitorResult    = models.MonitorResult
+	BreakpointHit    = models.BreakpointHit
+	ConversionReport = models.ConversionReport
+	ConversionIssue  = models.ConversionIssue
+	RenderFormat     = models.RenderFormat
+	CPNVersion       = models.CPNVersion
+	MigrationPlan    = models.MigrationPlan
+	MigrationResult  = models.MigrationResult
+)
+
+// Engine types, re-exported
+type (
+	Binding             = engine.TokenBinding
+	Budget              = engine.Budget
+	BudgetExceededError = engine.BudgetExceededError
+	LivelockDiagnosis   = engine.LivelockDiagnosis
+	ExperimentConfig    = engine.ExperimentConfig
+	ExperimentResult    = engine.ExperimentResult
+	PredictionConfig    = engine.PredictionConfig
+	Prediction          = engine.Prediction
+	PredictedRun        = engine.PredictedRun
+	PathStep            = engine.PathStep
+)
+
+// Go functions callable from Lua expressions, re-exported
+type (
+	Function   = expression.Function
+	Signature  = expression.Signature
+	GoFunction = expression.GoFunction
+	ValueType  = expression.ValueType
+)
+
+// Declared parameter and result types of Go functions
+const (
+	TypeAny    = expression.TypeAny
+	TypeInt    = expression.TypeInt
+	TypeReal   = expression.TypeReal
+	TypeString = expression.TypeString
+	TypeBool   = expression.TypeBool
+	TypeList   = expression.TypeList
+	TypeMap    = expression.TypeMap
+)
+
+// Case statuses
+const (
+	CaseStatusCreated   = models.CaseStatusCreated
+	CaseStatusRunning   = models.CaseStatusRunning
+	CaseStatusCompleted = models.CaseStatusCompleted
+	CaseStatusSuspended = models.CaseStatusSuspended
+	CaseStatusAborted   = models.CaseStatusAborted
+)
+
+// Render formats
+const (
+	RenderFormatDOT = models.RenderFormatDOT
+	RenderFormatSVG = models.RenderFormatSVG
+)
+
+// Work item priorities
+const (
+	WorkItemPriorityLow    = models.WorkItemPriorityLow
+	WorkItemPriorityNormal = models.WorkItemPriorityNormal
+	WorkItemPriorityHigh   = models.WorkItemPriorityHigh
+	WorkItemPriorityUrgent = models.WorkItemPriorityUrgent
+)
+
+// DefaultBudget is the budget of automatic execution unless WithBudget is given
+var DefaultBudget = engine.DefaultBudget
+
+// CPNSummary describes a loaded CPN
+type CPNSummary struct {
+	ID          string
+	Name        string
+	Description string
+	Completed   bool   // current simulation marking is a final marking
+	Version     int    // latest deployed version
+	Hash        string // hash of the latest version's definition
+}
+
+// TransitionStatus describes a transition in a marking together with its binding candidates
+type TransitionStatus struct {
+	Transition *Transition
+	Enabled    bool
+	Bindings   []Binding // empty unless enabled
+}
+
+// StepResult is the outcome of simulation steps on a CPN's simulation marking
+type StepResult struct {
+	TransitionsFired int
+	Completed        bool
+	Marking          *Marking // snapshot after the steps
+	Step             int      // step counter of the marking
+	Breakpoint       *BreakpointHit
+}
@@ -0,0 +1,139 @@
+package petri
+
+import (
+	"context"
+	"strings"
+
+	"go-petri-flow/internal/models"
+)
+
+// ValidationViolation represents a failed validation rule.
+type ValidationViolation struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// TransitionDiagnostic provides per-transition enablement info.
+type TransitionDiagnostic struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Reasons []string `json:"reasons,omitempty"`
+	Kind    string   `json:"kind"`
+	Guard   string   `json:"guard"`
+}
+
+// ValidationReport is the result of Validate
+type ValidationReport struct {
+	CPNID       string                 `json:"cpnId"`
+	Valid       bool                   `json:"valid"`
+	Violations  []ValidationViolation  `json:"violations"`
+	Transitions []TransitionDiagnostic `json:"transitions"`
+}
+
+// Validate checks a CPN definition and its simulation marking and explains why transitions are disabled.
+// Treats empty / whitespace guard as true.
+func (r *Runtime) Validate(ctx context.Context, cpnID string) (*ValidationReport, error) {
+	var report *ValidationReport
+	err := r.run(ctx, "", func() error {
+		cpn, marking, err := r.lookup(cpnID)
+		if err != nil {
+			return err
+		}
+		report = r.validate(cpn, marking)
+		return nil
+	})
+	return report, err
+}
+
+func (r *Runtime) validate(cpn *models.CPN, marking *models.Marking) *ValidationReport {
+	violations := []ValidationViolation{}
+
+	// Duplicate place names
+	nameCount := map[string]int{}
+	for _, p := range cpn.Places {
+		nameCount[p.Name]++
+	}
+	for n, c := range nameCount {
+		if c > 1 {
+			violations = append(violations, ValidationViolation{Code: "duplicate_place_name", Message: "Duplicate place name detected", Context: map[string]interface{}{"name": n, "count": c}})
+		}
+	}
+
+	// Missing color sets
+	for _, p := range cpn.Places {
+		if p.ColorSet == nil {
+			violations = append(violations, ValidationViolation{Code: "missing_color_set", Message: "Place has no color set", Context: map[string]interface{}{"placeId": p.ID, "placeName": p.Name}})
+		}
+	}
+
+	// Initial marking referencing unknown places or bad tokens (including JSON schema violations)
+	for placeName, multi := range cpn.InitialMarking {
+		place := cpn.GetPlaceByName(placeName)
+		if place == nil {
+			violations = append(violations, ValidationViolation{Code: "initial_marking_unknown_place", Message: "Initial marking references unknown place", Context: map[string]interface{}{"placeName": placeName}})
+			continue
+		}
+		for _, tok := range multi {
+			if place.ColorSet != nil && !place.ColorSet.IsMember(tok.Value) {
+				code := "token_color_mismatch"
+				// Provide more specific code & detail for json schema mismatch
+				if jc, ok := place.ColorSet.(*models.JsonColorSet); ok {
+					if err := jc.Validate(tok.Value); err != nil {
+						code = "token_schema_violation"
+						violations = append(violations, ValidationViolation{Code: code, Message: err.Error(), Context: map[string]interface{}{"placeName": placeName, "colorSet": place.ColorSet.Name()}})
+						continue
+					}
+				}
+				violations = append(violations, ValidationViolation{Code: code, Message: "Token value not member of place color set", Context: map[string]interface{}{"placeName": placeName, "value": tok.Value, "colorSet": place.ColorSet.Name()}})
+			}
+		}
+	}
+
+	diagnostics := []TransitionDiagnostic{}
+	enabledTransitions, _, _ := r.engine.GetEnabledTransitions(cpn, marking)
+	enabledSet := map[string]bool{}
+	for _, t := range enabledTransitions {
+		enabledSet[t.ID] = true
+	}
+	for _, t := range cpn.Transitions {
+		diag := TransitionDiagnostic{ID: t.ID, Name: t.Name, Enabled: enabledSet[t.ID], Kind: string(t.Kind), Guard: t.GuardExpression}
+		if !diag.Enabled {
+			inputArcs := cpn.GetInputArcs(t.ID)
+			missingToken := false
+			for _, arc := range inputArcs {
+				place := cpn.GetPlace(arc.SourceID)
+				if place == nil {
+					diag.Reasons = append(diag.Reasons, "missing_input_place")
+					continue
+				}
+				ms := marking.Places[place.Name]
+				if ms == nil || ms.Size() == 0 {
+					diag.Reasons = append(diag.Reasons, "no_tokens_in_"+place.Name)
+					missingToken = true
+				}
+			}
+			g := strings.TrimSpace(t.GuardExpression)
+			if !missingToken {
+				if locallyEnabled, _, _ := r.engine.IsEnabled(cpn, t, marking); locallyEnabled {
+					diag.Reasons = append(diag.Reasons, "disabled_by_priority")
+				} else if g != "" {
+					diag.Reasons = append(diag.Reasons, "guard_or_binding_not_satisfied")
+				}
+			}
+		}
+		diagnostics = append(diagnostics, diag)
+	}
+
+	if len(enabledSet) == 0 {
+		violations = append(violations, ValidationViolation{Code: "deadlock", Message: "No transitions are currently enabled"})
+	}
+
+	return &ValidationReport{
+		CPNID:       cpn.ID,
+		Valid:       len(violations) == 0,
+		Violations:  violations,
+		Transitions: diagnostics,
+	}
+}
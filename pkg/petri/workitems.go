@@ -0,0 +1,213 @@
+package petri
+
+import (
+	"context"
+	"time"
+
+	"go-petri-flow/internal/models"
+)
+
+// workItemEvent returns an event about a work item; the lock must be held
+func (r *Runtime) workItemEvent(eventType EventType, workItemID string) Event {
+	event := Event{Type: eventType, WorkItemID: workItemID}
+	if workItem, err := r.workItems.GetWorkItem(workItemID); err == nil {
+		event.CaseID = workItem.CaseID
+		event.TransitionID = workItem.TransitionID
+		event = r.withCaseCPN(event)
+	}
+	return event
+}
+
+func (r *Runtime) withCaseCPN(event Event) Event {
+	if case_, err := r.cases.GetCase(event.CaseID); err == nil {
+		event.CPNID = case_.CPNID
+	}
+	return event
+}
+
+// changeWorkItem runs a work item operation and emits an event of the given type when it succeeds
+func (r *Runtime) changeWorkItem(ctx context.Context, eventType EventType, workItemID string, fn func() error) error {
+	return r.run(ctx, "", func() error {
+		if err := fn(); err != nil {
+			return err
+		}
+		r.emit(r.workItemEvent(eventType, workItemID))
+		return nil
+	})
+}
+
+// CreateWorkItem creates a work item for an enabled transition of a case
+func (r *Runtime) CreateWorkItem(ctx context.Context, workItemID, caseID, transitionID, name string, opts ...WorkItemOption) (*WorkItem, error) {
+	var config workItemConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var created *models.WorkItem
+	err := r.changeWorkItem(ctx, EventWorkItemCreated, workItemID, func() error {
+		var err error
+		created, err = r.workItems.CreateWorkItem(workItemID, caseID, transitionID, name, config.description, config.bindingIndex)
+		return err
+	})
+	return created, err
+}
+
+// CreateWorkItemsForCase creates a work item for every enabled manual transition of a case
+func (r *Runtime) CreateWorkItemsForCase(ctx context.Context, caseID string) ([]*WorkItem, error) {
+	var created []*models.WorkItem
+	err := r.run(ctx, caseID, func() error {
+		var err error
+		created, err = r.workItems.CreateWorkItemsForCase(caseID)
+		for _, workItem := range created {
+			r.emit(r.workItemEvent(EventWorkItemCreated, workItem.ID))
+		}
+		return err
+	})
+	return created, err
+}
+
+// GetWorkItem returns a work item
+func (r *Runtime) GetWorkItem(workItemID string) (*WorkItem, error) {
+	var workItem *models.WorkItem
+	err := r.run(context.Background(), "", func() error {
+		var err error
+		workItem, err = r.workItems.GetWorkItem(workItemID)
+		return err
+	})
+	return workItem, err
+}
+
+// UpdateWorkItem merges data and metadata into a work item
+func (r *Runtime) UpdateWorkItem(ctx context.Context, workItemID string, data, metadata map[string]interface{}) error {
+	return r.changeWorkItem(ctx, EventWorkItemUpdated, workItemID, func() error {
+		return r.workItems.UpdateWorkItem(workItemID, data, metadata)
+	})
+}
+
+// SetWorkItemPriority sets the priority of a work item
+func (r *Runtime) SetWorkItemPriority(ctx context.Context, workItemID string, priority WorkItemPriority) error {
+	return r.changeWorkItem(ctx, EventWorkItemUpdated, workItemID, func() error {
+		return r.workItems.SetPriority(workItemID, priority)
+	})
+}
+
+// SetWorkItemDueDate sets (or clears, with nil) the due date of a work item
+func (r *Runtime) SetWorkItemDueDate(ctx context.Context, workItemID string, dueDate *time.Time) error {
+	return r.changeWorkItem(ctx, EventWorkItemUpdated, workItemID, func() error {
+		return r.workItems.SetDueDate(workItemID, dueDate)
+	})
+}
+
+// OfferWorkItem offers a work item to users
+func (r *Runtime) OfferWorkItem(ctx context.Context, workItemID string, userIDs []string) error {
+	return r.changeWorkItem(ctx, EventWorkItemOffered, workItemID, func() error {
+		return r.workItems.OfferWorkItem(workItemID, userIDs)
+	})
+}
+
+// AllocateWorkItem allocates a work item to a user
+func (r *Runtime) AllocateWorkItem(ctx context.Context, workItemID, userID string) error {
+	return r.changeWorkItem(ctx, EventWorkItemAllocated, workItemID, func() error {
+		return r.workItems.AllocateWorkItem(workItemID, userID)
+	})
+}
+
+// StartWorkItem starts an allocated work item
+func (r *Runtime) StartWorkItem(ctx context.Context, workItemID string) error {
+	return r.changeWorkItem(ctx, EventWorkItemStarted, workItemID, func() error {
+		return r.workItems.StartWorkItem(workItemID)
+	})
+}
+
+// CompleteWorkItem completes a started work item by firing its transition in the case
+func (r *Runtime) CompleteWorkItem(ctx context.Context, workItemID string) error {
+	return r.changeWorkItem(ctx, EventWorkItemCompleted, workItemID, func() error {
+		workItem, err := r.workItems.GetWorkItem(workItemID)
+		if err != nil {
+			return err
+		}
+		r.scopeCase = workItem.CaseID
+		return r.advanceCase(workItem.CaseID, func() error {
+			return r.workItems.CompleteWorkItem(workItemID)
+		})
+	})
+}
+
+// FailWorkItem marks a work item as failed
+func (r *Runtime) FailWorkItem(ctx context.Context, workItemID string) error {
+	return r.changeWorkItem(ctx, EventWorkItemFailed, workItemID, func() error {
+		return r.workItems.FailWorkItem(workItemID)
+	})
+}
+
+// CancelWorkItem cancels a work item
+func (r *Runtime) CancelWorkItem(ctx context.Context, workItemID string) error {
+	return r.changeWorkItem(ctx, EventWorkItemCancelled, workItemID, func() error {
+		return r.workItems.CancelWorkItem(workItemID)
+	})
+}
+
+// DeleteWorkItem deletes a work item
+func (r *Runtime) DeleteWorkItem(ctx context.Context, workItemID string) error {
+	return r.run(ctx, "", func() error {
+		event := r.workItemEvent(EventWorkItemDeleted, workItemID)
+		if err := r.workItems.DeleteWorkItem(workItemID); err != nil {
+			return err
+		}
+		r.emit(event)
+		return nil
+	})
+}
+
+// QueryWorkItems returns the work items matching a query
+func (r *Runtime) QueryWorkItems(ctx context.Context, query *WorkItemQuery) ([]*WorkItem, error) {
+	var workItems []*models.WorkItem
+	err := r.run(ctx, "", func() error {
+		var err error
+		workItems, err = r.workItems.QueryWorkItems(query)
+		return err
+	})
+	return workItems, err
+}
+
+// WorkItemsByCase returns the work items of a case
+func (r *Runtime) WorkItemsByCase(caseID string) ([]*WorkItem, error) {
+	var workItems []*models.WorkItem
+	err := r.run(context.Background(), "", func() error {
+		var err error
+		workItems, err = r.workItems.GetWorkItemsByCase(caseID)
+		return err
+	})
+	return workItems, err
+}
+
+// WorkItemsByUser returns the work items offered or allocated to a user
+func (r *Runtime) WorkItemsByUser(userID string) ([]*WorkItem, error) {
+	var workItems []*models.WorkItem
+	err := r.run(context.Background(), "", func() error {
+		var err error
+		workItems, err = r.workItems.GetWorkItemsByUser(userID)
+		return err
+	})
+	return workItems, err
+}
+
+// OverdueWorkItems returns the active work items past their due date
+func (r *Runtime) OverdueWorkItems() ([]*WorkItem, error) {
+	var workItems []*models.WorkItem
+	err := r.run(context.Background(), "", func() error {
+		var err error
+		workItems, err = r.workItems.GetOverdueWorkItems()
+		return err
+	})
+	return workItems, err
+}
+
+// WorkItemStatistics returns statistics about work items
+func (r *Runtime) WorkItemStatistics() map[string]interface{} {
+	var stats map[string]interface{}
+	r.run(context.Background(), "", func() error {
+		stats = r.workItems.GetWorkItemStatistics()
+		return nil
+	})
+	return stats
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// createJoinCPN builds orders + items -> match, joining items to their order by guard
+func createJoinCPN(guard string) *models.CPN {
+	cpn := models.NewCPN("join", "Join", "Items joined to orders")
+	cs := models.NewJsonMapColorSet("REC", false)
+	cpn.AddPlace(models.NewPlace("orders", "Orders", cs))
+	cpn.AddPlace(models.NewPlace("items", "Items", cs))
+	cpn.AddPlace(models.NewPlace("matched", "Matched", cs))
+	cpn.AddTransition(models.NewTransitionWithGuard("match", "Match", guard, nil))
+	cpn.AddArc(models.NewInputArc("a_order", "orders", "match", "o"))
+	cpn.AddArc(models.NewInputArc("a_item", "items", "match", "i"))
+	cpn.AddArc(models.NewOutputArc("a_out", "match", "matched", "i"))
+	return cpn
+}
+
+func joinMarking(orders, itemsPerOrder int) *models.Marking {
+	marking := models.NewMarking()
+	for n := 0; n < orders; n++ {
+		marking.AddToken("orders", models.NewToken(map[string]interface{}{"id": n, "open": n%2 == 0}, 0))
+		for k := 0; k < itemsPerOrder; k++ {
+			marking.AddToken("items", models.NewToken(map[string]interface{}{"orderId": n, "line": k}, 0))
+		}
+	}
+	return marking
+}
+
+func TestBindingJoinAndGuardPushdown(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createJoinCPN("o.open and i.orderId == o.id")
+	marking := joinMarking(500, 2)
+	match := cpn.GetTransition("match")
+
+	bindings, err := eng.FindBindings(cpn, match, marking, 0)
+	if err != nil {
+		t.Fatalf("Failed to find bindings: %v", err)
+	}
+	if len(bindings) != 500 { // 250 open orders with 2 items each
+		t.Fatalf("Expected 500 bindings, got %d", len(bindings))
+	}
+	for _, b := range bindings {
+		order, item := b["o"].Value.(map[string]interface{}), b["i"].Value.(map[string]interface{})
+		if order["open"] != true || item["orderId"] != order["id"] {
+			t.Fatalf("Binding violates guard: %v %v", order, item)
+		}
+	}
+
+	first, err := eng.FindBindings(cpn, match, marking, 1)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Expected early stop after one binding, got %d (%v)", len(first), err)
+	}
+}
+
+func TestBindingUnificationAndMultiplicity(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn := models.NewCPN("unify", "Unify", "")
+	for _, id := range []string{"p1", "p2", "p3", "out"} {
+		cpn.AddPlace(models.NewPlace(id, id, intCS))
+	}
+	cpn.AddTransition(models.NewTransition("t", "T"))
+	cpn.AddArc(models.NewInputArc("a1", "p1", "t", "x"))
+	cpn.AddArc(models.NewInputArc("a2", "p2", "t", "x"))
+	pair := models.NewInputArc("a3", "p3", "t", "x * 10")
+	pair.Multiplicity = 2
+	cpn.AddArc(pair)
+	cpn.AddArc(models.NewOutputArc("a4", "t", "out", "x"))
+
+	marking := models.NewMarking()
+	for _, v := range []int{1, 2, 3} {
+		marking.AddToken("p1", models.NewToken(v, 0))
+	}
+	for _, v := range []int{2, 3, 4} {
+		marking.AddToken("p2", models.NewToken(v, 0))
+	}
+	for _, v := range []int{20, 30, 30} {
+		marking.AddToken("p3", models.NewToken(v, 0))
+	}
+
+	bindings, err := eng.FindBindings(cpn, cpn.GetTransition("t"), marking, 0)
+	if err != nil {
+		t.Fatalf("Failed to find bindings: %v", err)
+	}
+	// x must be in p1 and p2, and p3 must hold two tokens x*10
+	if len(bindings) != 1 || bindings[0]["x"].Value != 3 {
+		t.Fatalf("Expected the single binding x=3, got %v", bindings)
+	}
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t"), bindings[0], marking); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if marking.CountTokens("p3") != 1 || !marking.HasTokenWithValue("out", 3) {
+		t.Errorf("Unexpected marking after firing: %s", marking)
+	}
+}
+
+func TestBindingOrderFollowsInputArcs(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn := models.NewCPN("order", "Order", "")
+	cpn.AddPlace(models.NewPlace("many", "Many", intCS))
+	cpn.AddPlace(models.NewPlace("few", "Few", intCS))
+	cpn.AddTransition(models.NewTransitionWithGuard("t", "T", "x < 4 and x + y > 0", nil))
+	cpn.AddArc(models.NewInputArc("a1", "many", "t", "x"))
+	cpn.AddArc(models.NewInputArc("a2", "few", "t", "y"))
+
+	marking := models.NewMarking()
+	for v := 1; v <= 5; v++ {
+		marking.AddToken("many", models.NewToken(v, 0))
+	}
+	marking.AddToken("few", models.NewToken(7, 0))
+	marking.AddToken("few", models.NewToken(8, 0))
+
+	bindings, err := eng.FindBindings(cpn, cpn.GetTransition("t"), marking, 0)
+	if err != nil {
+		t.Fatalf("Failed to find bindings: %v", err)
+	}
+	var got []string
+	for _, b := range bindings {
+		got = append(got, fmt.Sprintf("%v/%v", b["x"].Value, b["y"].Value))
+	}
+	expected := []string{"1/7", "1/8", "2/7", "2/8", "3/7", "3/8"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected bindings %v, got %v", expected, got)
+	}
+}
+
+func TestGuardAnalysis(t *testing.T) {
+	conjuncts := map[string][]string{
+		"x > 0 and (y.a == 'and' or z) and not w": {"x > 0", "(y.a == 'and' or z)", "not w"},
+		"x > 0 or y > 0 and z":                    {"x > 0 or y > 0 and z"},
+		"local v = x; return v > 0 and y":         {"local v = x; return v > 0 and y"},
+	}
+	for guard, expected := range conjuncts {
+		if got := expression.SplitConjuncts(guard); !reflect.DeepEqual(got, expected) {
+			t.Errorf("SplitConjuncts(%q) = %q, expected %q", guard, got, expected)
+		}
+	}
+
+	if names, ok := expression.Identifiers("o.id == item.orderId .. suffix and f({k = v})"); !ok ||
+		!reflect.DeepEqual(names, []string{"o", "item", "suffix", "f", "v"}) {
+		t.Errorf("Unexpected identifiers %v", names)
+	}
+	if lhs, rhs, ok := expression.SplitEquality("i.orderId == o.id"); !ok || lhs != "i.orderId" || rhs != "o.id" {
+		t.Errorf("Unexpected equality split %q %q", lhs, rhs)
+	}
+	if _, _, ok := expression.SplitEquality("x == 1 or y"); ok {
+		t.Error("Disjunction must not be split as an equality")
+	}
+	if !expression.UsesRandom("x > 0 and bernoulli(0.5) == 1") || expression.UsesRandom("x.uniform > 0") {
+		t.Error("Unexpected random function detection")
+	}
+}
+
+func BenchmarkBindingJoin(b *testing.B) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+	cpn := createJoinCPN("i.orderId == o.id")
+	marking := joinMarking(1000, 1)
+	match := cpn.GetTransition("match")
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if bindings, err := eng.FindBindings(cpn, match, marking, 0); err != nil || len(bindings) != 1000 {
+			b.Fatalf("Expected 1000 bindings, got %d (%v)", len(bindings), err)
+		}
+	}
+}
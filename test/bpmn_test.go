@@ -0,0 +1,320 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+const orderBPMN = `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL"
+    xmlns:bpmndi="http://www.omg.org/spec/BPMN/20100524/DI" xmlns:dc="http://www.omg.org/spec/DD/20100524/DC"
+    xmlns:di="http://www.omg.org/spec/DD/20100524/DI" id="defs">
+  <bpmn:process id="order" name="Order" isExecutable="true">
+    <bpmn:startEvent id="received" name="Order received"/>
+    <bpmn:scriptTask id="assess" name="Assess" scriptFormat="lua">
+      <bpmn:script>data = {amount = 1500}</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:exclusiveGateway id="big" name="Big order?" default="f_small"/>
+    <bpmn:userTask id="approve" name="Approve"/>
+    <bpmn:boundaryEvent id="escalate" name="Escalate" attachedToRef="approve">
+      <bpmn:timerEventDefinition><bpmn:timeDuration>PT10S</bpmn:timeDuration></bpmn:timerEventDefinition>
+    </bpmn:boundaryEvent>
+    <bpmn:serviceTask id="auto" name="Auto approve"/>
+    <bpmn:exclusiveGateway id="merge"/>
+    <bpmn:parallelGateway id="fork"/>
+    <bpmn:task id="ship" name="Ship"/>
+    <bpmn:task id="bill" name="Bill"/>
+    <bpmn:parallelGateway id="join"/>
+    <bpmn:endEvent id="done" name="Done"/>
+    <bpmn:endEvent id="escalated" name="Escalated"/>
+    <bpmn:dataObject id="orderData"/>
+    <bpmn:sequenceFlow id="f1" sourceRef="received" targetRef="assess"/>
+    <bpmn:sequenceFlow id="f2" sourceRef="assess" targetRef="big"/>
+    <bpmn:sequenceFlow id="f_big" name="yes" sourceRef="big" targetRef="approve">
+      <bpmn:conditionExpression xsi:type="bpmn:tFormalExpression" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">${amount &gt; 1000}</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="f_small" sourceRef="big" targetRef="auto"/>
+    <bpmn:sequenceFlow id="f3" sourceRef="approve" targetRef="merge"/>
+    <bpmn:sequenceFlow id="f4" sourceRef="auto" targetRef="merge"/>
+    <bpmn:sequenceFlow id="f5" sourceRef="merge" targetRef="fork"/>
+    <bpmn:sequenceFlow id="f6" sourceRef="fork" targetRef="ship"/>
+    <bpmn:sequenceFlow id="f7" sourceRef="fork" targetRef="bill"/>
+    <bpmn:sequenceFlow id="f8" sourceRef="ship" targetRef="join"/>
+    <bpmn:sequenceFlow id="f9" sourceRef="bill" targetRef="join"/>
+    <bpmn:sequenceFlow id="f10" sourceRef="join" targetRef="done"/>
+    <bpmn:sequenceFlow id="f11" sourceRef="escalate" targetRef="escalated"/>
+  </bpmn:process>
+  <bpmndi:BPMNDiagram id="diagram">
+    <bpmndi:BPMNPlane id="plane" bpmnElement="order">
+      <bpmndi:BPMNShape id="s_approve" bpmnElement="approve"><dc:Bounds x="300" y="80" width="100" height="80"/></bpmndi:BPMNShape>
+      <bpmndi:BPMNEdge id="e_f8" bpmnElement="f8"><di:waypoint x="600" y="40"/><di:waypoint x="700" y="40"/></bpmndi:BPMNEdge>
+    </bpmndi:BPMNPlane>
+  </bpmndi:BPMNDiagram>
+</bpmn:definitions>`
+
+const paymentBPMN = `<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns="http://www.omg.org/spec/BPMN/20100524/MODEL" id="defs">
+  <process id="shop">
+    <startEvent id="s"/>
+    <callActivity id="pay" name="Pay" calledElement="payment"/>
+    <endEvent id="e"/>
+    <sequenceFlow id="f1" sourceRef="s" targetRef="pay"/>
+    <sequenceFlow id="f2" sourceRef="pay" targetRef="e"/>
+  </process>
+  <process id="payment" name="Payment">
+    <startEvent id="ps"/>
+    <eventBasedGateway id="wait"/>
+    <intermediateCatchEvent id="paid" name="Paid"><messageEventDefinition/></intermediateCatchEvent>
+    <intermediateCatchEvent id="timeout" name="Timeout">
+      <timerEventDefinition><timeDuration>PT1H</timeDuration></timerEventDefinition>
+    </intermediateCatchEvent>
+    <endEvent id="pe"/>
+    <sequenceFlow id="g1" sourceRef="ps" targetRef="wait"/>
+    <sequenceFlow id="g2" sourceRef="wait" targetRef="paid"/>
+    <sequenceFlow id="g3" sourceRef="wait" targetRef="timeout"/>
+    <sequenceFlow id="g4" sourceRef="paid" targetRef="pe"/>
+    <sequenceFlow id="g5" sourceRef="timeout" targetRef="pe"/>
+  </process>
+</definitions>`
+
+func findTransition(def *models.CPNDefinitionJSON, id string) *models.TransitionJSON {
+	for i := range def.Transitions {
+		if def.Transitions[i].ID == id {
+			return &def.Transitions[i]
+		}
+	}
+	return nil
+}
+
+// inputPlaces returns the places a transition of a definition consumes from
+func inputPlaces(def *models.CPNDefinitionJSON, transitionID string) []string {
+	var places []string
+	for _, arc := range def.Arcs {
+		if arc.Direction == "IN" && arc.TargetID == transitionID {
+			places = append(places, arc.SourceID)
+		}
+	}
+	return places
+}
+
+func TestBPMNCompile(t *testing.T) {
+	defs, report, err := models.NewCPNParser().ParseBPMN([]byte(orderBPMN))
+	if err != nil {
+		t.Fatalf("Failed to compile BPMN: %v", err)
+	}
+	if len(defs) != 1 || defs[0].ID != "order" || defs[0].Name != "Order" {
+		t.Fatalf("Unexpected definitions %+v", defs)
+	}
+	def := defs[0]
+
+	if tr := findTransition(def, "approve"); tr == nil || tr.Kind != "Manual" || tr.Position == nil || tr.Position.X != 350 || tr.Position.Y != 120 {
+		t.Errorf("Expected manual transition approve at the task's center, got %+v", tr)
+	}
+	if tr := findTransition(def, "assess"); tr == nil || tr.ActionExpression != "data = {amount = 1500}" {
+		t.Errorf("Expected the Lua script as action, got %+v", tr)
+	}
+	if tr := findTransition(def, "big_f_big"); tr == nil || tr.GuardExpression != "data.amount > 1000" {
+		t.Errorf("Unexpected conditional branch %+v", tr)
+	}
+	if tr := findTransition(def, "big_f_small"); tr == nil || tr.GuardExpression != "not ((data.amount > 1000))" {
+		t.Errorf("Unexpected default branch %+v", tr)
+	}
+	if in := inputPlaces(def, "join"); len(in) != 2 || in[0] != "flow_f8" || in[1] != "flow_f9" {
+		t.Errorf("Expected the join to synchronize its flows, got %v", in)
+	}
+	if in := inputPlaces(def, "merge"); len(in) != 1 || in[0] != "in_merge" {
+		t.Errorf("Expected the exclusive merge to take one input place, got %v", in)
+	}
+	if in := inputPlaces(def, "escalate"); len(in) != 2 || in[0] != "ready_approve" || in[1] != "timer_escalate" {
+		t.Errorf("Expected the boundary timer to race with the task, got %v", in)
+	}
+	if findTransition(def, "arm_approve") == nil || findTransition(def, "expire_escalate") == nil {
+		t.Errorf("Expected arming and expiring transitions for the boundary timer")
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected an exact compilation, got %+v", report.Issues)
+	}
+}
+
+func TestBPMNSimulation(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	// A big order waits at the user task with its escalation timer armed
+	if _, _, err := rt.ImportBPMN(ctx, []byte(orderBPMN)); err != nil {
+		t.Fatalf("Failed to import BPMN: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "order", 20); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ := rt.Marking("order")
+	timers := marking.GetTokens("timer_escalate")
+	if len(marking.GetTokens("ready_approve")) != 1 || len(timers) != 1 || timers[0].Timestamp != 10 {
+		t.Fatalf("Expected the order to wait for approval with the timer due at 10, got %v", marking.Places)
+	}
+	if _, err := rt.FireTransition(ctx, "order", "approve"); err != nil {
+		t.Fatalf("Failed to approve: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "order", 20); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ = rt.Marking("order")
+	if len(marking.GetTokens("end")) != 1 {
+		t.Fatalf("Expected the approval to end the order, got %v", marking.Places)
+	}
+	// The stale timer expires once due without escalating
+	if _, err := rt.SimulateStep(ctx, "order"); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ = rt.Marking("order")
+	if len(marking.GetTokens("timer_escalate")) != 0 || len(marking.GetTokens("end")) != 1 || marking.GlobalClock != 10 {
+		t.Errorf("Expected the timer to expire at 10, got %v (clock %d)", marking.Places, marking.GlobalClock)
+	}
+
+	// A small order takes the default flow through both parallel branches
+	small := strings.Replace(orderBPMN, "amount = 1500", "amount = 50", 1)
+	if _, _, err := rt.ImportBPMN(ctx, []byte(small)); err != nil {
+		t.Fatalf("Failed to import BPMN: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "order", 20); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ = rt.Marking("order")
+	tokens := marking.GetTokens("end")
+	if len(tokens) != 1 {
+		t.Fatalf("Expected the order to complete, got %v", marking.Places)
+	}
+	if data, ok := tokens[0].Value.(map[string]interface{}); !ok || data["amount"] != 50 {
+		t.Errorf("Expected the process data to reach the end, got %v", tokens[0].Value)
+	}
+}
+
+func TestBPMNEventGatewayAndCallActivity(t *testing.T) {
+	defs, report, err := models.NewCPNParser().ParseBPMN([]byte(paymentBPMN))
+	if err != nil {
+		t.Fatalf("Failed to compile BPMN: %v", err)
+	}
+	if len(defs) != 2 || defs[0].ID != "shop" || defs[1].ID != "payment" {
+		t.Fatalf("Expected the calling process first, got %d definitions", len(defs))
+	}
+	if sw := defs[0].SubWorkflows; len(sw) != 1 || sw[0].CPNID != "payment" || sw[0].CallTransitionID != "pay" {
+		t.Errorf("Expected a sub workflow for the call activity, got %+v", sw)
+	}
+	if tr := findTransition(defs[1], "paid"); tr == nil || tr.Kind != "Message" {
+		t.Errorf("Expected a Message transition for the message event, got %+v", tr)
+	}
+	if in := inputPlaces(defs[1], "timeout"); len(in) != 2 || in[0] != "ready_wait" || in[1] != "timer_timeout" {
+		t.Errorf("Expected the timer to race at the gateway, got %v", in)
+	}
+	if !report.Exact() {
+		t.Errorf("Unexpected issues %+v", report.Issues)
+	}
+
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	cpns, _, err := rt.ImportBPMN(ctx, []byte(paymentBPMN))
+	if err != nil || len(cpns) != 2 {
+		t.Fatalf("Failed to import BPMN: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "payment", 2); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "payment", "paid"); err != nil {
+		t.Fatalf("Failed to fire the message event: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "payment", 5); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ := rt.Marking("payment")
+	if len(marking.GetTokens("end")) != 1 || marking.GlobalClock >= 3600 {
+		t.Errorf("Expected the payment to end before the timeout, got %v (clock %d)", marking.Places, marking.GlobalClock)
+	}
+}
+
+func TestBPMNExclusiveGatewayTakesFirstMatchingFlow(t *testing.T) {
+	// Both conditions hold for an amount of 1500: only the first flow may be taken
+	doc := strings.Replace(orderBPMN, "amount &gt; 1000", "amount &gt; 100", 1)
+	doc = strings.Replace(doc, `<bpmn:sequenceFlow id="f_small"`, `<bpmn:sequenceFlow id="f_huge" sourceRef="big" targetRef="auto">
+      <bpmn:conditionExpression>${amount &gt; 1000}</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="f_small"`, 1)
+	defs, _, err := models.NewCPNParser().ParseBPMN([]byte(doc))
+	if err != nil {
+		t.Fatalf("Failed to compile BPMN: %v", err)
+	}
+	if tr := findTransition(defs[0], "big_f_huge"); tr == nil || tr.GuardExpression != "(data.amount > 1000) and not ((data.amount > 100))" {
+		t.Errorf("Expected the second flow to exclude the first, got %+v", tr)
+	}
+	if tr := findTransition(defs[0], "big_f_small"); tr == nil || tr.GuardExpression != "not ((data.amount > 100) or (data.amount > 1000))" {
+		t.Errorf("Unexpected default branch %+v", tr)
+	}
+
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, _, err := rt.ImportBPMN(ctx, []byte(doc)); err != nil {
+		t.Fatalf("Failed to import BPMN: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "order", 20); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ := rt.Marking("order")
+	if len(marking.GetTokens("ready_approve")) != 1 || len(marking.GetTokens("end")) != 0 {
+		t.Errorf("Expected the order to wait for approval, got %v", marking.Places)
+	}
+}
+
+func TestBPMNImportLoadsAllOrNothing(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+
+	// The main process has a condition that does not compile; the called process is fine
+	doc := strings.Replace(paymentBPMN, `<sequenceFlow id="f2" sourceRef="pay" targetRef="e"/>`, `<sequenceFlow id="f2" sourceRef="pay" targetRef="x"/>
+    <exclusiveGateway id="x"/>
+    <sequenceFlow id="f3" sourceRef="x" targetRef="e"><conditionExpression>${amount &gt;}</conditionExpression></sequenceFlow>
+    <sequenceFlow id="f4" sourceRef="x" targetRef="e"/>`, 1)
+	if _, _, err := rt.ImportBPMN(context.Background(), []byte(doc)); err == nil {
+		t.Fatal("Expected the import to fail")
+	}
+	if cpns := rt.ListCPNs(); len(cpns) != 0 {
+		t.Errorf("Expected no net to be loaded, got %d", len(cpns))
+	}
+}
+
+func TestAPIBPMNImport(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/import/bpmn", bytes.NewBufferString(paymentBPMN)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data api.NetsImportResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data.CPNs) != 2 || response.Data.CPNs[0].ID != "shop" {
+		t.Errorf("Unexpected import response %+v", response.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/import/bpmn", bytes.NewBufferString("<definitions/>")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a document without process, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,188 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	case_manager "go-petri-flow/internal/case"
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+)
+
+// createSelfLoopCPN builds p1 -> t1 -> p1: an automatic transition regenerating its own input
+func createSelfLoopCPN() *models.CPN {
+	cpn := models.NewCPN("self-loop", "Self loop", "Livelocking net")
+	intCS := models.NewIntegerColorSet("INT", true)
+	cpn.AddPlace(models.NewPlace("p1", "P1", intCS))
+	cpn.AddTransition(models.NewTransition("t1", "Spin"))
+	cpn.AddArc(models.NewInputArc("a1", "p1", "t1", "x"))
+	cpn.AddArc(models.NewOutputArc("a2", "t1", "p1", "x"))
+	cpn.AddInitialToken("p1", models.NewToken(1, 0))
+	return cpn
+}
+
+func TestBudgetDetectsSelfLoop(t *testing.T) {
+	cpn := createSelfLoopCPN()
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	marking := cpn.CreateInitialMarking()
+	fired, err := eng.FireEnabledTransitionsWithBudget(cpn, marking, engine.Budget{MaxFirings: 50})
+	var budgetErr *engine.BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Expected budget error, got %v", err)
+	}
+	if fired != 50 || budgetErr.Limit != engine.BudgetLimitFirings || marking.StepCounter != 50 {
+		t.Errorf("Expected 50 partial firings, got fired=%d limit=%s", fired, budgetErr.Limit)
+	}
+	diagnosis := budgetErr.Diagnosis
+	if !diagnosis.RepeatedMarking || !reflect.DeepEqual(diagnosis.CyclingTransitions, []string{"t1"}) {
+		t.Errorf("Expected t1 livelock on a repeated marking, got %+v", diagnosis)
+	}
+	if diagnosis.FiringCounts["t1"] != 50 {
+		t.Errorf("Expected firing count 50 for t1, got %d", diagnosis.FiringCounts["t1"])
+	}
+}
+
+func TestBudgetDetectsGrowingCycle(t *testing.T) {
+	cpn := models.NewCPN("counter", "Counter", "Cycle that never repeats a marking")
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn.AddPlace(models.NewPlace("p1", "P1", intCS))
+	cpn.AddPlace(models.NewPlace("p2", "P2", intCS))
+	cpn.AddTransition(models.NewTransition("t1", "Inc"))
+	cpn.AddTransition(models.NewTransition("t2", "Back"))
+	cpn.AddArc(models.NewInputArc("a1", "p1", "t1", "x"))
+	cpn.AddArc(models.NewOutputArc("a2", "t1", "p2", "x + 1"))
+	cpn.AddArc(models.NewInputArc("a3", "p2", "t2", "x"))
+	cpn.AddArc(models.NewOutputArc("a4", "t2", "p1", "x"))
+	cpn.AddInitialToken("p1", models.NewToken(0, 0))
+
+	eng := engine.NewEngine()
+	defer eng.Close()
+	_, err := eng.FireEnabledTransitionsWithBudget(cpn, cpn.CreateInitialMarking(), engine.Budget{MaxFirings: 40})
+	var budgetErr *engine.BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Expected budget error, got %v", err)
+	}
+	if budgetErr.Diagnosis.RepeatedMarking || !reflect.DeepEqual(budgetErr.Diagnosis.CyclingTransitions, []string{"t1", "t2"}) {
+		t.Errorf("Expected repeating t1/t2 sequence without repeated marking, got %+v", budgetErr.Diagnosis)
+	}
+}
+
+func TestBudgetTimeAdvanceAndQuiescence(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createSelfLoopCPN()
+	cpn.GetTransition("t1").SetDelay(5)
+	_, err := eng.FireEnabledTransitionsWithBudget(cpn, cpn.CreateInitialMarking(), engine.Budget{MaxTimeAdvance: 20})
+	var budgetErr *engine.BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Limit != engine.BudgetLimitTimeAdvance {
+		t.Fatalf("Expected time advance budget error, got %v", err)
+	}
+
+	// A net that becomes quiescent exactly at the limit is not reported (Start is untimed, so the
+	// initial token is available although its timestamp lies ahead)
+	cpn = createSimpleCPN()
+	marking := cpn.CreateInitialMarking()
+	marking.AddToken("Start", models.NewToken("job", 0))
+	fired, err := eng.FireEnabledTransitionsWithBudget(cpn, marking, engine.Budget{MaxFirings: 2})
+	if err != nil || fired != 2 {
+		t.Errorf("Expected quiescent run without budget error, fired=%d err=%v", fired, err)
+	}
+}
+
+func TestCaseExecuteAllBudget(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+	eng.SetBudget(engine.Budget{MaxFirings: 25})
+
+	manager := case_manager.NewManager(eng)
+	manager.RegisterCPN(createSelfLoopCPN())
+	if _, err := manager.CreateCase("loop-case", "self-loop", "Loop", "", nil); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	if err := manager.StartCase("loop-case"); err != nil {
+		t.Fatalf("Failed to start case: %v", err)
+	}
+
+	fired, err := manager.ExecuteAll("loop-case")
+	var budgetErr *engine.BudgetExceededError
+	if !errors.As(err, &budgetErr) || fired != 25 {
+		t.Fatalf("Expected budget error after 25 firings, got fired=%d err=%v", fired, err)
+	}
+
+	// The case is not left locked and stays running with its partial result
+	case_, err := manager.GetCase("loop-case")
+	if err != nil || case_.Status != models.CaseStatusRunning || case_.Marking.CountTokens("p1") != 1 {
+		t.Errorf("Expected running case with partial result, got %+v, %v", case_, err)
+	}
+}
+
+func TestAPIExecuteAllBudget(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	cpnDef := models.CPNDefinitionJSON{
+		ID:          "api-loop",
+		Name:        "API loop",
+		ColorSets:   []string{"colset INT = int;"},
+		Places:      []models.PlaceJSON{{ID: "p1", Name: "P1", ColorSet: "INT"}},
+		Transitions: []models.TransitionJSON{{ID: "t1", Name: "Spin", Kind: "Auto"}},
+		Arcs: []models.ArcJSON{
+			{ID: "a1", SourceID: "p1", TargetID: "t1", Expression: "x", Direction: "IN"},
+			{ID: "a2", SourceID: "t1", TargetID: "p1", Expression: "x", Direction: "OUT"},
+		},
+		InitialMarking: map[string][]models.TokenJSON{"p1": {{Value: 1}}},
+	}
+	body, _ := json.Marshal(cpnDef)
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/api/cpn/load", bytes.NewBuffer(body)),
+		httptest.NewRequest("POST", "/api/cases/create", bytes.NewBufferString(`{"id": "c1", "cpnId": "api-loop", "name": "Loop"}`)),
+		httptest.NewRequest("POST", "/api/cases/start?id=c1", nil),
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK && rr.Code != http.StatusCreated {
+			t.Fatalf("Request %s failed: %d %s", req.URL, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/executeall?id=c1&maxFirings=20", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected partial result with status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data api.CaseExecutionResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	exceeded := response.Data.BudgetExceeded
+	if response.Data.TransitionsFired != 20 || exceeded == nil || !reflect.DeepEqual(exceeded.Diagnosis.CyclingTransitions, []string{"t1"}) {
+		t.Errorf("Unexpected execution response: %s", rr.Body.String())
+	}
+
+	for _, query := range []string{"maxFirings=-1", "maxFirings=0", "maxTimeAdvance=0", "maxWallTimeMs=0"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/executeall?id=c1&"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for invalid budget, got %d", query, rr.Code)
+		}
+	}
+
+	// Requests cannot raise the server's limits
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/executeall?id=c1&maxFirings=1000000", nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Data.TransitionsFired != engine.DefaultBudget.MaxFirings {
+		t.Errorf("Expected the firings clamped to %d, got %s", engine.DefaultBudget.MaxFirings, rr.Body.String())
+	}
+}
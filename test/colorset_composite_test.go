@@ -0,0 +1,194 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+)
+
+func TestCompositeColorSetsRoundTrip(t *testing.T) {
+	parser := models.NewColorSetParser()
+	definitions := []string{
+		"colset Small = INT with -5..10",
+		"colset Ints = list INT with 0..3",
+		"colset Names = list STRING",
+		"colset Item = record id:INT * name:STRING",
+		"colset Result = union Ok:Item + Failed timed",
+		"colset Even = subset INT by isEven",
+	}
+	for _, def := range definitions {
+		cs, err := parser.ParseColorSetDefinition(def)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", def, err)
+		}
+		// String() must parse again to an equivalent color set
+		reparsed, err := parser.ParseColorSetDefinition(cs.String())
+		if err != nil || reparsed.String() != cs.String() {
+			t.Errorf("Round trip of %q failed: %q -> %v (%v)", def, cs.String(), reparsed, err)
+		}
+	}
+
+	for _, bad := range []string{
+		"colset B = list NOPE",
+		"colset B = record id:INT * id:STRING",
+		"colset B = union A:INT",
+		"colset B = subset INT",
+		"colset B = STRING with 0..10",
+	} {
+		if _, err := parser.ParseColorSetDefinition(bad); err == nil {
+			t.Errorf("Expected %q to fail", bad)
+		}
+	}
+}
+
+func TestCompositeColorSetValues(t *testing.T) {
+	parser := models.NewColorSetParser()
+	for _, def := range []string{
+		"colset Ints = list INT with 0..3",
+		"colset Item = record id:INT * name:STRING",
+		"colset Result = union Ok:Item + Failed",
+	} {
+		if _, err := parser.ParseColorSetDefinition(def); err != nil {
+			t.Fatalf("Failed to parse %q: %v", def, err)
+		}
+	}
+	ints, _ := parser.GetColorSet("Ints")
+	item, _ := parser.GetColorSet("Item")
+	result, _ := parser.GetColorSet("Result")
+
+	valid := []struct {
+		cs       models.ColorSet
+		text     string
+		expected interface{}
+	}{
+		{ints, "[1, 2, 3]", []interface{}{1, 2, 3}},
+		{item, `{"id": 7, "name": "a"}`, map[string]interface{}{"id": 7, "name": "a"}},
+		{result, `Ok({"id": 1, "name": "b"})`, map[string]interface{}{"Ok": map[string]interface{}{"id": 1, "name": "b"}}},
+		{result, "Failed", "Failed"},
+	}
+	for _, v := range valid {
+		got, err := models.ParseColorSetValue(v.cs, v.text)
+		if err != nil || !reflect.DeepEqual(got, v.expected) {
+			t.Errorf("%s %q: expected %v, got %v (%v)", v.cs.Name(), v.text, v.expected, got, err)
+		}
+	}
+
+	invalid := map[models.ColorSet][]string{
+		ints:   {"[1, 2, 3, 4]", `["a"]`},
+		item:   {`{"id": 7}`, `{"id": "7", "name": "a"}`, `{"id": 7, "name": "a", "x": 1}`},
+		result: {"Ok(1)", "Pending", `{"Ok": {"id": 1, "name": "b"}, "Failed": 1}`},
+	}
+	for cs, texts := range invalid {
+		for _, text := range texts {
+			if _, err := models.ParseColorSetValue(cs, text); err == nil {
+				t.Errorf("Expected %q not to be a member of %s", text, cs.Name())
+			}
+		}
+	}
+}
+
+func TestRecordFieldsAndSubsetPredicates(t *testing.T) {
+	parser := models.NewCPNParser()
+	def := models.CPNDefinitionJSON{
+		ID:           "records",
+		Name:         "Records",
+		Declarations: "function isEven(n) return n % 2 == 0 end",
+		ColorSets: []string{
+			"colset Item = record id:INT * name:STRING;",
+			"colset Even = subset INT by isEven;",
+		},
+		Places: []models.PlaceJSON{
+			{ID: "items", Name: "Items", ColorSet: "Item"},
+			{ID: "ids", Name: "Ids", ColorSet: "Even"},
+		},
+		Transitions: []models.TransitionJSON{{ID: "t", Name: "T", GuardExpression: "x.id > 0", Variables: []string{"x"}}},
+		Arcs: []models.ArcJSON{
+			{ID: "a1", SourceID: "items", TargetID: "t", Expression: "x", Direction: "IN"},
+			{ID: "a2", SourceID: "t", TargetID: "ids", Expression: "x.id * 2 + #x.name - 1", Direction: "OUT"},
+		},
+		InitialMarking: map[string][]models.TokenJSON{"items": {
+			{Value: map[string]interface{}{"id": 0, "name": "zero"}},
+			{Value: map[string]interface{}{"id": 4, "name": "a"}},
+			{Value: map[string]interface{}{"id": 5, "name": "ab"}},
+		}},
+	}
+	cpn, err := parser.ParseCPNFromDefinition(&def)
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	eng := engine.NewEngine()
+	defer eng.Close()
+	if err := eng.CompileCPN(cpn); err != nil {
+		t.Fatalf("Failed to compile CPN: %v", err)
+	}
+
+	even := cpn.GetPlace("ids").ColorSet
+	if !even.IsMember(4) || even.IsMember(3) || even.IsMember("4") {
+		t.Error("Subset membership must apply the declared predicate")
+	}
+
+	// x.id > 0 excludes the first record; id 4 yields 8, id 5 yields 11 which is not even
+	marking := cpn.CreateInitialMarking()
+	transition := cpn.GetTransition("t")
+	_, bindings, err := eng.IsEnabled(cpn, transition, marking)
+	if err != nil || len(bindings) != 2 {
+		t.Fatalf("Expected 2 bindings, got %d (%v)", len(bindings), err)
+	}
+	var failed int
+	for _, b := range bindings {
+		if err := eng.FireTransition(cpn, transition, b, marking); err != nil {
+			failed++
+		}
+	}
+	if failed != 1 || !marking.HasTokenWithValue("ids", 8) || marking.CountTokens("ids") != 1 {
+		t.Errorf("Expected only 8 to be produced, got %s", marking)
+	}
+}
+
+func TestCloneUnboundRebindsSubsetPredicates(t *testing.T) {
+	def := models.CPNDefinitionJSON{
+		ID:           "unbound",
+		Name:         "Unbound",
+		Declarations: "function isEven(n) return n % 2 == 0 end",
+		ColorSets: []string{
+			"colset Even = subset INT by isEven;",
+			"colset Evens = list Even;",
+		},
+		Places: []models.PlaceJSON{
+			{ID: "even", Name: "Even", ColorSet: "Even"},
+			{ID: "evens", Name: "Evens", ColorSet: "Evens"},
+		},
+	}
+	cpn, err := models.NewCPNParser().ParseCPNFromDefinition(&def)
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	eng := engine.NewEngine()
+	defer eng.Close()
+	if err := eng.CompileCPN(cpn); err != nil {
+		t.Fatalf("Failed to compile CPN: %v", err)
+	}
+
+	clone := cpn.CloneUnbound()
+	if clone.GetPlace("even").ColorSet == cpn.GetPlace("even").ColorSet || clone.GetPlace("evens").ColorSet == cpn.GetPlace("evens").ColorSet {
+		t.Fatal("Expected new instances of the subset color set and the list built from it")
+	}
+	if evens, _ := clone.GetColorSet("Evens"); evens != clone.GetPlace("evens").ColorSet {
+		t.Error("Expected the declared and the place color sets of the copy to be the same instance")
+	}
+
+	// Binding the copy on another engine leaves the original bound to its own engine
+	other := engine.NewEngine()
+	if err := other.CompileCPN(clone); err != nil {
+		t.Fatalf("Failed to compile the copy: %v", err)
+	}
+	if !clone.GetPlace("evens").ColorSet.IsMember([]interface{}{2, 4}) || clone.GetPlace("evens").ColorSet.IsMember([]interface{}{3}) {
+		t.Error("Expected the copy to apply the predicate")
+	}
+	other.Close()
+	if even := cpn.GetPlace("even").ColorSet; !even.IsMember(4) || even.IsMember(3) {
+		t.Error("Expected the original to keep its predicate")
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+func TestColorSetFunctions(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+	ctx := expression.NewEvaluationContext()
+	ctx.RegisterColorSet(models.NewEnumeratedColorSet("Color", false, []string{"red", "green", "blue"}))
+	ctx.RegisterColorSet(models.NewIntegerColorSetWithRange("Small", false, -1, 2))
+	ctx.RegisterColorSet(models.NewIntegerColorSet("Any", false))
+
+	expected := map[string]interface{}{
+		`cs.all("Color")`:            []interface{}{"red", "green", "blue"},
+		`cs.all("Small")`:            []interface{}{-1, 0, 1, 2},
+		`cs.size("Color")`:           3,
+		`cs.size("Small")`:           4,
+		`cs.member("Color", "blue")`: true,
+		`cs.member("Small", 3)`:      false,
+		`cs.member("Any", 3)`:        true,
+		`cs.ord("Color", "green")`:   1,
+		`cs.ord("Small", 0)`:         1,
+		`cs.col("Color", 2)`:         "blue",
+		`cs.succ("Color", "blue")`:   "red",
+		`cs.pred("Small", -1)`:       2,
+		`cs.succ("Small", 0)`:        1,
+	}
+	for expr, want := range expected {
+		got, err := evaluator.EvaluateArcExpression(expr, ctx)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v (%v)", expr, want, got, err)
+		}
+	}
+
+	for _, expr := range []string{`cs.all("Any")`, `cs.size("Nope")`, `cs.ord("Color", "pink")`, `cs.col("Small", 4)`} {
+		if _, err := evaluator.EvaluateArcExpression(expr, ctx); err == nil {
+			t.Errorf("Expected %s to fail", expr)
+		}
+	}
+}
+
+func TestColorSetFunctionsSeeDeclaredColorSets(t *testing.T) {
+	parser := models.NewCPNParser()
+	def := models.CPNDefinitionJSON{
+		ID:           "colors",
+		Name:         "Colors",
+		Declarations: "function isOdd(n) return n % 2 == 1 end",
+		ColorSets: []string{
+			"colset Color = with red | green | blue;",
+			"colset Digit = int[0..9];",
+			"colset Odd = subset Digit by isOdd;",
+		},
+		Places: []models.PlaceJSON{
+			{ID: "in", Name: "In", ColorSet: "Color"},
+			{ID: "out", Name: "Out", ColorSet: "Color"},
+		},
+		Transitions: []models.TransitionJSON{{ID: "t", Name: "T", GuardExpression: "cs.size('Odd') == 5", Variables: []string{"c"}}},
+		Arcs: []models.ArcJSON{
+			{ID: "a1", SourceID: "in", TargetID: "t", Expression: "c", Direction: "IN"},
+			{ID: "a2", SourceID: "t", TargetID: "out", Expression: "cs.succ('Color', c)", Direction: "OUT"},
+		},
+		InitialMarking: map[string][]models.TokenJSON{"in": {{Value: "blue"}}},
+	}
+	cpn, err := parser.ParseCPNFromDefinition(&def)
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	eng := engine.NewEngine()
+	defer eng.Close()
+	if err := eng.CompileCPN(cpn); err != nil {
+		t.Fatalf("Failed to compile CPN: %v", err)
+	}
+	marking := cpn.CreateInitialMarking()
+	fired, err := eng.FireEnabledTransitions(cpn, marking)
+	if err != nil || fired != 1 || !marking.HasTokenWithValue("out", "red") {
+		t.Fatalf("Expected blue to become red, got %s (%d, %v)", marking, fired, err)
+	}
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+func TestCompileErrorsReportedAtLoad(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+
+	definition := strings.NewReplacer(
+		`{"id": "t1", "name": "Check", "kind": "Auto"}`, `{"id": "t1", "name": "Check", "kind": "Auto", "guardExpression": "x >"}`,
+		`"expression": "x + 1"`, `"expression": "x +* 1"`,
+	).Replace(approvalCPNJSON)
+	_, err := rt.LoadCPNJSON(context.Background(), []byte(definition))
+	if err == nil {
+		t.Fatal("Expected compile errors at load")
+	}
+	for _, owner := range []string{"transition t1 guard", "arc a2"} {
+		if !strings.Contains(err.Error(), owner) {
+			t.Errorf("Expected error to name %q, got %v", owner, err)
+		}
+	}
+	if _, getErr := rt.GetCPN("approval"); getErr == nil {
+		t.Error("CPN with compile errors should not be loaded")
+	}
+}
+
+func TestCompiledExpressionsEvaluation(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+
+	expressions := []string{"x * 2", "local y = x + 1; y * 10", "return x - 1"}
+	for _, expr := range expressions {
+		if err := evaluator.Compile(expr, expression.ArcExpression); err != nil {
+			t.Fatalf("Failed to compile %q: %v", expr, err)
+		}
+	}
+	if err := evaluator.Compile("x = x +", expression.ActionExpression); err == nil {
+		t.Error("Expected action compile error")
+	}
+
+	// Cached prototypes are re-run with fresh bindings
+	for i := 1; i <= 3; i++ {
+		ctx := expression.NewEvaluationContext()
+		ctx.BindVariable("x", models.NewToken(i, 0))
+		expected := []interface{}{i * 2, (i + 1) * 10, i - 1}
+		for j, expr := range expressions {
+			result, err := evaluator.EvaluateArcExpression(expr, ctx)
+			if err != nil || result != expected[j] {
+				t.Errorf("%q with x=%d: expected %v, got %v (%v)", expr, i, expected[j], result, err)
+			}
+		}
+		if err := evaluator.EvaluateAction("x = x * 100", ctx); err != nil || evaluator.GetGlobalValue("x") != i*100 {
+			t.Errorf("Action with x=%d failed: %v", i, err)
+		}
+	}
+}
+
+func BenchmarkGuardEvaluation(b *testing.B) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+	ctx := expression.NewEvaluationContext()
+	ctx.BindVariable("x", models.NewToken(map[string]interface{}{"amount": 250, "currency": "EUR"}, 0))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := evaluator.EvaluateGuard("x.amount > 100 and x.currency == 'EUR'", ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCompiledNetExpressionsSurviveCacheChurn(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+
+	churn := func() {
+		ctx := expression.NewEvaluationContext()
+		ctx.BindVariable("x", models.NewToken(1, 0))
+		for i := 0; i < 5000; i++ {
+			if _, err := evaluator.EvaluateArcExpression(fmt.Sprintf("x + %d", i), ctx); err != nil {
+				t.Fatalf("Evaluation failed: %v", err)
+			}
+		}
+	}
+	for version := 1; version <= 2; version++ {
+		cpn := models.NewCPN("net", "Net", "")
+		cpn.Version = version
+		net, err := evaluator.CompileNet(cpn)
+		if err != nil {
+			t.Fatalf("Failed to compile declarations: %v", err)
+		}
+		if err := net.Compile("x * 2", expression.ArcExpression); err != nil {
+			t.Fatalf("Failed to compile: %v", err)
+		}
+		net.Install()
+	}
+	churn()
+	if !evaluator.IsCompiled("x * 2", expression.ArcExpression) {
+		t.Error("Inscription compiled for a net was evicted by evaluations of other expressions")
+	}
+
+	// The inscription stays pinned while one version still uses it
+	evaluator.ReleaseNetVersion("net", 1)
+	churn()
+	if !evaluator.IsCompiled("x * 2", expression.ArcExpression) {
+		t.Error("Expected version 2 to keep the inscription")
+	}
+	evaluator.ReleaseNetVersion("net", 2)
+	if evaluator.IsCompiled("x * 2", expression.ArcExpression) {
+		t.Error("Expected the inscription to be released with its last version")
+	}
+}
+
+func TestFailedCompilePinsNothing(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+	evaluator := eng.EvaluatorAccessor()
+
+	cpn := createTransactionCPN("")
+	cpn.GetArc("a_ok").Expression = "x * 7"
+	cpn.GetTransition("t").GuardExpression = "x >"
+	if err := eng.CompileCPN(cpn); err == nil {
+		t.Fatal("Expected the guard to fail to compile")
+	}
+	ctx := expression.NewEvaluationContext()
+	ctx.BindVariable("x", models.NewToken(1, 0))
+	for i := 0; i < 5000; i++ {
+		if _, err := evaluator.EvaluateArcExpression(fmt.Sprintf("x + %d", i), ctx); err != nil {
+			t.Fatalf("Evaluation failed: %v", err)
+		}
+	}
+	if evaluator.IsCompiled("x * 7", expression.ArcExpression) {
+		t.Error("Expected the inscriptions of a CPN that failed to compile not to be pinned")
+	}
+}
+
+func TestPreparedCPNInstallsOnDemand(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createTransactionCPN("")
+	cpn.Declarations = "limit = 1"
+	if err := eng.CompileCPN(cpn); err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	next := createTransactionCPN("")
+	next.Declarations = "limit = 2"
+	net, err := eng.PrepareCPN(next)
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	if limit := eng.EvaluatorAccessor().GetNetValue(cpn, "limit"); limit != 1 {
+		t.Errorf("Expected preparing to leave the loaded declarations, got limit=%v", limit)
+	}
+	net.Install()
+	if limit := eng.EvaluatorAccessor().GetNetValue(cpn, "limit"); limit != 2 {
+		t.Errorf("Expected the installed declarations, got limit=%v", limit)
+	}
+}
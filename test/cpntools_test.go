@@ -0,0 +1,272 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+const cpnToolsGlobbox = `<globbox>
+      <block id="b1"><id>Standard declarations</id>
+        <color id="c1"><id>UNIT</id><unit/><layout>colset UNIT = unit;</layout></color>
+        <color id="c2"><id>INT</id><int/></color>
+        <color id="c3"><id>STRING</id><string/></color>
+        <color id="c4"><id>Colour</id><enum><id>red</id><id>green</id></enum></color>
+        <color id="c5"><id>Item</id><record><recordfield><id>id</id><id>INT</id></recordfield><recordfield><id>name</id><id>STRING</id></recordfield></record></color>
+        <color id="c6"><id>Small</id><int><with><ml>1</ml><ml>10</ml></with></int></color>
+        <color id="c7"><id>Result</id><union><unionfield><id>Ok</id><type><id>INT</id></type></unionfield><unionfield><id>Failed</id></unionfield></union></color>
+        <color id="c8"><id>Even</id><subset><id>INT</id><by><ml>fn n => n mod 2 = 0</ml></by></subset></color>
+        <var id="v1"><type><id>INT</id></type><id>n</id><id>m</id></var>
+        <var id="v2"><type><id>Colour</id></type><id>c</id></var>
+        <var id="v3"><type><id>Item</id></type><id>r</id></var>
+        <block id="b2"><id>Values</id>
+          <ml id="ml1">val LIMIT = 3;<layout>val LIMIT = 3;</layout></ml>
+          <ml id="ml2">fun double x = 2 * x;</ml>
+        </block>
+      </block>
+    </globbox>`
+
+const cpnToolsModel = `<?xml version="1.0" encoding="iso-8859-1"?>
+<workspaceElements>
+  <generator tool="CPN Tools" version="4.0.1" format="6"/>
+  <cpnet>
+    ` + cpnToolsGlobbox + `
+    <page id="top">
+      <pageattr name="Order Flow"/>
+      <place id="start"><posattr x="-84.0" y="42.0"/><text>Start</text>
+        <type id="start_t"><text tool="CPN Tools" version="4.0.1">INT</text></type>
+        <initmark id="start_m"><text tool="CPN Tools" version="4.0.1">1` + "`" + `1 ++ 1` + "`" + `2</text></initmark>
+      </place>
+      <place id="lights"><posattr x="0" y="100"/><text>Lights</text>
+        <type><text>Colour</text></type>
+        <initmark><text>2` + "`" + `red@5</text></initmark>
+      </place>
+      <place id="mid"><posattr x="0" y="0"/><text>Mid</text><type><text>INT</text></type></place>
+      <place id="done"><posattr x="84" y="0"/><text>Done</text><type><text>INT</text></type></place>
+      <trans id="t1"><posattr x="-42" y="0"/><text>Prepare</text>
+        <cond><text>[n &lt; LIMIT]</text></cond>
+        <code><text>input (n);
+output (m);
+action n + 1;</text></code>
+        <priority><text>P_HIGH</text></priority>
+      </trans>
+      <trans id="t2"><posattr x="42" y="0"/><text>Handle</text>
+        <subst subpage="child" portsock="(cin,mid)(cout,done)"><subpageinfo id="spi"/></subst>
+      </trans>
+      <arc id="a1" orientation="PtoT" order="1"><transend idref="t1"/><placeend idref="start"/><annot><text>n</text></annot></arc>
+      <arc id="a2" orientation="TtoP" order="1"><transend idref="t1"/><placeend idref="mid"/><annot><text>m</text></annot></arc>
+      <arc id="a3" orientation="PtoT" order="1"><transend idref="t2"/><placeend idref="mid"/><annot><text>m</text></annot></arc>
+      <arc id="a4" orientation="TtoP" order="1"><transend idref="t2"/><placeend idref="done"/><annot><text>m</text></annot>
+        <bendpoint id="bp"><posattr x="60" y="20"/></bendpoint>
+      </arc>
+    </page>
+    <page id="child">
+      <pageattr name="Handle Order"/>
+      <place id="cin"><posattr x="0" y="0"/><text>In</text><type><text>INT</text></type><port id="p1" type="In"/></place>
+      <place id="cout"><posattr x="80" y="0"/><text>Out</text><type><text>INT</text></type><port id="p2" type="Out"/></place>
+      <trans id="w"><posattr x="40" y="0"/><text>Work</text><time><text>@+5</text></time></trans>
+      <trans id="w2"><posattr x="40" y="40"/><text>Check</text>
+        <cond><text>if n &gt; 0 then true else false</text></cond>
+      </trans>
+      <arc id="c1a" orientation="PtoT"><transend idref="w"/><placeend idref="cin"/><annot><text>n</text></annot></arc>
+      <arc id="c1b" orientation="TtoP"><transend idref="w"/><placeend idref="cout"/><annot><text>n</text></annot></arc>
+      <arc id="c2a" orientation="PtoT"><transend idref="w2"/><placeend idref="cin"/><annot><text>double n</text></annot></arc>
+    </page>
+  </cpnet>
+</workspaceElements>`
+
+func findIssue(report *models.ConversionReport, element, fragment string) *models.ConversionIssue {
+	for i, issue := range report.Issues {
+		if issue.Element == element && strings.Contains(issue.Message, fragment) {
+			return &report.Issues[i]
+		}
+	}
+	return nil
+}
+
+func TestCPNToolsImport(t *testing.T) {
+	defs, report, err := models.NewCPNParser().ParseCPNTools([]byte(cpnToolsModel), "")
+	if err != nil {
+		t.Fatalf("Failed to parse CPN Tools model: %v", err)
+	}
+	if len(defs) != 2 || defs[0].ID != "Order_Flow" || defs[1].ID != "Order_Flow_Handle_Order" {
+		t.Fatalf("Expected the main net and one child net, got %d nets", len(defs))
+	}
+	main, child := defs[0], defs[1]
+
+	expected := []string{
+		"colset UNIT = unit;",
+		"colset INT = int;",
+		"colset STRING = string;",
+		"colset Colour = with red | green;",
+		"colset Item = record id:INT * name:STRING;",
+		"colset Small = int[1..10];",
+		"colset Result = union Ok:INT + Failed;",
+		"colset Even = INT;",
+	}
+	if strings.Join(main.ColorSets, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected color sets %v", main.ColorSets)
+	}
+	if main.Declarations != "LIMIT = 3" {
+		t.Errorf("Unexpected declarations %q", main.Declarations)
+	}
+	if p := main.Places[0]; p.Name != "Start" || p.ColorSet != "INT" || p.Position == nil || p.Position.X != -84 || p.Position.Y != -42 {
+		t.Errorf("Unexpected place %+v", p)
+	}
+	if tokens := main.InitialMarking["lights"]; len(tokens) != 1 || tokens[0].Value != "red" || tokens[0].Count != 2 || tokens[0].Timestamp != 5 {
+		t.Errorf("Unexpected marking of Lights %+v", tokens)
+	}
+
+	t1 := main.Transitions[0]
+	if t1.GuardExpression != "n < LIMIT" || t1.ActionExpression != "m = n + 1" || t1.Priority == nil || *t1.Priority != models.PriorityHigh {
+		t.Errorf("Unexpected transition %+v", t1)
+	}
+	if len(main.SubWorkflows) != 1 {
+		t.Fatalf("Expected a sub workflow for the substitution transition, got %+v", main.SubWorkflows)
+	}
+	sw := main.SubWorkflows[0]
+	if sw.CPNID != child.ID || sw.CallTransitionID != "t2" || sw.InputMapping["m"] != "n" || sw.OutputMapping["n"] != "m" {
+		t.Errorf("Unexpected sub workflow %+v", sw)
+	}
+	if len(child.EndPlaces) != 1 || child.EndPlaces[0] != "cout" || child.Transitions[0].TransitionDelay != 5 {
+		t.Errorf("Unexpected child net: end places %v, transitions %+v", child.EndPlaces, child.Transitions)
+	}
+
+	if g := child.Transitions[1].GuardExpression; !strings.HasPrefix(g, `error("untranslated CPN ML: if n > 0`) {
+		t.Errorf("Expected a placeholder guard, got %q", g)
+	}
+	for _, element := range []string{"w2", "c2a", "ml2", "c8", "t2"} {
+		if issue := findIssue(report, element, ""); issue == nil || !issue.ManualReview {
+			t.Errorf("Expected %s to be flagged for review, got %+v", element, report.Issues)
+		}
+	}
+	if issue := findIssue(report, "a4", "bend points"); issue == nil || issue.ManualReview {
+		t.Errorf("Expected a plain issue for the bend points, got %+v", report.Issues)
+	}
+}
+
+// cpnToolsGuard imports a one-transition model with the guard and returns the translated guard
+func cpnToolsGuard(t *testing.T, guard string) (string, *models.ConversionReport) {
+	t.Helper()
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(guard))
+	model := `<workspaceElements><cpnet>` + cpnToolsGlobbox + `
+    <page id="pg"><pageattr name="P"/><trans id="t"><text>T</text><cond><text>` + escaped.String() + `</text></cond></trans></page>
+  </cpnet></workspaceElements>`
+	defs, report, err := models.NewCPNParser().ParseCPNTools([]byte(model), "net")
+	if err != nil {
+		t.Fatalf("Failed to parse model: %v", err)
+	}
+	return defs[0].Transitions[0].GuardExpression, report
+}
+
+func TestCPNMLTranslation(t *testing.T) {
+	tests := []struct {
+		ml, lua string
+	}{
+		{"[n <> m, n >= 0]", "n ~= m and n >= 0"},
+		{"n = 1 orelse m = 2 andalso c = green", `n == 1 or m == 2 and c == "green"`},
+		{"(n + 1) * 2 = m", "(n + 1) * 2 == m"},
+		{"n div 2 + n mod 2 = ~m", "math.floor(n / 2) + n % 2 == -(m)"},
+		{"~ ~n = n", "-(-(n)) == n"},
+		{`size (#name r ^ "!") = length (#name r)`, `#(r.name .. "!") == #r.name`},
+		{"hd [n, m] = n", "({n, m})[1] == n"},
+		{`#name r ^ "!" = "a!"`, `r.name .. "!" == "a!"`},
+		{"Colour.succ c = red", `cs.succ("Colour", c) == "red"`},
+		{"Int.toString (#id r) = \"1\"", `tostring(r.id) == "1"`},
+		{"not (n < LIMIT)", "not (n < LIMIT)"},
+		{"Colour.size() = 2 andalso Small.mem n", `cs.size("Colour") == 2 and cs.member("Small", n)`},
+	}
+	for _, tc := range tests {
+		got, report := cpnToolsGuard(t, tc.ml)
+		if got != tc.lua {
+			t.Errorf("%s: expected %q, got %q (%+v)", tc.ml, tc.lua, got, report.Issues)
+		}
+	}
+
+	for _, ml := range []string{"let val x = n in x > 0 end", "double n > 0", "n :: [] = []", "unknown = 1"} {
+		got, report := cpnToolsGuard(t, ml)
+		if issue := findIssue(report, "t", "not translated"); issue == nil || !issue.ManualReview || !strings.HasPrefix(got, "error(") {
+			t.Errorf("%s: expected a placeholder flagged for review, got %q (%+v)", ml, got, report.Issues)
+		}
+	}
+}
+
+func TestCPNToolsInscriptions(t *testing.T) {
+	model := strings.Replace(cpnToolsModel, "<annot><text>m</text></annot></arc>\n      <arc id=\"a3\"",
+		"<annot><text>1`m ++ 2`(m + 1) @+ 3</text></annot></arc>\n      <arc id=\"a3\"", 1)
+	model = strings.Replace(model, "<annot><text>n</text></annot></arc>\n      <arc id=\"a2\"",
+		"<annot><text>n</text></annot></arc>\n      <arc id=\"a5\" orientation=\"TtoP\"><transend idref=\"t1\"/><placeend idref=\"lights\"/><annot><text>empty</text></annot></arc>\n      <arc id=\"a2\"", 1)
+	defs, report, err := models.NewCPNParser().ParseCPNTools([]byte(model), "flow")
+	if err != nil {
+		t.Fatalf("Failed to parse CPN Tools model: %v", err)
+	}
+	for _, arc := range defs[0].Arcs {
+		if arc.ID == "a2" && arc.Expression != "1'm ++ 2'delay(m + 1, 3)" {
+			t.Errorf("Unexpected multiset inscription %q", arc.Expression)
+		}
+		if arc.ID == "a5" {
+			t.Errorf("Expected the empty inscription to be dropped, got %+v", arc)
+		}
+	}
+	if findIssue(report, "a5", "empty multiset") == nil {
+		t.Errorf("Expected an issue for the dropped arc, got %+v", report.Issues)
+	}
+}
+
+func TestCPNToolsRuntimeImport(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	cpns, report, err := rt.ImportCPNTools(ctx, []byte(cpnToolsModel), "flow")
+	if err != nil {
+		t.Fatalf("Failed to import CPN Tools model: %v", err)
+	}
+	if len(cpns) != 2 || cpns[0].ID != "flow" || cpns[1].ID != "flow_Handle_Order" || !report.NeedsReview() {
+		t.Fatalf("Unexpected import result: %d nets, report %+v", len(cpns), report.Issues)
+	}
+	if _, err := rt.SimulateSteps(ctx, "flow", 2); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ := rt.Marking("flow")
+	if len(marking.GetTokens("start")) != 0 || marking.CountTokensWithValue("mid", 2)+marking.CountTokensWithValue("mid", 3) != 2 {
+		t.Errorf("Expected Prepare to move both orders to Mid, got %v", marking.Places)
+	}
+}
+
+func TestAPICPNToolsImport(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	req := httptest.NewRequest("POST", "/api/cpn/import/cpntools?id=orders", bytes.NewBufferString(cpnToolsModel))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data api.NetsImportResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data.CPNs) != 2 || response.Data.CPNs[0].ID != "orders" || !response.Data.Report.NeedsReview() {
+		t.Errorf("Unexpected import response %+v", response.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/import/cpntools", bytes.NewBufferString("<pnml/>")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid model, got %d", rr.Code)
+	}
+}
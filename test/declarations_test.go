@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+func declarationsCPN(id, declarations string) []byte {
+	def := map[string]interface{}{
+		"id": id, "name": id,
+		"colorSets":    []string{"colset INT = int;"},
+		"declarations": declarations,
+		"places": []map[string]string{
+			{"id": "p1", "name": "In", "colorSet": "INT"},
+			{"id": "p2", "name": "Out", "colorSet": "INT"},
+		},
+		"transitions": []map[string]string{
+			{"id": "t1", "name": "Scale", "kind": "Auto", "guardExpression": "accept(x)"},
+		},
+		"arcs": []map[string]string{
+			{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+			{"id": "a2", "sourceId": "t1", "targetId": "p2", "expression": "scale(x) + OFFSET[kind]", "direction": "OUT"},
+		},
+		"initialMarking": map[string]interface{}{"In": []map[string]int{{"value": 5}}},
+	}
+	data, _ := json.Marshal(def)
+	return data
+}
+
+func TestNetDeclarations(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	nets := map[string]string{
+		"double": "FACTOR = 2\nkind = 'small'\nOFFSET = {small = 1, large = 100}\nfunction scale(v) return v * FACTOR end\nfunction accept(v) return v < 10 end",
+		"triple": "local factor = 3\nkind = 'large'\nOFFSET = {small = 1, large = 100}\nfunction scale(v) return math.floor(v * factor) end\nfunction accept(v) return v > 0 end",
+	}
+	for id, declarations := range nets {
+		if _, err := rt.LoadCPNJSON(ctx, declarationsCPN(id, declarations)); err != nil {
+			t.Fatalf("Failed to load %s: %v", id, err)
+		}
+	}
+
+	expected := map[string]interface{}{"double": 11, "triple": 115}
+	for id, value := range expected {
+		marking, err := rt.FireTransition(ctx, id, "t1")
+		if err != nil {
+			t.Fatalf("Failed to fire transition of %s: %v", id, err)
+		}
+		if tokens := marking.GetTokens("p2"); len(tokens) != 1 || tokens[0].Value != value {
+			t.Errorf("Expected %v in %s, got %v", value, id, tokens)
+		}
+	}
+
+	// Declarations round-trip through the JSON definition
+	data, err := rt.ExportCPN("double")
+	if err != nil {
+		t.Fatalf("Failed to export CPN: %v", err)
+	}
+	var exported models.CPNDefinitionJSON
+	if err := json.Unmarshal(data, &exported); err != nil || exported.Declarations != nets["double"] {
+		t.Errorf("Declarations did not round-trip: %q (%v)", exported.Declarations, err)
+	}
+
+	// Declarations of one net are invisible to others
+	if _, err := rt.LoadCPNJSON(ctx, declarationsCPN("plain", "")); err != nil {
+		t.Fatalf("Failed to load plain: %v", err)
+	}
+	if _, err := rt.EnabledTransitions(ctx, "plain"); err == nil || !strings.Contains(err.Error(), "accept") {
+		t.Errorf("Expected undefined accept() in plain net, got %v", err)
+	}
+
+	// Compile and runtime errors are reported at load
+	for _, bad := range []string{"function scale(v) return v *", "error('boom')"} {
+		if _, err := rt.LoadCPNJSON(ctx, declarationsCPN("broken", bad)); err == nil || !strings.Contains(err.Error(), "declarations of CPN broken") {
+			t.Errorf("Expected declarations error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestNetGlobalsAreIsolated(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	net := func(id, declarations, guard, action string, token int) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id": id, "name": id,
+			"colorSets":    []string{"colset INT = int;"},
+			"declarations": declarations,
+			"places": []map[string]string{
+				{"id": "p1", "name": "In", "colorSet": "INT"},
+				{"id": "p2", "name": "Out", "colorSet": "INT"},
+			},
+			"transitions": []map[string]string{
+				{"id": "t1", "name": "T", "kind": "Auto", "guardExpression": guard, "actionExpression": action},
+			},
+			"arcs": []map[string]string{
+				{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+				{"id": "a2", "sourceId": "t1", "targetId": "p2", "expression": "x", "direction": "OUT"},
+			},
+			"initialMarking": map[string]interface{}{"In": []map[string]int{{"value": token}}},
+		})
+		return data
+	}
+	if _, err := rt.LoadCPNJSON(ctx, net("a", "", "", "limit = 99", 1)); err != nil {
+		t.Fatalf("Failed to load a: %v", err)
+	}
+	if _, err := rt.LoadCPNJSON(ctx, net("b", "limit = 3", "x < limit", "", 50)); err != nil {
+		t.Fatalf("Failed to load b: %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "a", "t1"); err != nil {
+		t.Fatalf("Failed to fire a: %v", err)
+	}
+	if enabled, err := rt.EnabledTransitions(ctx, "b"); err != nil || len(enabled) != 0 {
+		t.Errorf("Expected the action globals of a to be invisible to b, got %v (%v)", enabled, err)
+	}
+}
+
+func TestFailedLoadKeepsNetGlobals(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	net := func(guard string) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id": "once", "name": "once",
+			"colorSets":    []string{"colset INT = int;"},
+			"declarations": "seen = 0",
+			"places": []map[string]string{
+				{"id": "p1", "name": "In", "colorSet": "INT"},
+				{"id": "p2", "name": "Out", "colorSet": "INT"},
+			},
+			"transitions": []map[string]string{
+				{"id": "t1", "name": "T", "kind": "Auto", "guardExpression": guard, "actionExpression": "seen = 1"},
+			},
+			"arcs": []map[string]string{
+				{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+				{"id": "a2", "sourceId": "t1", "targetId": "p2", "expression": "x", "direction": "OUT"},
+			},
+			"initialMarking": map[string]interface{}{"In": []map[string]int{{"value": 1}, {"value": 2}}},
+		})
+		return data
+	}
+	if _, err := rt.LoadCPNJSON(ctx, net("seen == 0")); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "once", "t1"); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+
+	// A version that fails to compile must not redeclare the globals of the loaded one
+	if _, err := rt.LoadCPNJSON(ctx, net("seen ==")); err == nil {
+		t.Fatal("Expected the broken guard to be rejected")
+	}
+	if enabled, err := rt.EnabledTransitions(ctx, "once"); err != nil || len(enabled) != 0 {
+		t.Errorf("Expected seen to stay 1, got enabled %v (%v)", enabled, err)
+	}
+
+	// A new version gets globals of its own
+	cpn, err := rt.LoadCPNJSON(ctx, net("seen == 0"))
+	if err != nil || cpn.Version != 2 {
+		t.Fatalf("Expected version 2, got %v (%v)", cpn, err)
+	}
+	if enabled, err := rt.EnabledTransitions(ctx, "once"); err != nil || len(enabled) != 1 {
+		t.Errorf("Expected t1 enabled on version 2, got %v (%v)", enabled, err)
+	}
+}
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// createLanesCPN builds independent lanes p<l>_0 -> t<l>_0 -> p<l>_1 -> ... -> p<l>_<length>,
+// guarding the transitions of lane l with guard(l) if given
+func createLanesCPN(lanes, length int, guard func(lane int) string) *models.CPN {
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn := models.NewCPN("lanes", "Lanes", "Independent sequential lanes")
+	for l := 0; l < lanes; l++ {
+		for s := 0; s <= length; s++ {
+			cpn.AddPlace(models.NewPlace(fmt.Sprintf("p%d_%d", l, s), fmt.Sprintf("P%d.%d", l, s), intCS))
+		}
+		for s := 0; s < length; s++ {
+			id := fmt.Sprintf("t%d_%d", l, s)
+			if guard != nil {
+				cpn.AddTransition(models.NewTransitionWithGuard(id, id, guard(l), nil))
+			} else {
+				cpn.AddTransition(models.NewTransition(id, id))
+			}
+			cpn.AddArc(models.NewInputArc("in_"+id, fmt.Sprintf("p%d_%d", l, s), id, "x"))
+			cpn.AddArc(models.NewOutputArc("out_"+id, id, fmt.Sprintf("p%d_%d", l, s+1), "x + 1"))
+		}
+	}
+	return cpn
+}
+
+func lanesMarking(lanes int) *models.Marking {
+	marking := models.NewMarking()
+	for l := 0; l < lanes; l++ {
+		marking.AddToken(fmt.Sprintf("p%d_0", l), models.NewToken(0, 0))
+	}
+	return marking
+}
+
+func TestIncrementalEnablementReevaluatesAdjacentTransitions(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	calls := make(map[int]int)
+	err := eng.RegisterFunction(expression.Function{
+		Namespace: "probe", Name: "lane",
+		Signature: expression.Signature{Params: []expression.ValueType{expression.TypeInt}, Result: expression.TypeBool},
+		Call: func(args []interface{}) (interface{}, error) {
+			calls[args[0].(int)]++
+			return true, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register function: %v", err)
+	}
+
+	cpn := createLanesCPN(2, 2, func(lane int) string { return fmt.Sprintf("probe.lane(%d)", lane) })
+	marking := lanesMarking(2)
+
+	enabled, _, err := eng.GetEnabledTransitions(cpn, marking)
+	if err != nil || len(enabled) != 2 {
+		t.Fatalf("Expected 2 enabled transitions, got %d (%v)", len(enabled), err)
+	}
+	if calls[0] != 2 || calls[1] != 2 { // one guard per transition and lane
+		t.Fatalf("Unexpected guard evaluations %v", calls)
+	}
+
+	_, bindings, _ := eng.IsEnabled(cpn, cpn.GetTransition("t0_0"), marking)
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t0_0"), bindings[0], marking); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	enabled, bindingsMap, err := eng.GetEnabledTransitions(cpn, marking)
+	if err != nil || len(enabled) != 2 || bindingsMap["t0_1"] == nil || bindingsMap["t1_0"] == nil {
+		t.Fatalf("Expected t0_1 and t1_0 to be enabled, got %v (%v)", enabled, err)
+	}
+	// Only lane 0 touches the changed places
+	if calls[0] != 4 || calls[1] != 2 {
+		t.Errorf("Expected only lane 0 to be re-evaluated, got %v", calls)
+	}
+
+	// A clone starts without cached bindings
+	clone := marking.Clone()
+	if _, _, err := eng.GetEnabledTransitions(cpn, clone); err != nil || calls[1] != 4 {
+		t.Errorf("Expected clone to evaluate all guards, got %v (%v)", calls, err)
+	}
+}
+
+func TestIncrementalEnablementTimedTokens(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createLanesCPN(1, 1, nil)
+	cpn.GetPlace("p0_0").ColorSet = models.NewIntegerColorSet("TINT", true)
+	marking := models.NewMarking()
+	marking.AddToken("p0_0", models.NewToken(0, 5))
+
+	if enabled, _, _ := eng.IsEnabled(cpn, cpn.GetTransition("t0_0"), marking); enabled {
+		t.Fatal("Transition must wait for its token")
+	}
+	marking.AdvanceGlobalClock(5)
+	if enabled, _, _ := eng.IsEnabled(cpn, cpn.GetTransition("t0_0"), marking); !enabled {
+		t.Error("Clock advance must re-evaluate a transition waiting for a token")
+	}
+}
+
+func TestIncrementalEnablementNetFunctionsAndGlobals(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	// A declared function reading the clock is re-evaluated when time passes
+	cpn := createLanesCPN(1, 1, func(int) string { return "ready()" })
+	cpn.Declarations = "function ready() return global_clock >= 5 end"
+	marking := lanesMarking(1)
+	if enabled, _, err := eng.IsEnabled(cpn, cpn.GetTransition("t0_0"), marking); err != nil || enabled {
+		t.Fatalf("Expected t0_0 to wait for the clock, got %v (%v)", enabled, err)
+	}
+	marking.AdvanceGlobalClock(10)
+	if enabled, _, err := eng.IsEnabled(cpn, cpn.GetTransition("t0_0"), marking); err != nil || !enabled {
+		t.Errorf("Expected t0_0 to be enabled after the clock advance, got %v (%v)", enabled, err)
+	}
+
+	// Globals of the net read by a guard are re-read once an action assigns them
+	cpn = createLanesCPN(2, 1, func(lane int) string { return []string{"true", "x < limit"}[lane] })
+	cpn.Declarations = "limit = 0"
+	cpn.GetTransition("t0_0").SetAction("limit = 10")
+	marking = lanesMarking(2)
+	if enabled, _, err := eng.IsEnabled(cpn, cpn.GetTransition("t1_0"), marking); err != nil || enabled {
+		t.Fatalf("Expected t1_0 to be disabled by the limit, got %v (%v)", enabled, err)
+	}
+	_, bindings, _ := eng.IsEnabled(cpn, cpn.GetTransition("t0_0"), marking)
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t0_0"), bindings[0], marking); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if enabled, _, err := eng.IsEnabled(cpn, cpn.GetTransition("t1_0"), marking); err != nil || !enabled {
+		t.Errorf("Expected t1_0 to be enabled after the limit was raised, got %v (%v)", enabled, err)
+	}
+}
+
+func TestIncrementalEnablementMatchesFullRescan(t *testing.T) {
+	run := func(incremental bool) (int, string) {
+		eng := engine.NewEngine()
+		defer eng.Close()
+		eng.SetIncrementalEnablement(incremental)
+		cpn := createLanesCPN(5, 4, func(int) string { return "x < 3" })
+		marking := lanesMarking(5)
+		fired, err := eng.FireEnabledTransitions(cpn, marking)
+		if err != nil {
+			t.Fatalf("Failed to fire transitions: %v", err)
+		}
+		return fired, marking.String()
+	}
+
+	fired, final := run(true)
+	expectedFired, expectedFinal := run(false)
+	if fired != expectedFired || final != expectedFinal {
+		t.Errorf("Incremental run fired %d to %s, full rescan fired %d to %s", fired, final, expectedFired, expectedFinal)
+	}
+	if fired != 15 {
+		t.Errorf("Expected 15 firings, got %d", fired)
+	}
+}
+
+func BenchmarkLargeNetFiring(b *testing.B) {
+	for _, incremental := range []bool{true, false} {
+		name := "incremental"
+		if !incremental {
+			name = "full-rescan"
+		}
+		b.Run(name, func(b *testing.B) {
+			eng := engine.NewEngine()
+			defer eng.Close()
+			eng.SetIncrementalEnablement(incremental)
+			cpn := createLanesCPN(100, 5, func(int) string { return "x >= 0" })
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				marking := lanesMarking(100)
+				if fired, err := eng.FireEnabledTransitions(cpn, marking); err != nil || fired != 500 {
+					b.Fatalf("Expected 500 firings, got %d (%v)", fired, err)
+				}
+			}
+		})
+	}
+}
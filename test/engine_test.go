@@ -139,7 +139,7 @@ func TestTransitionDelay(t *testing.T) {
 	// Create CPN with delayed transition
 	cpn := models.NewCPN("delayed-cpn", "Delayed CPN", "CPN with delay")
 
-	intCS := models.NewIntegerColorSet("INT", false)
+	intCS := models.NewIntegerColorSet("INT", true)
 
 	place1 := models.NewPlace("p1", "Place1", intCS)
 	place2 := models.NewPlace("p2", "Place2", intCS)
@@ -178,15 +178,15 @@ func TestTransitionDelay(t *testing.T) {
 		t.Fatalf("Failed to fire transition: %v", err)
 	}
 
-	// Check that global clock advanced
-	if marking.GlobalClock != 15 {
-		t.Errorf("Expected global clock 15, got %d", marking.GlobalClock)
+	// The delay applies to the produced token, the global clock stays
+	if marking.GlobalClock != 10 {
+		t.Errorf("Expected global clock 10, got %d", marking.GlobalClock)
 	}
 
 	// Check that token was produced
 	tokens := marking.GetTokens("p2")
-	if len(tokens) != 1 || tokens[0].Value != 42 {
-		t.Errorf("Expected token value 42 in Place2, got %v", tokens)
+	if len(tokens) != 1 || tokens[0].Value != 42 || tokens[0].Timestamp != 15 {
+		t.Errorf("Expected token 42@15 in Place2, got %v", tokens)
 	}
 }
 
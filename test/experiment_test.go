@@ -0,0 +1,250 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+// createQueueCPN builds a single server queue: jobs wait in "queue", are served with an
+// exponentially distributed service time and end up in "done".
+func createQueueCPN(jobs int) *models.CPN {
+	cpn := models.NewCPN("queue-cpn", "Queue", "Single server queue")
+	intCS := models.NewIntegerColorSet("INT", true)
+	cpn.AddPlace(models.NewPlace("queue", "Queue", intCS))
+	cpn.AddPlace(models.NewPlace("idle", "Idle", intCS))
+	cpn.AddPlace(models.NewPlace("busy", "Busy", intCS))
+	cpn.AddPlace(models.NewPlace("done", "Done", intCS))
+
+	cpn.AddTransition(models.NewTransition("start", "Start"))
+	cpn.AddTransition(models.NewTransition("finish", "Finish"))
+	cpn.AddArc(models.NewInputArc("a1", "queue", "start", "x"))
+	cpn.AddArc(models.NewInputArc("a2", "idle", "start", "s"))
+	cpn.AddArc(models.NewOutputArc("a3", "start", "busy", "delay(x, exponential(0.5))"))
+	cpn.AddArc(models.NewInputArc("a4", "busy", "finish", "x"))
+	cpn.AddArc(models.NewOutputArc("a5", "finish", "done", "x"))
+	cpn.AddArc(models.NewOutputArc("a6", "finish", "idle", "1"))
+
+	for i := 1; i <= jobs; i++ {
+		cpn.AddInitialToken("queue", models.NewToken(i, 0))
+	}
+	cpn.AddInitialToken("idle", models.NewToken(1, 0))
+	cpn.SetEndPlaces([]string{"done"})
+	return cpn
+}
+
+func TestExperimentPredicateStopAndStatistics(t *testing.T) {
+	cpn := createQueueCPN(5)
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	config := engine.ExperimentConfig{
+		Replications: 8,
+		Seed:         11,
+		Stop:         engine.StopCriteria{Predicate: "#places.done >= 5"},
+	}
+	result, err := eng.RunExperiment(cpn, config)
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	if len(result.Replications) != 8 {
+		t.Fatalf("Expected 8 replications, got %d", len(result.Replications))
+	}
+	for _, r := range result.Replications {
+		if r.StopReason != engine.StopReasonPredicate {
+			t.Errorf("Replication %d stopped with %s, expected predicate", r.Replication, r.StopReason)
+		}
+		if r.PlaceOccupancyMax["queue"] != 5 {
+			t.Errorf("Expected max queue length 5, got %d", r.PlaceOccupancyMax["queue"])
+		}
+	}
+
+	finish := result.Summary.TransitionFirings["finish"]
+	if finish.Mean != 5 || finish.HalfWidth != 0 {
+		t.Errorf("Expected finish to fire exactly 5 times per replication, got %+v", finish)
+	}
+	elapsed := result.Summary.ElapsedTime
+	if elapsed.Mean <= 0 || elapsed.HalfWidth <= 0 || elapsed.Lower > elapsed.Mean || elapsed.Upper < elapsed.Mean {
+		t.Errorf("Expected a proper confidence interval for elapsed time, got %+v", elapsed)
+	}
+	if wait, ok := result.Summary.WaitingTime["queue"]; !ok || wait.Mean <= 0 {
+		t.Errorf("Expected positive waiting time in queue, got %+v", wait)
+	}
+	if busy := result.Summary.PlaceOccupancyAvg["busy"]; busy.Mean <= 0 || busy.Mean > 1 {
+		t.Errorf("Expected server utilisation in (0, 1], got %+v", busy)
+	}
+	if result.Summary.Throughput.Mean <= 0 {
+		t.Errorf("Expected positive throughput, got %+v", result.Summary.Throughput)
+	}
+
+	// Same configuration reproduces the same results
+	again, err := eng.RunExperiment(cpn, config)
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Replications, again.Replications) {
+		t.Error("Same seed produced different replications")
+	}
+}
+
+func TestExperimentStopCriteria(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	result, err := eng.RunExperiment(createQueueCPN(50), engine.ExperimentConfig{
+		Replications: 3,
+		Stop:         engine.StopCriteria{MaxTime: 10},
+	})
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	for _, r := range result.Replications {
+		if r.StopReason != engine.StopReasonMaxTime || r.ElapsedTime != 10 {
+			t.Errorf("Expected stop at model time 10, got %s after %d", r.StopReason, r.ElapsedTime)
+		}
+	}
+
+	result, err = eng.RunExperiment(createQueueCPN(5), engine.ExperimentConfig{
+		Replications: 2,
+		Stop:         engine.StopCriteria{Completion: true},
+	})
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	if result.Summary.CompletionRate != 1 || result.Replications[0].Firings != 2 {
+		t.Errorf("Expected stop at first completion, got %+v", result.Replications[0])
+	}
+
+	result, err = eng.RunExperiment(createQueueCPN(5), engine.ExperimentConfig{
+		Replications: 1,
+		Stop:         engine.StopCriteria{MaxSteps: 3},
+	})
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	if r := result.Replications[0]; r.StopReason != engine.StopReasonMaxSteps || r.Steps != 3 {
+		t.Errorf("Expected stop after 3 steps, got %s after %d", r.StopReason, r.Steps)
+	}
+
+	result, err = eng.RunExperiment(createQueueCPN(2), engine.ExperimentConfig{Replications: 1})
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	if r := result.Replications[0]; r.StopReason != engine.StopReasonDead || r.TransitionFirings["finish"] != 2 {
+		t.Errorf("Expected dead marking after both jobs, got %+v", r)
+	}
+
+	if _, err := eng.RunExperiment(createQueueCPN(1), engine.ExperimentConfig{ConfidenceLevel: 0.5}); err == nil {
+		t.Error("Expected unsupported confidence level to be rejected")
+	}
+}
+
+func TestAPIRunExperiment(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	cpnDef := models.CPNDefinitionJSON{
+		ID:        "experiment-cpn",
+		Name:      "Experiment CPN",
+		ColorSets: []string{"colset INT = int timed;"},
+		Places: []models.PlaceJSON{
+			{ID: "p1", Name: "In", ColorSet: "INT"},
+			{ID: "p2", Name: "Out", ColorSet: "INT"},
+		},
+		Transitions: []models.TransitionJSON{{ID: "t1", Name: "Work", Kind: "Auto"}},
+		Arcs: []models.ArcJSON{
+			{ID: "a1", SourceID: "p1", TargetID: "t1", Expression: "x", Direction: "IN"},
+			{ID: "a2", SourceID: "t1", TargetID: "p1", Expression: "delay(x, uniform(1, 3))", Direction: "OUT"},
+		},
+		InitialMarking: map[string][]models.TokenJSON{"In": {{Value: 1, Timestamp: 0}}},
+	}
+	body, _ := json.Marshal(cpnDef)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/load", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Failed to load CPN: %s", rr.Body.String())
+	}
+
+	config := `{"replications": 4, "seed": 5, "stop": {"maxTime": 50}}`
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/experiment?id=experiment-cpn", bytes.NewBufferString(config)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response struct {
+		Success bool                    `json:"success"`
+		Data    engine.ExperimentResult `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !response.Success || len(response.Data.Replications) != 4 {
+		t.Fatalf("Unexpected experiment response: %s", rr.Body.String())
+	}
+	if firings := response.Data.Summary.TransitionFirings["t1"]; firings.Mean < 10 {
+		t.Errorf("Expected t1 to fire repeatedly within the horizon, got %+v", firings)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/experiment?id=missing", bytes.NewBufferString(config)))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown CPN, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/experiment?id=experiment-cpn", bytes.NewBufferString(`{"replications": 1001}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for too many replications, got %d", rr.Code)
+	}
+}
+
+// evenCounterCPNJSON counts up in steps of 2 through a place whose color set is a subset
+const evenCounterCPNJSON = `{
+	"id": "even", "name": "Even",
+	"declarations": "function isEven(n) return n % 2 == 0 end",
+	"colorSets": ["colset INT = int;", "colset Even = subset INT by isEven;"],
+	"places": [{"id": "p", "name": "P", "colorSet": "Even"}],
+	"transitions": [{"id": "t", "name": "T", "guardExpression": "x < 200"}],
+	"arcs": [
+		{"id": "a1", "sourceId": "p", "targetId": "t", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "t", "targetId": "p", "expression": "x + 2", "direction": "OUT"}
+	],
+	"initialMarking": {"P": [{"value": 0}]}
+}`
+
+func TestRuntimeExperimentRunsBesideSimulation(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(evenCounterCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+
+	// Subset predicates are evaluated by both engines at the same time
+	done := make(chan error)
+	go func() {
+		_, err := rt.SimulateSteps(ctx, "even", 100)
+		done <- err
+	}()
+	result, err := rt.RunExperiment(ctx, "even", petri.ExperimentConfig{Replications: 2})
+	if err != nil {
+		t.Fatalf("Experiment failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	if r := result.Replications[0]; r.StopReason != engine.StopReasonDead || r.TransitionFirings["t"] != 100 {
+		t.Errorf("Expected 100 firings up to 200, got %+v", r)
+	}
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+func TestGoFunctionRegistration(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+
+	rates := map[string]float64{"EUR": 1.1, "GBP": 1.25}
+	functions := []expression.Function{
+		{
+			Namespace: "fx", Name: "convert",
+			Signature: expression.Signature{Params: []expression.ValueType{expression.TypeReal, expression.TypeString}, Result: expression.TypeReal},
+			Call: func(args []interface{}) (interface{}, error) {
+				rate, ok := rates[args[1].(string)]
+				if !ok {
+					return nil, fmt.Errorf("unknown currency %s", args[1])
+				}
+				return args[0].(float64) * rate, nil
+			},
+		},
+		{
+			Namespace: "acme.text", Name: "join",
+			Signature: expression.Signature{Params: []expression.ValueType{expression.TypeString, expression.TypeString}, Variadic: true, Result: expression.TypeString},
+			Call: func(args []interface{}) (interface{}, error) {
+				parts := make([]string, 0, len(args)-1)
+				for _, arg := range args[1:] {
+					parts = append(parts, arg.(string))
+				}
+				return strings.Join(parts, args[0].(string)), nil
+			},
+		},
+		{
+			Namespace: "acme.text", Name: "split",
+			Signature: expression.Signature{Params: []expression.ValueType{expression.TypeString}, Result: expression.TypeList},
+			Call: func(args []interface{}) (interface{}, error) {
+				return strings.Split(args[0].(string), ","), nil // typed slice converts to a Lua list
+			},
+		},
+	}
+	for _, fn := range functions {
+		if err := evaluator.RegisterFunction(fn); err != nil {
+			t.Fatalf("Failed to register %s: %v", fn.QualifiedName(), err)
+		}
+	}
+
+	context := expression.NewEvaluationContext()
+	context.BindVariable("amount", models.NewToken(100, 0))
+	result, err := evaluator.EvaluateArcExpression("fx.convert(amount, 'EUR')", context)
+	if err != nil || result.(float64) < 109.99 || result.(float64) > 110.01 {
+		t.Errorf("Expected 110, got %v (%v)", result, err)
+	}
+	if ok, err := evaluator.EvaluateGuard("acme.text.join('-', 'a', 'b', 'c') == 'a-b-c'", context); err != nil || !ok {
+		t.Errorf("Variadic call failed: %v", err)
+	}
+	if result, err := evaluator.EvaluateArcExpression("#acme.text.split('x,y,z')", context); err != nil || result != 3 {
+		t.Errorf("Expected list of 3 items, got %v (%v)", result, err)
+	}
+
+	failures := map[string]string{
+		"fx.convert('ten', 'EUR')": "real expected",
+		"fx.convert(10)":           "called with 1 arguments",
+		"fx.convert(10, 'XYZ')":    "unknown currency XYZ",
+	}
+	for expr, message := range failures {
+		if _, err := evaluator.EvaluateArcExpression(expr, context); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error containing %q for %s, got %v", message, expr, err)
+		}
+	}
+
+	noop := func(args []interface{}) (interface{}, error) { return nil, nil }
+	invalid := []expression.Function{
+		{Name: "f", Call: noop},                        // no namespace
+		{Namespace: "math", Name: "f", Call: noop},     // shadows a Lua library
+		{Namespace: "tuple", Name: "f", Call: noop},    // shadows a CPN function
+		{Namespace: "fx", Name: "convert", Call: noop}, // duplicate
+		{Namespace: "fx", Name: "end", Call: noop},     // keyword
+		{Namespace: "fx", Name: "g"},                   // no implementation
+		{Namespace: "fx", Name: "h", Call: noop, Signature: expression.Signature{Params: []expression.ValueType{"money"}}},
+	}
+	for _, fn := range invalid {
+		if err := evaluator.RegisterFunction(fn); err == nil {
+			t.Errorf("Expected registration of %s.%s to fail", fn.Namespace, fn.Name)
+		}
+	}
+	if names := len(evaluator.Functions()); names != 3 {
+		t.Errorf("Expected 3 registered functions, got %d", names)
+	}
+}
+
+func TestRuntimeFunctionsInCPN(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	err := rt.RegisterFunction(petri.Function{
+		Namespace:   "fx",
+		Name:        "double",
+		Signature:   petri.Signature{Params: []petri.ValueType{petri.TypeInt}, Result: petri.TypeInt},
+		Description: "Doubles a value",
+		Call:        func(args []interface{}) (interface{}, error) { return args[0].(int) * 2, nil },
+	})
+	if err != nil {
+		t.Fatalf("Failed to register function: %v", err)
+	}
+
+	definition := strings.Replace(approvalCPNJSON, `"expression": "x + 1"`, `"expression": "fx.double(x)"`, 1)
+	if _, err := rt.LoadCPNJSON(ctx, []byte(definition)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	marking, err := rt.FireTransition(ctx, "approval", "t1")
+	if err != nil {
+		t.Fatalf("Failed to fire transition: %v", err)
+	}
+	if tokens := marking.GetTokens("p2"); len(tokens) != 1 || tokens[0].Value != 82 {
+		t.Errorf("Expected token 82, got %v", tokens)
+	}
+
+	server := api.NewServerWithRuntime(rt)
+	rec := httptest.NewRecorder()
+	server.ListFunctions(rec, httptest.NewRequest(http.MethodGet, "/api/functions", nil))
+	var response struct {
+		Data []api.FunctionInfo `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data) != 1 || response.Data[0].Name != "fx.double" || response.Data[0].Signature != "(int) -> int" {
+		t.Errorf("Unexpected function listing: %+v", response.Data)
+	}
+}
@@ -0,0 +1,178 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/pkg/petri"
+)
+
+// playShipping loads the shipping net and plays it to the end: the check (step 1), the approval
+// (step 2) and the delivery once the shipment arrives (step 3)
+func playShipping(t *testing.T, rt *petri.Runtime) {
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(shippingCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	if _, err := rt.SimulateStep(ctx, "shipping"); err != nil {
+		t.Fatalf("Failed to simulate: %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "shipping", "t2"); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if result, err := rt.SimulateStep(ctx, "shipping"); err != nil || !result.Completed {
+		t.Fatalf("Expected the net to complete, got %+v (%v)", result, err)
+	}
+}
+
+func TestStepBackAndForward(t *testing.T) {
+	var restored []petri.Event
+	rt := petri.New(petri.WithEventHandler(func(e petri.Event) {
+		if e.Type == petri.EventMarkingRestored {
+			restored = append(restored, e)
+		}
+	}))
+	defer rt.Close()
+	ctx := context.Background()
+	playShipping(t, rt)
+
+	result, err := rt.StepBack(ctx, "shipping", 1)
+	if err != nil || result.Step != 2 || result.Completed || result.Marking.CountTokens("p3") != 1 || result.Marking.GlobalClock != 0 {
+		t.Fatalf("Expected the marking after the approval, got %+v (%v)", result, err)
+	}
+	if result, _ = rt.StepBack(ctx, "shipping", 10); result.Step != 0 || result.Marking.CountTokens("p1") != 1 {
+		t.Errorf("Expected the initial marking, got %+v", result)
+	}
+	if _, err := rt.StepBack(ctx, "shipping", 1); !errors.Is(err, petri.ErrStepNotInHistory) {
+		t.Errorf("Expected ErrStepNotInHistory, got %v", err)
+	}
+
+	if result, _ = rt.StepForward(ctx, "shipping", 2); result.Step != 2 {
+		t.Errorf("Expected step 2, got %d", result.Step)
+	}
+	result, err = rt.GoToStep(ctx, "shipping", 3)
+	if err != nil || !result.Completed || result.Marking.GlobalClock != 5 {
+		t.Fatalf("Expected the completed marking, got %+v (%v)", result, err)
+	}
+	if _, err := rt.GoToStep(ctx, "shipping", 9); !errors.Is(err, petri.ErrStepNotInHistory) {
+		t.Errorf("Expected ErrStepNotInHistory, got %v", err)
+	}
+	if len(restored) != 4 || restored[3].Step != 3 {
+		t.Errorf("Expected four restore events, got %+v", restored)
+	}
+
+	// Firing after stepping back discards the undone steps
+	if _, err := rt.GoToStep(ctx, "shipping", 1); err != nil {
+		t.Fatalf("Failed to go to step 1: %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "shipping", "t2"); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if _, err := rt.StepForward(ctx, "shipping", 1); !errors.Is(err, petri.ErrStepNotInHistory) {
+		t.Errorf("Expected nothing to redo, got %v", err)
+	}
+	history, _ := rt.History("shipping")
+	if len(history.Entries) != 3 || !history.Entries[2].Current || history.Entries[2].Step != 2 {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	if _, err := rt.ResetCPN(ctx, "shipping"); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if history, _ := rt.History("shipping"); len(history.Entries) != 1 {
+		t.Errorf("Expected the reset to clear the history, got %+v", history)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	rt := petri.New(petri.WithHistoryLimit(2))
+	defer rt.Close()
+	playShipping(t, rt)
+
+	history, err := rt.History("shipping")
+	if err != nil || len(history.Entries) != 2 || history.Entries[0].Step != 2 {
+		t.Fatalf("Expected the last two markings, got %+v (%v)", history, err)
+	}
+	if _, err := rt.GoToStep(context.Background(), "shipping", 0); !errors.Is(err, petri.ErrStepNotInHistory) {
+		t.Errorf("Expected the initial marking to be dropped, got %v", err)
+	}
+}
+
+func TestAPIStepBack(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+	playShipping(t, server.Runtime())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/back?id=shipping&steps=2", nil))
+	var response struct {
+		Data api.SimulationStepResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK || response.Data.CurrentStep != 1 {
+		t.Fatalf("Expected step 1, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/forward?id=shipping", nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Data.CurrentStep != 2 {
+		t.Errorf("Expected step 2, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/goto?id=shipping&step=7", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/simulation/history?id=shipping", nil))
+	var history struct {
+		Data petri.History `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil || len(history.Data.Entries) != 4 || !history.Data.Entries[2].Current {
+		t.Errorf("Unexpected history %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// diceCPNJSON adds a die roll to the token on every firing
+const diceCPNJSON = `{
+	"id": "dice", "name": "Dice",
+	"colorSets": ["colset INT = int;"],
+	"places": [{"id": "p", "name": "P", "colorSet": "INT"}],
+	"transitions": [{"id": "t", "name": "Roll", "kind": "Auto"}],
+	"arcs": [
+		{"id": "a1", "sourceId": "p", "targetId": "t", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "t", "targetId": "p", "expression": "x * 10 + discrete(1, 6)", "direction": "OUT"}
+	],
+	"initialMarking": {"P": [{"value": 0}]}
+}`
+
+func TestStepBackContinuesRandomSource(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(diceCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	roll := func() interface{} {
+		result, err := rt.SimulateSteps(ctx, "dice", 3)
+		if err != nil {
+			t.Fatalf("Failed to simulate: %v", err)
+		}
+		return result.Marking.GetTokens("p")[0].Value
+	}
+	roll()
+	second := roll()
+	if _, err := rt.StepBack(ctx, "dice", 3); err != nil {
+		t.Fatalf("Failed to step back: %v", err)
+	}
+	if again := roll(); again != second {
+		t.Errorf("Expected the same rolls after stepping back, got %v and %v", second, again)
+	}
+}
@@ -0,0 +1,172 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+// layoutCPNJSON splits into two branches that join again, loops back for rework and declares
+// the lower branch first
+const layoutCPNJSON = `{
+	"id": "layout", "name": "Layout",
+	"colorSets": ["colset INT = int;"],
+	"places": [
+		{"id": "start", "name": "Start", "colorSet": "INT"},
+		{"id": "low", "name": "Low", "colorSet": "INT"},
+		{"id": "high", "name": "High", "colorSet": "INT"},
+		{"id": "lowDone", "name": "Low done", "colorSet": "INT"},
+		{"id": "highDone", "name": "High done", "colorSet": "INT"},
+		{"id": "end", "name": "End", "colorSet": "INT"}
+	],
+	"transitions": [
+		{"id": "split", "name": "Split"},
+		{"id": "doLow", "name": "Do low"},
+		{"id": "doHigh", "name": "Do high"},
+		{"id": "join", "name": "Join"},
+		{"id": "rework", "name": "Rework"}
+	],
+	"arcs": [
+		{"id": "a1", "sourceId": "start", "targetId": "split", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "split", "targetId": "high", "expression": "x", "direction": "OUT"},
+		{"id": "a3", "sourceId": "split", "targetId": "low", "expression": "x", "direction": "OUT"},
+		{"id": "a4", "sourceId": "low", "targetId": "doLow", "expression": "x", "direction": "IN"},
+		{"id": "a5", "sourceId": "doLow", "targetId": "lowDone", "expression": "x", "direction": "OUT"},
+		{"id": "a6", "sourceId": "high", "targetId": "doHigh", "expression": "x", "direction": "IN"},
+		{"id": "a7", "sourceId": "doHigh", "targetId": "highDone", "expression": "x", "direction": "OUT"},
+		{"id": "a8", "sourceId": "lowDone", "targetId": "join", "expression": "x", "direction": "IN"},
+		{"id": "a9", "sourceId": "highDone", "targetId": "join", "expression": "y", "direction": "IN"},
+		{"id": "a10", "sourceId": "join", "targetId": "end", "expression": "x + y", "direction": "OUT"},
+		{"id": "a11", "sourceId": "highDone", "targetId": "rework", "expression": "x", "direction": "IN"},
+		{"id": "a12", "sourceId": "rework", "targetId": "start", "expression": "x", "direction": "OUT"}
+	],
+	"initialMarking": {"start": [{"value": 1}]},
+	"endPlaces": ["End"]
+}`
+
+func TestAutoLayout(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	cpn, err := rt.LoadCPNJSON(context.Background(), []byte(layoutCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+
+	positions := models.AutoLayout(cpn)
+	if len(positions) != 11 {
+		t.Fatalf("Expected a position for every node, got %v", positions)
+	}
+	seen := make(map[models.Position]string)
+	for id, pos := range positions {
+		if other, dup := seen[pos]; dup {
+			t.Errorf("Nodes %s and %s share position %+v", id, other, pos)
+		}
+		seen[pos] = id
+	}
+
+	// The flow goes from the marked place to the end place despite the rework cycle
+	for _, path := range [][]string{{"start", "split", "low", "doLow", "lowDone", "join", "end"}, {"split", "high", "doHigh", "highDone", "rework"}} {
+		for i := 1; i < len(path); i++ {
+			if positions[path[i]].X <= positions[path[i-1]].X {
+				t.Errorf("Expected %s right of %s, got %+v and %+v", path[i], path[i-1], positions[path[i]], positions[path[i-1]])
+			}
+		}
+	}
+	for id, pos := range positions {
+		if pos.X > positions["end"].X {
+			t.Errorf("Expected the end place in the last layer, %s is at %+v", id, pos)
+		}
+	}
+
+	// Both branches keep their order through the layers, so their arcs do not cross
+	if (positions["high"].Y < positions["low"].Y) != (positions["doHigh"].Y < positions["doLow"].Y) {
+		t.Errorf("Expected the branches not to cross, got %v", positions)
+	}
+}
+
+func TestLayoutCPNWithSubWorkflows(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+	ctx := context.Background()
+
+	rt := server.Runtime()
+	child, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to load child CPN: %v", err)
+	}
+	parent := `{
+		"id": "parent", "name": "Parent",
+		"colorSets": ["colset INT = int;"],
+		"places": [{"id": "in", "name": "In", "colorSet": "INT"}, {"id": "out", "name": "Out", "colorSet": "INT"}],
+		"transitions": [{"id": "call", "name": "Call"}],
+		"arcs": [
+			{"id": "a1", "sourceId": "in", "targetId": "call", "expression": "x", "direction": "IN"},
+			{"id": "a2", "sourceId": "call", "targetId": "out", "expression": "x", "direction": "OUT"}
+		],
+		"initialMarking": {"in": [{"value": 1}]},
+		"endPlaces": ["out"],
+		"subWorkflows": [{"id": "sw", "cpnId": "approval", "callTransitionId": "call", "autoStart": true}]
+	}`
+	if _, err := rt.LoadCPNJSON(ctx, []byte(parent)); err != nil {
+		t.Fatalf("Failed to load parent CPN: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/layout?id=parent", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data struct {
+			CPN          models.CPNDefinitionJSON   `json:"cpn"`
+			SubWorkflows []models.CPNDefinitionJSON `json:"subWorkflows"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	def := response.Data.CPN
+	if def.ID != "parent" || def.Transitions[0].Position == nil || def.Places[1].Position == nil || def.Places[1].Position.X <= def.Transitions[0].Position.X {
+		t.Errorf("Expected the parent laid out from In to Out, got %+v", def)
+	}
+	if len(response.Data.SubWorkflows) != 1 || response.Data.SubWorkflows[0].ID != "approval" {
+		t.Fatalf("Expected the child CPN in the response, got %+v", response.Data.SubWorkflows)
+	}
+	if pos := response.Data.SubWorkflows[0].Places[2].Position; pos == nil {
+		t.Errorf("Expected the child CPN laid out")
+	}
+
+	if child.Places[2].Position != nil {
+		t.Errorf("Expected the loaded child CPN to be unchanged")
+	}
+
+	// Complete layouts are kept unless forced
+	laidOut := response.Data.SubWorkflows[0]
+	laidOut.Places[0].Position = &models.Position{X: 1, Y: 1}
+	if _, err := rt.LoadCPN(ctx, &laidOut); err != nil {
+		t.Fatalf("Failed to load the laid out child CPN: %v", err)
+	}
+	for query, keep := range map[string]bool{"id=approval": true, "id=approval&force=true": false} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/layout?"+query, nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if kept := *response.Data.CPN.Places[0].Position == (models.Position{X: 1, Y: 1}); kept != keep {
+			t.Errorf("%s: expected the layout kept %v, got %+v", query, keep, response.Data.CPN.Places[0].Position)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/layout?id=missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
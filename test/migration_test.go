@@ -0,0 +1,233 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+// approvalV2CPNJSON replaces the Checked place of the approval net by a Review place
+const approvalV2CPNJSON = `{
+	"id": "approval", "name": "Approval",
+	"colorSets": ["colset INT = int;"],
+	"places": [
+		{"id": "p1", "name": "Submitted", "colorSet": "INT"},
+		{"id": "review", "name": "Review", "colorSet": "INT"},
+		{"id": "p3", "name": "Done", "colorSet": "INT"}
+	],
+	"transitions": [
+		{"id": "t1", "name": "Check", "kind": "Auto"},
+		{"id": "t2", "name": "Approve", "kind": "Manual"}
+	],
+	"arcs": [
+		{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "t1", "targetId": "review", "expression": "x + 1", "direction": "OUT"},
+		{"id": "a3", "sourceId": "review", "targetId": "t2", "expression": "x", "direction": "IN"},
+		{"id": "a4", "sourceId": "t2", "targetId": "p3", "expression": "x", "direction": "OUT"}
+	],
+	"initialMarking": {"Submitted": [{"value": 41}]},
+	"endPlaces": ["Done"]
+}`
+
+// startApprovalCases loads the approval net, runs the given cases to the Checked place and
+// deploys the second version
+func startApprovalCases(t *testing.T, rt *petri.Runtime, caseIDs ...string) {
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	for _, caseID := range caseIDs {
+		if _, err := rt.CreateCase(ctx, caseID, "approval", caseID); err != nil {
+			t.Fatalf("Failed to create case: %v", err)
+		}
+		if err := rt.StartCase(ctx, caseID); err != nil {
+			t.Fatalf("Failed to start case: %v", err)
+		}
+		if _, err := rt.ExecuteAll(ctx, caseID); err != nil {
+			t.Fatalf("Failed to execute case: %v", err)
+		}
+	}
+	if _, err := rt.LoadCPNJSON(ctx, []byte(approvalV2CPNJSON)); err != nil {
+		t.Fatalf("Failed to load second version: %v", err)
+	}
+}
+
+func TestMigrateCase(t *testing.T) {
+	var migrated []petri.Event
+	rt := petri.New(petri.WithEventHandler(func(e petri.Event) {
+		if e.Type == petri.EventCaseMigrated {
+			migrated = append(migrated, e)
+		}
+	}))
+	defer rt.Close()
+	ctx := context.Background()
+	startApprovalCases(t, rt, "c1")
+
+	// Tokens of places missing from the new version must be mapped
+	result, err := rt.MigrateCase(ctx, "c1", &petri.MigrationPlan{}, true)
+	if err != nil || result.Valid() || result.Issues[0].PlaceID != "p2" {
+		t.Fatalf("Expected an issue for the Checked place, got %+v (%v)", result, err)
+	}
+	if _, err := rt.MigrateCase(ctx, "c1", &petri.MigrationPlan{}, false); !errors.Is(err, petri.ErrMigrationInvalid) {
+		t.Errorf("Expected ErrMigrationInvalid, got %v", err)
+	}
+
+	// Migrated tokens must conform to the color set of their new place
+	plan := &petri.MigrationPlan{
+		PlaceMapping: map[string]string{"Checked": "Review"},
+		Transformers: map[string]string{"p2": `"token " .. x`},
+	}
+	if result, _ := rt.MigrateCase(ctx, "c1", plan, true); result.Valid() || !strings.Contains(result.Issues[0].Message, "not a member") {
+		t.Errorf("Expected a color set issue, got %+v", result.Issues)
+	}
+
+	// An empty table drops the token
+	plan.Transformers["p2"] = "{}"
+	result, err = rt.MigrateCase(ctx, "c1", plan, true)
+	if err != nil || !result.Valid() || len(result.Diff) != 1 || result.Diff[0].PlaceID != "p2" || len(result.Diff[0].After) != 0 {
+		t.Errorf("Expected the token to be dropped, got %+v (%v)", result, err)
+	}
+
+	plan.Transformers["p2"] = "x * 10"
+	result, err = rt.MigrateCase(ctx, "c1", plan, true)
+	if err != nil || !result.Valid() || result.Applied || len(result.Diff) != 2 {
+		t.Fatalf("Expected a valid dry run with two changed places, got %+v (%v)", result, err)
+	}
+	if change := result.Diff[1]; change.PlaceID != "review" || len(change.After) != 1 || change.After[0].Value != 420 {
+		t.Errorf("Unexpected diff: %+v", result.Diff)
+	}
+	if case_, _ := rt.GetCase("c1"); case_.CPNVersion != 1 || case_.Marking.CountTokens("p2") != 1 {
+		t.Errorf("Expected the dry run to leave the case unchanged, got %v", case_.Marking)
+	}
+
+	result, err = rt.MigrateCase(ctx, "c1", plan, false)
+	if err != nil || !result.Applied || result.FromVersion != 1 || result.ToVersion != 2 {
+		t.Fatalf("Expected the migration to apply, got %+v (%v)", result, err)
+	}
+	if len(migrated) != 1 || migrated[0].CaseID != "c1" || migrated[0].Version != 2 {
+		t.Errorf("Expected one migration event, got %+v", migrated)
+	}
+
+	// The case continues on the new net
+	if err := rt.FireCaseTransition(ctx, "c1", "t2", 0); err != nil {
+		t.Fatalf("Failed to fire on the new version: %v", err)
+	}
+	case_, _ := rt.GetCase("c1")
+	if case_.CPNVersion != 2 || case_.Status != petri.CaseStatusCompleted || case_.Marking.GetTokens("p3")[0].Value != 420 {
+		t.Errorf("Expected the case completed on version 2 with 420, got %s", case_.Marking)
+	}
+	if _, err := rt.MigrateCase(ctx, "c1", plan, true); err == nil {
+		t.Errorf("Expected terminated cases not to migrate")
+	}
+}
+
+func TestMigrationRederivesWorkItems(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	startApprovalCases(t, rt, "c1")
+	if _, err := rt.CreateWorkItemsForCase(ctx, "c1"); err != nil {
+		t.Fatalf("Failed to create work items: %v", err)
+	}
+
+	// Work items of the old version are cancelled and derived anew from the migrated marking
+	plan := &petri.MigrationPlan{PlaceMapping: map[string]string{"Checked": "Review"}}
+	result, err := rt.MigrateCase(ctx, "c1", plan, true)
+	if err != nil || len(result.CancelledWorkItems) != 1 || result.CancelledWorkItems[0] != "c1-t2-0" || len(result.CreatedWorkItems) != 0 {
+		t.Fatalf("Expected the dry run to list the work item to cancel, got %+v (%v)", result, err)
+	}
+	if workItem, _ := rt.GetWorkItem("c1-t2-0"); workItem.IsTerminated() {
+		t.Errorf("Expected the dry run to leave the work item open, got %s", workItem.Status)
+	}
+	result, err = rt.MigrateCase(ctx, "c1", plan, false)
+	if err != nil || len(result.CancelledWorkItems) != 1 || len(result.CreatedWorkItems) != 1 || result.CreatedWorkItems[0] != "c1-t2-0-v2" {
+		t.Fatalf("Expected the work item to be re-derived, got %+v (%v)", result, err)
+	}
+	if workItem, _ := rt.GetWorkItem("c1-t2-0"); workItem.Status != models.WorkItemStatusCancelled {
+		t.Errorf("Expected the old work item cancelled, got %s", workItem.Status)
+	}
+	if err := rt.AllocateWorkItem(ctx, "c1-t2-0-v2", "ann"); err != nil {
+		t.Fatalf("Failed to allocate the re-derived work item: %v", err)
+	}
+	if err := rt.StartWorkItem(ctx, "c1-t2-0-v2"); err != nil {
+		t.Fatalf("Failed to start the re-derived work item: %v", err)
+	}
+	if err := rt.CompleteWorkItem(ctx, "c1-t2-0-v2"); err != nil {
+		t.Fatalf("Failed to complete the re-derived work item: %v", err)
+	}
+	if case_, _ := rt.GetCase("c1"); case_.Status != petri.CaseStatusCompleted {
+		t.Errorf("Expected the case completed, got %s", case_.Status)
+	}
+}
+
+func TestMigrateCasesInBulk(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	startApprovalCases(t, rt, "c1", "c2")
+	// c3 starts on version 2 and has nothing to map
+	if _, err := rt.CreateCase(ctx, "c3", "approval", "c3"); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+
+	if _, err := rt.MigrateCases(ctx, &petri.CaseFilter{CPNVersion: 1}, &petri.MigrationPlan{}, true); err == nil {
+		t.Errorf("Expected a filter without CPN to be rejected")
+	}
+	filter := &petri.CaseFilter{CPNID: "approval", CPNVersion: 1}
+	results, err := rt.MigrateCases(ctx, filter, &petri.MigrationPlan{}, false)
+	if !errors.Is(err, petri.ErrMigrationInvalid) || len(results) != 2 || results[0].Applied {
+		t.Fatalf("Expected an invalid bulk migration, got %+v (%v)", results, err)
+	}
+
+	results, err = rt.MigrateCases(ctx, filter, &petri.MigrationPlan{PlaceMapping: map[string]string{"p2": "review"}}, false)
+	if err != nil || len(results) != 2 || results[0].CaseID != "c1" || results[1].CaseID != "c2" {
+		t.Fatalf("Expected both cases migrated, got %+v (%v)", results, err)
+	}
+	cases, _ := rt.QueryCases(ctx, &petri.CaseQuery{Filter: &petri.CaseFilter{CPNID: "approval", CPNVersion: 2}})
+	if len(cases) != 3 {
+		t.Errorf("Expected all cases on version 2, got %d", len(cases))
+	}
+	if case_, _ := rt.GetCase("c2"); case_.Marking.GetTokens("review")[0].Value != 42 {
+		t.Errorf("Expected the token moved to Review, got %s", case_.Marking)
+	}
+}
+
+func TestAPIMigrateCase(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+	startApprovalCases(t, server.Runtime(), "c1")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/migrate?id=c1&dryRun=true", strings.NewReader(`{"placeMapping": {"p2": "review"}}`)))
+	var response struct {
+		Data petri.MigrationResult `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !response.Data.DryRun || response.Data.ToVersion != 2 || len(response.Data.Diff) != 2 {
+		t.Errorf("Unexpected dry run: %+v", response.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/migrate?id=c1", strings.NewReader(`{}`)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	body := `{"filter": {"cpnId": "approval"}, "plan": {"placeMapping": {"p2": "review"}}}`
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/migrate/bulk", strings.NewReader(body)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"applied":true`) {
+		t.Errorf("Expected the bulk migration to apply, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
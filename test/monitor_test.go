@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	case_manager "go-petri-flow/internal/case"
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+)
+
+const monitoredCPNJSON = `{
+	"id": "monitored", "name": "Monitored",
+	"colorSets": ["colset INT = int;"],
+	"places": [
+		{"id": "p1", "name": "In", "colorSet": "INT"},
+		{"id": "p2", "name": "Out", "colorSet": "INT"}
+	],
+	"transitions": [{"id": "t1", "name": "Move", "kind": "Auto"}],
+	"arcs": [
+		{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "t1", "targetId": "p2", "expression": "x", "direction": "OUT"}
+	],
+	"initialMarking": {"p1": [{"value": 1}, {"value": 2}, {"value": 3}, {"value": 4}, {"value": 5}]},
+	"monitors": [
+		{"id": "values", "name": "Moved values", "type": "DataCollector", "transitions": ["t1"], "expression": "x * 10"},
+		{"id": "stop", "name": "Three moved", "type": "Breakpoint", "expression": "#places.p2 >= 3"},
+		{"id": "sizes", "name": "Sizes", "type": "MarkingSize", "places": ["p1", "p2"]}
+	]
+}`
+
+func TestMonitorsParseAndRoundTrip(t *testing.T) {
+	parser := models.NewCPNParser()
+	cpn, err := parser.ParseCPNFromJSON([]byte(monitoredCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	if len(cpn.Monitors) != 3 || cpn.GetMonitor("stop").Type != models.MonitorTypeBreakpoint {
+		t.Fatalf("Unexpected monitors: %+v", cpn.Monitors)
+	}
+
+	data, err := parser.CPNToJSON(cpn)
+	if err != nil {
+		t.Fatalf("Failed to serialize CPN: %v", err)
+	}
+	roundTrip, err := models.NewCPNParser().ParseCPNFromJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to re-parse CPN: %v", err)
+	}
+	if m := roundTrip.GetMonitor("values"); m == nil || m.Expression != "x * 10" || len(m.Transitions) != 1 {
+		t.Errorf("Round trip lost monitor definition: %s", string(data))
+	}
+
+	invalid := []string{
+		`{"id": "m", "type": "DataCollector", "transitions": ["missing"], "expression": "1"}`,
+		`{"id": "m", "type": "Breakpoint"}`,
+		`{"id": "m", "type": "Histogram"}`,
+	}
+	for _, monitor := range invalid {
+		def := `{"id": "bad", "name": "Bad", "places": [], "transitions": [], "arcs": [], "monitors": [` + monitor + `]}`
+		if _, err := models.NewCPNParser().ParseCPNFromJSON([]byte(def)); err == nil {
+			t.Errorf("Expected monitor %s to be rejected", monitor)
+		}
+	}
+}
+
+func TestMonitorsRecordAndBreak(t *testing.T) {
+	cpn, err := models.NewCPNParser().ParseCPNFromJSON([]byte(monitoredCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	marking := cpn.CreateInitialMarking()
+	fired, err := eng.FireEnabledTransitions(cpn, marking)
+	if err != nil {
+		t.Fatalf("Failed to fire transitions: %v", err)
+	}
+	hit := marking.Monitors.PendingBreakpoint()
+	if fired != 3 || hit == nil || hit.MonitorID != "stop" || hit.Step != 3 {
+		t.Fatalf("Expected breakpoint after 3 firings, fired=%d hit=%+v", fired, hit)
+	}
+
+	values := marking.Monitors.Get("values")
+	if len(values.Observations) != 3 || values.Stats == nil || values.Stats.Sum != 60 {
+		t.Errorf("Unexpected data collector results: %+v", values)
+	}
+	sizes := marking.Monitors.Get("sizes")
+	if sizes.PlaceStats["p2"].Max != 3 || sizes.PlaceStats["p1"].Min != 2 {
+		t.Errorf("Unexpected marking size results: %+v", sizes.PlaceStats)
+	}
+
+	// Resuming fires one more transition, then the breakpoint holds again
+	fired, err = eng.FireEnabledTransitions(cpn, marking)
+	if err != nil {
+		t.Fatalf("Failed to fire transitions: %v", err)
+	}
+	if fired != 1 || marking.Monitors.Get("stop").Triggered != 2 {
+		t.Errorf("Expected one more firing before breaking again, fired=%d", fired)
+	}
+}
+
+func TestCaseExecuteAllStopsAtBreakpoint(t *testing.T) {
+	cpn, err := models.NewCPNParser().ParseCPNFromJSON([]byte(monitoredCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	manager := case_manager.NewManager(eng)
+	manager.RegisterCPN(cpn)
+	if _, err := manager.CreateCase("monitored-case", cpn.ID, "Monitored", "", nil); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	if err := manager.StartCase("monitored-case"); err != nil {
+		t.Fatalf("Failed to start case: %v", err)
+	}
+
+	fired, err := manager.ExecuteAll("monitored-case")
+	if err != nil {
+		t.Fatalf("Failed to execute case: %v", err)
+	}
+	if fired != 3 {
+		t.Errorf("Expected ExecuteAll to stop at the breakpoint after 3 firings, got %d", fired)
+	}
+	results, err := manager.GetCaseMonitorResults("monitored-case")
+	if err != nil {
+		t.Fatalf("Failed to get monitor results: %v", err)
+	}
+	if results.PendingBreakpoint() == nil || len(results.Get("values").Observations) != 3 {
+		t.Errorf("Unexpected case monitor results: %+v", results)
+	}
+}
+
+func TestAPISimulateStepsBreakpointAndResults(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/load", bytes.NewBufferString(monitoredCPNJSON)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Failed to load CPN: %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/simulation/steps?id=monitored&steps=10", nil))
+	var stepResponse struct {
+		Data api.SimulationStepResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &stepResponse); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if stepResponse.Data.Breakpoint == nil || stepResponse.Data.Breakpoint.MonitorID != "stop" {
+		t.Fatalf("Expected simulation to stop at breakpoint, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/monitors/results?id=monitored&monitor=values", nil))
+	var resultResponse struct {
+		Data models.MonitorResult `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resultResponse); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if rr.Code != http.StatusOK || len(resultResponse.Data.Observations) == 0 {
+		t.Errorf("Expected data collector observations, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/monitors/results?id=monitored&monitor=unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown monitor, got %d", rr.Code)
+	}
+}
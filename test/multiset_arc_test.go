@@ -0,0 +1,159 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+func TestSplitMultiset(t *testing.T) {
+	cases := map[string][]expression.MultisetTerm{
+		"2'x ++ 1'(x+1)":       {{Count: 2, Expression: "x"}, {Count: 1, Expression: "(x+1)"}},
+		"x ++ f('a', \"++\")":  {{Count: 1, Expression: "x"}, {Count: 1, Expression: "f('a', \"++\")"}},
+		"3'{id = x, s = 'a'}":  {{Count: 3, Expression: "{id = x, s = 'a'}"}},
+		"1'delay(x, 5) ++ 2'y": {{Count: 1, Expression: "delay(x, 5)"}, {Count: 2, Expression: "y"}},
+	}
+	for inscription, expected := range cases {
+		terms, ok := expression.SplitMultiset(inscription)
+		if !ok || !reflect.DeepEqual(terms, expected) {
+			t.Errorf("SplitMultiset(%q) = %v, %v; expected %v", inscription, terms, ok, expected)
+		}
+	}
+	for _, plain := range []string{"x + 1", "'a' .. x", "tuple(x, 2)", "x ++"} {
+		if _, ok := expression.SplitMultiset(plain); ok {
+			t.Errorf("%q is not a multiset inscription", plain)
+		}
+	}
+}
+
+func TestMultisetArcExpressions(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+	ctx := expression.NewEvaluationContext()
+	ctx.BindVariable("x", models.NewToken(4, 0))
+
+	expected := map[string]expression.MultisetValue{
+		"2'x ++ 1'(x+1)":            {4, 4, 5},
+		"multiset({x, x * 2})":      {4, 8},
+		"1'multiset({1, 2}) ++ 2'x": {1, 2, 4, 4},
+		"multiset({delay(x, 3)})":   {map[string]interface{}{"value": 4, "delay": 3}},
+		"tuple(x, 1) ++ 0'x":        {[]interface{}{4, 1}},
+	}
+	for inscription, want := range expected {
+		got, err := evaluator.EvaluateArcExpression(inscription, ctx)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v (%v)", inscription, want, got, err)
+		}
+	}
+	// A plain Lua list is a single (list valued) token
+	if got, _ := evaluator.EvaluateArcExpression("{x, x}", ctx); !reflect.DeepEqual(got, []interface{}{4, 4}) {
+		t.Errorf("Expected a list value, got %v", got)
+	}
+}
+
+// createMultisetCPN builds in -> t -> out with the given input and output inscriptions
+func createMultisetCPN(input, output string) *models.CPN {
+	intCS := models.NewIntegerColorSet("INT", true)
+	cpn := models.NewCPN("ms", "Multiset", "")
+	cpn.AddPlace(models.NewPlace("src", "Source", intCS))
+	cpn.AddPlace(models.NewPlace("in", "In", intCS))
+	cpn.AddPlace(models.NewPlace("out", "Out", intCS))
+	cpn.AddTransition(models.NewTransition("t", "T"))
+	cpn.AddArc(models.NewInputArc("a_src", "src", "t", "x"))
+	cpn.AddArc(models.NewInputArc("a_in", "in", "t", input))
+	cpn.AddArc(models.NewOutputArc("a_out", "t", "out", output))
+	return cpn
+}
+
+func TestMultisetInputArcsConsumeAtomically(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createMultisetCPN("2'x ++ 1'(x+1)", "x")
+	marking := models.NewMarking()
+	marking.AddToken("src", models.NewToken(1, 0))
+	marking.AddToken("src", models.NewToken(5, 0))
+	for _, v := range []int{1, 1, 2, 5, 6} { // only x=1 has two tokens x and one x+1
+		marking.AddToken("in", models.NewToken(v, 0))
+	}
+
+	enabled, bindings, err := eng.IsEnabled(cpn, cpn.GetTransition("t"), marking)
+	if err != nil || !enabled || len(bindings) != 1 || bindings[0]["x"].Value != 1 {
+		t.Fatalf("Expected the single binding x=1, got %v (%v)", bindings, err)
+	}
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t"), bindings[0], marking); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if marking.CountTokens("in") != 2 || !marking.HasTokenWithValue("in", 5) || !marking.HasTokenWithValue("in", 6) {
+		t.Errorf("Expected 1'5 ++ 1'6 to remain, got %s", marking.Places["in"])
+	}
+
+	// A partial multiset disables the transition: x=5 would need two 5s
+	if enabled, _, _ := eng.IsEnabled(cpn, cpn.GetTransition("t"), marking); enabled {
+		t.Error("Transition must not be enabled without the whole multiset")
+	}
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t"), engine.TokenBinding{"x": marking.GetTokens("src")[0]}, marking); err == nil {
+		t.Error("Expected firing to fail")
+	}
+	if marking.CountTokens("in") != 2 || marking.CountTokens("src") != 1 {
+		t.Errorf("A failed firing must not consume tokens, got %s", marking)
+	}
+}
+
+func TestMultisetOutputArcsWithDelays(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createMultisetCPN("x", "2'x ++ 1'delay(x * 10, 3)")
+	marking := models.NewMarking()
+	marking.AddToken("src", models.NewToken(7, 0))
+	marking.AddToken("in", models.NewToken(7, 0))
+
+	fired, err := eng.FireEnabledTransitions(cpn, marking)
+	if err != nil || fired != 1 {
+		t.Fatalf("Expected one firing, got %d (%v)", fired, err)
+	}
+	if marking.CountTokensWithValue("out", 7) != 2 {
+		t.Errorf("Expected 2'7 in out, got %s", marking.Places["out"])
+	}
+	delayed := marking.GetTokensWithValue("out", 70)
+	if len(delayed) != 1 || delayed[0].Timestamp != 3 {
+		t.Errorf("Expected 70@3 in out, got %v", delayed)
+	}
+}
+
+func TestCountedVariableArcBindsVariable(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn := models.NewCPN("pairs", "Pairs", "")
+	cpn.AddPlace(models.NewPlace("p", "P", intCS))
+	cpn.AddPlace(models.NewPlace("q", "Q", intCS))
+	cpn.AddTransition(models.NewTransition("t", "T"))
+	cpn.AddArc(models.NewInputArc("a1", "p", "t", "2'x"))
+	cpn.AddArc(models.NewOutputArc("a2", "t", "q", "x"))
+
+	marking := models.NewMarking()
+	for _, v := range []int{1, 2, 2, 3} {
+		marking.AddToken("p", models.NewToken(v, 0))
+	}
+	_, bindings, err := eng.IsEnabled(cpn, cpn.GetTransition("t"), marking)
+	if err != nil || len(bindings) == 0 {
+		t.Fatalf("Expected bindings, got %v", err)
+	}
+	for _, b := range bindings { // x is bound to either token 2
+		if b["x"].Value != 2 {
+			t.Fatalf("Only x=2 has two tokens, got %v", bindings)
+		}
+	}
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t"), bindings[0], marking); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if marking.CountTokens("p") != 2 || marking.HasTokenWithValue("p", 2) || !marking.HasTokenWithValue("q", 2) {
+		t.Errorf("Expected both 2s consumed, got %s", marking)
+	}
+}
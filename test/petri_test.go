@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-petri-flow/pkg/petri"
+)
+
+const approvalCPNJSON = `{
+	"id": "approval", "name": "Approval",
+	"colorSets": ["colset INT = int;"],
+	"places": [
+		{"id": "p1", "name": "Submitted", "colorSet": "INT"},
+		{"id": "p2", "name": "Checked", "colorSet": "INT"},
+		{"id": "p3", "name": "Done", "colorSet": "INT"}
+	],
+	"transitions": [
+		{"id": "t1", "name": "Check", "kind": "Auto"},
+		{"id": "t2", "name": "Approve", "kind": "Manual"}
+	],
+	"arcs": [
+		{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "t1", "targetId": "p2", "expression": "x + 1", "direction": "OUT"},
+		{"id": "a3", "sourceId": "p2", "targetId": "t2", "expression": "x", "direction": "IN"},
+		{"id": "a4", "sourceId": "t2", "targetId": "p3", "expression": "x", "direction": "OUT"}
+	],
+	"initialMarking": {"Submitted": [{"value": 41}]},
+	"endPlaces": ["Done"]
+}`
+
+func TestRuntimeCaseAndWorkItemLifecycle(t *testing.T) {
+	var events []petri.Event
+	rt := petri.New(petri.WithEventHandler(func(e petri.Event) { events = append(events, e) }))
+	defer rt.Close()
+	ctx := context.Background()
+
+	if _, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	if _, err := rt.CreateCase(ctx, "c1", "approval", "Case 1", petri.WithCaseVariables(map[string]interface{}{"owner": "ann"})); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	if err := rt.StartCase(ctx, "c1"); err != nil {
+		t.Fatalf("Failed to start case: %v", err)
+	}
+	fired, err := rt.ExecuteAll(ctx, "c1")
+	if err != nil || fired != 1 {
+		t.Fatalf("Expected one automatic firing, got %d (%v)", fired, err)
+	}
+
+	items, err := rt.CreateWorkItemsForCase(ctx, "c1")
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected one work item, got %d (%v)", len(items), err)
+	}
+	id := items[0].ID
+	if err := rt.AllocateWorkItem(ctx, id, "ann"); err != nil {
+		t.Fatalf("Failed to allocate work item: %v", err)
+	}
+	if err := rt.StartWorkItem(ctx, id); err != nil {
+		t.Fatalf("Failed to start work item: %v", err)
+	}
+	if err := rt.CompleteWorkItem(ctx, id); err != nil {
+		t.Fatalf("Failed to complete work item: %v", err)
+	}
+
+	case_, err := rt.GetCase("c1")
+	if err != nil || case_.Status != petri.CaseStatusCompleted {
+		t.Fatalf("Expected completed case, got %v (%v)", case_, err)
+	}
+	if tokens := case_.Marking.GetTokens("p3"); len(tokens) != 1 || tokens[0].Value != 42 {
+		t.Errorf("Expected token 42 in Done, got %v", tokens)
+	}
+
+	var types []petri.EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	expected := []petri.EventType{
+		petri.EventCPNLoaded, petri.EventCaseCreated, petri.EventCaseStarted,
+		petri.EventTransitionFired, petri.EventWorkItemCreated, petri.EventWorkItemAllocated,
+		petri.EventWorkItemStarted, petri.EventTransitionFired, petri.EventCaseCompleted, petri.EventWorkItemCompleted,
+	}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("Expected events %v, got %v", expected, types)
+		}
+	}
+	if fire := events[7]; fire.CaseID != "c1" || fire.TransitionID != "t2" || fire.Binding["x"] != 42 {
+		t.Errorf("Unexpected firing event: %+v", fire)
+	}
+}
+
+func TestRuntimeSimulationErrorsAndContext(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	if _, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	if _, err := rt.Marking("missing"); !errors.Is(err, petri.ErrCPNNotFound) {
+		t.Errorf("Expected ErrCPNNotFound, got %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "approval", "t2"); !errors.Is(err, petri.ErrTransitionNotEnabled) {
+		t.Errorf("Expected ErrTransitionNotEnabled, got %v", err)
+	}
+	if _, err := rt.FireTransition(ctx, "approval", "t1", petri.WithBindingIndex(3)); !errors.Is(err, petri.ErrInvalidBinding) {
+		t.Errorf("Expected ErrInvalidBinding, got %v", err)
+	}
+
+	marking, err := rt.FireTransition(ctx, "approval", "t1")
+	if err != nil {
+		t.Fatalf("Failed to fire transition: %v", err)
+	}
+	if marking.CountTokens("p2") != 1 || marking.StepCounter != 1 {
+		t.Errorf("Unexpected marking after firing: %s", marking)
+	}
+	// Returned markings are snapshots
+	marking.AddToken("p2", marking.GetTokens("p2")[0])
+	if current, _ := rt.Marking("approval"); current.CountTokens("p2") != 1 {
+		t.Errorf("Snapshot modification leaked into the runtime")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := rt.SimulateSteps(cancelled, "approval", 5); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	rt.Close()
+	if _, err := rt.ResetCPN(ctx, "approval"); !errors.Is(err, petri.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
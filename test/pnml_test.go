@@ -0,0 +1,266 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+const ptNetPNML = `<?xml version="1.0" encoding="UTF-8"?>
+<pnml xmlns="http://www.pnml.org/version-2009/grammar/pnml">
+  <net id="pt" type="http://www.pnml.org/version-2009/grammar/ptnet">
+    <name><text>Producer</text></name>
+    <page id="top">
+      <place id="p1">
+        <name><text>Stock</text></name>
+        <graphics><position x="10" y="20.5"/></graphics>
+        <initialMarking><text>3</text></initialMarking>
+      </place>
+      <transition id="t1"><name><text>Pack</text></name></transition>
+      <arc id="a1" source="p1" target="t1"><inscription><text>2</text></inscription></arc>
+      <page id="sub">
+        <place id="p2"><name><text>Packed</text></name></place>
+        <referencePlace id="r2" ref="p2"/>
+        <arc id="a2" source="t1" target="r2"/>
+        <fancyThing/>
+      </page>
+    </page>
+  </net>
+</pnml>`
+
+const symmetricNetPNML = `<?xml version="1.0" encoding="UTF-8"?>
+<pnml xmlns="http://www.pnml.org/version-2009/grammar/pnml">
+  <net id="sn" type="http://www.pnml.org/version-2009/grammar/symmetricnet">
+    <name><text>Lights</text></name>
+    <declaration><structure><declarations>
+      <namedsort id="colour" name="Colour">
+        <cyclicenumeration>
+          <feconstant id="red" name="red"/>
+          <feconstant id="green" name="green"/>
+        </cyclicenumeration>
+      </namedsort>
+      <variabledecl id="vx" name="x"><usersort declaration="colour"/></variabledecl>
+      <partition id="part" name="Part"><usersort declaration="colour"/></partition>
+    </declarations></structure></declaration>
+    <page id="top">
+      <place id="p">
+        <type><structure><usersort declaration="colour"/></structure></type>
+        <hlinitialMarking><structure>
+          <add>
+            <subterm><numberof>
+              <subterm><numberconstant value="2"><positive/></numberconstant></subterm>
+              <subterm><useroperator declaration="red"/></subterm>
+            </numberof></subterm>
+            <subterm><numberof>
+              <subterm><numberconstant value="1"><positive/></numberconstant></subterm>
+              <subterm><useroperator declaration="green"/></subterm>
+            </numberof></subterm>
+          </add>
+        </structure></hlinitialMarking>
+      </place>
+      <place id="q"><type><structure><usersort declaration="colour"/></structure></type></place>
+      <transition id="t">
+        <condition><structure>
+          <equality>
+            <subterm><variable refvariable="vx"/></subterm>
+            <subterm><useroperator declaration="green"/></subterm>
+          </equality>
+        </structure></condition>
+      </transition>
+      <arc id="a1" source="p" target="t">
+        <hlinscription><structure><variable refvariable="vx"/></structure></hlinscription>
+      </arc>
+      <arc id="a2" source="t" target="q">
+        <hlinscription><structure>
+          <successor><subterm><variable refvariable="vx"/></subterm></successor>
+        </structure></hlinscription>
+      </arc>
+    </page>
+  </net>
+</pnml>`
+
+func hasIssue(report *models.ConversionReport, element, fragment string) bool {
+	for _, issue := range report.Issues {
+		if issue.Element == element && strings.Contains(issue.Message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPNMLImportPTNet(t *testing.T) {
+	def, report, err := models.NewCPNParser().ParsePNML([]byte(ptNetPNML))
+	if err != nil {
+		t.Fatalf("Failed to parse PNML: %v", err)
+	}
+	if def.ID != "pt" || def.Name != "Producer" || len(def.Places) != 2 || len(def.Transitions) != 1 || len(def.Arcs) != 2 {
+		t.Fatalf("Unexpected definition: %+v", def)
+	}
+	if p := def.Places[0]; p.ColorSet != "UNIT" || p.Position == nil || p.Position.X != 10 || p.Position.Y != 20.5 {
+		t.Errorf("Unexpected place %+v", p)
+	}
+	if def.Arcs[0].Expression != `2'"()"` || def.Arcs[1].TargetID != "p2" || def.Arcs[1].Direction != "OUT" {
+		t.Errorf("Unexpected arcs %+v", def.Arcs)
+	}
+	if !hasIssue(report, "sub", "<fancyThing>") || !hasIssue(report, "pt", "2 pages") {
+		t.Errorf("Expected issues for the unknown element and the flattened pages, got %+v", report.Issues)
+	}
+
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, _, err := rt.ImportPNML(ctx, []byte(ptNetPNML)); err != nil {
+		t.Fatalf("Failed to import PNML: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "pt", 10); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ := rt.Marking("pt")
+	if len(marking.GetTokens("p1")) != 1 || len(marking.GetTokens("p2")) != 1 {
+		t.Errorf("Expected one token in each place, got %v", marking.Places)
+	}
+
+	data, report, err := rt.ExportPNML("pt")
+	if err != nil {
+		t.Fatalf("Failed to export PNML: %v", err)
+	}
+	out := string(data)
+	if !strings.Contains(out, "grammar/ptnet") || !strings.Contains(out, "<text>2</text>") || !strings.Contains(out, "<text>3</text>") {
+		t.Errorf("Unexpected P/T export:\n%s", out)
+	}
+	if !report.Exact() {
+		t.Errorf("Expected an exact P/T export, got %+v", report.Issues)
+	}
+}
+
+func TestPNMLImportSymmetricNet(t *testing.T) {
+	def, report, err := models.NewCPNParser().ParsePNML([]byte(symmetricNetPNML))
+	if err != nil {
+		t.Fatalf("Failed to parse PNML: %v", err)
+	}
+	if len(def.ColorSets) != 1 || def.ColorSets[0] != "colset Colour = with red | green;" {
+		t.Errorf("Unexpected color sets %v", def.ColorSets)
+	}
+	if g := def.Transitions[0]; g.GuardExpression != `x == "green"` || len(g.Variables) != 1 || g.Variables[0] != "x" {
+		t.Errorf("Unexpected guard %+v", g)
+	}
+	if def.Arcs[1].Expression != `cs.succ("Colour", x)` {
+		t.Errorf("Unexpected output inscription %q", def.Arcs[1].Expression)
+	}
+	if !hasIssue(report, "part", "<partition>") {
+		t.Errorf("Expected an issue for the partition, got %+v", report.Issues)
+	}
+
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, _, err := rt.ImportPNML(ctx, []byte(symmetricNetPNML)); err != nil {
+		t.Fatalf("Failed to import PNML: %v", err)
+	}
+	if _, err := rt.SimulateSteps(ctx, "sn", 10); err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	marking, _ := rt.Marking("sn")
+	if tokens := marking.GetTokens("q"); len(tokens) != 1 || tokens[0].Value != "red" {
+		t.Errorf("Expected the green light to turn red, got %v", tokens)
+	}
+	if tokens := marking.GetTokens("p"); len(tokens) != 2 {
+		t.Errorf("Expected two red tokens left, got %v", tokens)
+	}
+}
+
+func TestPNMLExportRoundTrip(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	data, report, err := rt.ExportPNML("approval")
+	if err != nil {
+		t.Fatalf("Failed to export PNML: %v", err)
+	}
+	out := string(data)
+	if !strings.Contains(out, "grammar/highlevelnet") || !strings.Contains(out, `<variabledecl id="var_x" name="x">`) {
+		t.Errorf("Unexpected high-level export:\n%s", out)
+	}
+	if !hasIssue(report, "approval", "1 inscriptions") || !hasIssue(report, "approval", "1 transitions") {
+		t.Errorf("Expected issues for the text-only inscription and the manual transition, got %+v", report.Issues)
+	}
+
+	rt2 := petri.New()
+	defer rt2.Close()
+	cpn, _, err := rt2.ImportPNML(ctx, data)
+	if err != nil {
+		t.Fatalf("Failed to import exported PNML: %v", err)
+	}
+	if tr := cpn.GetTransition("t2"); tr == nil || tr.Kind != models.TransitionKindManual {
+		t.Errorf("Expected manual transition t2, got %+v", tr)
+	}
+	if arc := cpn.GetArc("a2"); arc == nil || arc.Expression != "x + 1" {
+		t.Errorf("Expected inscription x + 1, got %+v", arc)
+	}
+	if tokens := cpn.InitialMarking["p1"]; len(tokens) != 1 || tokens[0].Value != 41 {
+		t.Errorf("Expected initial token 41, got %v", tokens)
+	}
+	if len(cpn.EndPlaces) != 1 || cpn.EndPlaces[0] != "Done" {
+		t.Errorf("Expected end place Done, got %v", cpn.EndPlaces)
+	}
+}
+
+func TestAPIPNMLImportExport(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	req := httptest.NewRequest("POST", "/api/cpn/import/pnml", bytes.NewBufferString(ptNetPNML))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data api.ImportResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Data.CPN.ID != "pt" || response.Data.Report == nil || len(response.Data.Report.Issues) == 0 {
+		t.Errorf("Unexpected import response %+v", response.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/cpn/export/pnml?id=pt", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("Expected PNML document, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Body.String(), `<net id="pt"`) || rr.Header().Get("X-Conversion-Issues") == "" {
+		t.Errorf("Unexpected export response:\n%s", rr.Body.String())
+	}
+	if link := rr.Header().Get("Link"); link != `</api/cpn/export/pnml/report?id=pt>; rel="conversion-report"` {
+		t.Errorf("Unexpected report link %q", link)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/cpn/export/pnml/report?id=pt", nil))
+	var exported struct {
+		Data models.ConversionReport `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &exported); err != nil || rr.Code != http.StatusOK || exported.Data.Format != "pnml" {
+		t.Errorf("Unexpected export report %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/import/pnml", bytes.NewBufferString("<petri/>")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid document, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,213 @@
+package test
+
+import (
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+)
+
+// createConflictCPN builds p1 -> {t1, t2, t3} -> p2..p4 where all transitions compete for p1 tokens
+func createConflictCPN() *models.CPN {
+	cpn := models.NewCPN("conflict-cpn", "Conflict CPN", "Competing transitions")
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn.AddPlace(models.NewPlace("p1", "Input", intCS))
+	for i, id := range []string{"t1", "t2", "t3"} {
+		out := []string{"p2", "p3", "p4"}[i]
+		cpn.AddPlace(models.NewPlace(out, "Out"+id, intCS))
+		cpn.AddTransition(models.NewTransition(id, "T"+id))
+		cpn.AddArc(models.NewInputArc("in_"+id, "p1", id, "x"))
+		cpn.AddArc(models.NewOutputArc("out_"+id, id, out, "x"))
+	}
+	return cpn
+}
+
+func TestTransitionPriorityDisablesLowerPriority(t *testing.T) {
+	cpn := createConflictCPN()
+	cpn.GetTransition("t3").SetPriority(models.PriorityHigh)
+	cpn.GetTransition("t1").SetPriority(models.PriorityLow)
+
+	marking := models.NewMarking()
+	marking.AddToken("p1", models.NewToken(1, 0))
+
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	enabled, bindingsMap, err := eng.GetEnabledTransitions(cpn, marking)
+	if err != nil {
+		t.Fatalf("Failed to get enabled transitions: %v", err)
+	}
+	if len(enabled) != 1 || enabled[0].ID != "t3" {
+		t.Fatalf("Expected only high priority t3 to be enabled, got %v", enabled)
+	}
+	if _, ok := bindingsMap["t1"]; ok {
+		t.Error("Bindings of priority-disabled transitions should not be reported")
+	}
+
+	// Firing a lower priority transition directly must be rejected
+	t1 := cpn.GetTransition("t1")
+	_, bindings, _ := eng.IsEnabled(cpn, t1, marking)
+	if err := eng.FireTransition(cpn, t1, bindings[0], marking); err == nil {
+		t.Error("Expected firing of priority-disabled transition to fail")
+	}
+
+	fired, err := eng.FireEnabledTransitions(cpn, marking)
+	if err != nil {
+		t.Fatalf("Failed to fire enabled transitions: %v", err)
+	}
+	if fired != 1 || !marking.HasTokens("p4") {
+		t.Errorf("Expected t3 to fire into p4, fired=%d marking=%s", fired, marking)
+	}
+}
+
+func TestConflictResolutionRandomIsReproducible(t *testing.T) {
+	run := func(seed int64) []string {
+		cpn := createConflictCPN()
+		cpn.ConflictResolution = &models.ConflictResolution{Transitions: models.ConflictPolicyRandom, Seed: seed}
+		marking := cpn.CreateInitialMarking()
+		for i := 0; i < 20; i++ {
+			marking.AddToken("p1", models.NewToken(i, 0))
+		}
+		eng := engine.NewEngine()
+		defer eng.Close()
+
+		var trace []string
+		for i := 0; i < 20; i++ {
+			if _, err := eng.SimulateStep(cpn, marking); err != nil {
+				t.Fatalf("Simulation step failed: %v", err)
+			}
+			trace = append(trace, marking.String())
+		}
+		return trace
+	}
+
+	a, b := run(7), run(7)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("Same seed produced different traces at step %d: %s vs %s", i, a[i], b[i])
+		}
+	}
+}
+
+func TestConflictResolutionWeighted(t *testing.T) {
+	cpn := createConflictCPN()
+	cpn.ConflictResolution = &models.ConflictResolution{
+		Transitions: models.ConflictPolicyWeighted,
+		Bindings:    models.ConflictPolicyWeighted,
+		Seed:        3,
+	}
+	cpn.GetTransition("t1").Weight = 1
+	cpn.GetTransition("t2").Weight = 0.0001
+	cpn.GetTransition("t3").Weight = 1
+	// Only ever pick even tokens for t1 and t3
+	for _, id := range []string{"t1", "t3"} {
+		cpn.GetTransition(id).BindingWeight = "x % 2 == 0 and 1 or 0"
+	}
+
+	marking := cpn.CreateInitialMarking()
+	for i := 0; i < 10; i++ {
+		marking.AddToken("p1", models.NewToken(i, 0))
+	}
+
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := eng.SimulateStep(cpn, marking); err != nil {
+			t.Fatalf("Simulation step failed: %v", err)
+		}
+	}
+	for _, place := range []string{"p2", "p4"} {
+		for _, tk := range marking.GetTokens(place) {
+			if tk.Value.(int)%2 != 0 {
+				t.Errorf("Weighted binding selection chose odd token %v for %s", tk.Value, place)
+			}
+		}
+	}
+}
+
+func TestParsePriorityAndConflictResolution(t *testing.T) {
+	jsonDef := `{
+		"id": "prio", "name": "Prio",
+		"colorSets": ["colset INT = int;"],
+		"places": [{"id": "p1", "name": "P1", "colorSet": "INT"}],
+		"transitions": [
+			{"id": "t1", "name": "T1", "priority": 100, "weight": 2.5},
+			{"id": "t2", "name": "T2"}
+		],
+		"arcs": [],
+		"conflictResolution": {"transitions": "weighted", "bindings": "random", "seed": 9}
+	}`
+	parser := models.NewCPNParser()
+	cpn, err := parser.ParseCPNFromJSON([]byte(jsonDef))
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	if cpn.GetTransition("t1").Priority != models.PriorityHigh || cpn.GetTransition("t2").Priority != models.PriorityNormal {
+		t.Errorf("Unexpected priorities: %d, %d", cpn.GetTransition("t1").Priority, cpn.GetTransition("t2").Priority)
+	}
+	if cpn.ConflictResolution.TransitionPolicy() != models.ConflictPolicyWeighted || cpn.ConflictResolution.Seed != 9 {
+		t.Errorf("Unexpected conflict resolution: %+v", cpn.ConflictResolution)
+	}
+
+	data, err := parser.CPNToJSON(cpn)
+	if err != nil {
+		t.Fatalf("Failed to serialize CPN: %v", err)
+	}
+	roundTrip, err := models.NewCPNParser().ParseCPNFromJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to re-parse CPN: %v", err)
+	}
+	if roundTrip.GetTransition("t1").Weight != 2.5 || roundTrip.ConflictResolution.BindingPolicy() != models.ConflictPolicyRandom {
+		t.Errorf("Round trip lost conflict settings: %s", string(data))
+	}
+
+	zero := `{"id": "zero", "name": "Zero", "places": [], "arcs": [], "transitions": [
+		{"id": "t1", "name": "T1", "priority": 0, "weight": 0},
+		{"id": "t2", "name": "T2"}
+	]}`
+	zeroCPN, err := models.NewCPNParser().ParseCPNFromJSON([]byte(zero))
+	if err != nil {
+		t.Fatalf("Failed to parse CPN: %v", err)
+	}
+	if t1 := zeroCPN.GetTransition("t1"); t1.Priority != 0 || t1.GetWeight() != 0 {
+		t.Errorf("Explicit zero priority and weight were not kept: %+v", t1)
+	}
+	if t2 := zeroCPN.GetTransition("t2"); t2.Priority != models.PriorityNormal || t2.GetWeight() != 1 {
+		t.Errorf("Unexpected defaults: %+v", t2)
+	}
+	data, err = parser.CPNToJSON(zeroCPN)
+	if err != nil {
+		t.Fatalf("Failed to serialize CPN: %v", err)
+	}
+	if roundTrip, err = models.NewCPNParser().ParseCPNFromJSON(data); err != nil || roundTrip.GetTransition("t1").Weight != 0 || roundTrip.GetTransition("t1").Priority != 0 {
+		t.Errorf("Round trip lost zero priority and weight: %s", string(data))
+	}
+
+	bad := `{"id": "bad", "name": "Bad", "places": [], "transitions": [], "arcs": [], "conflictResolution": {"transitions": "lottery"}}`
+	if _, err := models.NewCPNParser().ParseCPNFromJSON([]byte(bad)); err == nil {
+		t.Error("Expected unknown conflict policy to be rejected")
+	}
+}
+
+func TestConflictResolutionZeroWeight(t *testing.T) {
+	cpn := createConflictCPN()
+	cpn.ConflictResolution = &models.ConflictResolution{Transitions: models.ConflictPolicyWeighted, Seed: 5}
+	cpn.GetTransition("t1").Weight = 0
+	cpn.GetTransition("t3").Weight = 0
+
+	marking := cpn.CreateInitialMarking()
+	for i := 0; i < 10; i++ {
+		marking.AddToken("p1", models.NewToken(i, 0))
+	}
+
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	if _, err := eng.FireEnabledTransitions(cpn, marking); err != nil {
+		t.Fatalf("Failed to fire enabled transitions: %v", err)
+	}
+	if len(marking.GetTokens("p3")) != 10 {
+		t.Errorf("Transitions with weight 0 fired while another transition was enabled: %s", marking)
+	}
+}
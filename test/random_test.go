@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+// createStochasticCPN builds a loop p1 -> t1 -> p2 -> t2 -> p1 where t1 has a bernoulli guard
+// and produces tokens with exponentially distributed delays.
+func createStochasticCPN() *models.CPN {
+	cpn := models.NewCPN("stochastic-cpn", "Stochastic CPN", "Random delays and guards")
+	intCS := models.NewIntegerColorSet("INT", true)
+	cpn.AddPlace(models.NewPlace("p1", "Queue", intCS))
+	cpn.AddPlace(models.NewPlace("p2", "Busy", intCS))
+
+	t1 := models.NewTransition("t1", "Serve")
+	t1.SetGuard("bernoulli(0.7) == 1", nil)
+	cpn.AddTransition(t1)
+	cpn.AddTransition(models.NewTransition("t2", "Release"))
+
+	cpn.AddArc(models.NewInputArc("a1", "p1", "t1", "x"))
+	cpn.AddArc(models.NewOutputArc("a2", "t1", "p2", "delay(x, exponential(0.5))"))
+	cpn.AddArc(models.NewInputArc("a3", "p2", "t2", "x"))
+	cpn.AddArc(models.NewOutputArc("a4", "t2", "p1", "delay(x + discrete(1, 3), uniform(0, 2))"))
+	return cpn
+}
+
+func TestRandomFunctionsReproducibleTrace(t *testing.T) {
+	run := func(seed int64) []string {
+		cpn := createStochasticCPN()
+		marking := cpn.CreateInitialMarking()
+		marking.SetSeed(seed)
+		marking.AddToken("p1", models.NewToken(1, 0))
+		marking.AddToken("p1", models.NewToken(2, 0))
+
+		eng := engine.NewEngine()
+		defer eng.Close()
+
+		var trace []string
+		for i := 0; i < 30; i++ {
+			if _, err := eng.SimulateStep(cpn, marking); err != nil {
+				t.Fatalf("Simulation step failed: %v", err)
+			}
+			trace = append(trace, marking.String())
+		}
+		return trace
+	}
+
+	a, b := run(42), run(42)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("Same seed produced different traces at step %d:\n%s\n%s", i, a[i], b[i])
+		}
+	}
+
+	c := run(43)
+	same := true
+	for i := range a {
+		if a[i] != c[i] {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Error("Different seeds produced identical traces")
+	}
+}
+
+func TestRandomDistributionBounds(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+
+	context := expression.NewEvaluationContext()
+	context.Random = rand.New(rand.NewSource(1))
+
+	checks := []struct {
+		expr string
+		ok   func(float64) bool
+	}{
+		{"uniform(2, 5)", func(v float64) bool { return v >= 2 && v < 5 }},
+		{"exponential(2)", func(v float64) bool { return v >= 0 }},
+		{"erlang(3, 1)", func(v float64) bool { return v >= 0 }},
+		{"discrete(1, 6)", func(v float64) bool { return v >= 1 && v <= 6 && v == float64(int(v)) }},
+		{"bernoulli(0.5)", func(v float64) bool { return v == 0 || v == 1 }},
+		{"poisson(3)", func(v float64) bool { return v >= 0 && v == float64(int(v)) }},
+		{"math.random(10)", func(v float64) bool { return v >= 1 && v <= 10 }},
+	}
+	for _, check := range checks {
+		for i := 0; i < 200; i++ {
+			result, err := evaluator.EvaluateArcExpression(check.expr, context)
+			if err != nil {
+				t.Fatalf("Failed to evaluate %s: %v", check.expr, err)
+			}
+			v, ok := toNumber(result)
+			if !ok || !check.ok(v) {
+				t.Fatalf("%s produced out of range value %v", check.expr, result)
+			}
+		}
+	}
+
+	// Sample mean of normal(10, 4) should be close to 10
+	sum := 0.0
+	for i := 0; i < 2000; i++ {
+		result, err := evaluator.EvaluateArcExpression("normal(10, 4)", context)
+		if err != nil {
+			t.Fatalf("Failed to evaluate normal: %v", err)
+		}
+		v, _ := toNumber(result)
+		sum += v
+	}
+	if mean := sum / 2000; mean < 9.7 || mean > 10.3 {
+		t.Errorf("normal(10, 4) sample mean %.3f too far from 10", mean)
+	}
+
+	for _, bad := range []string{"exponential(0)", "bernoulli(2)", "discrete(5, 1)", "erlang(0, 1)"} {
+		if _, err := evaluator.EvaluateArcExpression(bad, context); err == nil {
+			t.Errorf("Expected %s to fail", bad)
+		}
+	}
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func TestMarkingCloneContinuesRandomSequence(t *testing.T) {
+	marking := models.NewMarking()
+	marking.SetSeed(7)
+	for i := 0; i < 5; i++ {
+		marking.Random().Float64()
+	}
+
+	clone := marking.Clone()
+	if !bytes.Equal(clone.RandomState(), marking.RandomState()) {
+		t.Fatal("Expected the clone to copy the state of the random source")
+	}
+	for i := 0; i < 5; i++ {
+		if a, b := marking.Random().Float64(), clone.Random().Float64(); a != b {
+			t.Fatalf("Clone diverged from the original at draw %d: %v vs %v", i, a, b)
+		}
+	}
+
+	fresh := models.NewMarking()
+	fresh.SetSeed(7)
+	if clone.Random().Float64() == fresh.Random().Float64() {
+		t.Error("Clone replayed the random sequence from the start")
+	}
+}
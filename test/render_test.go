@@ -0,0 +1,134 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/internal/models"
+	"go-petri-flow/pkg/petri"
+)
+
+func TestNetLayout(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	cpn, err := rt.LoadCPNJSON(context.Background(), []byte(approvalCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+
+	// Without positions the net is laid out in layers from the marked place
+	positions := models.NetLayout(cpn)
+	order := []string{"p1", "t1", "p2", "t2", "p3"}
+	for i := 1; i < len(order); i++ {
+		if positions[order[i]].X <= positions[order[i-1]].X {
+			t.Errorf("Expected %s right of %s, got %v", order[i], order[i-1], positions)
+		}
+	}
+
+	// Stored positions are kept when every node has one
+	for i, place := range cpn.Places {
+		place.Position = &models.Position{X: float32(i * 10), Y: 5}
+	}
+	for _, transition := range cpn.Transitions {
+		transition.Position = &models.Position{X: 7, Y: 7}
+	}
+	if pos := models.NetLayout(cpn)["p2"]; pos.X != 10 || pos.Y != 5 {
+		t.Errorf("Expected the stored position of p2, got %+v", pos)
+	}
+}
+
+func TestRenderCPN(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+
+	dot, err := rt.Render(ctx, "approval", petri.RenderFormatDOT)
+	if err != nil {
+		t.Fatalf("Failed to render DOT: %v", err)
+	}
+	for _, want := range []string{
+		`digraph "approval" {`,
+		`"p1" [shape=ellipse, label="Submitted\n1: {41}"`,
+		`"t1" [shape=box, label="Check", pos=`,
+		`style="filled,bold"`,
+		`"t1" -> "p2" [label="x + 1"];`,
+	} {
+		if !strings.Contains(string(dot), want) {
+			t.Errorf("Expected DOT to contain %q, got:\n%s", want, dot)
+		}
+	}
+
+	svg, err := rt.Render(ctx, "approval", petri.RenderFormatSVG)
+	if err != nil {
+		t.Fatalf("Failed to render SVG: %v", err)
+	}
+	if err := xml.Unmarshal(svg, new(struct{})); err != nil {
+		t.Errorf("Expected well-formed SVG: %v", err)
+	}
+	if !strings.Contains(string(svg), `<g class="transition enabled" id="t1">`) || strings.Contains(string(svg), `class="transition enabled" id="t2"`) {
+		t.Errorf("Expected only t1 highlighted, got:\n%s", svg)
+	}
+
+	if _, err := rt.Render(ctx, "approval", "png"); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestAPIRender(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/load", bytes.NewBufferString(approvalCPNJSON)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Failed to load CPN: %s", rr.Body.String())
+	}
+	ctx := context.Background()
+	if _, err := server.Runtime().CreateCase(ctx, "c1", "approval", "Case 1"); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	if err := server.Runtime().StartCase(ctx, "c1"); err != nil {
+		t.Fatalf("Failed to start case: %v", err)
+	}
+	if _, err := server.Runtime().ExecuteAll(ctx, "c1"); err != nil {
+		t.Fatalf("Failed to execute case: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/cpn/render?id=approval", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(rr.Body.String(), "<svg") {
+		t.Errorf("Expected an SVG rendering, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	// The case has moved on to the manual approval
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/cases/render?id=c1&format=dot", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `label="Checked\n1: {42}"`) {
+		t.Errorf("Expected the case marking in DOT, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"t2" [shape=box, label="Approve", pos="`) || !strings.Contains(rr.Body.String(), `fillcolor="#c8f7c5", color="#2e7d32", xlabel="Manual"`) {
+		t.Errorf("Expected the manual transition highlighted, got %s", rr.Body.String())
+	}
+
+	for url, status := range map[string]int{
+		"/api/cpn/render?id=missing":           http.StatusNotFound,
+		"/api/cpn/render?id=approval&format=x": http.StatusBadRequest,
+		"/api/cases/render?id=missing":         http.StatusNotFound,
+	} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		if rr.Code != status {
+			t.Errorf("Expected status %d for %s, got %d", status, url, rr.Code)
+		}
+	}
+}
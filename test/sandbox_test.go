@@ -0,0 +1,198 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/pkg/petri"
+)
+
+// shippingCPNJSON waits for a manual approval, after which shipping takes 5 and delivery 3 time units
+const shippingCPNJSON = `{
+	"id": "shipping", "name": "Shipping",
+	"colorSets": ["colset INT = int timed;"],
+	"places": [
+		{"id": "p1", "name": "Ordered", "colorSet": "INT"},
+		{"id": "p2", "name": "Waiting", "colorSet": "INT"},
+		{"id": "p3", "name": "Shipped", "colorSet": "INT"},
+		{"id": "p4", "name": "Delivered", "colorSet": "INT"}
+	],
+	"transitions": [
+		{"id": "t1", "name": "Check", "kind": "Auto"},
+		{"id": "t2", "name": "Approve", "kind": "Manual"},
+		{"id": "t3", "name": "Deliver", "kind": "Auto"}
+	],
+	"arcs": [
+		{"id": "a1", "sourceId": "p1", "targetId": "t1", "expression": "x", "direction": "IN"},
+		{"id": "a2", "sourceId": "t1", "targetId": "p2", "expression": "x", "direction": "OUT"},
+		{"id": "a3", "sourceId": "p2", "targetId": "t2", "expression": "x", "direction": "IN"},
+		{"id": "a4", "sourceId": "t2", "targetId": "p3", "expression": "x @+ 5", "direction": "OUT"},
+		{"id": "a5", "sourceId": "p3", "targetId": "t3", "expression": "x", "direction": "IN"},
+		{"id": "a6", "sourceId": "t3", "targetId": "p4", "expression": "x @+ 3", "direction": "OUT"}
+	],
+	"initialMarking": {"Ordered": [{"value": 7}]},
+	"endPlaces": ["Delivered"]
+}`
+
+// startShippingCase loads the shipping net and runs a case up to the approval
+func startShippingCase(t *testing.T, rt *petri.Runtime) {
+	ctx := context.Background()
+	if _, err := rt.LoadCPNJSON(ctx, []byte(shippingCPNJSON)); err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	if _, err := rt.CreateCase(ctx, "c1", "shipping", "Order 7", petri.WithCaseVariables(map[string]interface{}{"customer": "ann"})); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	if err := rt.StartCase(ctx, "c1"); err != nil {
+		t.Fatalf("Failed to start case: %v", err)
+	}
+	if _, err := rt.ExecuteAll(ctx, "c1"); err != nil {
+		t.Fatalf("Failed to execute case: %v", err)
+	}
+}
+
+func TestForkCaseWhatIf(t *testing.T) {
+	var events []petri.Event
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+	startShippingCase(t, rt)
+	rt.Subscribe(func(e petri.Event) { events = append(events, e) })
+
+	fork, err := rt.ForkCase(ctx, "c1")
+	if err != nil {
+		t.Fatalf("Failed to fork case: %v", err)
+	}
+	if fork.CaseID != "c1" || fork.Variables["customer"] != "ann" || fork.Marking.CountTokens("p2") != 1 || len(fork.Enabled) != 1 {
+		t.Fatalf("Unexpected fork: %+v", fork)
+	}
+
+	// Without the approval nothing happens
+	prediction, err := rt.SandboxPredict(ctx, fork.ID, petri.PredictionConfig{})
+	if err != nil || prediction.CompletionRate != 0 || prediction.Runs[0].StopReason != "dead" {
+		t.Fatalf("Expected the case to wait for approval, got %+v (%v)", prediction, err)
+	}
+
+	// If we approve now, the order is delivered at 8
+	state, err := rt.SandboxFire(ctx, fork.ID, "t2")
+	if err != nil || len(state.Path) != 1 || state.Path[0].TransitionID != "t2" {
+		t.Fatalf("Failed to fire in the sandbox: %+v (%v)", state, err)
+	}
+	prediction, err = rt.SandboxPredict(ctx, fork.ID, petri.PredictionConfig{Runs: 3})
+	if err != nil || prediction.CompletionRate != 1 || prediction.CompletionTime.Mean != 8 {
+		t.Fatalf("Expected completion at 8, got %+v (%v)", prediction, err)
+	}
+	if len(prediction.Paths) != 1 || strings.Join(prediction.Paths[0].Path, ",") != "t3" || prediction.Paths[0].Runs != 3 {
+		t.Errorf("Unexpected paths: %+v", prediction.Paths)
+	}
+	if state, _ := rt.Sandbox(fork.ID); state.Marking.CountTokens("p3") != 1 || len(state.Path) != 1 {
+		t.Errorf("Expected the prediction to leave the sandbox unchanged, got %+v", state)
+	}
+
+	// Manual transitions can be assumed to be done at once
+	other, _ := rt.ForkCase(ctx, "c1")
+	prediction, err = rt.SandboxPredict(ctx, other.ID, petri.PredictionConfig{FireManual: true})
+	if err != nil || !prediction.Runs[0].Completed || len(prediction.Runs[0].Path) != 2 {
+		t.Errorf("Expected approval and delivery, got %+v (%v)", prediction, err)
+	}
+
+	state, err = rt.SandboxSimulate(ctx, fork.ID, 5)
+	if err != nil || !state.Completed || state.Marking.GlobalClock != 5 {
+		t.Fatalf("Expected the sandbox to complete, got %+v (%v)", state, err)
+	}
+
+	// The real case and the event stream are untouched
+	case_, _ := rt.GetCase("c1")
+	if case_.Status != petri.CaseStatusRunning || case_.Marking.CountTokens("p2") != 1 || case_.Marking.GlobalClock != 0 {
+		t.Errorf("Expected the case unchanged, got %s", case_.Marking)
+	}
+	if items, _ := rt.QueryWorkItems(ctx, &petri.WorkItemQuery{}); len(items) != 0 {
+		t.Errorf("Expected no work items, got %d", len(items))
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events, got %+v", events)
+	}
+
+	if err := rt.DiscardSandbox(fork.ID); err != nil {
+		t.Fatalf("Failed to discard sandbox: %v", err)
+	}
+	if _, err := rt.Sandbox(fork.ID); !errors.Is(err, petri.ErrSandboxNotFound) {
+		t.Errorf("Expected ErrSandboxNotFound, got %v", err)
+	}
+}
+
+func TestSandboxLimit(t *testing.T) {
+	rt := petri.New(petri.WithSandboxLimit(1))
+	defer rt.Close()
+	ctx := context.Background()
+	startShippingCase(t, rt)
+
+	fork, err := rt.ForkCase(ctx, "c1")
+	if err != nil {
+		t.Fatalf("Failed to fork case: %v", err)
+	}
+	if _, err := rt.ForkCase(ctx, "c1"); !errors.Is(err, petri.ErrTooManySandboxes) {
+		t.Errorf("Expected ErrTooManySandboxes, got %v", err)
+	}
+	if err := rt.DiscardSandbox(fork.ID); err != nil {
+		t.Fatalf("Failed to discard sandbox: %v", err)
+	}
+	if _, err := rt.ForkCase(ctx, "c1"); err != nil {
+		t.Errorf("Expected a fork after discarding, got %v", err)
+	}
+}
+
+func TestAPISandbox(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+	startShippingCase(t, server.Runtime())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/fork?id=c1", nil))
+	var fork struct {
+		Data petri.SandboxState `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &fork); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	id := fork.Data.ID
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/sandboxes/fire?id="+id, strings.NewReader(`{"transitionId": "t2"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/sandboxes/predict?id="+id, strings.NewReader(`{"runs": 2}`)))
+	var prediction struct {
+		Data petri.Prediction `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &prediction); err != nil || len(prediction.Data.Runs) != 2 || prediction.Data.CompletionTime.Mean != 8 {
+		t.Fatalf("Unexpected prediction %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/sandboxes/predict?id="+id, strings.NewReader(`{"runs": 1001}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for too many runs, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/sandboxes/delete?id="+id, nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/sandboxes/get?id="+id, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
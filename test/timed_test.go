@@ -0,0 +1,140 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/expression"
+	"go-petri-flow/internal/models"
+)
+
+func TestTimeInscriptions(t *testing.T) {
+	evaluator := expression.NewEvaluator()
+	defer evaluator.Close()
+	ctx := expression.NewEvaluationContext()
+	ctx.BindVariable("x", models.NewToken(4, 0))
+
+	delayed := func(value, delay int) map[string]interface{} {
+		return map[string]interface{}{"value": value, "delay": delay}
+	}
+	expected := map[string]interface{}{
+		"x @+ 3":                    delayed(4, 3),
+		"x+1@+x":                    delayed(5, 4),
+		"delay(x, 1) @+ 2":          delayed(4, 3),
+		"2'x ++ 1'(x+1) @+ 2":       expression.MultisetValue{delayed(4, 2), delayed(4, 2), delayed(5, 2)},
+		"1'delay(x, 1) ++ 1'x @+ 2": expression.MultisetValue{delayed(4, 3), delayed(4, 2)},
+		"'a@+b' .. x":               "a@+b4",
+		"tuple(x, '@+') @+ (x - 4)": map[string]interface{}{"value": []interface{}{4, "@+"}, "delay": 0},
+		"local y = x + 1; y @+ 2":   delayed(5, 2),
+		"{value = x, delay = 9} @+ 2": map[string]interface{}{
+			"value": map[string]interface{}{"value": 4, "delay": 9}, "delay": 2,
+		},
+	}
+	for inscription, want := range expected {
+		got, err := evaluator.EvaluateArcExpression(inscription, ctx)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v (%v)", inscription, want, got, err)
+		}
+	}
+}
+
+// createTimedCPN builds src -> t -> (timed, untimed) with the given output inscription on both
+// output arcs and a transition delay
+func createTimedCPN(output string, transitionDelay int) *models.CPN {
+	cpn := models.NewCPN("timed", "Timed", "")
+	cpn.AddPlace(models.NewPlace("src", "Source", models.NewIntegerColorSet("INT", false)))
+	cpn.AddPlace(models.NewPlace("timed", "Timed", models.NewIntegerColorSet("TINT", true)))
+	cpn.AddPlace(models.NewPlace("untimed", "Untimed", models.NewIntegerColorSet("INT", false)))
+	cpn.AddTransition(models.NewTransition("t", "T"))
+	cpn.GetTransition("t").SetDelay(transitionDelay)
+	cpn.AddArc(models.NewInputArc("a_src", "src", "t", "x"))
+	cpn.AddArc(models.NewOutputArc("a_timed", "t", "timed", output))
+	cpn.AddArc(models.NewOutputArc("a_untimed", "t", "untimed", output))
+	return cpn
+}
+
+func TestDelaysApplyToTimedPlacesOnly(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createTimedCPN("1'x ++ 1'delay(x + 1, 2) @+ 3", 4)
+	marking := models.NewMarkingWithClock(10)
+	// The source place is untimed: its token is available although its timestamp lies ahead
+	marking.AddToken("src", models.NewToken(1, 50))
+
+	transition := cpn.GetTransition("t")
+	_, bindings, err := eng.IsEnabled(cpn, transition, marking)
+	if err != nil || len(bindings) != 1 {
+		t.Fatalf("Expected the untimed token to be available, got %v (%v)", bindings, err)
+	}
+	if err := eng.FireTransition(cpn, transition, bindings[0], marking); err != nil {
+		t.Fatalf("Failed to fire: %v", err)
+	}
+	if marking.GlobalClock != 10 {
+		t.Errorf("Firing must not move the clock, got %d", marking.GlobalClock)
+	}
+	timestamps := func(placeID string, value int) []int {
+		var result []int
+		for _, token := range marking.GetTokensWithValue(placeID, value) {
+			result = append(result, token.Timestamp)
+		}
+		return result
+	}
+	// clock 10 + transition delay 4 + arc delays
+	if got := timestamps("timed", 1); !reflect.DeepEqual(got, []int{17}) {
+		t.Errorf("Expected 1@17, got %v", got)
+	}
+	if got := timestamps("timed", 2); !reflect.DeepEqual(got, []int{19}) {
+		t.Errorf("Expected 2@19, got %v", got)
+	}
+	if got := append(timestamps("untimed", 1), timestamps("untimed", 2)...); !reflect.DeepEqual(got, []int{10, 10}) {
+		t.Errorf("Untimed tokens must carry the firing time, got %v", got)
+	}
+}
+
+func TestClockAdvancesOnlyWhenNothingIsEnabled(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	timedCS := models.NewIntegerColorSet("TINT", true)
+	cpn := models.NewCPN("clock", "Clock", "")
+	cpn.AddPlace(models.NewPlace("wait", "Wait", timedCS))
+	cpn.AddPlace(models.NewPlace("ready", "Ready", models.NewIntegerColorSet("INT", false)))
+	cpn.AddPlace(models.NewPlace("done", "Done", timedCS))
+	cpn.AddTransition(models.NewTransition("timer", "Timer"))
+	cpn.AddTransition(models.NewTransition("work", "Work"))
+	cpn.AddArc(models.NewInputArc("a1", "wait", "timer", "x"))
+	cpn.AddArc(models.NewOutputArc("a2", "timer", "done", "x"))
+	cpn.AddArc(models.NewInputArc("a3", "ready", "work", "x"))
+	cpn.AddArc(models.NewOutputArc("a4", "work", "done", "x @+ 2"))
+
+	marking := models.NewMarking()
+	marking.AddToken("wait", models.NewToken(1, 5))
+	marking.AddToken("ready", models.NewToken(2, 0))
+
+	// work is enabled now, so the first step fires it without letting time pass
+	if fired, err := eng.SimulateStep(cpn, marking); err != nil || fired != 1 || marking.GlobalClock != 0 {
+		t.Fatalf("Expected work to fire at 0, fired=%d clock=%d (%v)", fired, marking.GlobalClock, err)
+	}
+	if next := eng.NextEventTime(cpn, marking); next != 2 {
+		t.Errorf("Expected the next event at 2, got %d", next)
+	}
+	// Nothing is enabled: the clock advances to the timer token (the token in done enables nothing)
+	if fired, err := eng.SimulateStep(cpn, marking); err != nil || fired != 1 || marking.GlobalClock != 5 {
+		t.Fatalf("Expected timer to fire at 5, fired=%d clock=%d (%v)", fired, marking.GlobalClock, err)
+	}
+
+	// An enabled manual transition keeps the clock from advancing
+	marking = models.NewMarking()
+	marking.AddToken("wait", models.NewToken(1, 5))
+	marking.AddToken("ready", models.NewToken(2, 0))
+	cpn.GetTransition("work").Kind = models.TransitionKindManual
+	if fired, err := eng.FireEnabledTransitions(cpn, marking); err != nil || fired != 0 || marking.GlobalClock != 0 {
+		t.Errorf("Expected no firing and no time advance, fired=%d clock=%d (%v)", fired, marking.GlobalClock, err)
+	}
+	marking.RemoveTokenByValue("ready", 2)
+	if fired, err := eng.FireEnabledTransitions(cpn, marking); err != nil || fired != 1 || marking.GlobalClock != 5 {
+		t.Errorf("Expected timer to fire at 5, fired=%d clock=%d (%v)", fired, marking.GlobalClock, err)
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"go-petri-flow/internal/engine"
+	"go-petri-flow/internal/models"
+)
+
+// createTransactionCPN builds in -> t -> (ok, small) where small only accepts values up to 10
+func createTransactionCPN(action string) *models.CPN {
+	intCS := models.NewIntegerColorSet("INT", false)
+	cpn := models.NewCPN("tx", "Transaction", "")
+	cpn.AddPlace(models.NewPlace("in", "In", intCS))
+	cpn.AddPlace(models.NewPlace("ok", "Ok", intCS))
+	cpn.AddPlace(models.NewPlace("small", "Small", models.NewIntegerColorSetWithRange("SMALL", false, 0, 10)))
+	cpn.AddTransition(models.NewTransition("t", "T"))
+	cpn.GetTransition("t").ActionExpression = action
+	cpn.AddArc(models.NewInputArc("a_in", "in", "t", "x"))
+	cpn.AddArc(models.NewOutputArc("a_ok", "t", "ok", "2'x"))
+	cpn.AddArc(models.NewOutputArc("a_small", "t", "small", "x"))
+	return cpn
+}
+
+func TestFailedFiringLeavesMarkingUnchanged(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createTransactionCPN("fired = (fired or 0) + 1; x = x * 10")
+	marking := models.NewMarking()
+	input := models.NewToken(3, 0)
+	marking.AddToken("in", input)
+	before := marking.String()
+
+	// The action turns x into 30, which the third output token cannot hold
+	_, bindings, _ := eng.IsEnabled(cpn, cpn.GetTransition("t"), marking)
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t"), bindings[0], marking); err == nil {
+		t.Fatal("Expected the firing to fail")
+	}
+	if marking.String() != before || marking.StepCounter != 0 {
+		t.Errorf("Expected marking %s to be unchanged, got %s (step %d)", before, marking, marking.StepCounter)
+	}
+	if input.Value != 3 {
+		t.Errorf("Bound token must keep its value, got %v", input.Value)
+	}
+	if fired := eng.EvaluatorAccessor().GetNetValue(cpn, "fired"); fired != nil {
+		t.Errorf("Action assignments must be rolled back, got fired=%v", fired)
+	}
+}
+
+func TestSuccessfulFiringCommitsAction(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createTransactionCPN("fired = (fired or 0) + 1; x = x + 1")
+	marking := models.NewMarking()
+	marking.AddToken("in", models.NewToken(3, 0))
+	marking.AddToken("in", models.NewToken(5, 0))
+
+	fired, err := eng.FireEnabledTransitions(cpn, marking)
+	if err != nil || fired != 2 {
+		t.Fatalf("Expected 2 firings, got %d (%v)", fired, err)
+	}
+	if marking.CountTokensWithValue("ok", 4) != 2 || !marking.HasTokenWithValue("small", 6) {
+		t.Errorf("Outputs must see the action's values, got %s", marking)
+	}
+	if got := eng.EvaluatorAccessor().GetNetValue(cpn, "fired"); got != 2 {
+		t.Errorf("Expected fired=2, got %v", got)
+	}
+}
+
+func TestFailedFiringRestoresRandomAndNetTables(t *testing.T) {
+	eng := engine.NewEngine()
+	defer eng.Close()
+
+	cpn := createTransactionCPN("bump(); r = uniform(0, 1); x = x * 10")
+	cpn.Declarations = "counter = {n = 0}\nfunction bump() counter.n = counter.n + 1 end"
+	marking := models.NewMarking()
+	marking.SetSeed(42)
+	marking.AddToken("in", models.NewToken(3, 0))
+
+	_, bindings, _ := eng.IsEnabled(cpn, cpn.GetTransition("t"), marking)
+	if err := eng.FireTransition(cpn, cpn.GetTransition("t"), bindings[0], marking); err == nil {
+		t.Fatal("Expected the firing to fail")
+	}
+	fresh := models.NewMarking()
+	fresh.SetSeed(42)
+	if got, want := marking.Random().Float64(), fresh.Random().Float64(); got != want {
+		t.Errorf("Expected the random sequence to restart, got %v want %v", got, want)
+	}
+	if counter := fmt.Sprint(eng.EvaluatorAccessor().GetNetValue(cpn, "counter")); counter != "map[n:0]" {
+		t.Errorf("Declared tables must be rolled back, got counter=%s", counter)
+	}
+}
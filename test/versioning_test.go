@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-petri-flow/internal/api"
+	"go-petri-flow/pkg/petri"
+)
+
+func TestVersionedDeployments(t *testing.T) {
+	rt := petri.New()
+	defer rt.Close()
+	ctx := context.Background()
+
+	v1, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON))
+	if err != nil {
+		t.Fatalf("Failed to load CPN: %v", err)
+	}
+	if _, err := rt.CreateCase(ctx, "c1", "approval", "Case 1"); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	v2, err := rt.LoadCPNJSON(ctx, []byte(strings.Replace(approvalCPNJSON, `"expression": "x + 1"`, `"expression": "x + 100"`, 1)))
+	if err != nil {
+		t.Fatalf("Failed to load second version: %v", err)
+	}
+	if v1.Version != 1 || v2.Version != 2 || v1.Hash == "" || v1.Hash == v2.Hash {
+		t.Fatalf("Expected versions 1 and 2 with different hashes, got %d/%s and %d/%s", v1.Version, v1.Hash, v2.Version, v2.Hash)
+	}
+	if _, err := rt.CreateCase(ctx, "c2", "approval", "Case 2"); err != nil {
+		t.Fatalf("Failed to create case: %v", err)
+	}
+	if _, err := rt.CreateCase(ctx, "c3", "approval", "Case 3", petri.WithCPNVersion(1)); err != nil {
+		t.Fatalf("Failed to create case on version 1: %v", err)
+	}
+
+	// Each case runs the net of the version it is pinned to
+	for caseID, expected := range map[string]struct{ version, value int }{"c1": {1, 42}, "c2": {2, 141}, "c3": {1, 42}} {
+		if err := rt.StartCase(ctx, caseID); err != nil {
+			t.Fatalf("Failed to start %s: %v", caseID, err)
+		}
+		if _, err := rt.ExecuteAll(ctx, caseID); err != nil {
+			t.Fatalf("Failed to execute %s: %v", caseID, err)
+		}
+		case_, _ := rt.GetCase(caseID)
+		if case_.CPNVersion != expected.version {
+			t.Errorf("Expected %s on version %d, got %d", caseID, expected.version, case_.CPNVersion)
+		}
+		if tokens := case_.Marking.GetTokens("p2"); len(tokens) != 1 || tokens[0].Value != expected.value {
+			t.Errorf("Expected token %d in Checked for %s, got %v", expected.value, caseID, tokens)
+		}
+	}
+
+	versions, err := rt.CPNVersions("approval")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("Expected two versions, got %v (%v)", versions, err)
+	}
+	if versions[0].ActiveCases != 2 || versions[0].Latest || !versions[1].Latest || versions[1].ActiveCases != 1 {
+		t.Errorf("Unexpected versions: %+v", versions)
+	}
+
+	// Versions in use cannot be retired
+	if err := rt.RetireCPNVersion(ctx, "approval", 2); !errors.Is(err, petri.ErrVersionInUse) {
+		t.Errorf("Expected the latest version to stay, got %v", err)
+	}
+	if err := rt.RetireCPNVersion(ctx, "approval", 1); !errors.Is(err, petri.ErrVersionInUse) {
+		t.Errorf("Expected version 1 in use, got %v", err)
+	}
+	for _, caseID := range []string{"c1", "c3"} {
+		if err := rt.AbortCase(ctx, caseID); err != nil {
+			t.Fatalf("Failed to abort %s: %v", caseID, err)
+		}
+	}
+	if err := rt.RetireCPNVersion(ctx, "approval", 1); err != nil {
+		t.Fatalf("Failed to retire version 1: %v", err)
+	}
+	if _, err := rt.CreateCase(ctx, "c4", "approval", "Case 4", petri.WithCPNVersion(1)); !errors.Is(err, petri.ErrVersionRetired) {
+		t.Errorf("Expected ErrVersionRetired, got %v", err)
+	}
+	if _, err := rt.CreateCase(ctx, "c5", "approval", "Case 5", petri.WithCPNVersion(7)); !errors.Is(err, petri.ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestAPIVersionedDeployments(t *testing.T) {
+	server := api.NewServer()
+	defer server.Close()
+	handler := server.SetupRoutes()
+	ctx := context.Background()
+
+	rt := server.Runtime()
+	for i := 0; i < 2; i++ {
+		if _, err := rt.LoadCPNJSON(ctx, []byte(approvalCPNJSON)); err != nil {
+			t.Fatalf("Failed to load CPN: %v", err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cases/create", strings.NewReader(`{"id": "c1", "cpnId": "approval", "cpnVersion": 1, "name": "Case 1"}`)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"cpnVersion":1`) {
+		t.Fatalf("Expected a case pinned to version 1, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/cpn/versions?id=approval", nil))
+	var response struct {
+		Data []petri.CPNVersion `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || len(response.Data) != 2 {
+		t.Fatalf("Expected two versions, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// Identical definitions hash alike
+	if response.Data[0].Hash != response.Data[1].Hash || response.Data[0].ActiveCases != 1 {
+		t.Errorf("Unexpected versions: %+v", response.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/cpn/get?id=approval&version=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/versions/retire?id=approval&version=1", nil))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/cpn/versions/retire?id=approval&version=9", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}